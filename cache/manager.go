@@ -882,7 +882,9 @@ func (cm *cacheManager) Diff(ctx context.Context, lower, upper ImmutableRef, pg
 	// running the differ directly on lower and upper, but this is chosen as a default
 	// behavior in order to maximize layer re-use in the default case. We may add an
 	// option for controlling this behavior in the future if it's needed.
-	if dps.upper != nil {
+	// NoDiffMerge disables it for callers that need a single layer.
+	noMerge := slices.Contains(opts, RefOption(NoDiffMerge))
+	if dps.upper != nil && !noMerge {
 		lowerLayers := dps.lower.layerChain()
 		upperLayers := dps.upper.layerChain()
 		var lowerIsAncestor bool
@@ -1529,6 +1531,12 @@ type noUpdateLastUsed struct{}
 
 var NoUpdateLastUsed noUpdateLastUsed
 
+type noDiffMerge struct{}
+
+// NoDiffMerge makes Diff always compute a single layer, even when lower is an
+// ancestor of upper and the layers separating them could be reused.
+var NoDiffMerge noDiffMerge
+
 func CachePolicyRetain(m *cacheMetadata) error {
 	return m.SetCachePolicyRetain()
 }
@@ -1150,7 +1150,7 @@ func TestLoopLeaseContent(t *testing.T) {
 	defer done(ctx)
 
 	// store an uncompressed blob to the content store
-	compressionLoop := []compression.Type{compression.Uncompressed, compression.Gzip, compression.Zstd, compression.EStargz}
+	compressionLoop := []compression.Type{compression.Uncompressed, compression.Gzip, compression.Zstd, compression.EStargz, compression.ZstdChunked}
 	blobBytes, orgDesc, err := mapToBlob(map[string]string{"foo": "1"}, false)
 	require.NoError(t, err)
 	contentBuffer := contentutil.NewBuffer()
@@ -1549,7 +1549,7 @@ func TestConversion(t *testing.T) {
 
 	// Tests all combination of the conversions from type i to type j preserve
 	// the uncompressed digest.
-	allCompression := []compression.Type{compression.Uncompressed, compression.Gzip, compression.EStargz, compression.Zstd}
+	allCompression := []compression.Type{compression.Uncompressed, compression.Gzip, compression.EStargz, compression.Zstd, compression.ZstdChunked}
 	eg, egctx := errgroup.WithContext(ctx)
 	for _, orgDesc := range []ocispecs.Descriptor{orgDescGo, orgDescSys} {
 		for _, i := range allCompression {
@@ -1597,6 +1597,80 @@ func TestConversion(t *testing.T) {
 	require.NoError(t, eg.Wait())
 }
 
+func TestZstdChunkedVariant(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skipf("unsupported GOOS: %s", runtime.GOOS)
+	}
+
+	ctx := namespaces.WithNamespace(context.Background(), "buildkit-test")
+
+	tmpdir := t.TempDir()
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+
+	co, cleanup, err := newCacheManager(ctx, t, cmOpt{
+		snapshotter:     snapshotter,
+		snapshotterName: "native",
+	})
+	require.NoError(t, err)
+	t.Cleanup(cleanup)
+	cm := co.manager
+
+	ctx, done, err := leaseutil.WithLease(ctx, co.lm, leaseutil.MakeTemporary)
+	require.NoError(t, err)
+	defer done(context.TODO())
+
+	blobBytes, orgDesc, err := mapToBlob(map[string]string{"foo": "1", "bar": "2"}, false)
+	require.NoError(t, err)
+	cw, err := co.cs.Writer(ctx, content.WithRef(fmt.Sprintf("write-test-blob-%s", orgDesc.Digest)))
+	require.NoError(t, err)
+	_, err = cw.Write(blobBytes)
+	require.NoError(t, err)
+	require.NoError(t, cw.Commit(ctx, 0, cw.Digest()))
+
+	ref, err := cm.GetByBlob(ctx, orgDesc, nil, nil)
+	require.NoError(t, err)
+	defer ref.Release(context.TODO())
+
+	getDesc := func(ct compression.Type) ocispecs.Descriptor {
+		remotes, err := ref.GetRemotes(ctx, true, config.RefConfig{Compression: compression.New(ct).SetForce(true)}, false, nil)
+		require.NoError(t, err)
+		require.Equal(t, 1, len(remotes))
+		require.Equal(t, 1, len(remotes[0].Descriptors))
+		return remotes[0].Descriptors[0]
+	}
+
+	zstdDesc := getDesc(compression.Zstd)
+	chunkedDesc := getDesc(compression.ZstdChunked)
+	require.Equal(t, ocispecs.MediaTypeImageLayerZstd, chunkedDesc.MediaType)
+	require.NotEqual(t, zstdDesc.Digest, chunkedDesc.Digest)
+	for _, k := range append(compression.ZstdChunkedAnnotations, estargz.TOCJSONDigestAnnotation) {
+		require.NotEmpty(t, chunkedDesc.Annotations[k], k)
+	}
+	checkDescriptor(ctx, t, co.cs, chunkedDesc, compression.ZstdChunked)
+
+	ok, err := compression.ZstdChunked.Is(ctx, co.cs, chunkedDesc.Digest)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = compression.ZstdChunked.Is(ctx, co.cs, zstdDesc.Digest)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// the variants are looked up from the content store
+	desc, err := ref.(*immutableRef).getBlobWithCompression(ctx, compression.Zstd)
+	require.NoError(t, err)
+	require.Equal(t, zstdDesc.Digest, desc.Digest)
+	desc, err = ref.(*immutableRef).getBlobWithCompression(ctx, compression.ZstdChunked)
+	require.NoError(t, err)
+	require.Equal(t, chunkedDesc.Digest, desc.Digest)
+	for _, k := range compression.ZstdChunkedAnnotations {
+		require.Equal(t, chunkedDesc.Annotations[k], desc.Annotations[k], k)
+	}
+	require.Equal(t, chunkedDesc.Digest, getDesc(compression.ZstdChunked).Digest)
+}
+
 type idxToVariants []map[compression.Type]ocispecs.Descriptor
 
 func TestGetRemotes(t *testing.T) {
@@ -2228,6 +2302,34 @@ func TestDiffOp(t *testing.T) {
 	require.NoError(t, cm.Prune(ctx, nil, client.PruneInfo{All: true}))
 	checkDiskUsage(ctx, t, cm, 0, 0)
 
+	// NoDiffMerge computes a single diff even if lower is an ancestor of upper
+	newRef, err = cm.New(ctx, nil, nil)
+	require.NoError(t, err)
+	a, err = newRef.Commit(ctx)
+	require.NoError(t, err)
+	newRef, err = cm.New(ctx, a, nil)
+	require.NoError(t, err)
+	b, err = newRef.Commit(ctx)
+	require.NoError(t, err)
+	newRef, err = cm.New(ctx, b, nil)
+	require.NoError(t, err)
+	c, err = newRef.Commit(ctx)
+	require.NoError(t, err)
+
+	diff, err = cm.Diff(ctx, a, c, nil, NoDiffMerge)
+	require.NoError(t, err)
+	checkDiskUsage(ctx, t, cm, 4, 0) // 3 base refs + 1 diff
+	chain := diff.LayerChain()
+	require.Len(t, chain, 1)
+	require.NoError(t, chain.Release(ctx))
+	require.NoError(t, a.Release(ctx))
+	require.NoError(t, b.Release(ctx))
+	require.NoError(t, c.Release(ctx))
+	require.NoError(t, diff.Release(ctx))
+	checkDiskUsage(ctx, t, cm, 0, 4)
+	require.NoError(t, cm.Prune(ctx, nil, client.PruneInfo{All: true}))
+	checkDiskUsage(ctx, t, cm, 0, 0)
+
 	// Test using nil as upper
 	newLower, err = cm.New(ctx, nil, nil)
 	require.NoError(t, err)
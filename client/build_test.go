@@ -22,6 +22,7 @@ import (
 	"github.com/moby/buildkit/session/sshforward/sshprovider"
 	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/solver/pb"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
 	"github.com/moby/buildkit/util/entitlements"
 	"github.com/moby/buildkit/util/grpcerrors"
 	utilsystem "github.com/moby/buildkit/util/system"
@@ -62,6 +63,7 @@ func TestClientGatewayIntegration(t *testing.T) {
 		testWarnings,
 		testClientGatewayNilResult,
 		testClientGatewayEmptyImageExec,
+		testClientGatewayContainerSourcePolicy,
 	), integration.WithMirroredImages(integration.OfficialImages("busybox:latest")))
 
 	integration.Run(t, integration.TestFuncs(
@@ -2131,6 +2133,89 @@ func testClientGatewayContainerHostNetworking(t *testing.T, sb integration.Sandb
 	checkAllReleasable(t, c, sb, true)
 }
 
+// testClientGatewayContainerSourcePolicy is testing that the exec rules of the
+// source policy apply to gateway containers and their processes
+func testClientGatewayContainerSourcePolicy(t *testing.T, sb integration.Sandbox) {
+	requiresLinux(t)
+	ctx := sb.Context()
+
+	c, err := New(ctx, sb.Address())
+	require.NoError(t, err)
+	defer c.Close()
+
+	product := "buildkit_test"
+
+	b := func(ctx context.Context, c client.Client) (*client.Result, error) {
+		def, err := llb.Image("busybox:latest").Marshal(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal state")
+		}
+
+		r, err := c.Solve(ctx, client.SolveRequest{
+			Definition: def.ToPB(),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to solve")
+		}
+
+		mounts := []client.Mount{{
+			Dest:      "/",
+			MountType: pb.MountType_BIND,
+			Ref:       r.Ref,
+		}}
+
+		_, err = c.NewContainer(ctx, client.NewContainerRequest{
+			Mounts:  mounts,
+			NetMode: pb.NetMode_HOST,
+		})
+		require.ErrorContains(t, err, "denied by policy")
+
+		ctr, err := c.NewContainer(ctx, client.NewContainerRequest{
+			Mounts: mounts,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer ctr.Release(ctx)
+
+		_, err = ctr.Start(ctx, client.StartRequest{
+			Args:         []string{"/bin/true"},
+			SecurityMode: pb.SecurityMode_INSECURE,
+		})
+		require.ErrorContains(t, err, "denied by policy")
+
+		pid, err := ctr.Start(ctx, client.StartRequest{
+			Args: []string{"/bin/true"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &client.Result{}, pid.Wait()
+	}
+
+	_, err = c.Build(ctx, SolveOpt{
+		SourcePolicy: &spb.Policy{
+			Rules: []*spb.Rule{
+				{
+					Action: spb.PolicyAction_DENY,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{Network: "host"},
+					},
+				},
+				{
+					Action: spb.PolicyAction_DENY,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{Security: "insecure"},
+					},
+				},
+			},
+		},
+	}, product, b, nil)
+	require.NoError(t, err)
+
+	checkAllReleasable(t, c, sb, true)
+}
+
 // testClientGatewayContainerSignal is testing that we can send a signal
 func testClientGatewayContainerSignal(t *testing.T, sb integration.Sandbox) {
 	requiresLinux(t)
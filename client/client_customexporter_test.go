@@ -0,0 +1,135 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+	"github.com/moby/buildkit/util/entitlements"
+	"github.com/moby/buildkit/util/testutil/integration"
+	"github.com/moby/buildkit/util/testutil/workers"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+var customExporterTests = []func(t *testing.T, sb integration.Sandbox){
+	testCustomExporter,
+}
+
+type exporterCustomEntitlement struct{}
+
+func (*exporterCustomEntitlement) UpdateConfigFile(in string) string {
+	return in + "\n\ninsecure-entitlements = [\"exporter.custom\"]\n"
+}
+
+func testCustomExporter(t *testing.T, sb integration.Sandbox) {
+	integration.SkipOnPlatform(t, "windows")
+	workers.CheckFeatureCompat(t, sb, workers.FeatureDirectPush)
+	c, err := New(sb.Context(), sb.Address())
+	require.NoError(t, err)
+	defer c.Close()
+
+	registry, err := sb.NewRegistry()
+	if errors.Is(err, integration.ErrRequirements) {
+		t.Skip(err.Error())
+	}
+	require.NoError(t, err)
+
+	// the exporter copies the build result and its options to the output
+	config, err := json.Marshal(ocispecs.Image{
+		Config: ocispecs.ImageConfig{
+			Entrypoint: []string{"/bin/sh", "-c", `cp -r "$BUILDKIT_EXPORTER_INPUT/." "$BUILDKIT_EXPORTER_OUTPUT/" && echo "$BUILDKIT_EXPORTER_OPT_0" > "$BUILDKIT_EXPORTER_OUTPUT/opt" && ls /sys/class/net > "$BUILDKIT_EXPORTER_OUTPUT/network"`},
+			Env:        []string{"PATH=/bin:/usr/bin"},
+		},
+	})
+	require.NoError(t, err)
+	def, err := llb.Image("busybox:latest").Marshal(sb.Context())
+	require.NoError(t, err)
+	exporterImage := registry + "/buildkit/testcustomexporter:latest"
+	_, err = c.Solve(sb.Context(), def, SolveOpt{
+		Exports: []ExportEntry{
+			{
+				Type: ExporterImage,
+				Attrs: map[string]string{
+					"name":                          exporterImage,
+					"push":                          "true",
+					exptypes.ExporterImageConfigKey: string(config),
+				},
+			},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	def, err = llb.Scratch().File(llb.Mkfile("foo", 0600, []byte("data"))).Marshal(sb.Context())
+	require.NoError(t, err)
+
+	export := func(destDir string, opt SolveOpt) error {
+		opt.Exports = []ExportEntry{
+			{
+				Type: ExporterCustom,
+				Attrs: map[string]string{
+					"image":  exporterImage,
+					"format": "deb",
+				},
+				OutputDir: destDir,
+			},
+		}
+		_, err := c.Solve(sb.Context(), def, opt, nil)
+		return err
+	}
+
+	err = export(t.TempDir(), SolveOpt{})
+	require.ErrorContains(t, err, "requires the exporter.custom entitlement")
+
+	destDir := t.TempDir()
+	err = export(destDir, SolveOpt{
+		AllowedEntitlements: []string{entitlements.EntitlementExporterCustom.String()},
+	})
+	require.NoError(t, err)
+
+	dt, err := os.ReadFile(filepath.Join(destDir, "foo"))
+	require.NoError(t, err)
+	require.Equal(t, "data", string(dt))
+
+	dt, err = os.ReadFile(filepath.Join(destDir, "opt"))
+	require.NoError(t, err)
+	require.Equal(t, "format=deb\n", string(dt))
+
+	// the exporter is run without network
+	dt, err = os.ReadFile(filepath.Join(destDir, "network"))
+	require.NoError(t, err)
+	require.Equal(t, "lo\n", string(dt))
+
+	// the source policy applies to the exporter image
+	err = export(t.TempDir(), SolveOpt{
+		AllowedEntitlements: []string{entitlements.EntitlementExporterCustom.String()},
+		SourcePolicy: &spb.Policy{
+			Rules: []*spb.Rule{{
+				Action: spb.PolicyAction_DENY,
+				Selector: &spb.Selector{
+					Identifier: "docker-image://" + registry + "/buildkit/testcustomexporter*",
+				},
+			}},
+		},
+	})
+	require.ErrorContains(t, err, "denied by policy")
+
+	// and its exec rules to the exporter process
+	err = export(t.TempDir(), SolveOpt{
+		AllowedEntitlements: []string{entitlements.EntitlementExporterCustom.String()},
+		SourcePolicy: &spb.Policy{
+			Rules: []*spb.Rule{{
+				Action: spb.PolicyAction_DENY,
+				Selector: &spb.Selector{
+					Exec: &spb.ExecSelector{Network: "none"},
+				},
+			}},
+		},
+	})
+	require.ErrorContains(t, err, "denied by policy")
+}
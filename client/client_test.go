@@ -176,6 +176,7 @@ var allTests = []func(t *testing.T, sb integration.Sandbox){
 	testFileOpInputSwap,
 	testRelativeMountpoint,
 	testLocalSourceDiffer,
+	testLocalSourceChunkedTransfer,
 	testLocalSourceWithHardlinksFilter,
 	testNoTarOCIIndexMediaType,
 	testOCILayoutSource,
@@ -290,6 +291,13 @@ func testIntegration(t *testing.T, funcs ...func(t *testing.T, sb integration.Sa
 	)
 
 	integration.Run(t, integration.TestFuncs(cdiTests...), mirrors)
+
+	integration.Run(t, integration.TestFuncs(customExporterTests...),
+		mirrors,
+		integration.WithMatrix("entitlements", map[string]any{
+			"exporter.custom": &exporterCustomEntitlement{},
+		}),
+	)
 }
 
 func newContainerd(cdAddress string) (*ctd.Client, error) {
@@ -2210,6 +2218,58 @@ func testLocalSourceWithDiffer(t *testing.T, sb integration.Sandbox, d llb.DiffT
 	}
 }
 
+func testLocalSourceChunkedTransfer(t *testing.T, sb integration.Sandbox) {
+	c, err := New(sb.Context(), sb.Address())
+	require.NoError(t, err)
+	defer c.Close()
+
+	dt := make([]byte, 4<<20)
+	_, err = rand.Read(dt)
+	require.NoError(t, err)
+
+	dir := integration.Tmpdir(
+		t,
+		fstest.CreateFile("large", dt, 0600),
+	)
+
+	def, err := llb.Local("mylocal", llb.ChunkedTransfer()).Marshal(sb.Context())
+	require.NoError(t, err)
+
+	build := func() string {
+		destDir := t.TempDir()
+		_, err := c.Solve(sb.Context(), def, SolveOpt{
+			Exports: []ExportEntry{
+				{
+					Type:      ExporterLocal,
+					OutputDir: destDir,
+				},
+			},
+			LocalMounts: map[string]fsutil.FS{
+				"mylocal": dir,
+			},
+		}, nil)
+		require.NoError(t, err)
+		return destDir
+	}
+
+	destDir := build()
+	dt2, err := os.ReadFile(filepath.Join(destDir, "large"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(dt, dt2))
+
+	// the moved file is assembled from the chunks of the previous transfer
+	copy(dt[1<<20:], "modified")
+	require.NoError(t, os.Remove(filepath.Join(dir.Name, "large")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir.Name, "moved"), dt, 0600))
+
+	destDir = build()
+	_, err = os.Stat(filepath.Join(destDir, "large"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	dt2, err = os.ReadFile(filepath.Join(destDir, "moved"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(dt, dt2))
+}
+
 // moby/buildkit#4831
 func testLocalSourceWithHardlinksFilter(t *testing.T, sb integration.Sandbox) {
 	requiresLinux(t)
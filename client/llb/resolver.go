@@ -26,5 +26,34 @@ func WithLayerLimit(l int) ImageOption {
 	})
 }
 
+// WithRequiredPaths returns an [ImageOption] that pulls only the layers of the
+// image that contain the paths, e.g. when only a few files are copied from a
+// large image. Other files in the image may be missing from the result. The
+// layers are selected with the table of contents of eStargz and zstd:chunked
+// layers. If any layer has no table of contents, all layers are pulled.
+func WithRequiredPaths(paths ...string) ImageOption {
+	return imageOptionFunc(func(ii *ImageInfo) {
+		ii.requiredPaths = append(ii.requiredPaths, paths...)
+	})
+}
+
+// VerifySignature returns an [ImageOption] that requires the image to have a
+// cosign signature made with one of the PEM encoded public keys before it is
+// used.
+func VerifySignature(key []byte) ImageOption {
+	return imageOptionFunc(func(ii *ImageInfo) {
+		ii.signatureKey = key
+	})
+}
+
+// RequireAttestation returns an [ImageOption] that requires the image to have
+// an in-toto attestation with the predicate type before it is used. If
+// [VerifySignature] is also set, the attestation must be signed with the key.
+func RequireAttestation(predicateType string) ImageOption {
+	return imageOptionFunc(func(ii *ImageInfo) {
+		ii.attestations = append(ii.attestations, predicateType)
+	})
+}
+
 // ImageMetaResolver can resolve image config metadata from a reference
 type ImageMetaResolver = sourceresolver.ImageMetaResolver
@@ -130,6 +130,22 @@ func Image(ref string, opts ...ImageOption) State {
 		addCap(&info.Constraints, pb.CapSourceImageLayerLimit)
 	}
 
+	if len(info.requiredPaths) > 0 {
+		dt, _ := json.Marshal(info.requiredPaths) // strings always marshal
+		attrs[pb.AttrImageRequiredPaths] = string(dt)
+		addCap(&info.Constraints, pb.CapSourceImageRequiredPaths)
+	}
+
+	if len(info.signatureKey) > 0 || len(info.attestations) > 0 {
+		if len(info.signatureKey) > 0 {
+			attrs[pb.AttrImageSignatureKey] = string(info.signatureKey)
+		}
+		if len(info.attestations) > 0 {
+			attrs[pb.AttrImageAttestations] = strings.Join(info.attestations, ",")
+		}
+		addCap(&info.Constraints, pb.CapSourceImageVerify)
+	}
+
 	src := NewSource("docker-image://"+ref, attrs, info.Constraints) // controversial
 	if err != nil {
 		src.err = err
@@ -227,6 +243,9 @@ type ImageInfo struct {
 	resolveDigest bool
 	resolveMode   ResolveMode
 	layerLimit    *int
+	signatureKey  []byte
+	attestations  []string
+	requiredPaths []string
 	RecordType    string
 }
 
@@ -328,6 +347,11 @@ func Git(url, ref string, opts ...GitOption) State {
 		addCap(&gi.Constraints, pb.CapSourceGitChecksum)
 	}
 
+	if gi.SubdirTreeKey {
+		attrs[pb.AttrGitSubdirTreeKey] = "true"
+		addCap(&gi.Constraints, pb.CapSourceGitSubdirTreeKey)
+	}
+
 	addCap(&gi.Constraints, pb.CapSourceGit)
 
 	source := NewSource("git://"+id, attrs, gi.Constraints)
@@ -352,6 +376,7 @@ type GitInfo struct {
 	KnownSSHHosts    string
 	MountSSHSock     string
 	Checksum         string
+	SubdirTreeKey    bool
 }
 
 func KeepGitDir() GitOption {
@@ -386,6 +411,16 @@ func GitChecksum(v string) GitOption {
 	})
 }
 
+// GitSubdirTreeKey makes the cache key of a git source that selects a
+// subdirectory depend on the tree object of that subdirectory instead of the
+// commit, so that commits not touching the subdirectory keep the cache valid.
+// The resolved commit is still recorded in the provenance.
+func GitSubdirTreeKey() GitOption {
+	return gitOptionFunc(func(gi *GitInfo) {
+		gi.SubdirTreeKey = true
+	})
+}
+
 // AuthOption can be used with either HTTP or Git sources.
 type AuthOption interface {
 	GitOption
@@ -455,6 +490,10 @@ func Local(name string, opts ...LocalOption) State {
 		}
 		addCap(&gi.Constraints, pb.CapSourceMetadataTransfer)
 	}
+	if gi.ChunkedTransfer {
+		attrs[pb.AttrLocalChunkedTransfer] = "true"
+		addCap(&gi.Constraints, pb.CapSourceLocalChunkedTransfer)
+	}
 
 	addCap(&gi.Constraints, pb.CapSourceLocal)
 
@@ -526,6 +565,15 @@ func Differ(t DiffType, required bool) LocalOption {
 	})
 }
 
+// ChunkedTransfer sends large files that changed since the previous transfer
+// of the local source as content-defined chunks, so that only the chunks that
+// the daemon doesn't have yet are transferred.
+func ChunkedTransfer() LocalOption {
+	return localOptionFunc(func(li *LocalInfo) {
+		li.ChunkedTransfer = true
+	})
+}
+
 func MetadataOnlyTransfer(exceptions []string) LocalOption {
 	return localOptionFunc(func(li *LocalInfo) {
 		li.MetadataOnlyCollector = true
@@ -591,6 +639,133 @@ type OCILayoutInfo struct {
 	layerLimit *int
 }
 
+// OCIArtifact returns a state that contains the layers of a non-image OCI
+// artifact (e.g. a Helm chart, WASM module or signature) in a registry as
+// regular files. Each layer is written to a file named after its
+// "org.opencontainers.image.title" annotation, or its digest if the annotation
+// is not set.
+//
+// The selected layers can be limited with [ArtifactMediaTypes] and
+// [ArtifactAnnotation].
+func OCIArtifact(ref string, opts ...OCIArtifactOption) State {
+	ai := &OCIArtifactInfo{}
+	for _, o := range opts {
+		o.SetOCIArtifactOption(ai)
+	}
+	attrs := map[string]string{}
+	if len(ai.mediaTypes) > 0 {
+		attrs[pb.AttrOCIArtifactMediaTypes] = strings.Join(ai.mediaTypes, ",")
+	}
+	for k, v := range ai.annotations {
+		attrs[pb.AttrOCIArtifactAnnotationPrefix+k] = v
+	}
+
+	addCap(&ai.Constraints, pb.CapSourceOCIArtifact)
+
+	source := NewSource("oci-artifact://"+ref, attrs, ai.Constraints)
+	return NewState(source.Output())
+}
+
+type OCIArtifactOption interface {
+	SetOCIArtifactOption(*OCIArtifactInfo)
+}
+
+type ociArtifactOptionFunc func(*OCIArtifactInfo)
+
+func (fn ociArtifactOptionFunc) SetOCIArtifactOption(ai *OCIArtifactInfo) {
+	fn(ai)
+}
+
+// ArtifactMediaTypes limits the layers of an [OCIArtifact] to the ones with
+// one of the given media types.
+func ArtifactMediaTypes(mediaTypes ...string) OCIArtifactOption {
+	return ociArtifactOptionFunc(func(ai *OCIArtifactInfo) {
+		ai.mediaTypes = append(ai.mediaTypes, mediaTypes...)
+	})
+}
+
+// ArtifactAnnotation limits the layers of an [OCIArtifact] to the ones that
+// have the annotation key set to value.
+func ArtifactAnnotation(key, value string) OCIArtifactOption {
+	return ociArtifactOptionFunc(func(ai *OCIArtifactInfo) {
+		if ai.annotations == nil {
+			ai.annotations = map[string]string{}
+		}
+		ai.annotations[key] = value
+	})
+}
+
+type OCIArtifactInfo struct {
+	constraintsWrapper
+	mediaTypes  []string
+	annotations map[string]string
+}
+
+// LockfileEntry is a single file of a lockfile that is fetched by
+// [Lockfile].
+type LockfileEntry struct {
+	URL    string        `json:"url"`
+	Digest digest.Digest `json:"digest"`
+	// Filename is the name of the file in the result. Defaults to the base of
+	// the URL path.
+	Filename string `json:"filename,omitempty"`
+}
+
+// ParseLockfile parses a lockfile that contains a JSON array of entries, e.g.
+//
+//	[
+//	  {"url": "https://example.com/foo.tar.gz", "digest": "sha256:..."},
+//	  {"url": "https://example.com/bar", "digest": "sha256:...", "filename": "bar.bin"}
+//	]
+func ParseLockfile(dt []byte) ([]LockfileEntry, error) {
+	var entries []LockfileEntry
+	if err := json.Unmarshal(dt, &entries); err != nil {
+		return nil, errors.Wrap(err, "failed to parse lockfile")
+	}
+	for _, e := range entries {
+		if e.URL == "" {
+			return nil, errors.New("lockfile entry is missing url")
+		}
+		if err := e.Digest.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid digest for %s", e.URL)
+		}
+		if e.Digest.Algorithm() != digest.SHA256 {
+			return nil, errors.Errorf("unsupported digest algorithm %s for %s", e.Digest.Algorithm(), e.URL)
+		}
+	}
+	return entries, nil
+}
+
+// Lockfile returns a state that contains all entries of a lockfile fetched
+// into a single directory. The entries are fetched in parallel and the
+// content of each entry is verified against its digest. Entries that have
+// not changed since a previous build are revalidated instead of being
+// downloaded again.
+func Lockfile(entries []LockfileEntry, opts ...LockfileOption) State {
+	li := &LockfileInfo{}
+	for _, o := range opts {
+		o.SetLockfileOption(li)
+	}
+
+	dt, _ := json.Marshal(entries) // entries always marshal
+	attrs := map[string]string{
+		pb.AttrLockfileEntries: string(dt),
+	}
+
+	addCap(&li.Constraints, pb.CapSourceLockfile)
+
+	source := NewSource("lockfile://"+digest.FromBytes(dt).Encoded(), attrs, li.Constraints)
+	return NewState(source.Output())
+}
+
+type LockfileOption interface {
+	SetLockfileOption(*LockfileInfo)
+}
+
+type LockfileInfo struct {
+	constraintsWrapper
+}
+
 type DiffType string
 
 const (
@@ -618,6 +793,7 @@ type LocalInfo struct {
 	Differ                 DifferInfo
 	MetadataOnlyCollector  bool
 	MetadataOnlyExceptions string
+	ChunkedTransfer        bool
 }
 
 func HTTP(url string, opts ...HTTPOption) State {
@@ -653,6 +829,24 @@ func HTTP(url string, opts ...HTTPOption) State {
 		hi.Header.setAttrs(attrs)
 		addCap(&hi.Constraints, pb.CapSourceHTTPHeader)
 	}
+	if len(hi.Mirrors) > 0 {
+		dt, _ := json.Marshal(hi.Mirrors) // strings always marshal
+		attrs[pb.AttrHTTPMirrors] = string(dt)
+		addCap(&hi.Constraints, pb.CapSourceHTTPMirrors)
+	}
+	if hi.Retries != nil {
+		attrs[pb.AttrHTTPRetries] = strconv.Itoa(*hi.Retries)
+		addCap(&hi.Constraints, pb.CapSourceHTTPRetries)
+	}
+	if hi.ChecksumURL != "" {
+		attrs[pb.AttrHTTPChecksumURL] = hi.ChecksumURL
+		addCap(&hi.Constraints, pb.CapSourceHTTPChecksumURL)
+	}
+	if hi.SignatureURL != "" {
+		attrs[pb.AttrHTTPSignatureURL] = hi.SignatureURL
+		attrs[pb.AttrHTTPSignatureKey] = string(hi.SignatureKey)
+		addCap(&hi.Constraints, pb.CapSourceHTTPSignature)
+	}
 
 	addCap(&hi.Constraints, pb.CapSourceHTTP)
 	source := NewSource(url, attrs, hi.Constraints)
@@ -668,6 +862,11 @@ type HTTPInfo struct {
 	GID              int
 	AuthHeaderSecret string
 	Header           *HTTPHeader
+	Mirrors          []string
+	Retries          *int
+	ChecksumURL      string
+	SignatureURL     string
+	SignatureKey     []byte
 }
 
 type HTTPOption interface {
@@ -686,6 +885,27 @@ func Checksum(dgst digest.Digest) HTTPOption {
 	})
 }
 
+// ChecksumURL returns an [HTTPOption] that verifies the file against the
+// SHA-256 checksum listed for it in a checksum file like SHA256SUMS. The file
+// is looked up in the checksum file by the last component of the URL path.
+func ChecksumURL(url string) HTTPOption {
+	return httpOptionFunc(func(hi *HTTPInfo) {
+		hi.ChecksumURL = url
+	})
+}
+
+// Signature returns an [HTTPOption] that verifies a detached signature with
+// the public key. If [ChecksumURL] is set, the signature is for the checksum
+// file, otherwise it is for the file itself. The key can be a minisign public
+// key, a PEM encoded public key as used by "cosign sign-blob" or an armored
+// OpenPGP public key.
+func Signature(url string, key []byte) HTTPOption {
+	return httpOptionFunc(func(hi *HTTPInfo) {
+		hi.SignatureURL = url
+		hi.SignatureKey = key
+	})
+}
+
 func Chmod(perm os.FileMode) HTTPOption {
 	return httpOptionFunc(func(hi *HTTPInfo) {
 		hi.Perm = int(perm) & 0777
@@ -713,6 +933,23 @@ func Header(header HTTPHeader) HTTPOption {
 	})
 }
 
+// HTTPMirrors returns an [HTTPOption] that sets URLs that are tried in order
+// before the source URL. Mirrors don't change the cache key of the source, so
+// they must serve the same content as the source URL.
+func HTTPMirrors(urls ...string) HTTPOption {
+	return httpOptionFunc(func(hi *HTTPInfo) {
+		hi.Mirrors = append(hi.Mirrors, urls...)
+	})
+}
+
+// HTTPRetries returns an [HTTPOption] that sets how many times a failed
+// request is retried, overriding the default of the daemon.
+func HTTPRetries(n int) HTTPOption {
+	return httpOptionFunc(func(hi *HTTPInfo) {
+		hi.Retries = &n
+	})
+}
+
 type HTTPHeader struct {
 	Accept    string
 	UserAgent string
@@ -0,0 +1,25 @@
+package llb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLockfile(t *testing.T) {
+	t.Parallel()
+
+	entries, err := ParseLockfile([]byte(`[{"url": "https://example.com/foo", "digest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", "filename": "bar"}]`))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "bar", entries[0].Filename)
+
+	_, err = ParseLockfile([]byte(`[{"digest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"}]`))
+	require.ErrorContains(t, err, "missing url")
+
+	_, err = ParseLockfile([]byte(`[{"url": "https://example.com/foo", "digest": "sha256:abc"}]`))
+	require.ErrorContains(t, err, "invalid digest")
+
+	_, err = ParseLockfile([]byte(`[{"url": "https://example.com/foo", "digest": "sha512:0cf9180a764aba863a67b6d72f0918bc131c6772642cb2dce5a34f0a702f9470ddc2bf125c12198b1995c233c34b4afd346c54a2334c350a948a51b6e8b4e6b6"}]`))
+	require.ErrorContains(t, err, "unsupported digest algorithm sha512")
+}
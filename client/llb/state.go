@@ -530,6 +530,8 @@ type ConstraintsOpt interface {
 	ImageOption
 	GitOption
 	OCILayoutOption
+	OCIArtifactOption
+	LockfileOption
 }
 
 type constraintsOptFunc func(m *Constraints)
@@ -550,6 +552,14 @@ func (fn constraintsOptFunc) SetOCILayoutOption(oi *OCILayoutInfo) {
 	oi.applyConstraints(fn)
 }
 
+func (fn constraintsOptFunc) SetOCIArtifactOption(ai *OCIArtifactInfo) {
+	ai.applyConstraints(fn)
+}
+
+func (fn constraintsOptFunc) SetLockfileOption(li *LockfileInfo) {
+	li.applyConstraints(fn)
+}
+
 func (fn constraintsOptFunc) SetHTTPOption(hi *HTTPInfo) {
 	hi.applyConstraints(fn)
 }
@@ -58,7 +58,7 @@ type ExportEntry struct {
 	Type        string
 	Attrs       map[string]string
 	Output      filesync.FileOutputFunc // for ExporterOCI and ExporterDocker
-	OutputDir   string                  // for ExporterLocal
+	OutputDir   string                  // for ExporterLocal and ExporterCustom
 	OutputStore content.Store
 }
 
@@ -161,6 +161,10 @@ func (c *Client) solve(ctx context.Context, def *llb.Definition, runGateway runG
 				supportDir = true
 			case ExporterTar:
 				supportFile = true
+			case ExporterCustom:
+				// the output directory is optional, custom exporters may
+				// not send any files to the client
+				supportDir = ex.OutputDir != ""
 			case ExporterOCI, ExporterDocker:
 				supportFile = ex.Output != nil
 				supportStore = ex.OutputStore != nil || ex.OutputDir != ""
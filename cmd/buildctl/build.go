@@ -23,6 +23,7 @@ import (
 	"github.com/moby/buildkit/session/auth/authprovider"
 	"github.com/moby/buildkit/session/sshforward/sshprovider"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/sourcepolicy"
 	spb "github.com/moby/buildkit/sourcepolicy/pb"
 	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/progress/progresswriter"
@@ -89,7 +90,7 @@ var buildCommand = cli.Command{
 		},
 		cli.StringSliceFlag{
 			Name:  "allow",
-			Usage: "Allow extra privileged entitlement, e.g. network.host, security.insecure",
+			Usage: "Allow extra privileged entitlement, e.g. network.host, security.insecure, exporter.custom",
 		},
 		cli.StringSliceFlag{
 			Name:  "ssh",
@@ -103,6 +104,10 @@ var buildCommand = cli.Command{
 			Name:  "source-policy-file",
 			Usage: "Read source policy file from a JSON file",
 		},
+		cli.StringFlag{
+			Name:  "source-policy-lock-file",
+			Usage: "Write the sources pinned by the source policy to a JSON file that can be used as a source policy file",
+		},
 		cli.StringFlag{
 			Name:  "ref-file",
 			Usage: "Write build ref to a file",
@@ -111,6 +116,10 @@ var buildCommand = cli.Command{
 			Name:  "registry-auth-tlscontext",
 			Usage: "Overwrite TLS configuration when authenticating with registries, e.g. --registry-auth-tlscontext host=https://myserver:2376,insecure=false,ca=/path/to/my/ca.crt,cert=/path/to/my/cert.crt,key=/path/to/my/key.crt",
 		},
+		cli.BoolFlag{
+			Name:  "watch",
+			Usage: "Watch the local directories for changes and rebuild automatically",
+		},
 		cli.StringFlag{
 			Name:  "debug-json-cache-metrics",
 			Usage: "Where to output json cache metrics, use 'stdout' or 'stderr' for standard (error) output.",
@@ -169,6 +178,9 @@ func buildAction(clicontext *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if clicontext.Bool("watch") && clicontext.String("debug-json-cache-metrics") != "" {
+		return errors.New("--debug-json-cache-metrics is not supported with --watch")
+	}
 	cacheMetricsFile, err := openCacheMetricsFile(clicontext)
 	if err != nil {
 		return err
@@ -244,8 +256,6 @@ func buildAction(clicontext *cli.Context) error {
 		srcPol = &srcPolStruct
 	}
 
-	eg, ctx := errgroup.WithContext(bccommon.CommandContext(clicontext))
-
 	ref := identity.NewID()
 
 	solveOpt := client.SolveOpt{
@@ -296,10 +306,19 @@ func buildAction(clicontext *cli.Context) error {
 	refFile := clicontext.String("ref-file")
 	if refFile != "" {
 		defer func() {
-			continuity.AtomicWriteFile(refFile, []byte(ref), 0666)
+			continuity.AtomicWriteFile(refFile, []byte(solveOpt.Ref), 0666)
 		}()
 	}
 
+	if clicontext.Bool("watch") {
+		return watchBuild(clicontext, c, &solveOpt, def, traceEnc)
+	}
+	return runBuild(clicontext, c, solveOpt, def, traceEnc, cacheMetricsFile, startTime)
+}
+
+func runBuild(clicontext *cli.Context, c *client.Client, solveOpt client.SolveOpt, def *llb.Definition, traceEnc *json.Encoder, cacheMetricsFile *os.File, startTime time.Time) error {
+	eg, ctx := errgroup.WithContext(bccommon.CommandContext(clicontext))
+
 	// not using shared context to not disrupt display but let is finish reporting errors
 	pw, err := progresswriter.NewPrinter(context.TODO(), os.Stderr, clicontext.String("progress"))
 	if err != nil {
@@ -338,7 +357,7 @@ func buildAction(clicontext *cli.Context) error {
 	mw := progresswriter.NewMultiWriter(pw)
 
 	var writers []progresswriter.Writer
-	for _, at := range attachable {
+	for _, at := range solveOpt.Session {
 		if s, ok := at.(interface {
 			SetLogger(progresswriter.Logger)
 		}); ok {
@@ -404,6 +423,11 @@ func buildAction(clicontext *cli.Context) error {
 				return err
 			}
 		}
+		if lockFile := clicontext.String("source-policy-lock-file"); lockFile != "" {
+			if err := writeSourcePolicyLockFile(lockFile, resp.ExporterResponse); err != nil {
+				return err
+			}
+		}
 
 		return nil
 	})
@@ -432,6 +456,26 @@ func buildAction(clicontext *cli.Context) error {
 	return nil
 }
 
+func writeSourcePolicyLockFile(filename string, exporterResponse map[string]string) error {
+	v, ok := exporterResponse[sourcepolicy.LockResponseKey]
+	if !ok {
+		return errors.New("build did not return a source policy lockfile, no sources were matched by PIN rules")
+	}
+	dt, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode source policy lockfile")
+	}
+	var pol spb.Policy
+	if err := json.Unmarshal(dt, &pol); err != nil {
+		return errors.Wrap(err, "failed to unmarshal source policy lockfile")
+	}
+	dt, err = json.MarshalIndent(&pol, "", "  ")
+	if err != nil {
+		return err
+	}
+	return continuity.AtomicWriteFile(filename, dt, 0666)
+}
+
 func writeMetadataFile(filename string, exporterResponse map[string]string) error {
 	out := make(map[string]any)
 	for k, v := range exporterResponse {
@@ -23,3 +23,12 @@ func ParseLocal(locals []string) (map[string]fsutil.FS, error) {
 
 	return mounts, nil
 }
+
+// ParseLocalDirs parses --local and returns the directories by their name
+func ParseLocalDirs(locals []string) (map[string]string, error) {
+	localDirs, err := attrMap(locals)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return localDirs, nil
+}
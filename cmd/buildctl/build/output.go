@@ -65,6 +65,25 @@ func ParseOutput(exports []string) ([]client.ExportEntry, error) {
 	return entries, nil
 }
 
+// OutputPaths returns the local files and directories that the outputs of
+// --output write to. Outputs written to stdout are not included.
+func OutputPaths(exports []string) ([]string, error) {
+	var paths []string
+	for _, s := range exports {
+		fields, err := csvvalue.Fields(s, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			key, value, _ := strings.Cut(field, "=")
+			if strings.ToLower(key) == "dest" && value != "" && value != "-" {
+				paths = append(paths, value)
+			}
+		}
+	}
+	return paths, nil
+}
+
 // resolveExporterDest returns at most either one of io.WriteCloser (single file) or a string (directory path).
 func resolveExporterDest(exporter, dest string, attrs map[string]string) (filesync.FileOutputFunc, string, error) {
 	wrapWriter := func(wc io.WriteCloser) func(map[string]string) (io.WriteCloser, error) {
@@ -80,6 +99,8 @@ func resolveExporterDest(exporter, dest string, attrs map[string]string) (filesy
 		supportDir = true
 	case client.ExporterTar:
 		supportFile = true
+	case client.ExporterCustom:
+		supportDir = dest != ""
 	case client.ExporterOCI, client.ExporterDocker:
 		tar, err := strconv.ParseBool(attrs["tar"])
 		if err != nil {
@@ -0,0 +1,18 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputPaths(t *testing.T) {
+	paths, err := OutputPaths([]string{
+		"type=local,dest=out",
+		"type=tar,dest=-",
+		`type=oci,"dest=out.tar",name=foo`,
+		"type=image,name=foo,push=true",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"out", "out.tar"}, paths)
+}
@@ -0,0 +1,148 @@
+package build
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+const defaultWatchDebounce = 200 * time.Millisecond
+
+// Watcher reports changes to the local directories of a build.
+type Watcher struct {
+	w        *fsnotify.Watcher
+	ignore   []string
+	debounce time.Duration
+}
+
+// NewWatcher watches dirs and all their subdirectories for changes. Changes
+// inside the ignore paths, e.g. the destination of a local exporter, are not
+// reported.
+func NewWatcher(dirs, ignore []string) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create file watcher")
+	}
+	w := &Watcher{
+		w:        fw,
+		debounce: defaultWatchDebounce,
+	}
+	for _, p := range ignore {
+		if p, err = filepath.Abs(p); err == nil {
+			w.ignore = append(w.ignore, p)
+		}
+	}
+	for _, dir := range dirs {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			fw.Close()
+			return nil, errors.WithStack(err)
+		}
+		if err := w.add(dir); err != nil {
+			fw.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// add watches dir and its subdirectories.
+func (w *Watcher) add(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if w.ignored(p) || (p != dir && d.Name() == ".git") {
+			return filepath.SkipDir
+		}
+		if err := w.w.Add(p); err != nil {
+			return errors.Wrapf(err, "failed to watch %s", p)
+		}
+		return nil
+	})
+}
+
+func (w *Watcher) ignored(p string) bool {
+	for _, ig := range w.ignore {
+		if p == ig || strings.HasPrefix(p, ig+string(filepath.Separator)) {
+			return true
+		}
+		// temporary file of an atomic write of ig
+		if filepath.Dir(p) == filepath.Dir(ig) && strings.HasPrefix(filepath.Base(p), ".tmp-"+filepath.Base(ig)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait blocks until files have changed and returns the changed paths. Changes
+// are collected until no new events have arrived for the debounce period so
+// that saving multiple files triggers a single rebuild. Changes that happened
+// since the previous call are also returned.
+func (w *Watcher) Wait(ctx context.Context) ([]string, error) {
+	changed := map[string]struct{}{}
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case err, ok := <-w.w.Errors:
+			if !ok {
+				return nil, errors.New("file watcher closed")
+			}
+			return nil, errors.Wrap(err, "failed to watch files")
+		case ev, ok := <-w.w.Events:
+			if !ok {
+				return nil, errors.New("file watcher closed")
+			}
+			if w.ignored(ev.Name) {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if fi, err := os.Lstat(ev.Name); err == nil && fi.IsDir() {
+					if err := w.add(ev.Name); err != nil {
+						return nil, err
+					}
+				}
+			}
+			changed[ev.Name] = struct{}{}
+			if timer == nil {
+				timer = time.NewTimer(w.debounce)
+				timeout = timer.C
+			} else {
+				timer.Reset(w.debounce)
+			}
+		case <-timeout:
+			paths := make([]string, 0, len(changed))
+			for p := range changed {
+				paths = append(paths, p)
+			}
+			slices.Sort(paths)
+			return paths, nil
+		}
+	}
+}
+
+// Close stops watching the directories.
+func (w *Watcher) Close() error {
+	return w.w.Close()
+}
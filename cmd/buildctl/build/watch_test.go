@@ -0,0 +1,57 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerd/continuity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.MkdirAll(out, 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+
+	metadataFile := filepath.Join(dir, "metadata.json")
+	w, err := NewWatcher([]string{dir}, []string{out, metadataFile})
+	require.NoError(t, err)
+	defer w.Close()
+	w.debounce = 50 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
+	defer cancel()
+
+	// changes in ignored directories and files are not reported
+	require.NoError(t, os.WriteFile(filepath.Join(out, "foo"), []byte("foo"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "index"), []byte("foo"), 0600))
+	require.NoError(t, continuity.AtomicWriteFile(metadataFile, []byte("{}"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "foo"), []byte("foo"), 0600))
+
+	changed, err := w.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "sub", "foo")}, changed)
+
+	// new directories are watched as well
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "new"), 0755))
+	changed, err = w.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "new")}, changed)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "new", "bar"), []byte("bar"), 0600))
+	changed, err = w.Wait(ctx)
+	require.NoError(t, err)
+	require.Contains(t, changed, filepath.Join(dir, "new", "bar"))
+
+	ctx, cancel = context.WithCancel(context.TODO())
+	cancel()
+	_, err = w.Wait(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
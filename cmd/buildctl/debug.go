@@ -11,6 +11,8 @@ var debugCommand = cli.Command{
 	Subcommands: []cli.Command{
 		debug.DumpLLBCommand,
 		debug.DumpMetadataCommand,
+		debug.PolicyEvalCommand,
+		debug.VerifyProvenanceCommand,
 		debug.WorkersCommand,
 		debug.InfoCommand,
 		debug.MonitorCommand,
@@ -0,0 +1,158 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/sourcepolicy"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+var PolicyEvalCommand = cli.Command{
+	Name:      "policy-eval",
+	Usage:     "evaluate a source policy against LLB. LLB can be also passed via stdin. This command does not require the daemon to be running.",
+	ArgsUsage: "<llbfile>",
+	Action:    policyEval,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "source-policy-file",
+			Usage: "Read source policy file from a JSON file",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output the decisions in JSON format",
+		},
+	},
+}
+
+type policyEvalResult struct {
+	Digest     digest.Digest           `json:"digest"`
+	Identifier string                  `json:"identifier,omitempty"`
+	Updated    string                  `json:"updated,omitempty"`
+	Args       []string                `json:"args,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+	Decisions  []sourcepolicy.Decision `json:"decisions,omitempty"`
+}
+
+func policyEval(clicontext *cli.Context) error {
+	polFile := clicontext.String("source-policy-file")
+	if polFile == "" {
+		return errors.New("source-policy-file is required")
+	}
+	dt, err := os.ReadFile(polFile)
+	if err != nil {
+		return err
+	}
+	var pol spb.Policy
+	if err := json.Unmarshal(dt, &pol); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal source-policy-file %q", polFile)
+	}
+
+	var r io.Reader
+	if llbFile := clicontext.Args().First(); llbFile != "" && llbFile != "-" {
+		f, err := os.Open(llbFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		r = os.Stdin
+	}
+	ops, err := loadLLB(r)
+	if err != nil {
+		return err
+	}
+
+	results, err := evaluatePolicy(context.TODO(), &pol, ops)
+	if err != nil {
+		return err
+	}
+
+	var denied int
+	enc := json.NewEncoder(os.Stdout)
+	for _, res := range results {
+		if res.Error != "" {
+			denied++
+		}
+		if clicontext.Bool("json") {
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+			continue
+		}
+		printPolicyEvalResult(os.Stdout, res)
+	}
+	if denied > 0 {
+		return errors.Errorf("%d operations denied by policy", denied)
+	}
+	return nil
+}
+
+// evaluatePolicy evaluates the source and exec operations against the policy.
+// Denied operations don't stop the evaluation, the error is set in the result.
+func evaluatePolicy(ctx context.Context, pol *spb.Policy, ops []llbOp) ([]policyEvalResult, error) {
+	var decisions []sourcepolicy.Decision
+	e := sourcepolicy.NewEngine([]*spb.Policy{pol}, sourcepolicy.WithDecisionHandler(func(_ context.Context, d sourcepolicy.Decision) {
+		decisions = append(decisions, d)
+	}))
+
+	var results []policyEvalResult
+	for _, op := range ops {
+		res := policyEvalResult{Digest: op.Digest}
+		var err error
+		switch o := op.Op.Op.(type) {
+		case *pb.Op_Source:
+			res.Identifier = o.Source.Identifier
+			var mut bool
+			mut, err = e.Evaluate(ctx, o.Source)
+			if mut {
+				res.Updated = o.Source.Identifier
+			}
+		case *pb.Op_Exec:
+			res.Args = o.Exec.GetMeta().GetArgs()
+			err = e.EvaluateExec(ctx, o.Exec)
+		default:
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, sourcepolicy.ErrSourceDenied) && !errors.Is(err, sourcepolicy.ErrExecDenied) {
+				return nil, errors.Wrapf(err, "failed to evaluate %s", op.Digest)
+			}
+			res.Error = err.Error()
+		}
+		res.Decisions = decisions
+		decisions = nil
+		if res.Error == "" && res.Updated == "" && len(res.Decisions) == 0 {
+			continue
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func printPolicyEvalResult(w io.Writer, res policyEvalResult) {
+	subject := fmt.Sprintf("source %q", res.Identifier)
+	if res.Identifier == "" {
+		subject = fmt.Sprintf("exec %q", strings.Join(res.Args, " "))
+	}
+	switch {
+	case res.Error != "":
+		fmt.Fprintf(w, "%s %s: DENIED: %s\n", res.Digest, subject, res.Error)
+	case res.Updated != "":
+		fmt.Fprintf(w, "%s %s: CONVERTED to %q\n", res.Digest, subject, res.Updated)
+	default:
+		fmt.Fprintf(w, "%s %s: ALLOWED\n", res.Digest, subject)
+	}
+	for _, d := range res.Decisions {
+		fmt.Fprintf(w, "  rule %d: %s\n", d.Rule, d.Action)
+	}
+}
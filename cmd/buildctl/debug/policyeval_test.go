@@ -0,0 +1,113 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluatePolicy(t *testing.T) {
+	ctx := context.TODO()
+	st := llb.Image("docker.io/library/alpine:latest").
+		Run(llb.Shlex("apk add curl"), llb.Network(llb.NetModeHost)).Root()
+	st = llb.Image("docker.io/library/busybox:latest").
+		Run(llb.Shlex("echo hello")).
+		AddMount("/src", st)
+	def, err := st.Marshal(ctx)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, llb.WriteTo(def, &buf))
+	ops, err := loadLLB(&buf)
+	require.NoError(t, err)
+
+	pol := &spb.Policy{
+		Rules: []*spb.Rule{
+			{
+				Action: spb.PolicyAction_CONVERT,
+				Selector: &spb.Selector{
+					Identifier: "docker-image://docker.io/library/alpine:latest",
+				},
+				Updates: &spb.Update{
+					Identifier: "docker-image://docker.io/library/alpine:3.20",
+				},
+			},
+			{
+				Action: spb.PolicyAction_AUDIT,
+				Selector: &spb.Selector{
+					Identifier: "docker-image://docker.io/library/*",
+					MatchType:  spb.MatchType_WILDCARD,
+				},
+			},
+			{
+				Action: spb.PolicyAction_DENY,
+				Selector: &spb.Selector{
+					Exec: &spb.ExecSelector{Network: "host"},
+				},
+			},
+		},
+	}
+	results, err := evaluatePolicy(ctx, pol, ops)
+	require.NoError(t, err)
+
+	// the exec without a matching rule is left out
+	require.Len(t, results, 3)
+	byIdent := map[string]policyEvalResult{}
+	for _, res := range results {
+		if res.Identifier != "" {
+			byIdent[res.Identifier] = res
+		} else {
+			byIdent[strings.Join(res.Args, " ")] = res
+		}
+	}
+
+	res := byIdent["docker-image://docker.io/library/alpine:latest"]
+	require.Equal(t, "docker-image://docker.io/library/alpine:3.20", res.Updated)
+	require.Empty(t, res.Error)
+	require.Len(t, res.Decisions, 2)
+	require.Equal(t, spb.PolicyAction_CONVERT, res.Decisions[0].Action)
+	require.Equal(t, 0, res.Decisions[0].Rule)
+	require.Equal(t, "docker-image://docker.io/library/alpine:latest", res.Decisions[0].Identifier)
+	require.Equal(t, "docker-image://docker.io/library/alpine:3.20", res.Decisions[0].Updated)
+	require.Equal(t, spb.PolicyAction_AUDIT, res.Decisions[1].Action)
+	require.Equal(t, 1, res.Decisions[1].Rule)
+
+	res = byIdent["docker-image://docker.io/library/busybox:latest"]
+	require.Empty(t, res.Updated)
+	require.Empty(t, res.Error)
+	require.Len(t, res.Decisions, 1)
+	require.Equal(t, spb.PolicyAction_AUDIT, res.Decisions[0].Action)
+
+	res = byIdent["apk add curl"]
+	require.Contains(t, res.Error, "denied by policy")
+	require.Len(t, res.Decisions, 1)
+	require.Equal(t, spb.PolicyAction_DENY, res.Decisions[0].Action)
+	require.Equal(t, 2, res.Decisions[0].Rule)
+
+	buf.Reset()
+	printPolicyEvalResult(&buf, res)
+	require.True(t, strings.HasPrefix(buf.String(), string(res.Digest)+` exec "apk add curl": DENIED: `), buf.String())
+	require.True(t, strings.HasSuffix(buf.String(), "\n  rule 2: DENY\n"), buf.String())
+}
+
+func TestEvaluatePolicyInvalidRule(t *testing.T) {
+	ops := []llbOp{{
+		Op: &pb.Op{Op: &pb.Op_Exec{Exec: &pb.ExecOp{Meta: &pb.Meta{Args: []string{"true"}}, Network: pb.NetMode_NONE}}},
+	}}
+	pol := &spb.Policy{
+		Rules: []*spb.Rule{{
+			Action: spb.PolicyAction_CONVERT,
+			Selector: &spb.Selector{
+				Exec: &spb.ExecSelector{Network: "none"},
+			},
+		}},
+	}
+	_, err := evaluatePolicy(context.TODO(), pol, ops)
+	require.ErrorContains(t, err, "action is not supported for exec selectors")
+}
@@ -0,0 +1,565 @@
+package debug
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/containerd/platforms"
+	"github.com/docker/cli/cli/config"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	provenancetypes "github.com/moby/buildkit/solver/llbsolver/provenance/types"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/attestation"
+	"github.com/moby/buildkit/util/contentutil"
+	"github.com/moby/buildkit/util/resolver"
+	"github.com/moby/buildkit/util/signutil"
+	"github.com/moby/buildkit/util/wildcard"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/urfave/cli"
+)
+
+const (
+	ociLayoutPrefix = "oci-layout://"
+
+	mediaTypeDSSEEnvelope           = "application/vnd.dsse.envelope.v1+json"
+	annotationPredicateType         = "in-toto.io/predicate-type"
+	attestationManifestArtifactType = "application/vnd.docker.attestation.manifest.v1+json"
+)
+
+var VerifyProvenanceCommand = cli.Command{
+	Name:      "verify-provenance",
+	Usage:     "verify the provenance attestations of an image against a policy. This command does not require the daemon to be running.",
+	ArgsUsage: "<image|oci-layout://path>",
+	Action:    verifyProvenance,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "policy-file",
+			Usage: "Read provenance policy from a JSON file",
+		},
+		cli.StringFlag{
+			Name:  "key",
+			Usage: "Require the provenance to be signed with one of the PEM encoded public keys in the file",
+		},
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Output the results in JSON format",
+		},
+	},
+}
+
+// provenancePolicy is the policy the provenance attestations are checked
+// against. Empty fields are not checked.
+type provenancePolicy struct {
+	// Builders are the allowed builder IDs. Wildcards are supported.
+	Builders []string `json:"builders,omitempty"`
+	// Sources are the source repositories that need to be either the config
+	// source or a resolved dependency of the build. Wildcards are supported
+	// and the fragment of the URIs is ignored.
+	Sources []string `json:"sources,omitempty"`
+	// NoInsecureEntitlements denies builds that ran steps with the
+	// security.insecure or network.host entitlements. This needs provenance
+	// created with mode=max.
+	NoInsecureEntitlements bool `json:"noInsecureEntitlements,omitempty"`
+	// PinnedMaterials requires all resolved dependencies to have a digest.
+	PinnedMaterials bool `json:"pinnedMaterials,omitempty"`
+}
+
+type provenanceVerifier struct {
+	policy   provenancePolicy
+	builders []*wildcard.Wildcard
+	sources  []*wildcard.Wildcard
+	keys     []crypto.PublicKey
+}
+
+type verifyProvenanceResult struct {
+	Digest        digest.Digest `json:"digest"`
+	Platform      string        `json:"platform,omitempty"`
+	PredicateType string        `json:"predicateType,omitempty"`
+	Signed        bool          `json:"signed,omitempty"`
+	Violations    []string      `json:"violations,omitempty"`
+}
+
+func verifyProvenance(clicontext *cli.Context) error {
+	polFile := clicontext.String("policy-file")
+	if polFile == "" {
+		return errors.New("policy-file is required")
+	}
+	dt, err := os.ReadFile(polFile)
+	if err != nil {
+		return err
+	}
+	var pol provenancePolicy
+	dec := json.NewDecoder(bytes.NewReader(dt))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pol); err != nil {
+		return errors.Wrapf(err, "failed to unmarshal policy-file %q", polFile)
+	}
+
+	var keys []crypto.PublicKey
+	if keyFile := clicontext.String("key"); keyFile != "" {
+		dt, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		keys, err = signutil.ParsePublicKeys(dt)
+		if err != nil {
+			return errors.Wrapf(err, "invalid key %q", keyFile)
+		}
+	}
+
+	v, err := newProvenanceVerifier(pol, keys)
+	if err != nil {
+		return err
+	}
+
+	target := clicontext.Args().First()
+	if target == "" {
+		return errors.New("image or oci-layout path is required")
+	}
+	ctx := context.TODO()
+	src, err := resolveProvenanceTarget(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer src.close()
+	imgs, atts, err := collectImages(ctx, src.provider, src.roots)
+	if err != nil {
+		return err
+	}
+	if len(imgs) == 0 {
+		return errors.Errorf("no images found in %s", target)
+	}
+
+	var failed int
+	enc := json.NewEncoder(os.Stdout)
+	for _, img := range imgs {
+		imgAtts, err := src.referrers(ctx, img.Digest, atts[img.Digest])
+		if err != nil {
+			return err
+		}
+		res, err := v.verifyImage(ctx, src.provider, img, imgAtts)
+		if err != nil {
+			return err
+		}
+		if len(res.Violations) > 0 {
+			failed++
+		}
+		if clicontext.Bool("json") {
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+			continue
+		}
+		printVerifyProvenanceResult(os.Stdout, res)
+	}
+	if failed > 0 {
+		return errors.Errorf("%d images violate the provenance policy", failed)
+	}
+	return nil
+}
+
+func newProvenanceVerifier(pol provenancePolicy, keys []crypto.PublicKey) (*provenanceVerifier, error) {
+	v := &provenanceVerifier{policy: pol, keys: keys}
+	for _, b := range pol.Builders {
+		w, err := wildcard.New(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid builder %q", b)
+		}
+		v.builders = append(v.builders, w)
+	}
+	for _, s := range pol.Sources {
+		w, err := wildcard.New(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid source %q", s)
+		}
+		v.sources = append(v.sources, w)
+	}
+	return v, nil
+}
+
+// provenanceTarget is an image in a registry or in an OCI layout directory.
+type provenanceTarget struct {
+	provider content.Provider
+	roots    []ocispecs.Descriptor
+	// resolver and ref are set for images in a registry, where the
+	// attestation manifests can also be pushed as referrers of the images
+	resolver *resolver.Resolver
+	ref      string
+	close    func()
+}
+
+// resolveProvenanceTarget returns the content provider and the root
+// descriptors of an image in a registry or in an OCI layout directory.
+func resolveProvenanceTarget(ctx context.Context, target string) (*provenanceTarget, error) {
+	if p, ok := strings.CutPrefix(target, ociLayoutPrefix); ok {
+		dt, err := os.ReadFile(filepath.Join(p, ocispecs.ImageIndexFile))
+		if err != nil {
+			return nil, err
+		}
+		var idx ocispecs.Index
+		if err := json.Unmarshal(dt, &idx); err != nil {
+			return nil, errors.Wrapf(err, "invalid OCI layout %s", p)
+		}
+		cs, err := local.NewStore(p)
+		if err != nil {
+			return nil, err
+		}
+		return &provenanceTarget{provider: cs, roots: idx.Manifests, close: func() {}}, nil
+	}
+
+	r, closeSession, err := registryResolver(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	name, desc, err := r.Resolve(ctx, target)
+	if err != nil {
+		closeSession()
+		return nil, err
+	}
+	fetcher, err := r.Fetcher(ctx, name)
+	if err != nil {
+		closeSession()
+		return nil, err
+	}
+	return &provenanceTarget{
+		provider: contentutil.FromFetcher(fetcher),
+		roots:    []ocispecs.Descriptor{desc},
+		resolver: r,
+		ref:      name,
+		close:    closeSession,
+	}, nil
+}
+
+// registryResolver returns a resolver that gets the registry credentials
+// from the docker configuration through an in-process session, the same way
+// the daemon gets them from the client.
+func registryResolver(ctx context.Context, ref string) (*resolver.Resolver, func(), error) {
+	sm, err := session.NewManager()
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := session.NewSession(ctx, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	s.Allow(authprovider.NewDockerAuthProvider(authprovider.DockerAuthProviderConfig{
+		ConfigFile: config.LoadDefaultConfigFile(os.Stderr),
+	}))
+	go s.Run(ctx, func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+		c1, c2 := net.Pipe()
+		go sm.HandleConn(ctx, c2, meta)
+		return c1, nil
+	})
+	r := resolver.NewPool().GetResolver(nil, ref, "pull", sm, session.NewGroup(s.ID()))
+	return r, func() { s.Close() }, nil
+}
+
+// referrers adds the attestation manifests pushed as referrers of the image
+// to the ones found in the index.
+func (t *provenanceTarget) referrers(ctx context.Context, img digest.Digest, atts []ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
+	if t.resolver == nil {
+		return atts, nil
+	}
+	refs, err := t.resolver.Referrers(ctx, t.ref, img, attestationManifestArtifactType)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list referrers of %s", img)
+	}
+	for _, desc := range refs {
+		if !slices.ContainsFunc(atts, func(d ocispecs.Descriptor) bool { return d.Digest == desc.Digest }) {
+			atts = append(atts, desc)
+		}
+	}
+	return atts, nil
+}
+
+// collectImages walks the indexes and returns the image manifests and the
+// attestation manifests keyed by the digest of the image they refer to.
+func collectImages(ctx context.Context, provider content.Provider, descs []ocispecs.Descriptor) ([]ocispecs.Descriptor, map[digest.Digest][]ocispecs.Descriptor, error) {
+	var imgs []ocispecs.Descriptor
+	atts := make(map[digest.Digest][]ocispecs.Descriptor)
+	var walk func([]ocispecs.Descriptor) error
+	walk = func(descs []ocispecs.Descriptor) error {
+		for _, desc := range descs {
+			switch {
+			case images.IsIndexType(desc.MediaType):
+				dt, err := content.ReadBlob(ctx, provider, desc)
+				if err != nil {
+					return err
+				}
+				var idx ocispecs.Index
+				if err := json.Unmarshal(dt, &idx); err != nil {
+					return errors.Wrapf(err, "invalid index %s", desc.Digest)
+				}
+				if err := walk(idx.Manifests); err != nil {
+					return err
+				}
+			case images.IsManifestType(desc.MediaType):
+				if desc.Annotations[attestation.DockerAnnotationReferenceType] == attestation.DockerAnnotationReferenceTypeDefault {
+					if subject := desc.Annotations[attestation.DockerAnnotationReferenceDigest]; subject != "" {
+						atts[digest.Digest(subject)] = append(atts[digest.Digest(subject)], desc)
+					}
+					continue
+				}
+				imgs = append(imgs, desc)
+			}
+		}
+		return nil
+	}
+	if err := walk(descs); err != nil {
+		return nil, nil, err
+	}
+	return imgs, atts, nil
+}
+
+// verifyImage checks the provenance attestations of an image. Policy
+// violations are returned in the result.
+func (v *provenanceVerifier) verifyImage(ctx context.Context, provider content.Provider, img ocispecs.Descriptor, atts []ocispecs.Descriptor) (*verifyProvenanceResult, error) {
+	res := &verifyProvenanceResult{Digest: img.Digest}
+	if img.Platform != nil {
+		res.Platform = platforms.Format(*img.Platform)
+	}
+	if len(atts) == 0 {
+		res.Violations = append(res.Violations, "no attestation manifest found")
+		return res, nil
+	}
+
+	var found int
+	signed := true
+	for _, att := range atts {
+		dt, err := content.ReadBlob(ctx, provider, att)
+		if err != nil {
+			return nil, err
+		}
+		var mfst ocispecs.Manifest
+		if err := json.Unmarshal(dt, &mfst); err != nil {
+			return nil, errors.Wrapf(err, "invalid attestation manifest %s", att.Digest)
+		}
+
+		for _, l := range mfst.Layers {
+			predicateType := l.Annotations[annotationPredicateType]
+			if predicateType != slsa02.PredicateSLSAProvenance && predicateType != slsa1.PredicateSLSAProvenance {
+				continue
+			}
+			found++
+			res.PredicateType = predicateType
+			dt, err := content.ReadBlob(ctx, provider, l)
+			if err != nil {
+				return nil, err
+			}
+			pred, ok, err := v.loadProvenance(dt, l.MediaType, img.Digest)
+			if err != nil {
+				res.Violations = append(res.Violations, err.Error())
+				signed = false
+				continue
+			}
+			signed = signed && ok
+			res.Violations = append(res.Violations, v.checkPredicate(pred)...)
+		}
+	}
+	if found == 0 {
+		res.Violations = append(res.Violations, "no provenance attestation found")
+	}
+	res.Signed = found > 0 && signed
+	return res, nil
+}
+
+// loadProvenance decodes the provenance attestation, verifying the signature
+// if keys are configured, and returns it as a SLSA v1 predicate.
+func (v *provenanceVerifier) loadProvenance(dt []byte, mediaType string, subject digest.Digest) (*provenancetypes.ProvenancePredicateSLSA1, bool, error) {
+	var signed bool
+	payload := dt
+	if mediaType == mediaTypeDSSEEnvelope {
+		var env dsse.Envelope
+		if err := json.Unmarshal(dt, &env); err != nil {
+			return nil, false, errors.Wrap(err, "invalid provenance envelope")
+		}
+		if env.PayloadType != intoto.PayloadType {
+			return nil, false, errors.Errorf("unsupported provenance envelope payload type %q", env.PayloadType)
+		}
+		p, err := env.DecodeB64Payload()
+		if err != nil {
+			return nil, false, errors.Wrap(err, "invalid provenance envelope")
+		}
+		if len(v.keys) > 0 {
+			if !verifyEnvelope(&env, p, v.keys) {
+				return nil, false, errors.New("provenance is not signed with the trusted keys")
+			}
+			signed = true
+		}
+		payload = p
+	} else if len(v.keys) > 0 {
+		return nil, false, errors.New("provenance is not signed")
+	}
+
+	var stmt struct {
+		intoto.StatementHeader
+		Predicate json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(payload, &stmt); err != nil {
+		return nil, false, errors.Wrap(err, "invalid provenance statement")
+	}
+	if !hasSubject(stmt.Subject, subject) {
+		return nil, false, errors.Errorf("provenance subject does not match image %s", subject)
+	}
+
+	switch stmt.PredicateType {
+	case slsa1.PredicateSLSAProvenance:
+		var pred provenancetypes.ProvenancePredicateSLSA1
+		if err := json.Unmarshal(stmt.Predicate, &pred); err != nil {
+			return nil, false, errors.Wrap(err, "invalid provenance predicate")
+		}
+		return &pred, signed, nil
+	case slsa02.PredicateSLSAProvenance:
+		var pred provenancetypes.ProvenancePredicateSLSA02
+		if err := json.Unmarshal(stmt.Predicate, &pred); err != nil {
+			return nil, false, errors.Wrap(err, "invalid provenance predicate")
+		}
+		return pred.ConvertToSLSA1(), signed, nil
+	default:
+		return nil, false, errors.Errorf("unsupported provenance predicate type %q", stmt.PredicateType)
+	}
+}
+
+func hasSubject(subjects []intoto.Subject, dgst digest.Digest) bool {
+	for _, s := range subjects {
+		if s.Digest[dgst.Algorithm().String()] == dgst.Encoded() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPredicate returns the policy violations of the provenance predicate.
+func (v *provenanceVerifier) checkPredicate(pred *provenancetypes.ProvenancePredicateSLSA1) []string {
+	var violations []string
+
+	if len(v.builders) > 0 {
+		id := pred.RunDetails.Builder.ID
+		if !matchAny(v.builders, id) {
+			violations = append(violations, fmt.Sprintf("builder %q is not allowed", id))
+		}
+	}
+
+	if len(v.sources) > 0 {
+		uris := []string{pred.BuildDefinition.ExternalParameters.ConfigSource.URI}
+		for _, d := range pred.BuildDefinition.ResolvedDependencies {
+			uris = append(uris, d.URI)
+		}
+		for _, w := range v.sources {
+			if !matchAnyURI(w, uris) {
+				violations = append(violations, fmt.Sprintf("required source %q not found", w))
+			}
+		}
+	}
+
+	if v.policy.NoInsecureEntitlements {
+		bc := pred.BuildDefinition.InternalParameters.BuildConfig
+		if bc == nil {
+			violations = append(violations, "build steps are not recorded, provenance with mode=max is required to check entitlements")
+		} else {
+			for _, step := range bc.Definition {
+				exec := step.Op.GetExec()
+				if exec == nil {
+					continue
+				}
+				if exec.Security == pb.SecurityMode_INSECURE {
+					violations = append(violations, fmt.Sprintf("step %s uses the security.insecure entitlement", step.ID))
+				}
+				if exec.Network == pb.NetMode_HOST {
+					violations = append(violations, fmt.Sprintf("step %s uses the network.host entitlement", step.ID))
+				}
+			}
+		}
+	}
+
+	if v.policy.PinnedMaterials {
+		for _, d := range pred.BuildDefinition.ResolvedDependencies {
+			if len(d.Digest) == 0 {
+				name := d.URI
+				if name == "" {
+					name = d.Name
+				}
+				violations = append(violations, fmt.Sprintf("material %q is not pinned to a digest", name))
+			}
+		}
+	}
+
+	return violations
+}
+
+func matchAny(ws []*wildcard.Wildcard, s string) bool {
+	for _, w := range ws {
+		if w.Match(s) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyURI(w *wildcard.Wildcard, uris []string) bool {
+	for _, uri := range uris {
+		if uri == "" {
+			continue
+		}
+		base, _, _ := strings.Cut(uri, "#")
+		if w.Match(uri) != nil || w.Match(base) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func printVerifyProvenanceResult(w io.Writer, res *verifyProvenanceResult) {
+	subject := string(res.Digest)
+	if res.Platform != "" {
+		subject += " " + res.Platform
+	}
+	if len(res.Violations) > 0 {
+		fmt.Fprintf(w, "%s: FAILED\n", subject)
+		for _, v := range res.Violations {
+			fmt.Fprintf(w, "  %s\n", v)
+		}
+		return
+	}
+	if res.Signed {
+		fmt.Fprintf(w, "%s: VERIFIED (signed %s)\n", subject, res.PredicateType)
+		return
+	}
+	fmt.Fprintf(w, "%s: VERIFIED (%s)\n", subject, res.PredicateType)
+}
+
+// verifyEnvelope returns true if one of the envelope signatures was made with
+// one of the keys over the pre-authentication encoding of the payload.
+func verifyEnvelope(env *dsse.Envelope, payload []byte, keys []crypto.PublicKey) bool {
+	pae := dsse.PAE(env.PayloadType, payload)
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if signutil.VerifyAny(keys, pae, sig) {
+			return true
+		}
+	}
+	return false
+}
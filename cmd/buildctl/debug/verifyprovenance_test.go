@@ -0,0 +1,241 @@
+package debug
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	slsa "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
+	provenancetypes "github.com/moby/buildkit/solver/llbsolver/provenance/types"
+	"github.com/moby/buildkit/solver/pb"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckProvenancePredicate(t *testing.T) {
+	pred := &provenancetypes.ProvenancePredicateSLSA1{}
+	pred.RunDetails.Builder.ID = "https://github.com/moby/buildkit/builder/1"
+	pred.BuildDefinition.ExternalParameters.ConfigSource.URI = "https://github.com/moby/buildkit.git#v1"
+	pred.BuildDefinition.ResolvedDependencies = []slsa1.ResourceDescriptor{
+		{URI: "pkg:docker/alpine@latest", Digest: slsa.DigestSet{"sha256": "abc"}},
+		{URI: "https://example.com/file.tar"},
+	}
+	pred.BuildDefinition.InternalParameters.BuildConfig = &provenancetypes.BuildConfig{
+		Definition: []provenancetypes.BuildStep{
+			{ID: "step0", Op: &pb.Op{Op: &pb.Op_Exec{Exec: &pb.ExecOp{Security: pb.SecurityMode_INSECURE}}}},
+			{ID: "step1", Op: &pb.Op{Op: &pb.Op_Exec{Exec: &pb.ExecOp{}}}},
+		},
+	}
+
+	v, err := newProvenanceVerifier(provenancePolicy{
+		Builders: []string{"https://github.com/moby/buildkit/builder/*"},
+		Sources:  []string{"https://github.com/moby/buildkit.git"},
+	}, nil)
+	require.NoError(t, err)
+	require.Empty(t, v.checkPredicate(pred))
+
+	v, err = newProvenanceVerifier(provenancePolicy{
+		Builders:               []string{"https://example.com/builder"},
+		Sources:                []string{"https://github.com/moby/moby.git"},
+		NoInsecureEntitlements: true,
+		PinnedMaterials:        true,
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`builder "https://github.com/moby/buildkit/builder/1" is not allowed`,
+		`required source "https://github.com/moby/moby.git" not found`,
+		"step step0 uses the security.insecure entitlement",
+		`material "https://example.com/file.tar" is not pinned to a digest`,
+	}, v.checkPredicate(pred))
+
+	pred.BuildDefinition.InternalParameters.BuildConfig = nil
+	v, err = newProvenanceVerifier(provenancePolicy{NoInsecureEntitlements: true}, nil)
+	require.NoError(t, err)
+	require.Len(t, v.checkPredicate(pred), 1)
+}
+
+func TestLoadProvenance(t *testing.T) {
+	subject := digest.FromString("image")
+	pred := provenancetypes.ProvenancePredicateSLSA1{}
+	pred.RunDetails.Builder.ID = "builder"
+	stmt := intoto.Statement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: slsa1.PredicateSLSAProvenance,
+			Subject:       []intoto.Subject{{Name: "_", Digest: slsa.DigestSet{"sha256": subject.Encoded()}}},
+		},
+		Predicate: pred,
+	}
+	payload, err := json.Marshal(stmt)
+	require.NoError(t, err)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sig := ed25519.Sign(priv, dsse.PAE(intoto.PayloadType, payload))
+	env, err := json.Marshal(dsse.Envelope{
+		PayloadType: intoto.PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []dsse.Signature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	})
+	require.NoError(t, err)
+
+	v, err := newProvenanceVerifier(provenancePolicy{}, []crypto.PublicKey{pub})
+	require.NoError(t, err)
+
+	p, signed, err := v.loadProvenance(env, mediaTypeDSSEEnvelope, subject)
+	require.NoError(t, err)
+	require.True(t, signed)
+	require.Equal(t, "builder", p.RunDetails.Builder.ID)
+
+	_, _, err = v.loadProvenance(payload, intoto.PayloadType, subject)
+	require.ErrorContains(t, err, "not signed")
+
+	other, err := json.Marshal(dsse.Envelope{
+		PayloadType: "text/plain",
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []dsse.Signature{{Sig: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, dsse.PAE("text/plain", payload)))}},
+	})
+	require.NoError(t, err)
+	_, _, err = v.loadProvenance(other, mediaTypeDSSEEnvelope, subject)
+	require.ErrorContains(t, err, "unsupported provenance envelope payload type")
+
+	_, _, err = v.loadProvenance(env, mediaTypeDSSEEnvelope, digest.FromString("other"))
+	require.ErrorContains(t, err, "subject does not match")
+
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	v, err = newProvenanceVerifier(provenancePolicy{}, []crypto.PublicKey{otherPub})
+	require.NoError(t, err)
+	_, _, err = v.loadProvenance(env, mediaTypeDSSEEnvelope, subject)
+	require.ErrorContains(t, err, "not signed with the trusted keys")
+}
+
+func TestVerifyProvenanceReferrers(t *testing.T) {
+	blobs := map[digest.Digest][]byte{}
+	mediaTypes := map[digest.Digest]string{}
+	add := func(mediaType string, v any) ocispecs.Descriptor {
+		dt, ok := v.([]byte)
+		if !ok {
+			var err error
+			dt, err = json.Marshal(v)
+			require.NoError(t, err)
+		}
+		dgst := digest.FromBytes(dt)
+		blobs[dgst] = dt
+		mediaTypes[dgst] = mediaType
+		return ocispecs.Descriptor{MediaType: mediaType, Digest: dgst, Size: int64(len(dt))}
+	}
+
+	imgConfig := add(ocispecs.MediaTypeImageConfig, []byte("{}"))
+	img := add(ocispecs.MediaTypeImageManifest, ocispecs.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Config:    imgConfig,
+	})
+
+	pred := provenancetypes.ProvenancePredicateSLSA1{}
+	pred.RunDetails.Builder.ID = "builder"
+	stmt := add(intoto.PayloadType, intoto.Statement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: slsa1.PredicateSLSAProvenance,
+			Subject:       []intoto.Subject{{Name: "_", Digest: slsa.DigestSet{"sha256": img.Digest.Encoded()}}},
+		},
+		Predicate: pred,
+	})
+	stmt.Annotations = map[string]string{annotationPredicateType: slsa1.PredicateSLSAProvenance}
+	att := add(ocispecs.MediaTypeImageManifest, ocispecs.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: attestationManifestArtifactType,
+		Config:       ocispecs.DescriptorEmptyJSON,
+		Layers:       []ocispecs.Descriptor{stmt},
+		Subject:      &img,
+	})
+	att.ArtifactType = attestationManifestArtifactType
+	referrers, err := json.Marshal(ocispecs.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispecs.MediaTypeImageIndex,
+		Manifests: []ocispecs.Descriptor{att},
+	})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var dt []byte
+		var mediaType string
+		switch p := r.URL.Path; {
+		case p == "/v2/" || p == "/v2":
+			return
+		case p == "/v2/test/referrers/"+img.Digest.String():
+			dt, mediaType = referrers, ocispecs.MediaTypeImageIndex
+		case p == "/v2/test/manifests/latest":
+			dt, mediaType = blobs[img.Digest], img.MediaType
+		case strings.HasPrefix(p, "/v2/test/manifests/"), strings.HasPrefix(p, "/v2/test/blobs/"):
+			dgst := digest.Digest(p[strings.LastIndex(p, "/")+1:])
+			var ok bool
+			if dt, ok = blobs[dgst]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			mediaType = mediaTypes[dgst]
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(dt).String())
+		w.Header().Set("Content-Length", strconv.Itoa(len(dt)))
+		if r.Method != http.MethodHead {
+			w.Write(dt)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	// the credentials are read from the docker configuration
+	dir := t.TempDir()
+	auth := base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths":{"`+host+`":{"auth":"`+auth+`"}}}`), 0600))
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	ctx := context.TODO()
+	target, err := resolveProvenanceTarget(ctx, host+"/test:latest")
+	require.NoError(t, err)
+	defer target.close()
+
+	imgs, atts, err := collectImages(ctx, target.provider, target.roots)
+	require.NoError(t, err)
+	require.Len(t, imgs, 1)
+	require.Empty(t, atts)
+
+	imgAtts, err := target.referrers(ctx, img.Digest, atts[img.Digest])
+	require.NoError(t, err)
+	require.Len(t, imgAtts, 1)
+
+	v, err := newProvenanceVerifier(provenancePolicy{Builders: []string{"builder"}}, nil)
+	require.NoError(t, err)
+	res, err := v.verifyImage(ctx, target.provider, imgs[0], imgAtts)
+	require.NoError(t, err)
+	require.Empty(t, res.Violations)
+	require.Equal(t, slsa1.PredicateSLSAProvenance, res.PredicateType)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/cmd/buildctl/build"
+	bccommon "github.com/moby/buildkit/cmd/buildctl/common"
+	"github.com/moby/buildkit/identity"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// watchBuild runs the build and runs it again every time files in the local
+// directories change, until the command is interrupted. Every iteration uses
+// a new session as the cache key of local sources is bound to the session.
+// The daemon keeps the files transferred by the previous iteration so only the
+// changed files are sent again.
+func watchBuild(clicontext *cli.Context, c *client.Client, solveOpt *client.SolveOpt, def *llb.Definition, traceEnc *json.Encoder) error {
+	ctx := bccommon.CommandContext(clicontext)
+
+	localDirs, err := build.ParseLocalDirs(clicontext.StringSlice("local"))
+	if err != nil {
+		return errors.Wrap(err, "invalid local")
+	}
+	if len(localDirs) == 0 {
+		return errors.New("--watch requires at least one --local directory")
+	}
+	dirs := slices.Sorted(maps.Values(localDirs))
+
+	// don't trigger a new build for files written by the build itself
+	ignore, err := build.OutputPaths(clicontext.StringSlice("output"))
+	if err != nil {
+		return errors.Wrap(err, "invalid output")
+	}
+	for _, ex := range solveOpt.CacheExports {
+		if dest := ex.Attrs["dest"]; ex.Type == "local" && dest != "" {
+			ignore = append(ignore, dest)
+		}
+	}
+	for _, name := range []string{"metadata-file", "ref-file", "source-policy-lock-file"} {
+		if p := clicontext.String(name); p != "" {
+			ignore = append(ignore, p)
+		}
+	}
+
+	w, err := build.NewWatcher(dirs, ignore)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	for i := 1; ; i++ {
+		if i > 1 {
+			solveOpt.Ref = identity.NewID()
+		}
+		fmt.Fprintf(os.Stderr, "=== build %d (ref %s)\n", i, solveOpt.Ref)
+		startTime := time.Now()
+		if err := runBuild(clicontext, c, *solveOpt, def, traceEnc, nil, startTime); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "=== build %d failed after %s: %v\n", i, time.Since(startTime).Round(time.Millisecond), err)
+		} else {
+			fmt.Fprintf(os.Stderr, "=== build %d done in %s\n", i, time.Since(startTime).Round(time.Millisecond))
+		}
+
+		fmt.Fprintf(os.Stderr, "=== watching %s for changes\n", strings.Join(dirs, ", "))
+		changed, err := w.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "=== %d path(s) changed, rebuilding\n", len(changed))
+	}
+}
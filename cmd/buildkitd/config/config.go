@@ -32,6 +32,14 @@ type Config struct {
 
 	Registries map[string]resolverconfig.RegistryConfig `toml:"registry"`
 
+	HTTP *HTTPConfig `toml:"http"`
+
+	Image *ImageConfig `toml:"image"`
+
+	SourcePolicy *SourcePolicyConfig `toml:"sourcepolicy"`
+
+	Provenance *ProvenanceConfig `toml:"provenance"`
+
 	DNS *DNSConfig `toml:"dns"`
 
 	History *HistoryConfig `toml:"history"`
@@ -197,6 +205,75 @@ type DNSConfig struct {
 	SearchDomains []string `toml:"searchDomains"`
 }
 
+type HTTPConfig struct {
+	// Retries is the number of times a request of an HTTP source that failed
+	// with a network error or a temporary error status is retried. Requests
+	// are not retried by default.
+	Retries *int `toml:"retries"`
+	// Rewrite redirects requests for matching URLs to mirrors, e.g. for
+	// air-gapped environments.
+	Rewrite []HTTPRewriteRule `toml:"rewrite"`
+}
+
+type HTTPRewriteRule struct {
+	// Prefix is the URL prefix the rule applies to.
+	Prefix string `toml:"prefix"`
+	// Mirrors replace the prefix of the URL and are tried in order before
+	// the original URL.
+	Mirrors []string `toml:"mirrors"`
+}
+
+type ImageConfig struct {
+	// Verify requires images pulled from registries to be signed or to have
+	// attestations before they are used in a build.
+	Verify []ImageVerifyRule `toml:"verify"`
+	// SigningKeys maps key names to paths of PEM encoded private keys. The
+	// image exporter signs with them when sign-key=kms://<name> is set.
+	SigningKeys map[string]string `toml:"signingKeys"`
+}
+
+type ImageVerifyRule struct {
+	// Match is the image name the rule applies to, e.g.
+	// docker.io/library/alpine. Wildcards (*) are supported.
+	Match string `toml:"match"`
+	// SignatureKeys are paths to PEM encoded public keys. Matching images
+	// need a cosign signature made with one of the keys.
+	SignatureKeys []string `toml:"signatureKeys"`
+	// Attestations are the in-toto predicate types matching images need to
+	// have attestations for.
+	Attestations []string `toml:"attestations"`
+}
+
+type ProvenanceConfig struct {
+	// BuilderID is the builder.id recorded in the provenance attestations of
+	// all builds. It takes precedence over the builder-id set by the client.
+	BuilderID string `toml:"builderID"`
+	// SigningKey is the path to a PEM encoded private key. Attestations
+	// requested with sign=true are exported signed with it in DSSE
+	// envelopes.
+	SigningKey string `toml:"signingKey"`
+}
+
+type SourcePolicyConfig struct {
+	// Files are paths to source policies in JSON format that are applied to
+	// all builds ahead of the policies from the client and the frontend.
+	Files []string `toml:"files"`
+	// Overrides replace the default policy files for matching builds. The
+	// first matching override is used.
+	Overrides []SourcePolicyOverride `toml:"override"`
+}
+
+type SourcePolicyOverride struct {
+	// Namespace matches builds running on a containerd worker in the
+	// namespace.
+	Namespace string `toml:"namespace"`
+	// Entitlements match builds that are granted all of the entitlements,
+	// e.g. network.host.
+	Entitlements []string `toml:"entitlements"`
+	// Files are paths to source policies in JSON format.
+	Files []string `toml:"files"`
+}
+
 type HistoryConfig struct {
 	MaxAge     Duration `toml:"maxAge"`
 	MaxEntries int64    `toml:"maxEntries"`
@@ -76,6 +76,31 @@ cert="cert.pem"
 nameservers=["1.1.1.1","8.8.8.8"]
 options=["edns0"]
 searchDomains=["example.com"]
+
+[http]
+retries=5
+[[http.rewrite]]
+prefix="https://github.com/"
+mirrors=["https://mirror.example.com/github/"]
+
+[[image.verify]]
+match="docker.io/myorg/*"
+signatureKeys=["/etc/buildkit/cosign.pub"]
+attestations=["https://slsa.dev/provenance/v0.2"]
+
+[image.signingKeys]
+release="/etc/buildkit/cosign.key"
+
+[provenance]
+builderID="https://example.com/buildkit"
+signingKey="/etc/buildkit/provenance.key"
+
+[sourcepolicy]
+files=["/etc/buildkit/policy.json"]
+[[sourcepolicy.override]]
+namespace="trusted"
+entitlements=["network.host"]
+files=["/etc/buildkit/trusted.json"]
 `
 
 	cfg, err := Load(bytes.NewBuffer([]byte(testConfig)))
@@ -148,4 +173,29 @@ searchDomains=["example.com"]
 	require.Equal(t, []string{"1.1.1.1", "8.8.8.8"}, cfg.DNS.Nameservers)
 	require.Equal(t, []string{"example.com"}, cfg.DNS.SearchDomains)
 	require.Equal(t, []string{"edns0"}, cfg.DNS.Options)
+
+	require.NotNil(t, cfg.HTTP)
+	require.NotNil(t, cfg.HTTP.Retries)
+	require.Equal(t, 5, *cfg.HTTP.Retries)
+	require.Equal(t, 1, len(cfg.HTTP.Rewrite))
+	require.Equal(t, "https://github.com/", cfg.HTTP.Rewrite[0].Prefix)
+	require.Equal(t, []string{"https://mirror.example.com/github/"}, cfg.HTTP.Rewrite[0].Mirrors)
+
+	require.NotNil(t, cfg.Image)
+	require.Equal(t, 1, len(cfg.Image.Verify))
+	require.Equal(t, "docker.io/myorg/*", cfg.Image.Verify[0].Match)
+	require.Equal(t, []string{"/etc/buildkit/cosign.pub"}, cfg.Image.Verify[0].SignatureKeys)
+	require.Equal(t, []string{"https://slsa.dev/provenance/v0.2"}, cfg.Image.Verify[0].Attestations)
+	require.Equal(t, map[string]string{"release": "/etc/buildkit/cosign.key"}, cfg.Image.SigningKeys)
+
+	require.NotNil(t, cfg.Provenance)
+	require.Equal(t, "https://example.com/buildkit", cfg.Provenance.BuilderID)
+	require.Equal(t, "/etc/buildkit/provenance.key", cfg.Provenance.SigningKey)
+
+	require.NotNil(t, cfg.SourcePolicy)
+	require.Equal(t, []string{"/etc/buildkit/policy.json"}, cfg.SourcePolicy.Files)
+	require.Equal(t, 1, len(cfg.SourcePolicy.Overrides))
+	require.Equal(t, "trusted", cfg.SourcePolicy.Overrides[0].Namespace)
+	require.Equal(t, []string{"network.host"}, cfg.SourcePolicy.Overrides[0].Entitlements)
+	require.Equal(t, []string{"/etc/buildkit/trusted.json"}, cfg.SourcePolicy.Overrides[0].Files)
 }
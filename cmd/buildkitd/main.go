@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"net"
 	"os"
@@ -32,6 +33,7 @@ import (
 	"github.com/moby/buildkit/cmd/buildkitd/config"
 	"github.com/moby/buildkit/control"
 	"github.com/moby/buildkit/executor/oci"
+	"github.com/moby/buildkit/exporter/attestation"
 	"github.com/moby/buildkit/frontend"
 	dockerfile "github.com/moby/buildkit/frontend/dockerfile/builder"
 	"github.com/moby/buildkit/frontend/gateway"
@@ -39,7 +41,11 @@ import (
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/solver/bboltcachestorage"
+	"github.com/moby/buildkit/solver/llbsolver"
 	"github.com/moby/buildkit/solver/llbsolver/cdidevices"
+	"github.com/moby/buildkit/source/containerimage"
+	httpsource "github.com/moby/buildkit/source/http"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
 	"github.com/moby/buildkit/util/apicaps"
 	"github.com/moby/buildkit/util/appcontext"
 	"github.com/moby/buildkit/util/appdefaults"
@@ -48,6 +54,7 @@ import (
 	"github.com/moby/buildkit/util/cachedigest"
 	"github.com/moby/buildkit/util/db/boltutil"
 	"github.com/moby/buildkit/util/disk"
+	"github.com/moby/buildkit/util/entitlements"
 	"github.com/moby/buildkit/util/grpcerrors"
 	_ "github.com/moby/buildkit/util/grpcutil/encoding/proto"
 	"github.com/moby/buildkit/util/profiler"
@@ -212,7 +219,7 @@ func main() {
 		},
 		cli.StringSliceFlag{
 			Name:  "allow-insecure-entitlement",
-			Usage: "allows insecure entitlements e.g. network.host, security.insecure",
+			Usage: "allows insecure entitlements e.g. network.host, security.insecure, exporter.custom",
 		},
 		cli.StringFlag{
 			Name:  "otel-socket-path",
@@ -378,6 +385,8 @@ func main() {
 					cfg.Entitlements = append(cfg.Entitlements, e)
 				case "network.host":
 					cfg.Entitlements = append(cfg.Entitlements, e)
+				case "exporter.custom":
+					cfg.Entitlements = append(cfg.Entitlements, e)
 				default:
 					return errors.Errorf("invalid entitlement : %s", e)
 				}
@@ -857,6 +866,11 @@ func newController(ctx context.Context, c *cli.Context, cfg *config.Config) (*co
 		cfg.Entitlements = append(cfg.Entitlements, "device")
 	}
 
+	srcPol, err := daemonSourcePolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	return control.NewController(control.Opt{
 		SessionManager:            sessionManager,
 		WorkerController:          wc,
@@ -873,6 +887,8 @@ func newController(ctx context.Context, c *cli.Context, cfg *config.Config) (*co
 		HistoryConfig:             cfg.History,
 		GarbageCollect:            w.GarbageCollect,
 		GracefulStop:              ctx.Done(),
+		SourcePolicy:              srcPol,
+		ProvenanceBuilderID:       provenanceBuilderID(cfg),
 	})
 }
 
@@ -880,6 +896,131 @@ func resolverFunc(cfg *config.Config) docker.RegistryHosts {
 	return resolver.NewRegistryConfig(cfg.Registries)
 }
 
+func httpSourceOpt(cfg *config.Config) (int, []httpsource.RewriteRule) {
+	if cfg.HTTP == nil {
+		return 0, nil
+	}
+	// failed requests are not retried unless enabled in the config
+	var retries int
+	if cfg.HTTP.Retries != nil {
+		retries = *cfg.HTTP.Retries
+	}
+	rules := make([]httpsource.RewriteRule, 0, len(cfg.HTTP.Rewrite))
+	for _, r := range cfg.HTTP.Rewrite {
+		rules = append(rules, httpsource.RewriteRule{
+			Prefix:  r.Prefix,
+			Mirrors: r.Mirrors,
+		})
+	}
+	return retries, rules
+}
+
+func imageVerifyPolicies(cfg *config.Config) ([]containerimage.VerifyPolicy, error) {
+	if cfg.Image == nil {
+		return nil, nil
+	}
+	policies := make([]containerimage.VerifyPolicy, 0, len(cfg.Image.Verify))
+	for _, r := range cfg.Image.Verify {
+		p := containerimage.VerifyPolicy{
+			Match:        r.Match,
+			Attestations: r.Attestations,
+		}
+		for _, fp := range r.SignatureKeys {
+			dt, err := os.ReadFile(fp)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read signature key for %s", r.Match)
+			}
+			p.SignatureKey = append(p.SignatureKey, dt...)
+			p.SignatureKey = append(p.SignatureKey, '\n')
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+func imageSigningKeys(cfg *config.Config) (map[string][]byte, error) {
+	if cfg.Image == nil || len(cfg.Image.SigningKeys) == 0 {
+		return nil, nil
+	}
+	keys := make(map[string][]byte, len(cfg.Image.SigningKeys))
+	for name, fp := range cfg.Image.SigningKeys {
+		dt, err := os.ReadFile(fp)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read signing key %s", name)
+		}
+		keys[name] = dt
+	}
+	return keys, nil
+}
+
+func attestationSigner(cfg *config.Config) (*attestation.Signer, error) {
+	if cfg.Provenance == nil || cfg.Provenance.SigningKey == "" {
+		return nil, nil
+	}
+	dt, err := os.ReadFile(cfg.Provenance.SigningKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read provenance signing key")
+	}
+	s, err := attestation.NewSigner(dt)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid provenance signing key")
+	}
+	return s, nil
+}
+
+func provenanceBuilderID(cfg *config.Config) string {
+	if cfg.Provenance == nil {
+		return ""
+	}
+	return cfg.Provenance.BuilderID
+}
+
+func daemonSourcePolicy(cfg *config.Config) (*llbsolver.DaemonSourcePolicy, error) {
+	if cfg.SourcePolicy == nil {
+		return nil, nil
+	}
+	pols, err := loadSourcePolicyFiles(cfg.SourcePolicy.Files)
+	if err != nil {
+		return nil, err
+	}
+	srcPol := &llbsolver.DaemonSourcePolicy{Policies: pols}
+	for _, o := range cfg.SourcePolicy.Overrides {
+		pols, err := loadSourcePolicyFiles(o.Files)
+		if err != nil {
+			return nil, err
+		}
+		override := llbsolver.DaemonSourcePolicyOverride{
+			Namespace: o.Namespace,
+			Policies:  pols,
+		}
+		for _, v := range o.Entitlements {
+			e, _, err := entitlements.Parse(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid source policy override entitlement %q", v)
+			}
+			override.Entitlements = append(override.Entitlements, e)
+		}
+		srcPol.Overrides = append(srcPol.Overrides, override)
+	}
+	return srcPol, nil
+}
+
+func loadSourcePolicyFiles(files []string) ([]*spb.Policy, error) {
+	pols := make([]*spb.Policy, 0, len(files))
+	for _, fp := range files {
+		dt, err := os.ReadFile(fp)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read source policy")
+		}
+		var pol spb.Policy
+		if err := json.Unmarshal(dt, &pol); err != nil {
+			return nil, errors.Wrapf(err, "failed to unmarshal source policy %q", fp)
+		}
+		pols = append(pols, &pol)
+	}
+	return pols, nil
+}
+
 func newWorkerController(c *cli.Context, wiOpt workerInitializerOpt) (*worker.Controller, error) {
 	wc := &worker.Controller{}
 	nWorkers := 0
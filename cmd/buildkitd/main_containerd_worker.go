@@ -354,6 +354,19 @@ func containerdWorkerInitializer(c *cli.Context, common workerInitializerOpt) ([
 	opt.GCPolicy = getGCPolicy(cfg.GCConfig, common.config.Root)
 	opt.BuildkitVersion = getBuildkitVersion()
 	opt.RegistryHosts = resolverFunc(common.config)
+	opt.HTTPRetries, opt.HTTPRewriteRules = httpSourceOpt(common.config)
+	opt.ImageVerifyPolicies, err = imageVerifyPolicies(common.config)
+	if err != nil {
+		return nil, err
+	}
+	opt.ImageSigningKeys, err = imageSigningKeys(common.config)
+	if err != nil {
+		return nil, err
+	}
+	opt.AttestationSigner, err = attestationSigner(common.config)
+	if err != nil {
+		return nil, err
+	}
 
 	if platformsStr := cfg.Platforms; len(platformsStr) != 0 {
 		platforms, err := parsePlatforms(platformsStr)
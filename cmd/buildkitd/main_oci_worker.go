@@ -326,6 +326,19 @@ func ociWorkerInitializer(c *cli.Context, common workerInitializerOpt) ([]worker
 	opt.GCPolicy = getGCPolicy(cfg.GCConfig, common.config.Root)
 	opt.BuildkitVersion = getBuildkitVersion()
 	opt.RegistryHosts = hosts
+	opt.HTTPRetries, opt.HTTPRewriteRules = httpSourceOpt(common.config)
+	opt.ImageVerifyPolicies, err = imageVerifyPolicies(common.config)
+	if err != nil {
+		return nil, err
+	}
+	opt.ImageSigningKeys, err = imageSigningKeys(common.config)
+	if err != nil {
+		return nil, err
+	}
+	opt.AttestationSigner, err = attestationSigner(common.config)
+	if err != nil {
+		return nil, err
+	}
 
 	if platformsStr := cfg.Platforms; len(platformsStr) != 0 {
 		platforms, err := parsePlatforms(platformsStr)
@@ -74,6 +74,10 @@ type Opt struct {
 	HistoryConfig             *config.HistoryConfig
 	GarbageCollect            func(context.Context) error
 	GracefulStop              <-chan struct{}
+	SourcePolicy              *llbsolver.DaemonSourcePolicy
+	// ProvenanceBuilderID overrides the builder ID of the provenance
+	// attestations.
+	ProvenanceBuilderID string
 }
 
 type Controller struct { // TODO: ControlService
@@ -114,6 +118,7 @@ func NewController(opt Opt) (*Controller, error) {
 		SessionManager:   opt.SessionManager,
 		Entitlements:     opt.Entitlements,
 		HistoryQueue:     hq,
+		SourcePolicy:     opt.SourcePolicy,
 	})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create solver")
@@ -479,12 +484,17 @@ func (c *Controller) Solve(ctx context.Context, req *controlapi.SolveRequest) (*
 
 	if attrs, ok := attests["sbom"]; ok {
 		var ref reference.Named
+		var builtin bool
 		params := make(map[string]string)
 		for k, v := range attrs {
 			if k == "generator" {
 				if v == "" {
 					return nil, errors.Errorf("sbom generator cannot be empty")
 				}
+				if v == attestations.BuiltinSBOMGenerator {
+					builtin = true
+					continue
+				}
 				ref, err = reference.ParseNormalizedNamed(v)
 				if err != nil {
 					return nil, errors.Wrapf(err, "failed to parse sbom generator %s", v)
@@ -495,17 +505,25 @@ func (c *Controller) Solve(ctx context.Context, req *controlapi.SolveRequest) (*
 			}
 		}
 
-		useCache := true
-		if v, ok := req.FrontendAttrs["no-cache"]; ok && v == "" {
-			// disable cache if cache is disabled for all stages
-			useCache = false
-		}
-		resolveMode := llb.ResolveModeDefault.String()
-		if v, ok := req.FrontendAttrs["image-resolve-mode"]; ok {
-			resolveMode = v
-		}
+		if builtin {
+			p, err := proc.BuiltinSBOMProcessor(params)
+			if err != nil {
+				return nil, err
+			}
+			procs = append(procs, p)
+		} else {
+			useCache := true
+			if v, ok := req.FrontendAttrs["no-cache"]; ok && v == "" {
+				// disable cache if cache is disabled for all stages
+				useCache = false
+			}
+			resolveMode := llb.ResolveModeDefault.String()
+			if v, ok := req.FrontendAttrs["image-resolve-mode"]; ok {
+				resolveMode = v
+			}
 
-		procs = append(procs, proc.SBOMProcessor(ref.String(), useCache, resolveMode, params))
+			procs = append(procs, proc.SBOMProcessor(ref.String(), useCache, resolveMode, params))
+		}
 	}
 
 	if attrs, ok := attests["provenance"]; ok {
@@ -521,6 +539,9 @@ func (c *Controller) Solve(ctx context.Context, req *controlapi.SolveRequest) (*
 				params[k] = v
 			}
 		}
+		if c.opt.ProvenanceBuilderID != "" {
+			params["builder-id"] = c.opt.ProvenanceBuilderID
+		}
 		procs = append(procs, proc.ProvenanceProcessor(slsaVersion, params))
 	}
 
@@ -0,0 +1,108 @@
+package attestation
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"strconv"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/solver/result"
+	"github.com/moby/buildkit/util/signutil"
+	"github.com/pkg/errors"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+// MediaTypeDSSEEnvelope is the media type of the signed attestations.
+const MediaTypeDSSEEnvelope = "application/vnd.dsse.envelope.v1+json"
+
+// Signer signs in-toto statements in DSSE envelopes with a key configured on
+// the daemon.
+type Signer struct {
+	sv *signerVerifier
+	es *dsse.EnvelopeSigner
+}
+
+// NewSigner parses a PEM encoded ECDSA, RSA or ed25519 private key.
+func NewSigner(dt []byte) (*Signer, error) {
+	key, _, err := signutil.ParsePrivateKey(dt)
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := dsse.SHA256KeyID(key.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compute key id")
+	}
+	sv := &signerVerifier{key: key, keyID: keyID}
+	es, err := dsse.NewEnvelopeSigner(sv)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{sv: sv, es: es}, nil
+}
+
+// Sign returns the DSSE envelope of the statement.
+func (s *Signer) Sign(ctx context.Context, stmt intoto.Statement) ([]byte, error) {
+	payload, err := json.Marshal(stmt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal attestation")
+	}
+	env, err := s.es.SignPayload(ctx, intoto.PayloadType, payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sign attestation")
+	}
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// SignRequested returns true if the attestation needs to be exported signed.
+func SignRequested(att exporter.Attestation) bool {
+	v, _ := strconv.ParseBool(string(att.Metadata[result.AttestationSignKey]))
+	return v
+}
+
+// SignStatements returns the DSSE envelopes of the statements made from the
+// attestations that request a signature. Statements that don't need to be
+// signed have a nil envelope.
+func SignStatements(ctx context.Context, s *Signer, attestations []exporter.Attestation, statements []intoto.Statement) ([][]byte, error) {
+	envelopes := make([][]byte, len(statements))
+	for i, att := range attestations {
+		if !SignRequested(att) {
+			continue
+		}
+		if s == nil {
+			return nil, errors.Errorf("attestation %s requires signing but no signing key is configured on the daemon", att.InToto.PredicateType)
+		}
+		dt, err := s.Sign(ctx, statements[i])
+		if err != nil {
+			return nil, err
+		}
+		envelopes[i] = dt
+	}
+	return envelopes, nil
+}
+
+// signerVerifier implements dsse.SignerVerifier for a crypto.Signer, making
+// the same signatures as the image signatures.
+type signerVerifier struct {
+	key   crypto.Signer
+	keyID string
+}
+
+var _ dsse.SignerVerifier = &signerVerifier{}
+
+func (sv *signerVerifier) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	return signutil.Sign(sv.key, data)
+}
+
+func (sv *signerVerifier) Verify(ctx context.Context, data, sig []byte) error {
+	return signutil.Verify(sv.key.Public(), data, sig)
+}
+
+func (sv *signerVerifier) KeyID() (string, error) {
+	return sv.keyID, nil
+}
+
+func (sv *signerVerifier) Public() crypto.PublicKey {
+	return sv.key.Public()
+}
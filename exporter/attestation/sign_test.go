@@ -0,0 +1,105 @@
+package attestation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/solver/result"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignStatement(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for _, key := range []any{ecKey, edKey} {
+		dt, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		s, err := NewSigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: dt}))
+		require.NoError(t, err)
+
+		stmt := intoto.Statement{
+			StatementHeader: intoto.StatementHeader{
+				Type:          intoto.StatementInTotoV01,
+				PredicateType: "https://slsa.dev/provenance/v1",
+				Subject:       []intoto.Subject{{Name: "foo", Digest: map[string]string{"sha256": "abc"}}},
+			},
+			Predicate: json.RawMessage(`{"foo":"bar"}`),
+		}
+		dt, err = s.Sign(context.TODO(), stmt)
+		require.NoError(t, err)
+
+		var env dsse.Envelope
+		require.NoError(t, json.Unmarshal(dt, &env))
+		require.Equal(t, intoto.PayloadType, env.PayloadType)
+		require.Len(t, env.Signatures, 1)
+
+		ev, err := dsse.NewEnvelopeVerifier(s.sv)
+		require.NoError(t, err)
+		accepted, err := ev.Verify(context.TODO(), &env)
+		require.NoError(t, err)
+		require.Len(t, accepted, 1)
+		require.Equal(t, env.Signatures[0].KeyID, accepted[0].KeyID)
+
+		payload, err := env.DecodeB64Payload()
+		require.NoError(t, err)
+		var stmt2 intoto.Statement
+		require.NoError(t, json.Unmarshal(payload, &stmt2))
+		require.Equal(t, stmt.PredicateType, stmt2.PredicateType)
+		require.Equal(t, stmt.Subject, stmt2.Subject)
+
+		// tampered payloads don't verify
+		env.Payload = env.Payload[:len(env.Payload)-4] + "AAAA"
+		_, err = ev.Verify(context.TODO(), &env)
+		require.Error(t, err)
+	}
+}
+
+func TestSignStatements(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	dt, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	s, err := NewSigner(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: dt}))
+	require.NoError(t, err)
+
+	atts := []exporter.Attestation{
+		{Metadata: map[string][]byte{result.AttestationSignKey: []byte("true")}},
+		{Metadata: map[string][]byte{result.AttestationSignKey: []byte("false")}},
+		{},
+	}
+	stmts := make([]intoto.Statement, len(atts))
+	envelopes, err := SignStatements(context.TODO(), s, atts, stmts)
+	require.NoError(t, err)
+	require.Len(t, envelopes, 3)
+	require.NotNil(t, envelopes[0])
+	require.Nil(t, envelopes[1])
+	require.Nil(t, envelopes[2])
+
+	_, err = SignStatements(context.TODO(), nil, atts, stmts)
+	require.ErrorContains(t, err, "no signing key is configured")
+
+	envelopes, err = SignStatements(context.TODO(), nil, atts[1:], stmts[1:])
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{nil, nil}, envelopes)
+}
+
+func TestNewSignerInvalid(t *testing.T) {
+	_, err := NewSigner([]byte("foo"))
+	require.ErrorContains(t, err, "no private key found")
+
+	_, err = NewSigner(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: []byte("foo")}))
+	require.ErrorContains(t, err, "encrypted private keys are not supported")
+}
@@ -105,10 +105,14 @@ func supplementSBOM(ctx context.Context, s session.Group, target cache.Immutable
 	if doc.CreationInfo == nil {
 		doc.CreationInfo = &spdx.CreationInfo{}
 	}
-	doc.CreationInfo.Creators = append(doc.CreationInfo.Creators, common.Creator{
+	creator := common.Creator{
 		CreatorType: "Tool",
 		Creator:     "buildkit-" + version.Version,
-	})
+	}
+	if !slices.Contains(doc.CreationInfo.Creators, creator) {
+		// sboms of the builtin generator are already created by buildkit
+		doc.CreationInfo.Creators = append(doc.CreationInfo.Creators, creator)
+	}
 
 	content, err = encodeSPDX(doc)
 	if err != nil {
@@ -0,0 +1,382 @@
+package containerimage
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+
+	"github.com/docker/go-units"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/util/progress"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/tonistiigi/fsutil"
+	copy "github.com/tonistiigi/fsutil/copy"
+)
+
+// dedupeEntry is the metadata of a file compared when looking for files
+// shared by all the refs.
+type dedupeEntry struct {
+	mode     os.FileMode
+	uid, gid uint32
+	size     int64
+	mtime    int64
+	linkname string
+}
+
+// dedupeLayers factors the files that are identical in all refs into a
+// common layer, so that registries store them only once. The layers of the
+// base image of each ref are kept as they are, and only the files added on
+// top of them are factored. Each returned ref is the base image layers, the
+// common layer and a layer with the rest of the files of the ref. The common
+// layer only depends on the shared files, so other images sharing the same
+// files reuse it. The layer groups map the layers of the original refs to the
+// new ones. Nil is returned if the refs don't share any files.
+func (ic *ImageWriter) dedupeLayers(ctx context.Context, s session.Group, refs []cache.ImmutableRef, baseLayers []int) (_ []cache.ImmutableRef, _ [][]layerGroup, err error) {
+	if len(refs) < 2 || slices.Contains(refs, nil) {
+		return nil, nil, nil
+	}
+	if ic.opt.CacheManager == nil {
+		return nil, nil, errors.New("layer deduplication is not supported by this worker")
+	}
+	done := progress.OneOff(ctx, fmt.Sprintf("deduplicating files of %d platforms", len(refs)))
+	defer func() {
+		done(err)
+	}()
+
+	chains := make([]cache.RefList, len(refs))
+	defer func() {
+		for _, chain := range chains {
+			chain.Release(context.WithoutCancel(ctx))
+		}
+	}()
+	bases := make([]int, len(refs))
+	for i, ref := range refs {
+		chains[i] = ref.LayerChain()
+		if i < len(baseLayers) {
+			bases[i] = min(baseLayers[i], len(chains[i]))
+		}
+		if bases[i] == len(chains[i]) {
+			// no layers on top of the base image
+			return nil, nil, nil
+		}
+	}
+
+	mount := func(ref cache.ImmutableRef) (string, func() error, error) {
+		m, err := ref.Mount(ctx, true, s)
+		if err != nil {
+			return "", nil, err
+		}
+		lm := snapshot.LocalMounter(m)
+		root, err := lm.Mount()
+		if err != nil {
+			return "", nil, err
+		}
+		return root, lm.Unmount, nil
+	}
+	// the files of the base image layers are compared with the base roots
+	// so that they are never moved out of these layers
+	roots := make([]string, len(refs))
+	baseRoots := make([]string, len(refs))
+	for i, ref := range refs {
+		root, unmount, err := mount(ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer unmount()
+		roots[i] = root
+		if bases[i] > 0 {
+			root, unmount, err := mount(chains[i][bases[i]-1])
+			if err != nil {
+				return nil, nil, err
+			}
+			defer unmount()
+			baseRoots[i] = root
+		}
+	}
+
+	shared, size, err := sharedFiles(ctx, roots, baseRoots)
+	if err != nil {
+		return nil, nil, err
+	}
+	if size == 0 {
+		return nil, nil, nil
+	}
+
+	cm := ic.opt.CacheManager
+	mref, err := cm.New(ctx, nil, s, cache.WithDescription("files shared by all platforms"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if mref != nil {
+			mref.Release(context.WithoutCancel(ctx))
+		}
+	}()
+	m, err := mref.Mount(ctx, false, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	lm := snapshot.LocalMounter(m)
+	dest, err := lm.Mount()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = copySharedFiles(ctx, roots[0], dest, shared)
+	if uerr := lm.Unmount(); err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	common, err := mref.Commit(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	mref = nil
+	defer common.Release(context.WithoutCancel(ctx))
+
+	out := make([]cache.ImmutableRef, 0, len(refs))
+	groups := make([][]layerGroup, 0, len(refs))
+	defer func() {
+		if err != nil {
+			for _, ref := range out {
+				ref.Release(context.WithoutCancel(ctx))
+			}
+		}
+	}()
+	for i, ref := range refs {
+		merged, err := dedupeRef(ctx, cm, s, ref, chains[i], bases[i], common)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, merged)
+
+		g := make([]layerGroup, 0, bases[i]+2)
+		for j := range bases[i] {
+			g = append(g, layerGroup{start: j, end: j + 1})
+		}
+		g = append(g, layerGroup{start: bases[i], end: bases[i]}, layerGroup{start: bases[i], end: len(chains[i])})
+		groups = append(groups, g)
+	}
+
+	progress.OneOff(ctx, fmt.Sprintf("deduplicated %d files shared by all platforms, %s saved", len(shared), units.HumanSize(float64(size*int64(len(refs)-1)))))(nil)
+	return out, groups, nil
+}
+
+// dedupeRef returns the ref with the first base layers of its chain, the
+// common layer and the diff from these layers to ref.
+func dedupeRef(ctx context.Context, cm cache.Accessor, s session.Group, ref cache.ImmutableRef, chain cache.RefList, base int, common cache.ImmutableRef) (cache.ImmutableRef, error) {
+	parents := []cache.ImmutableRef{common}
+	lower := common
+	if base > 0 {
+		parents = []cache.ImmutableRef{chain[base-1], common}
+		var err error
+		lower, err = cm.Merge(ctx, parents, nil, cache.WithDescription("base layers and files shared by all platforms"))
+		if err != nil {
+			return nil, err
+		}
+		defer lower.Release(context.WithoutCancel(ctx))
+	}
+	rest, err := cm.Diff(ctx, lower, ref, nil, cache.NoDiffMerge, cache.WithDescription("files not shared by all platforms"))
+	if err != nil {
+		return nil, err
+	}
+	defer rest.Release(context.WithoutCancel(ctx))
+	return cm.Merge(ctx, append(parents, rest), nil, cache.WithDescription("deduplicated layers"))
+}
+
+// sharedFiles returns the sorted paths of the files that are identical in
+// all roots, and the total size of the shared regular files. Files that are
+// unchanged from the base root of any root are not shared. Roots without a
+// base have an empty base root. The parent directories of the shared files
+// are always included.
+func sharedFiles(ctx context.Context, roots, baseRoots []string) ([]string, int64, error) {
+	scans := make([]map[string]dedupeEntry, len(roots))
+	baseScans := make([]map[string]dedupeEntry, len(roots))
+	for i, root := range roots {
+		var err error
+		if scans[i], err = scanFiles(ctx, root); err != nil {
+			return nil, 0, err
+		}
+		if i < len(baseRoots) && baseRoots[i] != "" {
+			if baseScans[i], err = scanFiles(ctx, baseRoots[i]); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	var size int64
+	shared := map[string]struct{}{}
+	for p, e := range scans[0] {
+		if slices.ContainsFunc(baseScans, func(scan map[string]dedupeEntry) bool {
+			e2, ok := scan[p]
+			return ok && e2 == e
+		}) {
+			// unchanged from the base image
+			continue
+		}
+		if !slices.ContainsFunc(scans[1:], func(scan map[string]dedupeEntry) bool {
+			e2, ok := scan[p]
+			return !ok || e2 != e
+		}) {
+			if e.mode.IsRegular() {
+				same, err := sameContent(roots, p)
+				if err != nil {
+					return nil, 0, err
+				}
+				if !same {
+					continue
+				}
+				size += e.size
+			}
+			shared[p] = struct{}{}
+		}
+	}
+	for p := range shared {
+		for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+			shared[dir] = struct{}{}
+		}
+	}
+
+	paths := make([]string, 0, len(shared))
+	for p := range shared {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	return paths, size, nil
+}
+
+// scanFiles returns the metadata of the directories, symlinks and regular
+// files in root. Hardlinks and special files are never shared.
+func scanFiles(ctx context.Context, root string) (map[string]dedupeEntry, error) {
+	files := map[string]dedupeEntry{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir(), fi.Mode()&os.ModeSymlink != 0:
+		case fi.Mode().IsRegular():
+			if _, ok := copy.GetLinkInfo(fi); ok {
+				return nil
+			}
+		default:
+			return nil
+		}
+		st, err := fsutil.Stat(p)
+		if err != nil {
+			return err
+		}
+		e := dedupeEntry{
+			mode:     fi.Mode(),
+			uid:      st.Uid,
+			gid:      st.Gid,
+			mtime:    st.ModTime,
+			linkname: st.Linkname,
+		}
+		if fi.Mode().IsRegular() {
+			e.size = fi.Size()
+		}
+		files["/"+filepath.ToSlash(rel)] = e
+		return nil
+	})
+	return files, errors.Wrapf(err, "failed to scan %s", root)
+}
+
+func sameContent(roots []string, p string) (bool, error) {
+	var dgst digest.Digest
+	for _, root := range roots {
+		f, err := os.Open(filepath.Join(root, filepath.FromSlash(p)))
+		if err != nil {
+			return false, err
+		}
+		d, err := digest.FromReader(f)
+		f.Close()
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to read %s", p)
+		}
+		if dgst != "" && d != dgst {
+			return false, nil
+		}
+		dgst = d
+	}
+	return true, nil
+}
+
+// copySharedFiles copies the shared files from src to dest with their
+// metadata.
+func copySharedFiles(ctx context.Context, src, dest string, paths []string) error {
+	var dirs []string
+	for _, p := range paths {
+		srcPath := filepath.Join(src, filepath.FromSlash(p))
+		destPath := filepath.Join(dest, filepath.FromSlash(p))
+		fi, err := os.Lstat(srcPath)
+		if err != nil {
+			return err
+		}
+		st, err := fsutil.Stat(srcPath)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi.IsDir():
+			if err := os.Mkdir(destPath, fi.Mode().Perm()); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := os.Chmod(destPath, fi.Mode()); err != nil {
+				return errors.WithStack(err)
+			}
+			dirs = append(dirs, p)
+		case fi.Mode()&os.ModeSymlink != 0:
+			if err := os.Symlink(st.Linkname, destPath); err != nil {
+				return errors.WithStack(err)
+			}
+		default:
+			if err := copy.Copy(ctx, src, p, dest, p); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := copy.Chown(destPath, nil, func(*copy.User) (*copy.User, error) {
+			return &copy.User{UID: int(st.Uid), GID: int(st.Gid)}, nil
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			tm := fi.ModTime()
+			if err := copy.Utimes(destPath, &tm); err != nil {
+				return err
+			}
+		}
+	}
+	// directory times are set last as creating their contents changes them
+	for _, p := range slices.Backward(dirs) {
+		fi, err := os.Lstat(filepath.Join(src, filepath.FromSlash(p)))
+		if err != nil {
+			return err
+		}
+		tm := fi.ModTime()
+		if err := copy.Utimes(filepath.Join(dest, filepath.FromSlash(p)), &tm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
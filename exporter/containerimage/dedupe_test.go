@@ -0,0 +1,222 @@
+package containerimage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/diff/apply"
+	ctdmetadata "github.com/containerd/containerd/v2/core/metadata"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/containerd/containerd/v2/plugins/diff/walking"
+	"github.com/containerd/containerd/v2/plugins/snapshots/native"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/cache/metadata"
+	"github.com/moby/buildkit/snapshot"
+	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
+	"github.com/moby/buildkit/util/leaseutil"
+	"github.com/moby/buildkit/util/winlayers"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestSharedFiles(t *testing.T) {
+	tm := time.Unix(1700000000, 0)
+	roots := make([]string, 2)
+	for i := range roots {
+		root := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/share/doc"), 0755))
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "bin"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "usr/share/doc/README"), []byte("shared"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "usr/share/doc/VERSION"), []byte{byte('0' + i)}, 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "bin/app"), []byte("binary"+string(rune('a'+i))), 0755))
+		for _, p := range []string{"usr/share/doc/README", "usr/share/doc/VERSION", "usr/share/doc", "bin/app"} {
+			require.NoError(t, os.Chtimes(filepath.Join(root, p), tm, tm))
+		}
+		roots[i] = root
+	}
+
+	shared, size, err := sharedFiles(context.TODO(), roots, nil)
+	require.NoError(t, err)
+	require.Contains(t, shared, "/usr/share/doc/README")
+	require.NotContains(t, shared, "/usr/share/doc/VERSION")
+	require.NotContains(t, shared, "/bin/app")
+	require.Contains(t, shared, "/usr")
+	require.Contains(t, shared, "/usr/share")
+	require.Contains(t, shared, "/usr/share/doc")
+	require.Equal(t, int64(len("shared")), size)
+
+	dest := t.TempDir()
+	require.NoError(t, copySharedFiles(context.TODO(), roots[0], dest, shared))
+	dt, err := os.ReadFile(filepath.Join(dest, "usr/share/doc/README"))
+	require.NoError(t, err)
+	require.Equal(t, "shared", string(dt))
+	fi, err := os.Stat(filepath.Join(dest, "usr/share/doc/README"))
+	require.NoError(t, err)
+	require.True(t, fi.ModTime().Equal(tm))
+	fi, err = os.Stat(filepath.Join(dest, "usr/share/doc"))
+	require.NoError(t, err)
+	require.True(t, fi.ModTime().Equal(tm))
+	_, err = os.Stat(filepath.Join(dest, "bin"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDedupeLayers(t *testing.T) {
+	ctx := context.TODO()
+	cm := newTestCacheManager(t)
+	ic, err := NewImageWriter(WriterOpt{CacheManager: cm})
+	require.NoError(t, err)
+
+	var refs []cache.ImmutableRef
+	for _, arch := range []string{"amd64", "arm64"} {
+		// the base image has files identical in both platforms that are
+		// kept in its layer
+		base := newTestRef(t, cm, nil, map[string]string{
+			"etc/arch":   arch,
+			"etc/shared": "base",
+		})
+		defer base.Release(ctx)
+		ref := newTestRef(t, cm, base, map[string]string{
+			"app/shared": "shared by all platforms",
+			"app/arch":   arch,
+		})
+		defer ref.Release(ctx)
+		refs = append(refs, ref)
+	}
+
+	out, groups, err := ic.dedupeLayers(ctx, nil, refs, []int{1, 1})
+	require.NoError(t, err)
+	require.Len(t, out, 2)
+	defer func() {
+		for _, ref := range out {
+			ref.Release(ctx)
+		}
+	}()
+
+	var commonID string
+	for i, ref := range out {
+		require.Equal(t, []layerGroup{{0, 1}, {1, 1}, {1, 2}}, groups[i])
+
+		chain := ref.LayerChain()
+		defer chain.Release(ctx)
+		require.Len(t, chain, 3)
+
+		orig := refs[i].LayerChain()
+		defer orig.Release(ctx)
+		require.Equal(t, orig[0].ID(), chain[0].ID())
+
+		if commonID == "" {
+			commonID = chain[1].ID()
+		}
+		require.Equal(t, commonID, chain[1].ID())
+
+		// the common layer has no parent and only the files added on top
+		// of the base image that are identical in both platforms
+		require.Equal(t, map[string]string{"app/shared": "shared by all platforms"}, readTestRef(t, chain[1]))
+
+		require.Equal(t, readTestRef(t, refs[i]), readTestRef(t, ref))
+	}
+
+	// nothing is shared on top of the base layers
+	_, groups, err = ic.dedupeLayers(ctx, nil, refs, []int{2, 2})
+	require.NoError(t, err)
+	require.Nil(t, groups)
+}
+
+func newTestRef(t *testing.T, cm cache.Manager, parent cache.ImmutableRef, files map[string]string) cache.ImmutableRef {
+	ctx := context.TODO()
+	mref, err := cm.New(ctx, parent, nil)
+	require.NoError(t, err)
+	m, err := mref.Mount(ctx, false, nil)
+	require.NoError(t, err)
+	lm := snapshot.LocalMounter(m)
+	root, err := lm.Mount()
+	require.NoError(t, err)
+	tm := time.Unix(1700000000, 0)
+	for p, dt := range files {
+		fp := filepath.Join(root, p)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		require.NoError(t, os.WriteFile(fp, []byte(dt), 0644))
+		require.NoError(t, os.Chtimes(fp, tm, tm))
+		require.NoError(t, os.Chtimes(filepath.Dir(fp), tm, tm))
+	}
+	require.NoError(t, lm.Unmount())
+	ref, err := mref.Commit(ctx)
+	require.NoError(t, err)
+	return ref
+}
+
+func readTestRef(t *testing.T, ref cache.ImmutableRef) map[string]string {
+	ctx := context.TODO()
+	m, err := ref.Mount(ctx, true, nil)
+	require.NoError(t, err)
+	lm := snapshot.LocalMounter(m)
+	root, err := lm.Mount()
+	require.NoError(t, err)
+	defer lm.Unmount()
+	files := map[string]string{}
+	require.NoError(t, filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		dt, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		files[rel] = string(dt)
+		return err
+	}))
+	return files
+}
+
+func newTestCacheManager(t *testing.T) cache.Manager {
+	tmpdir := t.TempDir()
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, snapshotter.Close())
+	})
+
+	store, err := local.NewStore(tmpdir)
+	require.NoError(t, err)
+
+	db, err := bolt.Open(filepath.Join(tmpdir, "containerdmeta.db"), 0644, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+
+	mdb := ctdmetadata.NewDB(db, store, map[string]snapshots.Snapshotter{
+		"native": snapshotter,
+	})
+
+	md, err := metadata.NewStore(filepath.Join(tmpdir, "metadata.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, md.Close())
+	})
+
+	lm := leaseutil.WithNamespace(ctdmetadata.NewLeaseManager(mdb), "buildkit")
+	c := mdb.ContentStore()
+	cm, err := cache.NewManager(cache.ManagerOpt{
+		Snapshotter:    snapshot.FromContainerdSnapshotter("native", containerdsnapshot.NSSnapshotter("buildkit", mdb.Snapshotter("native")), nil),
+		MetadataStore:  md,
+		LeaseManager:   lm,
+		ContentStore:   c,
+		Applier:        winlayers.NewFileSystemApplierWithWindows(c, apply.NewFileSystemApplier(c)),
+		Differ:         winlayers.NewWalkingDiffWithWindows(c, walking.NewWalkingDiff(c)),
+		GarbageCollect: mdb.GarbageCollect,
+		Root:           tmpdir,
+		MountPoolRoot:  filepath.Join(tmpdir, "cachemounts"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, cm.Close())
+	})
+	return cm
+}
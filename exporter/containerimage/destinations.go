@@ -0,0 +1,142 @@
+package containerimage
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/util/compression"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// destination is an additional registry the image is pushed to, with its
+// own registry and compression options.
+type destination struct {
+	id           string
+	names        []string
+	pushByDigest bool
+	insecure     bool
+	opts         ImageCommitOpts
+}
+
+// compressionKeys are the exporter options inherited by the destinations
+// that don't set their own compression.
+var compressionKeys = []exptypes.ImageExporterOptKey{
+	exptypes.OptKeyLayerCompression,
+	exptypes.OptKeyCompressionLevel,
+	exptypes.OptKeyForceCompression,
+}
+
+// parseDestinationKey splits a dest.<id>.<key> option into the destination
+// id and the option key.
+func parseDestinationKey(k string) (id, key string, ok bool) {
+	rest, ok := strings.CutPrefix(k, string(exptypes.OptKeyDestinationPrefix))
+	if !ok {
+		return "", "", false
+	}
+	id, key, ok = strings.Cut(rest, ".")
+	return id, key, ok && id != "" && key != ""
+}
+
+// loadDestinations returns the destinations configured with the options
+// in attrs, keyed by the destination id. The options not set for a
+// destination default to the options of the exporter.
+func (e *imageExporterInstance) loadDestinations(ctx context.Context, attrs map[string]map[string]string) ([]destination, error) {
+	out := make([]destination, 0, len(attrs))
+	for _, id := range slices.Sorted(maps.Keys(attrs)) {
+		d := destination{
+			id:           id,
+			pushByDigest: e.pushByDigest,
+			insecure:     e.insecure,
+			opts:         e.opts,
+		}
+		compAttrs := map[string]string{}
+		for _, k := range compressionKeys {
+			if v, ok := e.attrs[string(k)]; ok {
+				compAttrs[string(k)] = v
+			}
+		}
+		var ownCompression bool
+		for k, v := range attrs[id] {
+			var err error
+			switch exptypes.ImageExporterOptKey(k) {
+			case exptypes.OptKeyName:
+				for _, name := range strings.Split(v, ",") {
+					if name = strings.TrimSpace(name); name != "" {
+						d.names = append(d.names, name)
+					}
+				}
+			case exptypes.OptKeyPushByDigest:
+				err = parseBoolWithDefault(&d.pushByDigest, k, v, true)
+			case exptypes.OptKeyInsecure:
+				err = parseBoolWithDefault(&d.insecure, k, v, true)
+			case exptypes.OptKeyOCITypes:
+				err = parseBoolWithDefault(&d.opts.OCITypes, k, v, true)
+			case exptypes.OptKeyLayerCompression, exptypes.OptKeyCompressionLevel, exptypes.OptKeyForceCompression:
+				if !ownCompression {
+					clear(compAttrs)
+					ownCompression = true
+				}
+				compAttrs[k] = v
+			default:
+				err = errors.Errorf("unsupported option %s for destination %s", k, id)
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid options for destination %s", id)
+			}
+		}
+		if len(d.names) == 0 {
+			return nil, errors.Errorf("destination %s has no %s", id, exptypes.OptKeyName)
+		}
+		d.opts.ImageName = strings.Join(d.names, ",")
+
+		var err error
+		if d.opts.RefCfg.Compression, err = compression.ParseAttributes(compAttrs); err != nil {
+			return nil, errors.Wrapf(err, "invalid options for destination %s", id)
+		}
+		if d.opts.RefCfg.Compression.Type.OnlySupportOCITypes() {
+			d.opts.EnableOCITypes(ctx, d.opts.RefCfg.Compression.Type.String())
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// pushDestinations commits the image with the options of each destination
+// and pushes it, concurrently for all destinations. The opts are the commit
+// options of the exporter, with the annotations of the source.
+func (e *imageExporterInstance) pushDestinations(ctx context.Context, src *exporter.Source, sessionID string, inlineCache exptypes.InlineCache, opts ImageCommitOpts, signer *imageSigner) ([]exptypes.DestinationResult, error) {
+	results := make([]exptypes.DestinationResult, len(e.destinations))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, d := range e.destinations {
+		eg.Go(func() error {
+			dopts := d.opts
+			dopts.Annotations = opts.Annotations
+			desc, err := e.opt.ImageWriter.Commit(ctx, src, sessionID, inlineCache, &dopts)
+			if err != nil {
+				return errors.Wrapf(err, "failed to commit image for destination %s", d.id)
+			}
+			delete(desc.Annotations, exptypes.ExporterConfigDigestKey)
+			for _, name := range d.names {
+				if err := e.pushTarget(ctx, src, sessionID, name, *desc, &dopts, d.insecure, d.pushByDigest, signer); err != nil {
+					return err
+				}
+			}
+			results[i] = exptypes.DestinationResult{
+				ID:          d.id,
+				Names:       d.names,
+				Digest:      desc.Digest,
+				Compression: d.opts.RefCfg.Compression.Type.String(),
+			}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,103 @@
+package containerimage
+
+import (
+	"context"
+	"testing"
+
+	cacheconfig "github.com/moby/buildkit/cache/config"
+	"github.com/moby/buildkit/util/compression"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDestinationKey(t *testing.T) {
+	for _, tc := range []struct {
+		key     string
+		id, opt string
+		ok      bool
+	}{
+		{key: "dest.hub.name", id: "hub", opt: "name", ok: true},
+		{key: "dest.0.registry.insecure", id: "0", opt: "registry.insecure", ok: true},
+		{key: "dest.hub", ok: false},
+		{key: "dest..name", ok: false},
+		{key: "dest.hub.", ok: false},
+		{key: "name", ok: false},
+	} {
+		id, opt, ok := parseDestinationKey(tc.key)
+		require.Equal(t, tc.ok, ok, tc.key)
+		if ok {
+			require.Equal(t, tc.id, id, tc.key)
+			require.Equal(t, tc.opt, opt, tc.key)
+		}
+	}
+}
+
+func TestLoadDestinations(t *testing.T) {
+	e := &imageExporterInstance{
+		attrs: map[string]string{
+			"compression":       "gzip",
+			"compression-level": "9",
+		},
+		opts: ImageCommitOpts{
+			ImageName: "docker.io/library/app:latest",
+			RefCfg: cacheconfig.RefConfig{
+				Compression: compression.New(compression.Gzip).SetLevel(9),
+			},
+		},
+		insecure: true,
+	}
+
+	dests, err := e.loadDestinations(context.TODO(), map[string]map[string]string{
+		"internal": {
+			"name":              "registry.internal/app:1, registry.internal/app:latest",
+			"compression":       "zstd",
+			"force-compression": "true",
+		},
+		"hub": {
+			"name":              "docker.io/user/app:1",
+			"registry.insecure": "false",
+			"push-by-digest":    "",
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, dests, 2)
+
+	hub := dests[0]
+	require.Equal(t, "hub", hub.id)
+	require.Equal(t, []string{"docker.io/user/app:1"}, hub.names)
+	require.Equal(t, "docker.io/user/app:1", hub.opts.ImageName)
+	require.False(t, hub.insecure)
+	require.True(t, hub.pushByDigest)
+	require.Equal(t, compression.Gzip, hub.opts.RefCfg.Compression.Type)
+	require.NotNil(t, hub.opts.RefCfg.Compression.Level)
+	require.Equal(t, 9, *hub.opts.RefCfg.Compression.Level)
+	require.False(t, hub.opts.OCITypes)
+
+	internal := dests[1]
+	require.Equal(t, "internal", internal.id)
+	require.Equal(t, []string{"registry.internal/app:1", "registry.internal/app:latest"}, internal.names)
+	require.True(t, internal.insecure)
+	require.False(t, internal.pushByDigest)
+	require.Equal(t, compression.Zstd, internal.opts.RefCfg.Compression.Type)
+	require.True(t, internal.opts.RefCfg.Compression.Force)
+	require.Nil(t, internal.opts.RefCfg.Compression.Level)
+
+	// the exporter options are not changed
+	require.Equal(t, "docker.io/library/app:latest", e.opts.ImageName)
+	require.Equal(t, compression.Gzip, e.opts.RefCfg.Compression.Type)
+
+	_, err = e.loadDestinations(context.TODO(), map[string]map[string]string{
+		"hub": {"compression": "zstd"},
+	})
+	require.ErrorContains(t, err, "destination hub has no name")
+
+	_, err = e.loadDestinations(context.TODO(), map[string]map[string]string{
+		"hub": {"name": "docker.io/user/app:1", "unpack": "true"},
+	})
+	require.ErrorContains(t, err, "unsupported option unpack for destination hub")
+
+	dests, err = e.loadDestinations(context.TODO(), map[string]map[string]string{
+		"hub": {"name": "docker.io/user/app:1", "compression": "estargz"},
+	})
+	require.NoError(t, err)
+	require.True(t, dests[0].opts.OCITypes)
+}
@@ -52,6 +52,9 @@ type Opt struct {
 	Images         images.Store
 	RegistryHosts  docker.RegistryHosts
 	LeaseManager   leases.Manager
+	// SigningKeys are the PEM encoded private keys configured on the daemon
+	// that can be used for signing with sign-key=kms://<name>.
+	SigningKeys map[string][]byte
 }
 
 type imageExporter struct {
@@ -86,6 +89,7 @@ func (e *imageExporter) Resolve(ctx context.Context, id int, opt map[string]stri
 		return nil, err
 	}
 
+	destAttrs := map[string]map[string]string{}
 	for k, v := range opt {
 		switch exptypes.ImageExporterOptKey(k) {
 		case exptypes.OptKeyPush:
@@ -170,13 +174,69 @@ func (e *imageExporter) Resolve(ctx context.Context, id int, opt map[string]stri
 				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
 			}
 			i.nameCanonical = b
+		case exptypes.OptKeyAttestationReferrers:
+			if v == "" {
+				i.opts.AttestationReferrers = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.opts.AttestationReferrers = b
+		case exptypes.OptKeySign:
+			if v == "" {
+				i.sign = true
+				continue
+			}
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "non-bool value specified for %s", k)
+			}
+			i.sign = b
+		case exptypes.OptKeySignKey:
+			i.signKey = v
+		case exptypes.OptKeySignFormat:
+			i.signFormat = signFormat(v)
 		default:
+			if id, key, ok := parseDestinationKey(k); ok {
+				if destAttrs[id] == nil {
+					destAttrs[id] = map[string]string{}
+				}
+				destAttrs[id][key] = v
+				continue
+			}
 			if i.meta == nil {
 				i.meta = make(map[string][]byte)
 			}
 			i.meta[k] = []byte(v)
 		}
 	}
+	pushes := i.push || len(destAttrs) > 0
+	if i.opts.AttestationReferrers {
+		if !pushes {
+			return nil, errors.Errorf("%s requires %s", exptypes.OptKeyAttestationReferrers, exptypes.OptKeyPush)
+		}
+		i.opts.OCIArtifact = true
+		i.opts.EnableOCITypes(ctx, "attestation referrers")
+	}
+	if i.sign {
+		if !pushes {
+			return nil, errors.Errorf("%s requires %s", exptypes.OptKeySign, exptypes.OptKeyPush)
+		}
+		if i.signKey == "" {
+			return nil, errors.Errorf("%s requires %s", exptypes.OptKeySign, exptypes.OptKeySignKey)
+		}
+		if i.signFormat == "" {
+			i.signFormat = signFormatCosign
+		}
+		if err := i.signFormat.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if i.destinations, err = i.loadDestinations(ctx, destAttrs); err != nil {
+		return nil, err
+	}
 	return i, nil
 }
 
@@ -195,6 +255,10 @@ type imageExporterInstance struct {
 	nameCanonical        bool
 	danglingPrefix       string
 	danglingEmptyOnly    bool
+	sign                 bool
+	signKey              string
+	signFormat           signFormat
+	destinations         []destination
 	meta                 map[string][]byte
 }
 
@@ -269,6 +333,14 @@ func (e *imageExporterInstance) Export(ctx context.Context, src *exporter.Source
 		}
 	}
 
+	var signer *imageSigner
+	if e.sign && ((e.push && e.opts.ImageName != "") || len(e.destinations) > 0) {
+		signer, err = e.newImageSigner(ctx, sessionID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	if e.opts.ImageName != "" {
 		targetNames := strings.Split(e.opts.ImageName, ",")
 		for _, targetName := range targetNames {
@@ -354,22 +426,26 @@ func (e *imageExporterInstance) Export(ctx context.Context, src *exporter.Source
 				}
 			}
 			if e.push {
-				err = e.pushImage(ctx, src, sessionID, targetName, desc.Digest)
-				if err != nil {
-					var statusErr remoteserrors.ErrUnexpectedStatus
-					if errors.As(err, &statusErr) {
-						var dErr docker.Errors
-						if err1 := json.Unmarshal(statusErr.Body, &dErr); err1 == nil && len(dErr) > 0 {
-							err = &formattedDockerError{dErr: dErr}
-						}
-					}
-					return nil, nil, errors.Wrapf(err, "failed to push %v", targetName)
+				if err := e.pushTarget(ctx, src, sessionID, targetName, *desc, &opts, e.insecure, e.pushByDigest, signer); err != nil {
+					return nil, nil, err
 				}
 			}
 		}
 		resp[exptypes.ExporterImageNameKey] = e.opts.ImageName
 	}
 
+	if len(e.destinations) > 0 {
+		results, err := e.pushDestinations(ctx, src, sessionID, inlineCache, opts, signer)
+		if err != nil {
+			return nil, nil, err
+		}
+		dt, err := json.Marshal(results)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp[exptypes.ExporterImageDestinationsKey] = string(dt)
+	}
+
 	resp[exptypes.ExporterImageDigestKey] = desc.Digest.String()
 	if v, ok := desc.Annotations[exptypes.ExporterConfigDigestKey]; ok {
 		resp[exptypes.ExporterImageConfigDigestKey] = v
@@ -385,7 +461,34 @@ func (e *imageExporterInstance) Export(ctx context.Context, src *exporter.Source
 	return resp, nil, nil
 }
 
-func (e *imageExporterInstance) pushImage(ctx context.Context, src *exporter.Source, sessionID string, targetName string, dgst digest.Digest) error {
+// pushTarget pushes the image committed with opts to targetName, with the
+// attestations left out of the image as referrers and the signatures.
+func (e *imageExporterInstance) pushTarget(ctx context.Context, src *exporter.Source, sessionID string, targetName string, desc ocispecs.Descriptor, opts *ImageCommitOpts, insecure, pushByDigest bool, signer *imageSigner) error {
+	err := e.pushImage(ctx, src, sessionID, targetName, desc.Digest, opts.RefCfg, insecure, pushByDigest)
+	if err != nil {
+		var statusErr remoteserrors.ErrUnexpectedStatus
+		if errors.As(err, &statusErr) {
+			var dErr docker.Errors
+			if err1 := json.Unmarshal(statusErr.Body, &dErr); err1 == nil && len(dErr) > 0 {
+				err = &formattedDockerError{dErr: dErr}
+			}
+		}
+		return errors.Wrapf(err, "failed to push %v", targetName)
+	}
+	if len(opts.referrers) > 0 {
+		if err := push.PushReferrers(ctx, e.opt.SessionManager, sessionID, e.opt.ImageWriter.ContentStore(), opts.referrers, targetName, insecure, e.opt.RegistryHosts); err != nil {
+			return errors.Wrapf(err, "failed to push attestations for %v", targetName)
+		}
+	}
+	if signer != nil {
+		if err := e.signImage(ctx, signer, sessionID, targetName, desc, insecure); err != nil {
+			return errors.Wrapf(err, "failed to sign %v", targetName)
+		}
+	}
+	return nil
+}
+
+func (e *imageExporterInstance) pushImage(ctx context.Context, src *exporter.Source, sessionID string, targetName string, dgst digest.Digest, refCfg cacheconfig.RefConfig, insecure, pushByDigest bool) error {
 	var refs []cache.ImmutableRef
 	if src.Ref != nil {
 		refs = append(refs, src.Ref)
@@ -400,7 +503,7 @@ func (e *imageExporterInstance) pushImage(ctx context.Context, src *exporter.Sou
 	annotations := map[digest.Digest]map[string]string{}
 	mprovider := contentutil.NewMultiProvider(e.opt.ImageWriter.ContentStore())
 	for _, ref := range refs {
-		remotes, err := ref.GetRemotes(ctx, false, e.opts.RefCfg, false, session.NewGroup(sessionID))
+		remotes, err := ref.GetRemotes(ctx, false, refCfg, false, session.NewGroup(sessionID))
 		if err != nil {
 			return err
 		}
@@ -410,7 +513,7 @@ func (e *imageExporterInstance) pushImage(ctx context.Context, src *exporter.Sou
 			addAnnotations(annotations, desc)
 		}
 	}
-	return push.Push(ctx, e.opt.SessionManager, sessionID, mprovider, e.opt.ImageWriter.ContentStore(), dgst, targetName, e.insecure, e.opt.RegistryHosts, e.pushByDigest, annotations)
+	return push.Push(ctx, e.opt.SessionManager, sessionID, mprovider, e.opt.ImageWriter.ContentStore(), dgst, targetName, insecure, e.opt.RegistryHosts, pushByDigest, annotations)
 }
 
 func (e *imageExporterInstance) unpackImage(ctx context.Context, img images.Image, src *exporter.Source, s session.Group) (err0 error) {
@@ -53,6 +53,11 @@ var (
 	// Use OCI artifact format for the attestation manifest.
 	OptKeyOCIArtifact ImageExporterOptKey = "oci-artifact"
 
+	// Push attestation manifests as OCI referrers of the image manifests
+	// instead of adding them to the image index. Requires push.
+	// Value: bool <true|false>
+	OptKeyAttestationReferrers ImageExporterOptKey = "attestation-referrers"
+
 	// Force attestation to be attached.
 	// Value: bool <true|false>
 	OptKeyForceInlineAttestations ImageExporterOptKey = "attestation-inline"
@@ -69,8 +74,8 @@ var (
 	OptKeySourceDateEpoch ImageExporterOptKey = ImageExporterOptKey(commonexptypes.OptKeySourceDateEpoch)
 
 	// Compression type for newly created and cached layers.
-	// estargz should be used with OptKeyOCITypes set to true.
-	// Value: string <uncompressed|gzip|estargz|zstd>
+	// estargz and zstd:chunked should be used with OptKeyOCITypes set to true.
+	// Value: string <uncompressed|gzip|estargz|zstd|zstd:chunked>
 	OptKeyLayerCompression ImageExporterOptKey = "compression"
 
 	// Force compression on all (including existing) layers.
@@ -79,10 +84,55 @@ var (
 
 	// Compression level
 	// Value: int (0-9) for gzip and estargz
-	// Value: int (0-22) for zstd
+	// Value: int (0-22) for zstd and zstd:chunked
 	OptKeyCompressionLevel ImageExporterOptKey = "compression-level"
 
 	// Rewrite timestamps in layers to match SOURCE_DATE_EPOCH
 	// Value: bool <true|false>
 	OptKeyRewriteTimestamp ImageExporterOptKey = "rewrite-timestamp"
+
+	// Squash the layers of the image into a single layer.
+	// Value: bool <true|false>
+	OptKeySquash ImageExporterOptKey = "squash"
+
+	// Squash only the layers from the given index onward. "base" keeps the
+	// layers of the base image of the final stage. Implies squash.
+	// Value: string <base|int>
+	OptKeySquashFrom ImageExporterOptKey = "squash-from"
+
+	// Merge adjacent layers until the image has at most this many layers.
+	// Layers of the base image are kept.
+	// Value: int
+	OptKeyMaxLayers ImageExporterOptKey = "max-layers"
+
+	// Merge layers smaller than this many bytes into the layer above them.
+	// Layers of the base image are kept.
+	// Value: int
+	OptKeyMinLayerSize ImageExporterOptKey = "min-layer-size"
+
+	// Factor the files shared by all platforms of a multi-platform result
+	// into a common layer.
+	// Value: bool <true|false>
+	OptKeyDedupeLayers ImageExporterOptKey = "dedupe-layers"
+
+	// Sign the pushed manifests and index. Requires push.
+	// Value: bool <true|false>
+	OptKeySign ImageExporterOptKey = "sign"
+
+	// Private key used for signing. Either the ID of a session secret
+	// containing a PEM encoded private key, or kms://<name> for a signing key
+	// configured on the daemon.
+	// Value: string
+	OptKeySignKey ImageExporterOptKey = "sign-key"
+
+	// Format of the signatures.
+	// Value: string <cosign|notation>
+	OptKeySignFormat ImageExporterOptKey = "sign-format"
+
+	// Prefix of the options of an additional push destination, as
+	// dest.<id>.<key>. The keys name, push-by-digest, registry.insecure,
+	// oci-mediatypes, compression, compression-level and force-compression
+	// are supported, and default to the options of the exporter.
+	// Value: depends on the key
+	OptKeyDestinationPrefix ImageExporterOptKey = "dest."
 )
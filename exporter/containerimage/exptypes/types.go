@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/moby/buildkit/solver/result"
+	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -15,6 +16,7 @@ const (
 	ExporterImageConfigDigestKey = "containerimage.config.digest"
 	ExporterImageDescriptorKey   = "containerimage.descriptor"
 	ExporterImageBaseConfigKey   = "containerimage.base.config"
+	ExporterImageDestinationsKey = "containerimage.destinations"
 	ExporterPlatformsKey         = "refs.platforms"
 )
 
@@ -34,6 +36,16 @@ type Platform struct {
 	Platform ocispecs.Platform
 }
 
+// DestinationResult is the image pushed to an additional push destination
+// of the image exporter. The results are returned JSON encoded in
+// ExporterImageDestinationsKey.
+type DestinationResult struct {
+	ID          string        `json:"id"`
+	Names       []string      `json:"names"`
+	Digest      digest.Digest `json:"digest"`
+	Compression string        `json:"compression"`
+}
+
 type InlineCacheEntry struct {
 	Data []byte
 }
@@ -0,0 +1,271 @@
+package containerimage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/session"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// LayerGroupOpts controls how the layers of the exported ref are merged
+// into the layers of the image.
+type LayerGroupOpts struct {
+	// Squash merges the layers from SquashFrom onward into a single layer.
+	Squash bool
+	// SquashFrom is the index of the first squashed layer.
+	SquashFrom int
+	// SquashFromBase squashes the layers added on top of the base image
+	// instead of using SquashFrom.
+	SquashFromBase bool
+
+	// MaxLayers merges adjacent layers until the image has at most this
+	// many layers.
+	MaxLayers int
+	// MinLayerSize merges layers smaller than this many bytes into the
+	// layer above them.
+	MinLayerSize int64
+}
+
+func (o *LayerGroupOpts) load(k, v string) (bool, error) {
+	var err error
+	switch exptypes.ImageExporterOptKey(k) {
+	case exptypes.OptKeySquash:
+		err = parseBool(&o.Squash, k, v)
+	case exptypes.OptKeySquashFrom:
+		if v == "base" {
+			o.SquashFromBase = true
+			break
+		}
+		o.SquashFrom, err = strconv.Atoi(v)
+		if err == nil && o.SquashFrom < 0 {
+			err = errors.Errorf("negative value specified for %s", k)
+		}
+		err = errors.Wrapf(err, "invalid value specified for %s", k)
+	case exptypes.OptKeyMaxLayers:
+		o.MaxLayers, err = strconv.Atoi(v)
+		if err == nil && o.MaxLayers < 1 {
+			err = errors.Errorf("%s must be at least 1", k)
+		}
+		err = errors.Wrapf(err, "invalid value specified for %s", k)
+	case exptypes.OptKeyMinLayerSize:
+		o.MinLayerSize, err = strconv.ParseInt(v, 10, 64)
+		if err == nil && o.MinLayerSize < 0 {
+			err = errors.Errorf("negative value specified for %s", k)
+		}
+		err = errors.Wrapf(err, "invalid value specified for %s", k)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+func (o *LayerGroupOpts) validate() error {
+	if o.SquashFrom > 0 || o.SquashFromBase {
+		o.Squash = true
+	}
+	if o.Squash && (o.MaxLayers > 0 || o.MinLayerSize > 0) {
+		return errors.Errorf("%s cannot be used with %s or %s", exptypes.OptKeySquash, exptypes.OptKeyMaxLayers, exptypes.OptKeyMinLayerSize)
+	}
+	return nil
+}
+
+func (o *LayerGroupOpts) enabled() bool {
+	return o.Squash || o.MaxLayers > 0 || o.MinLayerSize > 0
+}
+
+// needsSizes returns true if the sizes of the layers are needed to group
+// them.
+func (o *LayerGroupOpts) needsSizes() bool {
+	return o.MaxLayers > 0 || o.MinLayerSize > 0
+}
+
+// layerGroup is a range [start, end) of layers merged into a single layer.
+type layerGroup struct {
+	start, end int
+}
+
+// groups returns the layer groups for a ref with layers of the given sizes,
+// of which baseLayers come from the base image. Nil is returned if no
+// layers need to be merged.
+func (o *LayerGroupOpts) groups(sizes []int64, baseLayers int) []layerGroup {
+	n := len(sizes)
+	keep := min(baseLayers, n)
+	if o.Squash && !o.SquashFromBase {
+		keep = min(o.SquashFrom, n)
+	}
+
+	groups := make([]layerGroup, 0, n)
+	for i := range keep {
+		groups = append(groups, layerGroup{start: i, end: i + 1})
+	}
+	switch {
+	case o.Squash:
+		if keep < n {
+			groups = append(groups, layerGroup{start: keep, end: n})
+		}
+	default:
+		start := keep
+		var size int64
+		for i := keep; i < n; i++ {
+			size += sizes[i]
+			if size >= o.MinLayerSize || i == n-1 {
+				groups = append(groups, layerGroup{start: start, end: i + 1})
+				start = i + 1
+				size = 0
+			}
+		}
+		for o.MaxLayers > 0 && len(groups) > o.MaxLayers && len(groups)-keep > 1 {
+			// merge the adjacent groups with the smallest combined size
+			best := -1
+			var bestSize int64
+			for i := keep; i < len(groups)-1; i++ {
+				var s int64
+				for _, size := range sizes[groups[i].start:groups[i+1].end] {
+					s += size
+				}
+				if best == -1 || s < bestSize {
+					best, bestSize = i, s
+				}
+			}
+			groups[best].end = groups[best+1].end
+			groups = append(groups[:best+1], groups[best+2:]...)
+		}
+	}
+
+	if len(groups) == n {
+		return nil
+	}
+	return groups
+}
+
+// groupLayers returns the ref with the layers of ref merged into the layer
+// groups to export instead of ref, and the groups. Nil groups are returned
+// if the layers are exported as they are. The returned ref must be released
+// if the groups are not nil.
+func (ic *ImageWriter) groupLayers(ctx context.Context, opts *ImageCommitOpts, s session.Group, ref cache.ImmutableRef, baseImg *dockerspec.DockerOCIImage) (cache.ImmutableRef, []layerGroup, error) {
+	if ref == nil || !opts.Layers.enabled() {
+		return ref, nil, nil
+	}
+	if ic.opt.CacheManager == nil {
+		return nil, nil, errors.New("layer grouping is not supported by this worker")
+	}
+
+	chain := ref.LayerChain()
+	defer chain.Release(context.WithoutCancel(ctx))
+
+	sizes := make([]int64, len(chain))
+	if opts.Layers.needsSizes() {
+		remotes, err := ic.exportLayers(ctx, opts.RefCfg, s, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(remotes[0].Descriptors) != len(chain) {
+			return nil, nil, errors.New("layer chain and descriptor list are not the same length")
+		}
+		for i, desc := range remotes[0].Descriptors {
+			sizes[i] = desc.Size
+		}
+	}
+	var baseLayers int
+	if baseImg != nil {
+		baseLayers = len(baseImg.RootFS.DiffIDs)
+	}
+	groups := opts.Layers.groups(sizes, baseLayers)
+	if groups == nil {
+		return ref, nil, nil
+	}
+
+	cm := ic.opt.CacheManager
+	var scratch cache.ImmutableRef
+	parents := make([]cache.ImmutableRef, 0, len(groups))
+	defer func() {
+		for _, p := range parents {
+			p.Release(context.WithoutCancel(ctx))
+		}
+		if scratch != nil {
+			scratch.Release(context.WithoutCancel(ctx))
+		}
+	}()
+	for _, g := range groups {
+		if g.start == 0 && g.end == 1 {
+			parents = append(parents, chain[0].Clone())
+			continue
+		}
+		var lower cache.ImmutableRef
+		if g.start > 0 {
+			lower = chain[g.start-1]
+		} else {
+			if scratch == nil {
+				mref, err := cm.New(ctx, nil, s, cache.WithDescription("scratch for layer grouping"))
+				if err != nil {
+					return nil, nil, err
+				}
+				scratch, err = mref.Commit(ctx)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			lower = scratch
+		}
+		diff, err := cm.Diff(ctx, lower, chain[g.end-1], nil, cache.NoDiffMerge,
+			cache.WithDescription(fmt.Sprintf("merged layers %d-%d", g.start, g.end-1)))
+		if err != nil {
+			return nil, nil, err
+		}
+		parents = append(parents, diff)
+	}
+	merged, err := cm.Merge(ctx, parents, nil, cache.WithDescription("grouped layers"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, groups, nil
+}
+
+// groupHistory marks the history entries of the layers merged into the
+// layer above them as empty, so that the history matches the layers after
+// grouping. Empty groups are layers with no matching layers in the ref, for
+// which a history entry is added.
+func groupHistory(ctx context.Context, history []ocispecs.History, ref cache.ImmutableRef, groups []layerGroup) []ocispecs.History {
+	layers := groups[len(groups)-1].end
+	refMeta := getRefMetadata(ref, layers)
+	history = completeHistory(ctx, history, refMeta, layers)
+
+	last := make(map[int]struct{}, len(groups))
+	var added []int
+	for _, g := range groups {
+		if g.start == g.end {
+			added = append(added, g.start)
+			continue
+		}
+		last[g.end-1] = struct{}{}
+	}
+	out := make([]ocispecs.History, 0, len(history)+len(added))
+	var layerIndex int
+	addLayers := func() {
+		for len(added) > 0 && added[0] == layerIndex {
+			out = append(out, ocispecs.History{
+				CreatedBy: "files shared by all platforms",
+				Comment:   "buildkit.exporter.image.v0",
+			})
+			added = added[1:]
+		}
+	}
+	for _, h := range history {
+		if !h.EmptyLayer {
+			addLayers()
+			if _, ok := last[layerIndex]; !ok {
+				h.EmptyLayer = true
+			}
+			layerIndex++
+		}
+		out = append(out, h)
+	}
+	addLayers()
+	return out
+}
@@ -0,0 +1,111 @@
+package containerimage
+
+import (
+	"context"
+	"testing"
+
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerGroups(t *testing.T) {
+	sizes := []int64{100, 10, 20, 5, 50, 1}
+
+	tcs := []struct {
+		name       string
+		opts       LayerGroupOpts
+		baseLayers int
+		expected   []layerGroup
+	}{
+		{
+			name: "disabled",
+		},
+		{
+			name:     "squash",
+			opts:     LayerGroupOpts{Squash: true},
+			expected: []layerGroup{{0, 6}},
+		},
+		{
+			name:     "squash from",
+			opts:     LayerGroupOpts{Squash: true, SquashFrom: 3},
+			expected: []layerGroup{{0, 1}, {1, 2}, {2, 3}, {3, 6}},
+		},
+		{
+			name:       "squash from base",
+			opts:       LayerGroupOpts{Squash: true, SquashFromBase: true},
+			baseLayers: 2,
+			expected:   []layerGroup{{0, 1}, {1, 2}, {2, 6}},
+		},
+		{
+			name: "squash top layer only",
+			opts: LayerGroupOpts{Squash: true, SquashFrom: 5},
+		},
+		{
+			name:     "max layers",
+			opts:     LayerGroupOpts{MaxLayers: 4},
+			expected: []layerGroup{{0, 1}, {1, 4}, {4, 5}, {5, 6}},
+		},
+		{
+			name:       "max layers keeps base",
+			opts:       LayerGroupOpts{MaxLayers: 1},
+			baseLayers: 2,
+			expected:   []layerGroup{{0, 1}, {1, 2}, {2, 6}},
+		},
+		{
+			name:     "min layer size",
+			opts:     LayerGroupOpts{MinLayerSize: 25},
+			expected: []layerGroup{{0, 1}, {1, 3}, {3, 5}, {5, 6}},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.opts.groups(sizes, tc.baseLayers))
+		})
+	}
+}
+
+func TestLayerGroupOptsLoad(t *testing.T) {
+	var c ImageCommitOpts
+	_, err := c.Load(context.TODO(), map[string]string{"squash-from": "base"})
+	require.NoError(t, err)
+	require.True(t, c.Layers.Squash)
+	require.True(t, c.Layers.SquashFromBase)
+
+	c = ImageCommitOpts{}
+	_, err = c.Load(context.TODO(), map[string]string{"squash": "true", "max-layers": "3"})
+	require.ErrorContains(t, err, "cannot be used with")
+
+	c = ImageCommitOpts{}
+	_, err = c.Load(context.TODO(), map[string]string{"max-layers": "0"})
+	require.ErrorContains(t, err, "must be at least 1")
+}
+
+func TestGroupHistory(t *testing.T) {
+	history := []ocispecs.History{
+		{CreatedBy: "base"},
+		{CreatedBy: "ENV foo=bar", EmptyLayer: true},
+		{CreatedBy: "RUN a"},
+		{CreatedBy: "RUN b"},
+	}
+	history = groupHistory(context.TODO(), history, nil, []layerGroup{{0, 1}, {1, 4}})
+	require.Len(t, history, 5)
+	var empty []bool
+	for _, h := range history {
+		empty = append(empty, h.EmptyLayer)
+	}
+	require.Equal(t, []bool{false, true, true, true, false}, empty)
+	require.Equal(t, "buildkit.exporter.image.v0", history[4].Comment)
+}
+
+func TestGroupHistoryAddedLayer(t *testing.T) {
+	history := []ocispecs.History{
+		{CreatedBy: "base"},
+		{CreatedBy: "RUN a"},
+	}
+	history = groupHistory(context.TODO(), history, nil, []layerGroup{{0, 0}, {0, 2}})
+	require.Len(t, history, 3)
+	require.Equal(t, "files shared by all platforms", history[0].CreatedBy)
+	require.False(t, history[0].EmptyLayer)
+	require.True(t, history[1].EmptyLayer)
+	require.False(t, history[2].EmptyLayer)
+}
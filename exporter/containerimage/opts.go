@@ -10,6 +10,7 @@ import (
 	"github.com/moby/buildkit/exporter/util/epoch"
 	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/compression"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 )
 
@@ -23,6 +24,13 @@ type ImageCommitOpts struct {
 
 	ForceInlineAttestations bool // force inline attestations to be attached
 	RewriteTimestamp        bool // rewrite timestamps in layers to match the epoch
+	AttestationReferrers    bool // keep attestation manifests out of the index, to be pushed as referrers
+
+	Layers       LayerGroupOpts
+	DedupeLayers bool // factor the files shared by all platforms into a common layer
+
+	// referrers are the attestation manifests left out of the index by Commit
+	referrers []ocispecs.Descriptor
 }
 
 func (c *ImageCommitOpts) Load(ctx context.Context, opt map[string]string) (map[string]string, error) {
@@ -58,14 +66,25 @@ func (c *ImageCommitOpts) Load(ctx context.Context, opt map[string]string) (map[
 			err = parseBool(&c.RefCfg.PreferNonDistributable, k, v)
 		case exptypes.OptKeyRewriteTimestamp:
 			err = parseBool(&c.RewriteTimestamp, k, v)
+		case exptypes.OptKeyDedupeLayers:
+			err = parseBool(&c.DedupeLayers, k, v)
 		default:
-			rest[k] = v
+			var ok bool
+			if ok, err = c.Layers.load(k, v); !ok {
+				rest[k] = v
+			}
 		}
 
 		if err != nil {
 			return nil, err
 		}
 	}
+	if err := c.Layers.validate(); err != nil {
+		return nil, err
+	}
+	if c.DedupeLayers && c.Layers.enabled() {
+		return nil, errors.Errorf("%s cannot be used with layer grouping options", exptypes.OptKeyDedupeLayers)
+	}
 
 	if c.RefCfg.Compression.Type.OnlySupportOCITypes() {
 		c.EnableOCITypes(ctx, c.RefCfg.Compression.Type.String())
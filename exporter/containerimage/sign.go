@@ -0,0 +1,458 @@
+package containerimage
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/distribution/reference"
+	"github.com/moby/buildkit/session/secrets"
+	"github.com/moby/buildkit/util/attestation"
+	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/util/push"
+	"github.com/moby/buildkit/util/signutil"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+type signFormat string
+
+const (
+	signFormatCosign   signFormat = "cosign"
+	signFormatNotation signFormat = "notation"
+)
+
+func (f signFormat) validate() error {
+	switch f {
+	case signFormatCosign, signFormatNotation:
+		return nil
+	default:
+		return errors.Errorf("unsupported signature format %q", f)
+	}
+}
+
+const (
+	// kmsKeyPrefix selects a signing key configured on the daemon instead of
+	// a session secret.
+	kmsKeyPrefix = "kms://"
+
+	cosignSignatureArtifactType    = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	cosignSimpleSigningMediaType   = "application/vnd.dev.cosign.simplesigning.v1+json"
+	cosignSignatureAnnotation      = "dev.cosignproject.cosign/signature"
+	cosignSimpleSigningPayloadType = "cosign container image signature"
+
+	notationSignatureArtifactType = "application/vnd.cncf.notary.signature"
+	notationJWSMediaType          = "application/jose+json"
+	notationPayloadContentType    = "application/vnd.cncf.notary.payload.v1+json"
+	notationThumbprintAnnotation  = "io.cncf.notary.x509chain.thumbprint#S256"
+	notationSigningScheme         = "notary.x509"
+)
+
+// imageSigner signs the manifests of pushed images.
+type imageSigner struct {
+	key    crypto.Signer
+	certs  []*x509.Certificate
+	format signFormat
+	// signingTime is recorded in notation signatures
+	signingTime time.Time
+}
+
+func (e *imageExporterInstance) newImageSigner(ctx context.Context, sessionID string) (*imageSigner, error) {
+	dt, err := e.loadSigningKey(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newImageSigner(dt, e.signFormat)
+	if err != nil {
+		return nil, err
+	}
+	// the signing time is a claim of the signer and is not affected by
+	// SOURCE_DATE_EPOCH
+	s.signingTime = time.Now().UTC()
+	return s, nil
+}
+
+// loadSigningKey returns the PEM encoded signing key from the session secret
+// or the keys configured on the daemon.
+func (e *imageExporterInstance) loadSigningKey(ctx context.Context, sessionID string) ([]byte, error) {
+	if name, ok := strings.CutPrefix(e.signKey, kmsKeyPrefix); ok {
+		dt, ok := e.opt.SigningKeys[name]
+		if !ok {
+			return nil, errors.Errorf("signing key %q is not configured on the daemon", name)
+		}
+		return dt, nil
+	}
+
+	timeoutCtx, cancel := context.WithTimeoutCause(ctx, 5*time.Second, errors.WithStack(context.DeadlineExceeded))
+	defer cancel()
+
+	caller, err := e.opt.SessionManager.Get(timeoutCtx, sessionID, false)
+	if err != nil {
+		return nil, err
+	}
+	dt, err := secrets.GetSecret(ctx, caller, e.signKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load signing key")
+	}
+	return dt, nil
+}
+
+// newImageSigner parses the PEM encoded private key and the optional
+// certificate chain for the key.
+func newImageSigner(dt []byte, format signFormat) (*imageSigner, error) {
+	key, certs, err := signutil.ParsePrivateKey(dt)
+	if err != nil {
+		return nil, err
+	}
+	s := &imageSigner{key: key, certs: certs, format: format}
+	if format == signFormatNotation {
+		if len(s.certs) == 0 {
+			return nil, errors.New("notation signatures require a certificate for the signing key")
+		}
+		if _, err := s.notationAlgorithm(); err != nil {
+			return nil, err
+		}
+		pub, ok := s.certs[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(s.key.Public()) {
+			return nil, errors.New("certificate does not match the signing key")
+		}
+	}
+	return s, nil
+}
+
+// signSubjects returns the manifests to sign: the pushed manifest or index,
+// and the image manifests of an index.
+func signSubjects(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor) ([]ocispecs.Descriptor, error) {
+	subjects := []ocispecs.Descriptor{{
+		MediaType: desc.MediaType,
+		Digest:    desc.Digest,
+		Size:      desc.Size,
+	}}
+	if !images.IsIndexType(desc.MediaType) {
+		return subjects, nil
+	}
+	dt, err := content.ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return nil, err
+	}
+	var idx ocispecs.Index
+	if err := json.Unmarshal(dt, &idx); err != nil {
+		return nil, errors.Wrap(err, "failed to parse index")
+	}
+	for _, m := range idx.Manifests {
+		if m.Annotations[attestation.DockerAnnotationReferenceType] == attestation.DockerAnnotationReferenceTypeDefault {
+			continue
+		}
+		subjects = append(subjects, ocispecs.Descriptor{
+			MediaType: m.MediaType,
+			Digest:    m.Digest,
+			Size:      m.Size,
+		})
+	}
+	return subjects, nil
+}
+
+// signImage signs the pushed image and pushes the signatures to the
+// repository of the image. The signature manifests refer to the signed
+// manifests with their subject field.
+func (e *imageExporterInstance) signImage(ctx context.Context, s *imageSigner, sessionID string, targetName string, desc ocispecs.Descriptor, insecure bool) error {
+	parsed, err := reference.ParseNormalizedNamed(targetName)
+	if err != nil {
+		return err
+	}
+	repo := parsed.Name()
+
+	store := e.opt.ImageWriter.ContentStore()
+	subjects, err := signSubjects(ctx, store, desc)
+	if err != nil {
+		return err
+	}
+
+	done := progress.OneOff(ctx, fmt.Sprintf("signing %d manifests for %s", len(subjects), targetName))
+	var mfsts []ocispecs.Descriptor
+	for _, subject := range subjects {
+		mfst, blobs, err := s.signatureManifest(repo, subject)
+		if err != nil {
+			return done(err)
+		}
+		mfstDesc, err := writeSignatureManifest(ctx, store, mfst, blobs)
+		if err != nil {
+			return done(err)
+		}
+		mfsts = append(mfsts, mfstDesc)
+	}
+	done(nil)
+
+	if err := push.PushReferrers(ctx, e.opt.SessionManager, sessionID, store, mfsts, repo, insecure, e.opt.RegistryHosts); err != nil {
+		return err
+	}
+	if s.format == signFormatCosign {
+		// cosign looks up signatures by tag unless it is configured to use
+		// the referrers API. The signature is added to the signatures
+		// already in the tag, as cosign does.
+		for i, mfstDesc := range mfsts {
+			ref := repo + ":" + cosignSignatureTag(subjects[i].Digest)
+			if err := push.AppendLayers(ctx, e.opt.SessionManager, sessionID, store, mfstDesc.Digest, ref, insecure, e.opt.RegistryHosts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func cosignSignatureTag(dgst digest.Digest) string {
+	return dgst.Algorithm().String() + "-" + dgst.Encoded() + ".sig"
+}
+
+// signatureManifest returns the manifest and the blobs of the signature for
+// the subject.
+func (s *imageSigner) signatureManifest(repo string, subject ocispecs.Descriptor) (ocispecs.Manifest, map[digest.Digest][]byte, error) {
+	mfst := ocispecs.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispecs.MediaTypeImageManifest,
+		Config:    ocispecs.DescriptorEmptyJSON,
+		Subject:   &subject,
+	}
+	blobs := map[digest.Digest][]byte{
+		ocispecs.DescriptorEmptyJSON.Digest: ocispecs.DescriptorEmptyJSON.Data,
+	}
+
+	var (
+		layer     ocispecs.Descriptor
+		dt        []byte
+		err       error
+		mediaType string
+	)
+	switch s.format {
+	case signFormatNotation:
+		mfst.ArtifactType = notationSignatureArtifactType
+		mediaType = notationJWSMediaType
+		dt, err = s.notationEnvelope(subject)
+		if err != nil {
+			return ocispecs.Manifest{}, nil, err
+		}
+		thumbprints := make([]string, len(s.certs))
+		for i, c := range s.certs {
+			sum := sha256.Sum256(c.Raw)
+			thumbprints[i] = hex.EncodeToString(sum[:])
+		}
+		tdt, err := json.Marshal(thumbprints)
+		if err != nil {
+			return ocispecs.Manifest{}, nil, err
+		}
+		mfst.Annotations = map[string]string{
+			notationThumbprintAnnotation: string(tdt),
+		}
+	default:
+		mfst.ArtifactType = cosignSignatureArtifactType
+		mediaType = cosignSimpleSigningMediaType
+		dt, err = json.Marshal(newSimpleSigningPayload(repo, subject.Digest))
+		if err != nil {
+			return ocispecs.Manifest{}, nil, err
+		}
+		sig, err := s.sign(dt)
+		if err != nil {
+			return ocispecs.Manifest{}, nil, err
+		}
+		layer.Annotations = map[string]string{
+			cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+		}
+	}
+	layer.MediaType = mediaType
+	layer.Digest = digest.FromBytes(dt)
+	layer.Size = int64(len(dt))
+	blobs[layer.Digest] = dt
+	mfst.Layers = []ocispecs.Descriptor{layer}
+	return mfst, blobs, nil
+}
+
+func writeSignatureManifest(ctx context.Context, store content.Store, mfst ocispecs.Manifest, blobs map[digest.Digest][]byte) (ocispecs.Descriptor, error) {
+	for dgst, dt := range blobs {
+		desc := ocispecs.Descriptor{Digest: dgst, Size: int64(len(dt))}
+		if err := content.WriteBlob(ctx, store, dgst.String(), bytes.NewReader(dt), desc); err != nil {
+			return ocispecs.Descriptor{}, errors.Wrapf(err, "error writing signature blob %s", dgst)
+		}
+	}
+
+	dt, err := json.MarshalIndent(mfst, "", "  ")
+	if err != nil {
+		return ocispecs.Descriptor{}, errors.Wrap(err, "failed to marshal signature manifest")
+	}
+	desc := ocispecs.Descriptor{
+		MediaType:    mfst.MediaType,
+		ArtifactType: mfst.ArtifactType,
+		Digest:       digest.FromBytes(dt),
+		Size:         int64(len(dt)),
+	}
+	labels := map[string]string{}
+	for i, l := range append([]ocispecs.Descriptor{mfst.Config}, mfst.Layers...) {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i)] = l.Digest.String()
+	}
+	if err := content.WriteBlob(ctx, store, desc.Digest.String(), bytes.NewReader(dt), desc, content.WithLabels(labels)); err != nil {
+		return ocispecs.Descriptor{}, errors.Wrapf(err, "error writing signature manifest %s", desc.Digest)
+	}
+	return desc, nil
+}
+
+// simpleSigningPayload is the payload signed by cosign.
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]any `json:"optional"`
+}
+
+func newSimpleSigningPayload(repo string, dgst digest.Digest) simpleSigningPayload {
+	var p simpleSigningPayload
+	p.Critical.Identity.DockerReference = repo
+	p.Critical.Image.DockerManifestDigest = dgst.String()
+	p.Critical.Type = cosignSimpleSigningPayloadType
+	return p
+}
+
+// sign signs the data the same way as cosign.
+func (s *imageSigner) sign(data []byte) ([]byte, error) {
+	return signutil.Sign(s.key, data)
+}
+
+type notationHeader struct {
+	Algorithm     string   `json:"alg"`
+	ContentType   string   `json:"cty"`
+	Critical      []string `json:"crit"`
+	SigningScheme string   `json:"io.cncf.notary.signingScheme"`
+	SigningTime   string   `json:"io.cncf.notary.signingTime"`
+}
+
+type notationEnvelope struct {
+	Payload   string `json:"payload"`
+	Protected string `json:"protected"`
+	Header    struct {
+		CertChain    [][]byte `json:"x5c"`
+		SigningAgent string   `json:"io.cncf.notary.signingAgent,omitempty"`
+	} `json:"header"`
+	Signature string `json:"signature"`
+}
+
+// notationAlgorithm returns the JWS algorithm for the key as required by the
+// notary project signature specification.
+func (s *imageSigner) notationAlgorithm() (string, error) {
+	switch pub := s.key.Public().(type) {
+	case *rsa.PublicKey:
+		switch pub.N.BitLen() {
+		case 2048:
+			return "PS256", nil
+		case 3072:
+			return "PS384", nil
+		case 4096:
+			return "PS512", nil
+		}
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+	}
+	return "", errors.Errorf("unsupported key type %T for notation signatures", s.key.Public())
+}
+
+// notationEnvelope returns the JWS envelope of a notation signature for the
+// subject.
+func (s *imageSigner) notationEnvelope(subject ocispecs.Descriptor) ([]byte, error) {
+	alg, err := s.notationAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := json.Marshal(notationHeader{
+		Algorithm:     alg,
+		ContentType:   notationPayloadContentType,
+		Critical:      []string{"io.cncf.notary.signingScheme"},
+		SigningScheme: notationSigningScheme,
+		SigningTime:   s.signingTime.Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(struct {
+		TargetArtifact ocispecs.Descriptor `json:"targetArtifact"`
+	}{subject})
+	if err != nil {
+		return nil, err
+	}
+
+	var env notationEnvelope
+	env.Protected = base64.RawURLEncoding.EncodeToString(hdr)
+	env.Payload = base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := s.signJWS(alg, []byte(env.Protected+"."+env.Payload))
+	if err != nil {
+		return nil, err
+	}
+	env.Signature = base64.RawURLEncoding.EncodeToString(sig)
+	for _, c := range s.certs {
+		env.Header.CertChain = append(env.Header.CertChain, c.Raw)
+	}
+	env.Header.SigningAgent = "buildkit"
+	return json.Marshal(env)
+}
+
+func (s *imageSigner) signJWS(alg string, data []byte) ([]byte, error) {
+	var h crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	default:
+		h = crypto.SHA512
+	}
+	hasher := h.New()
+	hasher.Write(data)
+	sum := hasher.Sum(nil)
+
+	if strings.HasPrefix(alg, "PS") {
+		return s.key.Sign(rand.Reader, sum, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h})
+	}
+	sig, err := s.key.Sign(rand.Reader, sum, h)
+	if err != nil {
+		return nil, err
+	}
+	// JWS uses the fixed size R || S encoding for ECDSA signatures
+	var esig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sig, &esig); err != nil {
+		return nil, errors.Wrap(err, "invalid ECDSA signature")
+	}
+	size := (s.key.Public().(*ecdsa.PublicKey).Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	esig.R.FillBytes(out[:size])
+	esig.S.FillBytes(out[size:])
+	return out, nil
+}
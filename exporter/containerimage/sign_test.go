@@ -0,0 +1,107 @@
+package containerimage
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func testSigningKey(t *testing.T, withCert bool) (*ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	dt, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	out := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: dt})
+	if withCert {
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "buildkit"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		dt, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+		require.NoError(t, err)
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: dt})...)
+	}
+	return key, out
+}
+
+func TestSignCosign(t *testing.T) {
+	key, dt := testSigningKey(t, false)
+	s, err := newImageSigner(dt, signFormatCosign)
+	require.NoError(t, err)
+
+	subject := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageManifest, Digest: digest.FromString("manifest"), Size: 8}
+	mfst, blobs, err := s.signatureManifest("docker.io/library/alpine", subject)
+	require.NoError(t, err)
+	require.Equal(t, cosignSignatureArtifactType, mfst.ArtifactType)
+	require.Equal(t, &subject, mfst.Subject)
+	require.Len(t, mfst.Layers, 1)
+
+	payload := blobs[mfst.Layers[0].Digest]
+	var p simpleSigningPayload
+	require.NoError(t, json.Unmarshal(payload, &p))
+	require.Equal(t, subject.Digest.String(), p.Critical.Image.DockerManifestDigest)
+	require.Equal(t, "docker.io/library/alpine", p.Critical.Identity.DockerReference)
+
+	sig, err := base64.StdEncoding.DecodeString(mfst.Layers[0].Annotations[cosignSignatureAnnotation])
+	require.NoError(t, err)
+	sum := sha256.Sum256(payload)
+	require.True(t, ecdsa.VerifyASN1(&key.PublicKey, sum[:], sig))
+}
+
+func TestSignNotation(t *testing.T) {
+	_, dt := testSigningKey(t, false)
+	_, err := newImageSigner(dt, signFormatNotation)
+	require.ErrorContains(t, err, "require a certificate")
+
+	key, dt := testSigningKey(t, true)
+	s, err := newImageSigner(dt, signFormatNotation)
+	require.NoError(t, err)
+
+	subject := ocispecs.Descriptor{MediaType: ocispecs.MediaTypeImageIndex, Digest: digest.FromString("index"), Size: 5}
+	mfst, blobs, err := s.signatureManifest("docker.io/library/alpine", subject)
+	require.NoError(t, err)
+	require.Equal(t, notationSignatureArtifactType, mfst.ArtifactType)
+	require.Equal(t, notationJWSMediaType, mfst.Layers[0].MediaType)
+	require.Contains(t, mfst.Annotations, notationThumbprintAnnotation)
+
+	var env notationEnvelope
+	require.NoError(t, json.Unmarshal(blobs[mfst.Layers[0].Digest], &env))
+	require.Len(t, env.Header.CertChain, 1)
+
+	hdrDt, err := base64.RawURLEncoding.DecodeString(env.Protected)
+	require.NoError(t, err)
+	var hdr notationHeader
+	require.NoError(t, json.Unmarshal(hdrDt, &hdr))
+	require.Equal(t, "ES256", hdr.Algorithm)
+	require.Equal(t, notationPayloadContentType, hdr.ContentType)
+
+	payloadDt, err := base64.RawURLEncoding.DecodeString(env.Payload)
+	require.NoError(t, err)
+	var payload struct {
+		TargetArtifact ocispecs.Descriptor `json:"targetArtifact"`
+	}
+	require.NoError(t, json.Unmarshal(payloadDt, &payload))
+	require.Equal(t, subject, payload.TargetArtifact)
+
+	sig, err := base64.RawURLEncoding.DecodeString(env.Signature)
+	require.NoError(t, err)
+	require.Len(t, sig, 64)
+	sum := sha256.Sum256([]byte(env.Protected + "." + env.Payload))
+	r, ss := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	require.True(t, ecdsa.Verify(&key.PublicKey, sum[:], r, ss))
+}
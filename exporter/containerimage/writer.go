@@ -53,6 +53,9 @@ type WriterOpt struct {
 	ContentStore content.Store
 	Applier      diff.Applier
 	Differ       diff.Comparer
+	CacheManager cache.Manager
+	// AttestationSigner signs the attestations that request a signature.
+	AttestationSigner *attestation.Signer
 }
 
 func NewImageWriter(opt WriterOpt) (*ImageWriter, error) {
@@ -128,17 +131,20 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp *exporter.Source, session
 			ref = inp.Ref
 		}
 		config := exptypes.ParseKey(inp.Metadata, exptypes.ExporterImageConfigKey, p)
-		baseImgConfig := exptypes.ParseKey(inp.Metadata, exptypes.ExporterImageBaseConfigKey, p)
-		var baseImg *dockerspec.DockerOCIImage
-		if len(baseImgConfig) > 0 {
-			var baseImgX dockerspec.DockerOCIImage
-			if err := json.Unmarshal(baseImgConfig, &baseImgX); err != nil {
-				return nil, errors.Wrap(err, "failed to unmarshal base image config")
-			}
-			baseImg = &baseImgX
+		baseImg, err := parseBaseImageConfig(inp.Metadata, p)
+		if err != nil {
+			return nil, err
+		}
+
+		layerRef, groups, err := ic.groupLayers(ctx, opts, session.NewGroup(sessionID), ref, baseImg)
+		if err != nil {
+			return nil, err
+		}
+		if groups != nil {
+			defer layerRef.Release(context.WithoutCancel(ctx))
 		}
 
-		remotes, err := ic.exportLayers(ctx, opts.RefCfg, session.NewGroup(sessionID), ref)
+		remotes, err := ic.exportLayers(ctx, opts.RefCfg, session.NewGroup(sessionID), layerRef)
 		if err != nil {
 			return nil, err
 		}
@@ -170,7 +176,7 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp *exporter.Source, session
 			}
 		}
 
-		mfstDesc, configDesc, err := ic.commitDistributionManifest(ctx, opts, ref, config, remote, annotations, inlineCacheEntry, opts.Epoch, session.NewGroup(sessionID), baseImg)
+		mfstDesc, configDesc, err := ic.commitDistributionManifest(ctx, opts, ref, groups, config, remote, annotations, inlineCacheEntry, opts.Epoch, session.NewGroup(sessionID), baseImg)
 		if err != nil {
 			return nil, err
 		}
@@ -191,13 +197,43 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp *exporter.Source, session
 
 	refs := make([]cache.ImmutableRef, 0, len(inp.Refs))
 	remotesMap := make(map[string]int, len(inp.Refs))
+	layerGroups := make(map[string][]layerGroup, len(inp.Refs))
+	baseLayers := make([]int, 0, len(inp.Refs))
 	for _, p := range ps.Platforms {
 		r, ok := inp.FindRef(p.ID)
 		if !ok {
 			return nil, errors.Errorf("failed to find ref for ID %s", p.ID)
 		}
+		baseImg, err := parseBaseImageConfig(inp.Metadata, &p)
+		if err != nil {
+			return nil, err
+		}
+		layerRef, groups, err := ic.groupLayers(ctx, opts, session.NewGroup(sessionID), r, baseImg)
+		if err != nil {
+			return nil, err
+		}
+		if groups != nil {
+			defer layerRef.Release(context.WithoutCancel(ctx))
+			layerGroups[p.ID] = groups
+		}
 		remotesMap[p.ID] = len(refs)
-		refs = append(refs, r)
+		refs = append(refs, layerRef)
+		if baseImg != nil {
+			baseLayers = append(baseLayers, len(baseImg.RootFS.DiffIDs))
+		} else {
+			baseLayers = append(baseLayers, 0)
+		}
+	}
+	if opts.DedupeLayers {
+		deduped, groups, err := ic.dedupeLayers(ctx, session.NewGroup(sessionID), refs, baseLayers)
+		if err != nil {
+			return nil, err
+		}
+		for i, ref := range deduped {
+			defer ref.Release(context.WithoutCancel(ctx))
+			refs[i] = ref
+			layerGroups[ps.Platforms[i].ID] = groups[i]
+		}
 	}
 
 	remotes, err := ic.exportLayers(ctx, opts.RefCfg, session.NewGroup(sessionID), refs...)
@@ -235,14 +271,9 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp *exporter.Source, session
 			return nil, errors.Errorf("failed to find ref for ID %s", p.ID)
 		}
 		config := exptypes.ParseKey(inp.Metadata, exptypes.ExporterImageConfigKey, &p)
-		baseImgConfig := exptypes.ParseKey(inp.Metadata, exptypes.ExporterImageBaseConfigKey, &p)
-		var baseImg *dockerspec.DockerOCIImage
-		if len(baseImgConfig) > 0 {
-			var baseImgX dockerspec.DockerOCIImage
-			if err := json.Unmarshal(baseImgConfig, &baseImgX); err != nil {
-				return nil, errors.Wrap(err, "failed to unmarshal base image config")
-			}
-			baseImg = &baseImgX
+		baseImg, err := parseBaseImageConfig(inp.Metadata, &p)
+		if err != nil {
+			return nil, err
 		}
 
 		remote := &remotes[remotesMap[p.ID]]
@@ -263,7 +294,7 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp *exporter.Source, session
 			inlineCacheEntry, _ = inlineCacheResult.FindRef(p.ID)
 		}
 
-		desc, _, err := ic.commitDistributionManifest(ctx, opts, r, config, remote, opts.Annotations.Platform(&p.Platform), inlineCacheEntry, opts.Epoch, session.NewGroup(sessionID), baseImg)
+		desc, _, err := ic.commitDistributionManifest(ctx, opts, r, layerGroups[p.ID], config, remote, opts.Annotations.Platform(&p.Platform), inlineCacheEntry, opts.Epoch, session.NewGroup(sessionID), baseImg)
 		if err != nil {
 			return nil, err
 		}
@@ -283,7 +314,7 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp *exporter.Source, session
 			for i, att := range attestations {
 				i, att := i, att
 				eg.Go(func() error {
-					att, err := supplementSBOM(ctx2, session.NewGroup(sessionID), r, remote, att)
+					att, err := supplementSBOM(ctx2, session.NewGroup(sessionID), refs[remotesMap[p.ID]], remote, att)
 					if err != nil {
 						return err
 					}
@@ -313,8 +344,12 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp *exporter.Source, session
 			if err != nil {
 				return nil, err
 			}
+			envelopes, err := attestation.SignStatements(ctx, ic.opt.AttestationSigner, attestations, stmts)
+			if err != nil {
+				return nil, err
+			}
 
-			desc, err := ic.commitAttestationsManifest(ctx, opts, *desc, stmts, opts.OCIArtifact)
+			desc, err := ic.commitAttestationsManifest(ctx, opts, *desc, stmts, envelopes, opts.OCIArtifact)
 			if err != nil {
 				return nil, err
 			}
@@ -324,8 +359,12 @@ func (ic *ImageWriter) Commit(ctx context.Context, inp *exporter.Source, session
 	}
 
 	for i, mfst := range attestationManifests {
-		idx.Manifests = append(idx.Manifests, mfst)
 		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", len(ps.Platforms)+i)] = mfst.Digest.String()
+		if opts.AttestationReferrers {
+			opts.referrers = append(opts.referrers, mfst)
+			continue
+		}
+		idx.Manifests = append(idx.Manifests, mfst)
 	}
 
 	idxBytes, err := json.MarshalIndent(idx, "", "  ")
@@ -459,7 +498,7 @@ func (ic *ImageWriter) rewriteRemoteWithEpoch(ctx context.Context, opts *ImageCo
 	}, nil
 }
 
-func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, opts *ImageCommitOpts, ref cache.ImmutableRef, config []byte, remote *solver.Remote, annotations *Annotations, inlineCache *exptypes.InlineCacheEntry, epoch *time.Time, sg session.Group, baseImg *dockerspec.DockerOCIImage) (*ocispecs.Descriptor, *ocispecs.Descriptor, error) {
+func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, opts *ImageCommitOpts, ref cache.ImmutableRef, groups []layerGroup, config []byte, remote *solver.Remote, annotations *Annotations, inlineCache *exptypes.InlineCacheEntry, epoch *time.Time, sg session.Group, baseImg *dockerspec.DockerOCIImage) (*ocispecs.Descriptor, *ocispecs.Descriptor, error) {
 	if len(config) == 0 {
 		var err error
 		config, err = defaultImageConfig()
@@ -473,6 +512,10 @@ func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, opts *Ima
 		return nil, nil, err
 	}
 
+	if groups != nil {
+		history = groupHistory(ctx, history, ref, groups)
+	}
+
 	remote, history, err = patchImageLayers(ctx, remote, history, ref, opts, sg)
 	if err != nil {
 		return nil, nil, err
@@ -555,7 +598,10 @@ func (ic *ImageWriter) commitDistributionManifest(ctx context.Context, opts *Ima
 	}, &configDesc, nil
 }
 
-func (ic *ImageWriter) commitAttestationsManifest(ctx context.Context, opts *ImageCommitOpts, target ocispecs.Descriptor, statements []intoto.Statement, ociArtifact bool) (*ocispecs.Descriptor, error) {
+// commitAttestationsManifest writes the attestation manifest for the
+// statements. Statements with a non-nil envelope are stored as the signed
+// DSSE envelope instead of the plain statement.
+func (ic *ImageWriter) commitAttestationsManifest(ctx context.Context, opts *ImageCommitOpts, target ocispecs.Descriptor, statements []intoto.Statement, envelopes [][]byte, ociArtifact bool) (*ocispecs.Descriptor, error) {
 	var (
 		manifestType = ocispecs.MediaTypeImageManifest
 		configType   = ocispecs.MediaTypeImageConfig
@@ -569,13 +615,20 @@ func (ic *ImageWriter) commitAttestationsManifest(ctx context.Context, opts *Ima
 	for i, statement := range statements {
 		i, statement := i, statement
 
-		data, err := json.Marshal(statement)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to marshal attestation")
+		mediaType := intoto.PayloadType
+		data := envelopes[i]
+		if data != nil {
+			mediaType = attestation.MediaTypeDSSEEnvelope
+		} else {
+			var err error
+			data, err = json.Marshal(statement)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to marshal attestation")
+			}
 		}
 		digest := digest.FromBytes(data)
 		desc := ocispecs.Descriptor{
-			MediaType: intoto.PayloadType,
+			MediaType: mediaType,
 			Digest:    digest,
 			Size:      int64(len(data)),
 			Annotations: map[string]string{
@@ -706,6 +759,18 @@ func attestationsConfig(layers []ocispecs.Descriptor) ([]byte, error) {
 	return dt, errors.Wrap(err, "failed to create attestations image config")
 }
 
+func parseBaseImageConfig(meta map[string][]byte, p *exptypes.Platform) (*dockerspec.DockerOCIImage, error) {
+	dt := exptypes.ParseKey(meta, exptypes.ExporterImageBaseConfigKey, p)
+	if len(dt) == 0 {
+		return nil, nil
+	}
+	var img dockerspec.DockerOCIImage
+	if err := json.Unmarshal(dt, &img); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal base image config")
+	}
+	return &img, nil
+}
+
 func parseHistoryFromConfig(dt []byte) ([]ocispecs.History, error) {
 	var config struct {
 		History []ocispecs.History
@@ -813,7 +878,48 @@ func patchImageConfig(dt []byte, descs []ocispecs.Descriptor, history []ocispecs
 
 func normalizeLayersAndHistory(ctx context.Context, remote *solver.Remote, history []ocispecs.History, ref cache.ImmutableRef, oci bool) (*solver.Remote, []ocispecs.History) {
 	refMeta := getRefMetadata(ref, len(remote.Descriptors))
+	history = completeHistory(ctx, history, refMeta, len(remote.Descriptors))
 
+	// Find the first new layer time. Otherwise, the history item for a first
+	// metadata command would be the creation time of a base image layer.
+	// If there is no such then the last layer with timestamp.
+	var created *time.Time
+	var noCreatedTime bool
+	for _, h := range history {
+		if h.Created != nil {
+			created = h.Created
+			if noCreatedTime {
+				break
+			}
+		} else {
+			noCreatedTime = true
+		}
+	}
+
+	// Fill in created times for all history items to be either the first new
+	// layer time or the previous layer.
+	noCreatedTime = false
+	for i, h := range history {
+		if h.Created != nil {
+			if noCreatedTime {
+				created = h.Created
+			}
+		} else {
+			noCreatedTime = true
+			h.Created = created
+		}
+		history[i] = h
+	}
+
+	// convert between oci and docker media types (or vice versa) if needed
+	remote.Descriptors = compression.ConvertAllLayerMediaTypes(ctx, oci, remote.Descriptors...)
+
+	return remote, history
+}
+
+// completeHistory makes the history match the number of layers, adding the
+// missing items based on the ref metadata.
+func completeHistory(ctx context.Context, history []ocispecs.History, refMeta []refMetadata, layers int) []ocispecs.History {
 	var historyLayers int
 	for _, h := range history {
 		if !h.EmptyLayer {
@@ -821,14 +927,14 @@ func normalizeLayersAndHistory(ctx context.Context, remote *solver.Remote, histo
 		}
 	}
 
-	if historyLayers > len(remote.Descriptors) {
+	if historyLayers > layers {
 		// this case shouldn't happen but if it does force set history layers empty
 		// from the bottom
 		bklog.G(ctx).Warn("invalid image config with unaccounted layers")
 		historyCopy := make([]ocispecs.History, 0, len(history))
 		var l int
 		for _, h := range history {
-			if l >= len(remote.Descriptors) {
+			if l >= layers {
 				h.EmptyLayer = true
 			}
 			if !h.EmptyLayer {
@@ -839,7 +945,7 @@ func normalizeLayersAndHistory(ctx context.Context, remote *solver.Remote, histo
 		history = historyCopy
 	}
 
-	if len(remote.Descriptors) > historyLayers {
+	if layers > historyLayers {
 		// some history items are missing. add them based on the ref metadata
 		for _, md := range refMeta[historyLayers:] {
 			history = append(history, ocispecs.History{
@@ -860,42 +966,7 @@ func normalizeLayersAndHistory(ctx context.Context, remote *solver.Remote, histo
 		}
 		history[i] = h
 	}
-
-	// Find the first new layer time. Otherwise, the history item for a first
-	// metadata command would be the creation time of a base image layer.
-	// If there is no such then the last layer with timestamp.
-	var created *time.Time
-	var noCreatedTime bool
-	for _, h := range history {
-		if h.Created != nil {
-			created = h.Created
-			if noCreatedTime {
-				break
-			}
-		} else {
-			noCreatedTime = true
-		}
-	}
-
-	// Fill in created times for all history items to be either the first new
-	// layer time or the previous layer.
-	noCreatedTime = false
-	for i, h := range history {
-		if h.Created != nil {
-			if noCreatedTime {
-				created = h.Created
-			}
-		} else {
-			noCreatedTime = true
-			h.Created = created
-		}
-		history[i] = h
-	}
-
-	// convert between oci and docker media types (or vice versa) if needed
-	remote.Descriptors = compression.ConvertAllLayerMediaTypes(ctx, oci, remote.Descriptors...)
-
-	return remote, history
+	return history
 }
 
 func RemoveInternalLayerAnnotations(in map[string]string, oci bool) map[string]string {
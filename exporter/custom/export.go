@@ -0,0 +1,326 @@
+package custom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/executor"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/exporter/local"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/filesync"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/progress/logs"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	keyImage = "image"
+
+	// inputDir is where the build result is mounted in the exporter
+	// container. Multi-platform results are mounted in a subdirectory for
+	// each platform.
+	inputDir = "/input"
+	// outputDir is where the exporter container writes the files that are
+	// sent to the client.
+	outputDir = "/output"
+)
+
+// ImageLoader pulls the image of the exporter and returns its root
+// filesystem and image config.
+type ImageLoader func(ctx context.Context, ref string, g session.Group) (cache.ImmutableRef, []byte, error)
+
+// Build is the build that the exporter is run for. The exporter image is
+// loaded through the solver of the build so that the source policies of the
+// build apply to it.
+type Build struct {
+	LoadImage ImageLoader
+	// EvaluateExec checks the exporter process against the exec rules of
+	// the source policies of the build.
+	EvaluateExec func(context.Context, *pb.ExecOp) error
+	// NetworkHost is set if the build is allowed the network.host
+	// entitlement. The exporter is run without network otherwise.
+	NetworkHost bool
+}
+
+type Opt struct {
+	SessionManager *session.Manager
+	CacheManager   cache.Manager
+	Executor       executor.Executor
+}
+
+type customExporter struct {
+	opt Opt
+}
+
+// New returns an exporter that runs a user-supplied container image with the
+// build result mounted read-only, similar to how gateway frontends are run.
+// The files the container writes to /output are sent to the client.
+func New(opt Opt) (exporter.Exporter, error) {
+	return &customExporter{opt: opt}, nil
+}
+
+func (e *customExporter) Resolve(ctx context.Context, id int, opt map[string]string) (exporter.ExporterInstance, error) {
+	i := &customExporterInstance{
+		customExporter: e,
+		id:             id,
+		attrs:          opt,
+		opts:           map[string]string{},
+	}
+	for k, v := range opt {
+		switch k {
+		case keyImage:
+			i.image = v
+		default:
+			i.opts[k] = v
+		}
+	}
+	if i.image == "" {
+		return nil, errors.Errorf("%s is required for %s exporter", keyImage, client.ExporterCustom)
+	}
+	named, err := reference.ParseNormalizedNamed(i.image)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid exporter image %s", i.image)
+	}
+	i.image = reference.TagNameOnly(named).String()
+	return i, nil
+}
+
+type customExporterInstance struct {
+	*customExporter
+	id    int
+	attrs map[string]string
+
+	image string
+	opts  map[string]string
+	build *Build
+}
+
+// SetBuild sets the build that the exporter is run for. It must be called
+// before Export.
+func (e *customExporterInstance) SetBuild(b Build) {
+	e.build = &b
+}
+
+func (e *customExporterInstance) ID() int {
+	return e.id
+}
+
+func (e *customExporterInstance) Name() string {
+	return "exporting with " + e.image
+}
+
+func (e *customExporterInstance) Type() string {
+	return client.ExporterCustom
+}
+
+func (e *customExporterInstance) Attrs() map[string]string {
+	return e.attrs
+}
+
+func (e *customExporterInstance) Config() *exporter.Config {
+	return exporter.NewConfig()
+}
+
+func (e *customExporterInstance) Export(ctx context.Context, src *exporter.Source, _ exptypes.InlineCache, sessionID string) (map[string]string, exporter.DescriptorReference, error) {
+	if e.build == nil {
+		return nil, nil, errors.Errorf("%s exporter is only supported in builds", client.ExporterCustom)
+	}
+	g := session.NewGroup(sessionID)
+
+	imgRef, config, err := e.build.LoadImage(ctx, e.image, g)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to load exporter image %s", e.image)
+	}
+	if imgRef != nil {
+		defer imgRef.Release(context.WithoutCancel(ctx))
+	}
+	var img dockerspec.DockerOCIImage
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &img); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to parse exporter image config")
+		}
+	}
+
+	mnts, err := inputMounts(src, g)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rootFS, err := e.opt.CacheManager.New(ctx, imgRef, g, cache.WithDescription("custom exporter "+e.image))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rootFS.Release(context.WithoutCancel(ctx))
+
+	output, err := e.opt.CacheManager.New(ctx, nil, g, cache.WithDescription("custom exporter output"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if output != nil {
+			output.Release(context.WithoutCancel(ctx))
+		}
+	}()
+	mnts = append(mnts, executor.Mount{
+		Src:  &mountable{m: output, g: g},
+		Dest: outputDir,
+	})
+
+	meta, err := e.processMeta(&img)
+	if err != nil {
+		return nil, nil, err
+	}
+	if e.build.EvaluateExec != nil {
+		if err := e.build.EvaluateExec(ctx, &pb.ExecOp{
+			Meta: &pb.Meta{
+				Args: meta.Args,
+				Env:  meta.Env,
+				Cwd:  meta.Cwd,
+				User: meta.User,
+			},
+			Network: meta.NetMode,
+		}); err != nil {
+			return nil, nil, errors.Wrap(err, "error evaluating the source policy")
+		}
+	}
+	stdout, stderr, flush := logs.NewLogStreams(ctx, false)
+	defer stdout.Close()
+	defer stderr.Close()
+	_, err = e.opt.Executor.Run(ctx, "", executor.Mount{Src: &mountable{m: rootFS, g: g}}, mnts, executor.ProcessInfo{Meta: meta, Stdout: stdout, Stderr: stderr}, nil)
+	flush()
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "exporter %s failed", e.image)
+	}
+
+	outRef, err := output.Commit(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	output = nil
+	defer outRef.Release(context.WithoutCancel(ctx))
+
+	return nil, nil, e.sendOutput(ctx, outRef, sessionID)
+}
+
+// processMeta returns the process of the exporter container. The exporter
+// options are passed in the environment the same way as the options of
+// gateway frontends.
+func (e *customExporterInstance) processMeta(img *dockerspec.DockerOCIImage) (executor.Meta, error) {
+	args := append(append([]string{}, img.Config.Entrypoint...), img.Config.Cmd...)
+	if len(args) == 0 {
+		return executor.Meta{}, errors.Errorf("exporter image %s has no entrypoint", e.image)
+	}
+	env := append([]string{}, img.Config.Env...)
+	keys := make([]string, 0, len(e.opts))
+	for k := range e.opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		env = append(env, fmt.Sprintf("BUILDKIT_EXPORTER_OPT_%d=%s=%s", i, k, e.opts[k]))
+	}
+	env = append(env, "BUILDKIT_EXPORTER_INPUT="+inputDir, "BUILDKIT_EXPORTER_OUTPUT="+outputDir)
+
+	cwd := img.Config.WorkingDir
+	if cwd == "" {
+		cwd = "/"
+	}
+	meta := executor.Meta{
+		Args:                      args,
+		Env:                       env,
+		Cwd:                       cwd,
+		User:                      img.Config.User,
+		RemoveMountStubsRecursive: true,
+	}
+	if e.build == nil || !e.build.NetworkHost {
+		meta.NetMode = pb.NetMode_NONE
+	}
+	return meta, nil
+}
+
+// inputMounts returns the read-only mounts of the build result.
+func inputMounts(src *exporter.Source, g session.Group) ([]executor.Mount, error) {
+	if len(src.Refs) == 0 {
+		if src.Ref == nil {
+			return nil, nil
+		}
+		return []executor.Mount{{
+			Src:      &mountable{m: src.Ref, g: g},
+			Dest:     inputDir,
+			Readonly: true,
+		}}, nil
+	}
+
+	ps, err := exptypes.ParsePlatforms(src.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	var mnts []executor.Mount
+	for _, p := range ps.Platforms {
+		ref, ok := src.FindRef(p.ID)
+		if !ok {
+			return nil, errors.Errorf("failed to find ref for ID %s", p.ID)
+		}
+		if ref == nil {
+			continue
+		}
+		mnts = append(mnts, executor.Mount{
+			Src:      &mountable{m: ref, g: g},
+			Dest:     path.Join(inputDir, strings.ReplaceAll(p.ID, "/", "_")),
+			Readonly: true,
+		})
+	}
+	return mnts, nil
+}
+
+var errNotEmpty = errors.New("not empty")
+
+// sendOutput copies the files written by the exporter container to the
+// client. Nothing is sent if the container didn't write any files.
+func (e *customExporterInstance) sendOutput(ctx context.Context, ref cache.ImmutableRef, sessionID string) error {
+	outputFS, cleanup, err := local.CreateFS(ctx, sessionID, "", ref, nil, time.Now().Truncate(time.Second), false, local.CreateFSOpts{})
+	if err != nil {
+		return err
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+	err = outputFS.Walk(ctx, "", func(string, fs.DirEntry, error) error {
+		return errNotEmpty
+	})
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, errNotEmpty) {
+		return err
+	}
+
+	timeoutCtx, cancel := context.WithTimeoutCause(ctx, 5*time.Second, errors.WithStack(context.DeadlineExceeded))
+	defer cancel()
+	caller, err := e.opt.SessionManager.Get(timeoutCtx, sessionID, false)
+	if err != nil {
+		return err
+	}
+	return filesync.CopyToCaller(ctx, outputFS, e.id, caller, local.NewProgressHandler(ctx, "copying files"))
+}
+
+type mountable struct {
+	m cache.Mountable
+	g session.Group
+}
+
+func (m *mountable) Mount(ctx context.Context, readonly bool) (snapshot.Mountable, error) {
+	return m.m.Mount(ctx, readonly, m.g)
+}
@@ -0,0 +1,250 @@
+package custom
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/diff/apply"
+	ctdmetadata "github.com/containerd/containerd/v2/core/metadata"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/containerd/containerd/v2/plugins/diff/walking"
+	"github.com/containerd/containerd/v2/plugins/snapshots/native"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/cache/metadata"
+	"github.com/moby/buildkit/executor"
+	resourcestypes "github.com/moby/buildkit/executor/resources/types"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/leaseutil"
+	"github.com/moby/buildkit/util/winlayers"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestResolve(t *testing.T) {
+	e := &customExporter{}
+	_, err := e.Resolve(context.TODO(), 0, map[string]string{"format": "deb"})
+	require.ErrorContains(t, err, "image is required")
+
+	inst, err := e.Resolve(context.TODO(), 0, map[string]string{"image": "myorg/deb-exporter", "format": "deb", "arch": "amd64"})
+	require.NoError(t, err)
+	i := inst.(*customExporterInstance)
+	require.Equal(t, "docker.io/myorg/deb-exporter:latest", i.image)
+
+	_, err = i.processMeta(&dockerspec.DockerOCIImage{})
+	require.ErrorContains(t, err, "no entrypoint")
+
+	img := &dockerspec.DockerOCIImage{}
+	img.Config = dockerspec.DockerOCIImageConfig{
+		ImageConfig: ocispecs.ImageConfig{
+			Entrypoint: []string{"/bin/export"},
+			Cmd:        []string{"--verbose"},
+			Env:        []string{"PATH=/bin"},
+			User:       "1000",
+		},
+	}
+	meta, err := i.processMeta(img)
+	require.NoError(t, err)
+	require.Equal(t, []string{"/bin/export", "--verbose"}, meta.Args)
+	require.Equal(t, "/", meta.Cwd)
+	require.Equal(t, "1000", meta.User)
+	require.Equal(t, []string{
+		"PATH=/bin",
+		"BUILDKIT_EXPORTER_OPT_0=arch=amd64",
+		"BUILDKIT_EXPORTER_OPT_1=format=deb",
+		"BUILDKIT_EXPORTER_INPUT=/input",
+		"BUILDKIT_EXPORTER_OUTPUT=/output",
+	}, meta.Env)
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.TODO()
+	cm := newTestCacheManager(t)
+
+	mref, err := cm.New(ctx, nil, nil)
+	require.NoError(t, err)
+	m, err := mref.Mount(ctx, false, nil)
+	require.NoError(t, err)
+	lm := snapshot.LocalMounter(m)
+	root, err := lm.Mount()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "foo"), []byte("bar"), 0644))
+	require.NoError(t, lm.Unmount())
+	input, err := mref.Commit(ctx)
+	require.NoError(t, err)
+	defer input.Release(ctx)
+
+	config, err := json.Marshal(dockerspec.DockerOCIImage{
+		Config: dockerspec.DockerOCIImageConfig{
+			ImageConfig: ocispecs.ImageConfig{
+				Entrypoint: []string{"/bin/export"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	exec := &testExecutor{}
+	e := &customExporter{opt: Opt{
+		CacheManager: cm,
+		Executor:     exec,
+	}}
+	inst, err := e.Resolve(ctx, 0, map[string]string{"image": "myorg/deb-exporter"})
+	require.NoError(t, err)
+
+	_, _, err = inst.Export(ctx, &exporter.Source{Ref: input}, nil, "")
+	require.ErrorContains(t, err, "only supported in builds")
+
+	var loaded []string
+	var evaluated []*pb.ExecOp
+	build := Build{
+		LoadImage: func(ctx context.Context, ref string, g session.Group) (cache.ImmutableRef, []byte, error) {
+			loaded = append(loaded, ref)
+			return nil, config, nil
+		},
+		EvaluateExec: func(ctx context.Context, op *pb.ExecOp) error {
+			evaluated = append(evaluated, op)
+			return nil
+		},
+	}
+	inst.(*customExporterInstance).SetBuild(build)
+	_, _, err = inst.Export(ctx, &exporter.Source{Ref: input}, nil, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"docker.io/myorg/deb-exporter:latest"}, loaded)
+	require.Len(t, evaluated, 1)
+	require.Equal(t, []string{"/bin/export"}, evaluated[0].Meta.Args)
+	require.Equal(t, pb.NetMode_NONE, evaluated[0].Network)
+
+	require.Len(t, exec.runs, 1)
+	require.Equal(t, []string{"/bin/export"}, exec.runs[0].meta.Args)
+	require.Equal(t, pb.NetMode_NONE, exec.runs[0].meta.NetMode)
+	require.Equal(t, map[string]string{"/input/foo": "bar"}, exec.runs[0].files)
+
+	// network is allowed with the network.host entitlement
+	build.NetworkHost = true
+	inst.(*customExporterInstance).SetBuild(build)
+	_, _, err = inst.Export(ctx, &exporter.Source{Ref: input}, nil, "")
+	require.NoError(t, err)
+	require.Len(t, exec.runs, 2)
+	require.Equal(t, pb.NetMode_UNSET, exec.runs[1].meta.NetMode)
+
+	// the exporter is not run if denied by the source policy
+	build.EvaluateExec = func(context.Context, *pb.ExecOp) error {
+		return errors.New("denied by policy")
+	}
+	inst.(*customExporterInstance).SetBuild(build)
+	_, _, err = inst.Export(ctx, &exporter.Source{Ref: input}, nil, "")
+	require.ErrorContains(t, err, "denied by policy")
+	require.Len(t, exec.runs, 2)
+}
+
+type testRun struct {
+	meta  executor.Meta
+	files map[string]string
+}
+
+// testExecutor records the processes it runs and the files of their
+// read-only mounts.
+type testExecutor struct {
+	runs []testRun
+}
+
+func (e *testExecutor) Run(ctx context.Context, id string, rootfs executor.Mount, mounts []executor.Mount, process executor.ProcessInfo, started chan<- struct{}) (resourcestypes.Recorder, error) {
+	run := testRun{meta: process.Meta, files: map[string]string{}}
+	for _, m := range mounts {
+		if !m.Readonly {
+			continue
+		}
+		mountable, err := m.Src.Mount(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		lm := snapshot.LocalMounter(mountable)
+		root, err := lm.Mount()
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			dt, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			run.files[path.Join(m.Dest, filepath.ToSlash(rel))] = string(dt)
+			return err
+		})
+		if uerr := lm.Unmount(); err == nil {
+			err = uerr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	e.runs = append(e.runs, run)
+	return nil, nil
+}
+
+func (e *testExecutor) Exec(ctx context.Context, id string, process executor.ProcessInfo) error {
+	return errors.New("not implemented")
+}
+func newTestCacheManager(t *testing.T) cache.Manager {
+	tmpdir := t.TempDir()
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, snapshotter.Close())
+	})
+
+	store, err := local.NewStore(tmpdir)
+	require.NoError(t, err)
+
+	db, err := bolt.Open(filepath.Join(tmpdir, "containerdmeta.db"), 0644, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+
+	mdb := ctdmetadata.NewDB(db, store, map[string]snapshots.Snapshotter{
+		"native": snapshotter,
+	})
+
+	md, err := metadata.NewStore(filepath.Join(tmpdir, "metadata.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, md.Close())
+	})
+
+	lm := leaseutil.WithNamespace(ctdmetadata.NewLeaseManager(mdb), "buildkit")
+	c := mdb.ContentStore()
+	cm, err := cache.NewManager(cache.ManagerOpt{
+		Snapshotter:    snapshot.FromContainerdSnapshotter("native", containerdsnapshot.NSSnapshotter("buildkit", mdb.Snapshotter("native")), nil),
+		MetadataStore:  md,
+		LeaseManager:   lm,
+		ContentStore:   c,
+		Applier:        winlayers.NewFileSystemApplierWithWindows(c, apply.NewFileSystemApplier(c)),
+		Differ:         winlayers.NewWalkingDiffWithWindows(c, walking.NewWalkingDiff(c)),
+		GarbageCollect: mdb.GarbageCollect,
+		Root:           tmpdir,
+		MountPoolRoot:  filepath.Join(tmpdir, "cachemounts"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, cm.Close())
+	})
+	return cm
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/moby/buildkit/cache"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/attestation"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/exporter/util/epoch"
 	"github.com/moby/buildkit/session"
@@ -24,6 +25,8 @@ import (
 
 type Opt struct {
 	SessionManager *session.Manager
+	// AttestationSigner signs the attestations that request a signature.
+	AttestationSigner *attestation.Signer
 }
 
 type localExporter struct {
@@ -46,6 +49,7 @@ func (e *localExporter) Resolve(ctx context.Context, id int, opt map[string]stri
 	if err != nil {
 		return nil, err
 	}
+	i.opts.AttestationSigner = e.opt.AttestationSigner
 
 	return i, nil
 }
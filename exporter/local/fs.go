@@ -39,6 +39,9 @@ type CreateFSOpts struct {
 	Epoch             *time.Time
 	AttestationPrefix string
 	PlatformSplit     *bool
+	// AttestationSigner signs the attestations that request a signature. It
+	// is set by the exporter from the daemon configuration.
+	AttestationSigner *attestation.Signer
 }
 
 func (c *CreateFSOpts) UsePlatformSplit(isMap bool) bool {
@@ -179,14 +182,21 @@ func CreateFS(ctx context.Context, sessionID string, k string, ref cache.Immutab
 		if err != nil {
 			return nil, nil, err
 		}
+		envelopes, err := attestation.SignStatements(ctx, opt.AttestationSigner, attestations, stmts)
+		if err != nil {
+			return nil, nil, err
+		}
 		stmtFS := staticfs.NewFS()
 		addPlatformToFilename := isMap && !opt.UsePlatformSplit(isMap)
 
 		names := map[string]struct{}{}
 		for i, stmt := range stmts {
-			dt, err := json.MarshalIndent(stmt, "", "  ")
-			if err != nil {
-				return nil, nil, errors.Wrap(err, "failed to marshal attestation")
+			dt := envelopes[i]
+			if dt == nil {
+				dt, err = json.MarshalIndent(stmt, "", "  ")
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "failed to marshal attestation")
+				}
 			}
 
 			name := opt.AttestationPrefix + path.Base(attestations[i].Path)
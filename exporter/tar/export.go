@@ -2,6 +2,8 @@ package local
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -9,9 +11,11 @@ import (
 	"github.com/moby/buildkit/cache"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/attestation"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
 	"github.com/moby/buildkit/exporter/local"
 	"github.com/moby/buildkit/exporter/util/epoch"
+	"github.com/moby/buildkit/exporter/util/fsimage"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/filesync"
 	"github.com/moby/buildkit/util/progress"
@@ -20,8 +24,16 @@ import (
 	fstypes "github.com/tonistiigi/fsutil/types"
 )
 
+// keyFormat selects a filesystem image format to export instead of a tarball.
+const keyFormat = "format"
+
 type Opt struct {
 	SessionManager *session.Manager
+	// AttestationSigner signs the attestations that request a signature.
+	AttestationSigner *attestation.Signer
+	// TempDir is where filesystem images are staged. It should be in the
+	// state directory of the daemon as images can be large.
+	TempDir string
 }
 
 type localExporter struct {
@@ -40,11 +52,15 @@ func (e *localExporter) Resolve(ctx context.Context, id int, opt map[string]stri
 		id:            id,
 		attrs:         opt,
 	}
-	_, err := li.opts.Load(opt)
+	rest, err := li.opts.Load(opt)
+	if err != nil {
+		return nil, err
+	}
+	li.opts.AttestationSigner = e.opt.AttestationSigner
+	li.format, err = fsimage.ParseFormat(rest[keyFormat])
 	if err != nil {
 		return nil, err
 	}
-	_ = opt
 
 	return li, nil
 }
@@ -54,7 +70,8 @@ type localExporterInstance struct {
 	id    int
 	attrs map[string]string
 
-	opts local.CreateFSOpts
+	opts   local.CreateFSOpts
+	format fsimage.Format
 }
 
 func (e *localExporterInstance) ID() int {
@@ -176,6 +193,17 @@ func (e *localExporterInstance) Export(ctx context.Context, inp *exporter.Source
 	if err != nil {
 		return nil, nil, err
 	}
+	if e.format != fsimage.FormatTar {
+		report := progress.OneOff(ctx, fmt.Sprintf("sending %s image", e.format))
+		err := fsimage.Write(ctx, e.opt.TempDir, e.format, func(tw io.WriteCloser) error {
+			return writeTar(ctx, fs, tw)
+		}, w, e.opts.Epoch)
+		if err != nil {
+			w.Close()
+			return nil, nil, report(err)
+		}
+		return nil, nil, report(w.Close())
+	}
 	report := progress.OneOff(ctx, "sending tarball")
 	if err := writeTar(ctx, fs, w); err != nil {
 		w.Close()
@@ -0,0 +1,281 @@
+// Package fsimage converts the tarball of an exported filesystem to a
+// filesystem image with the userspace mkfs tools, without mounting anything.
+package fsimage
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Format string
+
+const (
+	FormatTar      Format = "tar"
+	FormatErofs    Format = "erofs"
+	FormatSquashfs Format = "squashfs"
+	FormatExt4     Format = "ext4"
+)
+
+// nilUUID is used as the filesystem UUID of reproducible images.
+const nilUUID = "00000000-0000-0000-0000-000000000000"
+
+// ext4 images are sized from the files of the tarball, as mke2fs can't grow
+// them.
+const (
+	ext4BlockSize  = 4096
+	ext4InodeSize  = 256
+	ext4MinSize    = 16 << 20
+	ext4GroupSize  = 8 * ext4BlockSize // blocks per group
+	ext4ExtentSize = 32768             // max blocks per extent
+)
+
+func ParseFormat(v string) (Format, error) {
+	switch f := Format(v); f {
+	case "", FormatTar:
+		return FormatTar, nil
+	case FormatErofs, FormatSquashfs, FormatExt4:
+		return f, nil
+	default:
+		return "", errors.Errorf("unsupported filesystem image format %q", v)
+	}
+}
+
+// Write writes the filesystem image of the tarball written by writeTar to
+// w. The tarball and image are staged in a temporary directory in tmpRoot,
+// or in the default directory for temporary files if tmpRoot is empty.
+// If epoch is set, the filesystem timestamps and UUID are fixed so that the
+// image is reproducible. The timestamps of the files are taken from the
+// tarball.
+func Write(ctx context.Context, tmpRoot string, format Format, writeTar func(io.WriteCloser) error, w io.Writer, epoch *time.Time) error {
+	if format == FormatTar {
+		return errors.New("tar output is not a filesystem image")
+	}
+	if tmpRoot != "" {
+		if err := os.MkdirAll(tmpRoot, 0700); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	dir, err := os.MkdirTemp(tmpRoot, "fsimage-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tarPath := filepath.Join(dir, "rootfs.tar")
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := writeTar(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var layout ext4Layout
+	if format == FormatExt4 {
+		if layout, err = ext4LayoutFromTar(tarPath); err != nil {
+			return err
+		}
+	}
+
+	imgPath := filepath.Join(dir, "rootfs.img")
+	cmd := command(ctx, format, tarPath, imgPath, layout, epoch)
+	if format == FormatSquashfs {
+		// mksquashfs only reads tarballs from stdin
+		tf, err := os.Open(tarPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer tf.Close()
+		cmd.Stdin = tf
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "failed to create %s image: %s", format, strings.TrimSpace(string(out)))
+	}
+
+	img, err := os.Open(imgPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer img.Close()
+	_, err = io.Copy(w, img)
+	return errors.WithStack(err)
+}
+
+// command returns the mkfs command creating the image at imgPath from the
+// tarball at tarPath. The squashfs command reads the tarball from stdin. The
+// layout is only used for ext4 images.
+func command(ctx context.Context, format Format, tarPath string, imgPath string, layout ext4Layout, epoch *time.Time) *exec.Cmd {
+	var cmd *exec.Cmd
+	switch format {
+	case FormatErofs:
+		args := []string{"--quiet", "--tar=f"}
+		if epoch != nil {
+			args = append(args, "-T"+strconv.FormatInt(epoch.Unix(), 10), "-U", nilUUID)
+		}
+		cmd = exec.CommandContext(ctx, "mkfs.erofs", append(args, imgPath, tarPath)...)
+	case FormatSquashfs:
+		args := []string{"-", imgPath, "-tar", "-noappend", "-quiet"}
+		if epoch != nil {
+			args = append(args, "-mkfs-time", strconv.FormatInt(epoch.Unix(), 10))
+		}
+		cmd = exec.CommandContext(ctx, "mksquashfs", args...)
+	case FormatExt4:
+		args := []string{"-q", "-F", "-b", strconv.Itoa(ext4BlockSize), "-I", strconv.Itoa(ext4InodeSize), "-N", strconv.FormatInt(layout.inodes, 10), "-d", tarPath}
+		if epoch != nil {
+			args = append(args, "-U", nilUUID, "-E", "hash_seed="+nilUUID)
+		}
+		cmd = exec.CommandContext(ctx, "mkfs.ext4", append(args, imgPath, strconv.FormatInt(layout.blocks, 10))...)
+		if epoch != nil {
+			ts := strconv.FormatInt(epoch.Unix(), 10)
+			cmd.Env = append(os.Environ(), "E2FSPROGS_FAKE_TIME="+ts, "SOURCE_DATE_EPOCH="+ts)
+		}
+	}
+	return cmd
+}
+
+// ext4Layout is the number of blocks and inodes of an ext4 image.
+type ext4Layout struct {
+	blocks int64
+	inodes int64
+}
+
+// ext4LayoutFromTar returns the layout of an ext4 image that fits the files
+// of the tarball at tarPath. Every file takes an inode and its data is
+// rounded up to whole blocks, so the size of the tarball is not enough for
+// trees of many small files.
+func ext4LayoutFromTar(tarPath string) (ext4Layout, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return ext4Layout{}, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	// dirs is the size of the entries of each directory
+	dirs := map[string]int64{".": 0}
+	var addDir func(p string)
+	addDir = func(p string) {
+		if _, ok := dirs[p]; ok {
+			return
+		}
+		dirs[p] = 0
+		parent := path.Dir(p)
+		addDir(parent)
+		dirs[parent] += dirEntrySize(path.Base(p))
+	}
+
+	var blocks, inodes int64
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ext4Layout{}, errors.Wrap(err, "failed to read tarball")
+		}
+		p := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if p == "." {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			addDir(p)
+			continue
+		}
+		parent := path.Dir(p)
+		addDir(parent)
+		dirs[parent] += dirEntrySize(path.Base(p))
+		switch hdr.Typeflag {
+		case tar.TypeLink:
+			// hard links share the inode of their target
+			continue
+		case tar.TypeReg:
+			n := blockCount(hdr.Size)
+			// extent index blocks of fragmented files
+			blocks += n + n/ext4ExtentSize
+		case tar.TypeSymlink:
+			// short targets are stored in the inode
+			if len(hdr.Linkname) >= 60 {
+				blocks++
+			}
+		}
+		if len(hdr.PAXRecords) > 0 {
+			// extended attributes that don't fit in the inode
+			blocks++
+		}
+		inodes++
+	}
+	for _, size := range dirs {
+		// the "." and ".." entries and the tree of indexed directories
+		n := blockCount(size + 24)
+		blocks += n + n/64
+		inodes++
+	}
+
+	// reserved inodes and lost+found
+	inodes += 16
+	blocks += 4
+	// inode tables, bitmaps and group descriptors
+	blocks += blockCount(inodes * ext4InodeSize)
+	blocks += 2*(blocks/ext4GroupSize+1) + 64
+	// reserved blocks and slack for the allocator
+	blocks += blocks / 10
+	blocks = max(blocks, ext4MinSize/ext4BlockSize)
+	// the journal is sized from the size of the whole filesystem
+	journal := ext4JournalBlocks(blocks)
+	for j := ext4JournalBlocks(blocks + journal); j > journal; j = ext4JournalBlocks(blocks + journal) {
+		journal = j
+	}
+	return ext4Layout{
+		blocks: blocks + journal,
+		inodes: inodes,
+	}, nil
+}
+
+func blockCount(size int64) int64 {
+	return (size + ext4BlockSize - 1) / ext4BlockSize
+}
+
+// dirEntrySize returns the size of the directory entry of name.
+func dirEntrySize(name string) int64 {
+	return (8 + int64(len(name)) + 3) &^ 3
+}
+
+// ext4JournalBlocks returns the default journal size chosen by mke2fs for a
+// filesystem of the given number of blocks.
+func ext4JournalBlocks(blocks int64) int64 {
+	switch {
+	case blocks < 2048:
+		return 0
+	case blocks < 32768:
+		return 1024
+	case blocks < 256*1024:
+		return 4096
+	case blocks < 512*1024:
+		return 8192
+	case blocks < 4096*1024:
+		return 16384
+	case blocks < 8192*1024:
+		return 32768
+	case blocks < 16384*1024:
+		return 65536
+	case blocks < 32768*1024:
+		return 131072
+	default:
+		return 262144
+	}
+}
@@ -0,0 +1,125 @@
+package fsimage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("")
+	require.NoError(t, err)
+	require.Equal(t, FormatTar, f)
+
+	f, err = ParseFormat("erofs")
+	require.NoError(t, err)
+	require.Equal(t, FormatErofs, f)
+
+	_, err = ParseFormat("iso9660")
+	require.ErrorContains(t, err, "unsupported filesystem image format")
+}
+
+func TestCommand(t *testing.T) {
+	tm := time.Unix(1700000000, 0)
+
+	cmd := command(context.TODO(), FormatErofs, "rootfs.tar", "rootfs.img", ext4Layout{}, &tm)
+	require.Equal(t, "mkfs.erofs", filepath.Base(cmd.Args[0]))
+	require.Equal(t, []string{"--quiet", "--tar=f", "-T1700000000", "-U", nilUUID, "rootfs.img", "rootfs.tar"}, cmd.Args[1:])
+
+	cmd = command(context.TODO(), FormatSquashfs, "rootfs.tar", "rootfs.img", ext4Layout{}, nil)
+	require.Equal(t, []string{"-", "rootfs.img", "-tar", "-noappend", "-quiet"}, cmd.Args[1:])
+
+	cmd = command(context.TODO(), FormatExt4, "rootfs.tar", "rootfs.img", ext4Layout{blocks: 38400, inodes: 1000}, &tm)
+	require.Contains(t, strings.Join(cmd.Args, " "), "-N 1000 -d rootfs.tar")
+	require.Equal(t, "rootfs.img", cmd.Args[len(cmd.Args)-2])
+	require.Equal(t, "38400", cmd.Args[len(cmd.Args)-1])
+	require.Contains(t, cmd.Env, "E2FSPROGS_FAKE_TIME=1700000000")
+}
+
+func TestExt4Layout(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 not found")
+	}
+
+	// many small files take more space than the size of the tarball
+	dir := t.TempDir()
+	for i := range 50 {
+		sub := filepath.Join(dir, fmt.Sprintf("dir%d", i))
+		require.NoError(t, os.Mkdir(sub, 0755))
+		for j := range 100 {
+			require.NoError(t, os.WriteFile(filepath.Join(sub, fmt.Sprintf("file-with-a-long-name-%d", j)), bytes.Repeat([]byte{'a'}, 1024), 0644))
+		}
+	}
+	require.NoError(t, os.Symlink(strings.Repeat("target/", 20), filepath.Join(dir, "symlink")))
+	require.NoError(t, os.Link(filepath.Join(dir, "dir0", "file-with-a-long-name-0"), filepath.Join(dir, "hardlink")))
+
+	tarPath := filepath.Join(t.TempDir(), "rootfs.tar")
+	f, err := os.Create(tarPath)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.AddFS(os.DirFS(dir)))
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	fi, err := os.Stat(tarPath)
+	require.NoError(t, err)
+	layout, err := ext4LayoutFromTar(tarPath)
+	require.NoError(t, err)
+	require.Greater(t, layout.blocks*ext4BlockSize, fi.Size()*3/2)
+	require.GreaterOrEqual(t, layout.inodes, int64(5000))
+
+	// mkfs.ext4 creates the image from the directory with the layout of
+	// the tarball
+	imgPath := filepath.Join(t.TempDir(), "rootfs.img")
+	tm := time.Unix(1700000000, 0)
+	out, err := command(context.TODO(), FormatExt4, dir, imgPath, layout, &tm).CombinedOutput()
+	require.NoError(t, err, string(out))
+	if _, err := exec.LookPath("e2fsck"); err == nil {
+		out, err := exec.Command("e2fsck", "-fn", imgPath).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+}
+
+func TestWriteExt4(t *testing.T) {
+	out, err := exec.Command("mke2fs", "-V").CombinedOutput()
+	if err != nil {
+		t.Skip("mke2fs not found")
+	}
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(string(out), "mke2fs %d.%d.%d", &major, &minor, &patch); err != nil || major*10000+minor*100+patch < 14701 {
+		t.Skip("mke2fs doesn't support tarballs")
+	}
+
+	tmpRoot := filepath.Join(t.TempDir(), "fsimage")
+	buf := &bytes.Buffer{}
+	tm := time.Unix(1700000000, 0)
+	err = Write(context.TODO(), tmpRoot, FormatExt4, func(w io.WriteCloser) error {
+		tw := tar.NewWriter(w)
+		for i := range 5000 {
+			if err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("dir%d/file%d", i/100, i), Mode: 0644, Size: 1}); err != nil {
+				return err
+			}
+			if _, err := tw.Write([]byte("a")); err != nil {
+				return err
+			}
+		}
+		return tw.Close()
+	}, buf, &tm)
+	require.NoError(t, err)
+	require.Greater(t, buf.Len(), 0)
+
+	// the staging directory is removed
+	ents, err := os.ReadDir(tmpRoot)
+	require.NoError(t, err)
+	require.Empty(t, ents)
+}
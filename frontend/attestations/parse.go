@@ -13,6 +13,10 @@ const (
 	KeyTypeProvenance = "provenance"
 )
 
+// BuiltinSBOMGenerator is the sbom generator value selecting the SBOM
+// generator built into the daemon instead of a scanner image.
+const BuiltinSBOMGenerator = "builtin"
+
 const (
 	defaultSBOMGenerator = "docker/buildkit-syft-scanner:stable-1"
 	defaultSLSAVersion   = string(provenancetypes.ProvenanceSLSA02)
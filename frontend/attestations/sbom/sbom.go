@@ -10,6 +10,7 @@ import (
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/client/llb/sourceresolver"
+	"github.com/moby/buildkit/frontend/attestations"
 	gatewaypb "github.com/moby/buildkit/frontend/gateway/pb"
 	"github.com/moby/buildkit/solver/result"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
@@ -34,8 +35,11 @@ const (
 // attestation.
 type Scanner func(ctx context.Context, name string, ref llb.State, extras map[string]llb.State, opts ...llb.ConstraintsOpt) (result.Attestation[*llb.State], error)
 
+// CreateSBOMScanner returns a scanner running the scanner image. Nil is
+// returned if there is no scanner, or if the SBOM is generated by the
+// generator built into the daemon.
 func CreateSBOMScanner(ctx context.Context, resolver sourceresolver.MetaResolver, scanner string, resolveOpt sourceresolver.Opt, params map[string]string) (Scanner, error) {
-	if scanner == "" {
+	if scanner == "" || scanner == attestations.BuiltinSBOMGenerator {
 		return nil, nil
 	}
 
@@ -109,7 +113,7 @@ func CreateSBOMScanner(ctx context.Context, resolver sourceresolver.MetaResolver
 func HasSBOM[T comparable](res *result.Result[T]) bool {
 	for _, as := range res.Attestations {
 		for _, a := range as {
-			if a.InToto.PredicateType == intoto.PredicateSPDX {
+			if a.InToto.PredicateType == intoto.PredicateSPDX || a.InToto.PredicateType == intoto.PredicateCycloneDX {
 				return true
 			}
 		}
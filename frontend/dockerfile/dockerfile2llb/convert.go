@@ -725,6 +725,12 @@ func toDispatchState(ctx context.Context, dt []byte, opt ConvertOpt) (*dispatchS
 			sourceMap:           opt.SourceMap,
 			lint:                lint,
 			dockerIgnoreMatcher: dockerIgnoreMatcher,
+			readContextFile: func(filename string) ([]byte, error) {
+				if opt.Client == nil {
+					return nil, errors.Errorf("reading %s from build context is not supported", filename)
+				}
+				return opt.Client.ReadContextFile(ctx, filename)
+			},
 		}
 
 		for _, cmd := range d.commands {
@@ -867,6 +873,7 @@ type dispatchOpt struct {
 	sourceMap           *llb.SourceMap
 	lint                *linter.Linter
 	dockerIgnoreMatcher *patternmatcher.PatternMatcher
+	readContextFile     func(string) ([]byte, error)
 }
 
 func getEnv(state llb.State) shell.EnvGetter {
@@ -949,6 +956,9 @@ func dispatch(d *dispatchState, cmd command, opt dispatchOpt) error {
 			keepGitDir:      c.KeepGitDir,
 			checksum:        c.Checksum,
 			unpack:          c.Unpack,
+			lockfile:        c.Lockfile,
+			signature:       c.Signature,
+			signatureKey:    c.SignatureKey,
 			location:        c.Location(),
 			ignoreMatcher:   opt.dockerIgnoreMatcher,
 			opt:             opt,
@@ -1458,6 +1468,10 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 		}
 	}
 
+	if cfg.lockfile && cfg.checksum != "" {
+		return errors.New("checksum can't be specified with --lockfile")
+	}
+
 	if cfg.checksum != "" {
 		if !cfg.isAddCommand {
 			return errors.New("checksum can't be specified for COPY")
@@ -1468,6 +1482,27 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 		if !isHTTPSource(cfg.params.SourcePaths[0]) && !isGitSource(cfg.params.SourcePaths[0]) {
 			return errors.New("checksum requires HTTP(S) or Git sources")
 		}
+		if isHTTPSource(cfg.checksum) && !isHTTPSource(cfg.params.SourcePaths[0]) {
+			return errors.New("checksum URL requires HTTP(S) sources")
+		}
+	}
+
+	var signatureKey []byte
+	if cfg.signature != "" || cfg.signatureKey != "" {
+		if cfg.signature == "" || cfg.signatureKey == "" {
+			return errors.New("signature and signature-key must be specified together")
+		}
+		if len(cfg.params.SourcePaths) != 1 || !isHTTPSource(cfg.params.SourcePaths[0]) {
+			return errors.New("signature requires a single HTTP(S) source")
+		}
+		if cfg.opt.readContextFile == nil {
+			return errors.New("signature keys are not supported")
+		}
+		dt, err := cfg.opt.readContextFile(cfg.signatureKey)
+		if err != nil {
+			return err
+		}
+		signatureKey = dt
 	}
 
 	commitMessage := bytes.NewBufferString("")
@@ -1486,6 +1521,9 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 	if cfg.chmod != "" {
 		commitMessage.WriteString(" " + "--chmod=" + cfg.chmod)
 	}
+	if cfg.lockfile {
+		commitMessage.WriteString(" " + "--lockfile")
+	}
 
 	platform := cfg.opt.targetPlatform
 	if d.platform != nil {
@@ -1500,6 +1538,33 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 
 	for _, src := range cfg.params.SourcePaths {
 		commitMessage.WriteString(" " + src)
+		if cfg.lockfile {
+			if isHTTPSource(src) {
+				return errors.New("lockfile source can't be a URL")
+			}
+			if cfg.opt.readContextFile == nil {
+				return errors.New("lockfile sources are not supported")
+			}
+			dt, err := cfg.opt.readContextFile(src)
+			if err != nil {
+				return err
+			}
+			st, err := lockfileState(dt, pgName)
+			if err != nil {
+				return errors.Wrapf(err, "invalid lockfile %s", src)
+			}
+			opts := append([]llb.CopyOption{&llb.CopyInfo{
+				Mode:                chopt,
+				CopyDirContentsOnly: true,
+				CreateDestPath:      true,
+			}}, copyOpt...)
+			if a == nil {
+				a = llb.Copy(st, "/", dest, opts...)
+			} else {
+				a = a.Copy(st, "/", dest, opts...)
+			}
+			continue
+		}
 		gitRef, gitRefErr := gitutil.ParseGitRef(src)
 		if gitRefErr == nil && !gitRef.IndistinguishableFromLocal {
 			if !cfg.isAddCommand {
@@ -1545,15 +1610,21 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 				}
 			}
 
-			var checksum digest.Digest
-			if cfg.checksum != "" {
-				checksum, err = digest.Parse(cfg.checksum)
+			httpOpts := []llb.HTTPOption{llb.Filename(f), llb.WithCustomName(pgName), dfCmd(cfg.params)}
+			if isHTTPSource(cfg.checksum) {
+				httpOpts = append(httpOpts, llb.ChecksumURL(cfg.checksum))
+			} else if cfg.checksum != "" {
+				checksum, err := digest.Parse(cfg.checksum)
 				if err != nil {
 					return err
 				}
+				httpOpts = append(httpOpts, llb.Checksum(checksum))
+			}
+			if cfg.signature != "" {
+				httpOpts = append(httpOpts, llb.Signature(cfg.signature, signatureKey))
 			}
 
-			st := llb.HTTP(src, llb.Filename(f), llb.WithCustomName(pgName), llb.Checksum(checksum), dfCmd(cfg.params))
+			st := llb.HTTP(src, httpOpts...)
 
 			var unpack bool
 			if cfg.unpack != nil {
@@ -1624,6 +1695,24 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 	for _, src := range cfg.params.SourceContents {
 		commitMessage.WriteString(" <<" + src.Path)
 
+		if cfg.lockfile {
+			st, err := lockfileState([]byte(src.Data), pgName)
+			if err != nil {
+				return errors.Wrapf(err, "invalid lockfile %s", src.Path)
+			}
+			opts := append([]llb.CopyOption{&llb.CopyInfo{
+				Mode:                chopt,
+				CopyDirContentsOnly: true,
+				CreateDestPath:      true,
+			}}, copyOpt...)
+			if a == nil {
+				a = llb.Copy(st, "/", dest, opts...)
+			} else {
+				a = a.Copy(st, "/", dest, opts...)
+			}
+			continue
+		}
+
 		data := src.Data
 		f, err := system.CheckSystemDriveAndRemoveDriveLetter(src.Path, d.platform.OS, false)
 		if err != nil {
@@ -1681,6 +1770,19 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 	return commitToHistory(&d.image, commitMessage.String(), true, &d.state, d.epoch)
 }
 
+// lockfileState returns the state containing all the files listed in a
+// lockfile used with ADD --lockfile.
+func lockfileState(dt []byte, pgName string) (llb.State, error) {
+	entries, err := llb.ParseLockfile(dt)
+	if err != nil {
+		return llb.State{}, err
+	}
+	if len(entries) == 0 {
+		return llb.Scratch(), nil
+	}
+	return llb.Lockfile(entries, llb.WithCustomName(pgName)), nil
+}
+
 type copyConfig struct {
 	params          instructions.SourcesAndDest
 	excludePatterns []string
@@ -1697,6 +1799,9 @@ type copyConfig struct {
 	ignoreMatcher   *patternmatcher.PatternMatcher
 	opt             dispatchOpt
 	unpack          *bool
+	lockfile        bool
+	signature       string
+	signatureKey    string
 }
 
 func dispatchMaintainer(d *dispatchState, c *instructions.MaintainerCommand) error {
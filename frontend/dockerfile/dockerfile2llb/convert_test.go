@@ -230,3 +230,18 @@ RUN echo bar
 	assert.Equal(t, []digest.Digest{"sha256:2e112031b4b923a873c8b3d685d48037e4d5ccd967b658743d93a6e56c3064b9"}, baseImg.RootFS.DiffIDs)
 	assert.Equal(t, "2024-01-17 21:49:12 +0000 UTC", baseImg.Created.String())
 }
+
+func TestDockerfileAddChecksumURL(t *testing.T) {
+	df := `FROM scratch
+ADD --checksum=https://example.com/SHA256SUMS https://example.com/foo.tar.gz /
+`
+	_, _, _, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	assert.NoError(t, err)
+
+	df = `FROM scratch
+ADD --checksum=https://example.com/SHA256SUMS https://github.com/moby/buildkit.git#v0.10.1 /
+`
+	_, _, _, _, err = Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum URL requires HTTP(S) sources")
+}
@@ -0,0 +1,82 @@
+//go:build dflockfile
+
+package dockerfile2llb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/appcontext"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerfileAddLockfileHeredoc(t *testing.T) {
+	df := `FROM scratch
+ADD --lockfile <<EOT /deps/
+[
+  {"url": "https://example.com/foo.tar.gz", "digest": "sha256:24454f830cdb571e2c4ad15481119c43b3cafd48dd869a9b2945d1036d1dc68d"}
+]
+EOT
+`
+	st, _, _, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	require.NoError(t, err)
+
+	def, err := st.Marshal(appcontext.Context())
+	require.NoError(t, err)
+
+	var src *pb.SourceOp
+	var copyDest string
+	for _, dt := range def.Def {
+		var op pb.Op
+		require.NoError(t, op.Unmarshal(dt))
+		if s := op.GetSource(); s != nil && strings.HasPrefix(s.Identifier, "lockfile://") {
+			src = s
+		}
+		if f := op.GetFile(); f != nil {
+			for _, a := range f.Actions {
+				if c := a.GetCopy(); c != nil {
+					copyDest = c.Dest
+				}
+			}
+		}
+	}
+	require.NotNil(t, src)
+	entries, err := llb.ParseLockfile([]byte(src.Attrs[pb.AttrLockfileEntries]))
+	require.NoError(t, err)
+	require.Equal(t, []llb.LockfileEntry{{
+		URL:    "https://example.com/foo.tar.gz",
+		Digest: digest.Digest("sha256:24454f830cdb571e2c4ad15481119c43b3cafd48dd869a9b2945d1036d1dc68d"),
+	}}, entries)
+	assert.Equal(t, "/deps/", copyDest)
+}
+
+func TestDockerfileAddLockfileInvalid(t *testing.T) {
+	df := `FROM scratch
+ADD --lockfile https://example.com/deps.lock.json /deps/
+`
+	_, _, _, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lockfile source can't be a URL")
+
+	df = `FROM scratch
+ADD --lockfile --checksum=sha256:24454f830cdb571e2c4ad15481119c43b3cafd48dd869a9b2945d1036d1dc68d <<EOT /deps/
+[]
+EOT
+`
+	_, _, _, _, err = Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum can't be specified with --lockfile")
+
+	df = `FROM scratch
+ADD --lockfile <<EOT /deps/
+[{"url": "https://example.com/foo.tar.gz", "digest": "sha512:0cf9180a764aba863a67b6d72f0918bc131c6772642cb2dce5a34f0a702f9470ddc2bf125c12198b1995c233c34b4afd346c54a2334c350a948a51b6e8b4e6b6"}]
+EOT
+`
+	_, _, _, _, err = Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported digest algorithm sha512")
+}
@@ -0,0 +1,27 @@
+//go:build dfaddsignature
+
+package dockerfile2llb
+
+import (
+	"testing"
+
+	"github.com/moby/buildkit/util/appcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerfileAddSignatureInvalid(t *testing.T) {
+	df := `FROM scratch
+ADD --signature=https://example.com/foo.tar.gz.sig https://example.com/foo.tar.gz /
+`
+	_, _, _, _, err := Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "signature and signature-key must be specified together")
+
+	df = `FROM scratch
+ADD --signature=https://example.com/foo.sig --signature-key=key.pub foo /
+`
+	_, _, _, _, err = Dockerfile2LLB(appcontext.Context(), []byte(df), ConvertOpt{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "signature requires a single HTTP(S) source")
+}
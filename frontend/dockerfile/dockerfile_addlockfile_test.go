@@ -0,0 +1,164 @@
+//go:build dflockfile
+
+package dockerfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/continuity/fs/fstest"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/frontend/dockerui"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+	"github.com/moby/buildkit/util/testutil/httpserver"
+	"github.com/moby/buildkit/util/testutil/integration"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+	"github.com/tonistiigi/fsutil"
+)
+
+var addLockfileTests = integration.TestFuncs(
+	testAddLockfile,
+	testAddLockfileSourcePolicy,
+)
+
+func init() {
+	allTests = append(allTests, addLockfileTests...)
+}
+
+func testAddLockfile(t *testing.T, sb integration.Sandbox) {
+	integration.SkipOnPlatform(t, "windows")
+	f := getFrontend(t, sb)
+
+	server := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/foo":     {Content: []byte("content1")},
+		"/bar.txt": {Content: []byte("content2")},
+	})
+	defer server.Close()
+
+	lockfile := fmt.Sprintf(`[
+  {"url": "%s/foo", "digest": "%s", "filename": "foo.bin"},
+  {"url": "%s/bar.txt", "digest": "%s"}
+]`, server.URL, digest.FromString("content1"), server.URL, digest.FromString("content2"))
+
+	dockerfile := []byte(`
+FROM scratch
+ADD --lockfile deps.lock.json /deps/
+`)
+	dir := integration.Tmpdir(
+		t,
+		fstest.CreateFile("Dockerfile", dockerfile, 0600),
+		fstest.CreateFile("deps.lock.json", []byte(lockfile), 0600),
+	)
+
+	c, err := client.New(sb.Context(), sb.Address())
+	require.NoError(t, err)
+	defer c.Close()
+
+	destDir := t.TempDir()
+	_, err = f.Solve(sb.Context(), c, client.SolveOpt{
+		Exports: []client.ExportEntry{
+			{Type: client.ExporterLocal, OutputDir: destDir},
+		},
+		LocalMounts: map[string]fsutil.FS{
+			dockerui.DefaultLocalNameDockerfile: dir,
+			dockerui.DefaultLocalNameContext:    dir,
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	dt, err := os.ReadFile(filepath.Join(destDir, "deps/foo.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "content1", string(dt))
+
+	dt, err = os.ReadFile(filepath.Join(destDir, "deps/bar.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "content2", string(dt))
+
+	// digest mismatch
+	lockfile = fmt.Sprintf(`[{"url": "%s/foo", "digest": "%s"}]`, server.URL, digest.FromString("other"))
+	dir = integration.Tmpdir(
+		t,
+		fstest.CreateFile("Dockerfile", dockerfile, 0600),
+		fstest.CreateFile("deps.lock.json", []byte(lockfile), 0600),
+	)
+	_, err = f.Solve(sb.Context(), c, client.SolveOpt{
+		LocalMounts: map[string]fsutil.FS{
+			dockerui.DefaultLocalNameDockerfile: dir,
+			dockerui.DefaultLocalNameContext:    dir,
+		},
+	}, nil)
+	require.ErrorContains(t, err, "digest mismatch")
+}
+
+func testAddLockfileSourcePolicy(t *testing.T, sb integration.Sandbox) {
+	integration.SkipOnPlatform(t, "windows")
+	f := getFrontend(t, sb)
+
+	origin := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/foo": {Content: []byte("content1")},
+	})
+	defer origin.Close()
+
+	mirror := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/mirror/foo": {Content: []byte("content1")},
+	})
+	defer mirror.Close()
+
+	dockerfile := fmt.Appendf(nil, `
+FROM scratch
+ADD --lockfile <<EOT /deps/
+[{"url": "%s/foo", "digest": "%s"}]
+EOT
+`, origin.URL, digest.FromString("content1"))
+	dir := integration.Tmpdir(
+		t,
+		fstest.CreateFile("Dockerfile", dockerfile, 0600),
+	)
+
+	c, err := client.New(sb.Context(), sb.Address())
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = f.Solve(sb.Context(), c, client.SolveOpt{
+		LocalMounts: map[string]fsutil.FS{
+			dockerui.DefaultLocalNameDockerfile: dir,
+			dockerui.DefaultLocalNameContext:    dir,
+		},
+		SourcePolicy: &spb.Policy{
+			Rules: []*spb.Rule{{
+				Action:   spb.PolicyAction_DENY,
+				Selector: &spb.Selector{Identifier: origin.URL + "/foo"},
+			}},
+		},
+	}, nil)
+	require.ErrorContains(t, err, "denied by policy")
+	require.Equal(t, 0, origin.Stats("/foo").AllRequests)
+
+	destDir := t.TempDir()
+	_, err = f.Solve(sb.Context(), c, client.SolveOpt{
+		Exports: []client.ExportEntry{
+			{Type: client.ExporterLocal, OutputDir: destDir},
+		},
+		LocalMounts: map[string]fsutil.FS{
+			dockerui.DefaultLocalNameDockerfile: dir,
+			dockerui.DefaultLocalNameContext:    dir,
+		},
+		SourcePolicy: &spb.Policy{
+			Rules: []*spb.Rule{{
+				Action:   spb.PolicyAction_CONVERT,
+				Selector: &spb.Selector{Identifier: origin.URL + "/foo"},
+				Updates:  &spb.Update{Identifier: mirror.URL + "/mirror/foo"},
+			}},
+		},
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, origin.Stats("/foo").AllRequests)
+	require.Equal(t, 1, mirror.Stats("/mirror/foo").AllRequests)
+
+	dt, err := os.ReadFile(filepath.Join(destDir, "deps/foo"))
+	require.NoError(t, err)
+	require.Equal(t, "content1", string(dt))
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/containerd/platforms"
 	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	provenanceCommon "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
 	controlapi "github.com/moby/buildkit/api/services/control"
 	"github.com/moby/buildkit/client"
 	"github.com/moby/buildkit/client/llb"
@@ -189,6 +190,7 @@ RUN echo ok> /foo
 
 					require.Equal(t, "https://github.com/moby/buildkit/blob/master/docs/attestations/slsa-definitions.md", pred.BuildDefinition.BuildType)
 					require.Equal(t, "", pred.RunDetails.Builder.ID)
+					require.NotEmpty(t, pred.RunDetails.Builder.Version["buildkit"])
 
 					require.Equal(t, "", pred.BuildDefinition.ExternalParameters.ConfigSource.URI)
 
@@ -233,16 +235,33 @@ RUN echo ok> /foo
 					expectedBaseImage := integration.UnixOrWindows("busybox", "nanoserver")
 					escapedPlatform := url.PathEscape(platforms.Format(platforms.Normalize(platforms.DefaultSpec())))
 					expectedBase := fmt.Sprintf("pkg:docker/%s@latest?platform=%s", expectedBaseImage, escapedPlatform)
+					var deps, localDeps []slsa1.ResourceDescriptor
+					for _, d := range pred.BuildDefinition.ResolvedDependencies {
+						if d.URI == "" {
+							localDeps = append(localDeps, d)
+						} else {
+							deps = append(deps, d)
+						}
+					}
 					if isGateway {
-						require.Equal(t, 2, len(pred.BuildDefinition.ResolvedDependencies), "%+v", pred.BuildDefinition.ResolvedDependencies)
-						require.Contains(t, pred.BuildDefinition.ResolvedDependencies[0].URI, "docker/buildkit_test")
-						require.Equal(t, expectedBase, pred.BuildDefinition.ResolvedDependencies[1].URI)
-						require.NotEmpty(t, pred.BuildDefinition.ResolvedDependencies[1].Digest["sha256"])
+						require.Equal(t, 2, len(deps), "%+v", deps)
+						require.Contains(t, deps[0].URI, "docker/buildkit_test")
+						require.Equal(t, expectedBase, deps[1].URI)
+						require.NotEmpty(t, deps[1].Digest["sha256"])
 					} else {
-						require.Equal(t, 1, len(pred.BuildDefinition.ResolvedDependencies), "%+v", pred.BuildDefinition.ResolvedDependencies)
-						require.Equal(t, expectedBase, pred.BuildDefinition.ResolvedDependencies[0].URI)
-						require.NotEmpty(t, pred.BuildDefinition.ResolvedDependencies[0].Digest["sha256"])
+						require.Equal(t, 1, len(deps), "%+v", deps)
+						require.Equal(t, expectedBase, deps[0].URI)
+						require.NotEmpty(t, deps[0].Digest["sha256"])
+					}
+					// locals are transferred with different filters, e.g. for
+					// loading the .dockerignore file, and have a dependency
+					// for each transfer
+					localNames := map[string]struct{}{}
+					for _, d := range localDeps {
+						require.NotEmpty(t, d.Digest["sha256"], "%+v", d)
+						localNames[d.Name] = struct{}{}
 					}
+					require.Equal(t, map[string]struct{}{"local:context": {}, "local:dockerfile": {}}, localNames)
 
 					if !isClient {
 						require.Equal(t, "Dockerfile", pred.BuildDefinition.ExternalParameters.ConfigSource.Path)
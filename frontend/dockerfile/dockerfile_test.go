@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -51,6 +52,7 @@ import (
 	"github.com/moby/buildkit/session/upload/uploadprovider"
 	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/sourcepolicy"
 	spb "github.com/moby/buildkit/sourcepolicy/pb"
 	"github.com/moby/buildkit/util/contentutil"
 	"github.com/moby/buildkit/util/grpcerrors"
@@ -197,6 +199,7 @@ var allTests = integration.TestFuncs(
 	testFrontendDeduplicateSources,
 	testDuplicateLayersProvenance,
 	testSourcePolicyWithNamedContext,
+	testSourcePolicyPinLockfile,
 	testEagerNamedContextLookup,
 	testEmptyStringArgInEnv,
 	testInvalidJSONCommands,
@@ -9495,6 +9498,54 @@ func testSourcePolicyWithNamedContext(t *testing.T, sb integration.Sandbox) {
 	require.Equal(t, "foo", string(dt))
 }
 
+func testSourcePolicyPinLockfile(t *testing.T, sb integration.Sandbox) {
+	integration.SkipOnPlatform(t, "windows")
+	f := getFrontend(t, sb)
+	c, err := client.New(sb.Context(), sb.Address())
+	require.NoError(t, err)
+	defer c.Close()
+
+	dockerfile := []byte(`
+FROM busybox:latest
+RUN echo foo > /foo
+`)
+
+	dir := integration.Tmpdir(t, fstest.CreateFile("Dockerfile", dockerfile, 0600))
+
+	const tag = "docker-image://docker.io/library/busybox:latest"
+	res, err := f.Solve(sb.Context(), c, client.SolveOpt{
+		LocalMounts: map[string]fsutil.FS{
+			dockerui.DefaultLocalNameDockerfile: dir,
+			dockerui.DefaultLocalNameContext:    dir,
+		},
+		SourcePolicy: &spb.Policy{
+			Rules: []*spb.Rule{
+				{
+					Action: spb.PolicyAction_PIN,
+					Selector: &spb.Selector{
+						Identifier: tag,
+					},
+				},
+			},
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	v, ok := res.ExporterResponse[sourcepolicy.LockResponseKey]
+	require.True(t, ok)
+	dt, err := base64.StdEncoding.DecodeString(v)
+	require.NoError(t, err)
+	var lock spb.Policy
+	require.NoError(t, json.Unmarshal(dt, &lock))
+
+	// the FROM tag is pinned to the digest the frontend resolved it to
+	require.Len(t, lock.Rules, 1)
+	rule := lock.Rules[0]
+	require.Equal(t, spb.PolicyAction_CONVERT, rule.Action)
+	require.Equal(t, tag, rule.Selector.Identifier)
+	require.True(t, strings.HasPrefix(rule.Updates.Identifier, tag+"@sha256:"), rule.Updates.Identifier)
+}
+
 // testEagerNamedContextLookup tests that named context are not loaded if
 // they are not used by current build.
 func testEagerNamedContextLookup(t *testing.T, sb integration.Sandbox) {
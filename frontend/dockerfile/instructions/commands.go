@@ -247,6 +247,9 @@ type AddCommand struct {
 	KeepGitDir      bool // whether to keep .git dir, only meaningful for git sources
 	Checksum        string
 	Unpack          *bool
+	Lockfile        bool // sources are lockfiles listing the URLs to fetch
+	Signature       string
+	SignatureKey    string // path of the public key in the build context
 }
 
 func (c *AddCommand) Expand(expander SingleWordExpander) error {
@@ -268,6 +271,18 @@ func (c *AddCommand) Expand(expander SingleWordExpander) error {
 	}
 	c.Checksum = expandedChecksum
 
+	expandedSignature, err := expander(c.Signature)
+	if err != nil {
+		return err
+	}
+	c.Signature = expandedSignature
+
+	expandedSignatureKey, err := expander(c.SignatureKey)
+	if err != nil {
+		return err
+	}
+	c.SignatureKey = expandedSignatureKey
+
 	return c.SourcesAndDest.Expand(expander)
 }
 
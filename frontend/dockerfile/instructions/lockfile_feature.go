@@ -0,0 +1,7 @@
+//go:build dflockfile
+
+package instructions
+
+func init() {
+	lockfileEnabled = true
+}
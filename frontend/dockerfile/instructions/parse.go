@@ -38,6 +38,10 @@ var parseRunPostHooks []func(*RunCommand, parseRequest) error
 
 var parentsEnabled = false
 
+var lockfileEnabled = false
+
+var signatureEnabled = false
+
 func nodeArgs(node *parser.Node) []string {
 	result := []string{}
 	for ; node.Next != nil; node = node.Next {
@@ -321,6 +325,14 @@ func stringValuesFromFlagIfPossible(f *Flag) []string {
 	return f.StringValues
 }
 
+func stringValueFromFlagIfPossible(f *Flag) string {
+	if f == nil {
+		return ""
+	}
+
+	return f.Value
+}
+
 func parseAdd(req parseRequest) (*AddCommand, error) {
 	if len(req.args) < 2 {
 		return nil, errNoDestinationArgument("ADD")
@@ -339,6 +351,15 @@ func parseAdd(req parseRequest) (*AddCommand, error) {
 	flKeepGitDir := req.flags.AddBool("keep-git-dir", false)
 	flChecksum := req.flags.AddString("checksum", "")
 	flUnpack := req.flags.AddBool("unpack", false)
+	var flLockfile *Flag
+	if lockfileEnabled {
+		flLockfile = req.flags.AddBool("lockfile", false)
+	}
+	var flSignature, flSignatureKey *Flag
+	if signatureEnabled {
+		flSignature = req.flags.AddString("signature", "")
+		flSignatureKey = req.flags.AddString("signature-key", "")
+	}
 	if err := req.flags.Parse(); err != nil {
 		return nil, err
 	}
@@ -364,6 +385,9 @@ func parseAdd(req parseRequest) (*AddCommand, error) {
 		Checksum:        flChecksum.Value,
 		ExcludePatterns: stringValuesFromFlagIfPossible(flExcludes),
 		Unpack:          unpack,
+		Lockfile:        flLockfile != nil && flLockfile.Value == "true",
+		Signature:       stringValueFromFlagIfPossible(flSignature),
+		SignatureKey:    stringValueFromFlagIfPossible(flSignatureKey),
 	}, nil
 }
 
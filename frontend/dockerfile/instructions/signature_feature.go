@@ -0,0 +1,7 @@
+//go:build dfaddsignature
+
+package instructions
+
+func init() {
+	signatureEnabled = true
+}
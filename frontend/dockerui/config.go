@@ -51,6 +51,7 @@ const (
 	keyHostnameArg          = "build-arg:BUILDKIT_SANDBOX_HOSTNAME"
 	keyDockerfileLintArg    = "build-arg:BUILDKIT_DOCKERFILE_CHECK"
 	keyContextKeepGitDirArg = "build-arg:BUILDKIT_CONTEXT_KEEP_GIT_DIR"
+	keyContextGitTreeKeyArg = "build-arg:BUILDKIT_CONTEXT_GIT_SUBDIR_TREE_KEY"
 	keySourceDateEpoch      = "build-arg:SOURCE_DATE_EPOCH"
 )
 
@@ -263,24 +264,28 @@ func (bc *Client) init() error {
 	}
 	if attrs, ok := attests[attestations.KeyTypeSbom]; ok {
 		params := make(map[string]string)
-		var ref reference.Named
+		var generator string
 		for k, v := range attrs {
 			if k == "generator" {
-				ref, err = reference.ParseNormalizedNamed(v)
+				if v == attestations.BuiltinSBOMGenerator {
+					generator = v
+					continue
+				}
+				ref, err := reference.ParseNormalizedNamed(v)
 				if err != nil {
 					return errors.Wrapf(err, "failed to parse sbom scanner %s", v)
 				}
-				ref = reference.TagNameOnly(ref)
+				generator = reference.TagNameOnly(ref).String()
 			} else {
 				params[k] = v
 			}
 		}
-		if ref == nil {
+		if generator == "" {
 			return errors.Errorf("sbom scanner cannot be empty")
 		}
 
 		bc.SBOM = &SBOM{
-			Generator:  ref.String(),
+			Generator:  generator,
 			Parameters: params,
 		}
 	}
@@ -504,6 +509,54 @@ func (bc *Client) DockerIgnorePatterns(ctx context.Context) ([]string, error) {
 	return bc.dockerIgnorePatterns(ctx, bctx)
 }
 
+// ReadContextFile reads a single file from the main build context without
+// transferring the rest of the context.
+func (bc *Client) ReadContextFile(ctx context.Context, filename string) ([]byte, error) {
+	bctx, err := bc.buildContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filename = path.Clean(path.Join("/", filename))
+
+	var st llb.State
+	if bctx.context != nil {
+		st = *bctx.context
+	} else {
+		sessionID := bc.bopts.SessionID
+		if v, ok := bc.localsSessionIDs[bctx.contextLocalName]; ok {
+			sessionID = v
+		}
+		st = llb.Local(bctx.contextLocalName,
+			llb.SessionID(sessionID),
+			llb.FollowPaths([]string{strings.TrimPrefix(filename, "/")}),
+			llb.SharedKeyHint(bctx.contextLocalName+"-"+strings.TrimPrefix(filename, "/")),
+			WithInternalName("load "+strings.TrimPrefix(filename, "/")),
+			llb.Differ(llb.DiffNone, false),
+		)
+	}
+	def, err := st.Marshal(ctx, bc.marshalOpts()...)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bc.client.Solve(ctx, client.SolveRequest{
+		Definition: def.ToPB(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	ref, err := res.SingleRef()
+	if err != nil {
+		return nil, err
+	}
+	dt, err := ref.ReadFile(ctx, client.ReadRequest{
+		Filename: filename,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s from build context", filename)
+	}
+	return dt, nil
+}
+
 func DefaultMainContext(opts ...llb.LocalOption) *llb.State {
 	opts = append([]llb.LocalOption{
 		llb.SharedKeyHint(DefaultLocalNameContext),
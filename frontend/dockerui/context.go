@@ -73,7 +73,11 @@ func (bc *Client) initContext(ctx context.Context) (*buildContext, error) {
 	if v, err := strconv.ParseBool(opts[keyContextKeepGitDirArg]); err == nil {
 		keepGit = v
 	}
-	if st, ok := DetectGitContext(opts[localNameContext], keepGit); ok {
+	var gitOpts []llb.GitOption
+	if v, err := strconv.ParseBool(opts[keyContextGitTreeKeyArg]); err == nil && v {
+		gitOpts = append(gitOpts, llb.GitSubdirTreeKey())
+	}
+	if st, ok := DetectGitContext(opts[localNameContext], keepGit, gitOpts...); ok {
 		bctx.context = st
 		bctx.dockerfile = st
 	} else if st, filename, ok := DetectHTTPContext(opts[localNameContext]); ok {
@@ -140,7 +144,7 @@ func (bc *Client) initContext(ctx context.Context) (*buildContext, error) {
 	return bctx, nil
 }
 
-func DetectGitContext(ref string, keepGit bool) (*llb.State, bool) {
+func DetectGitContext(ref string, keepGit bool, opts ...llb.GitOption) (*llb.State, bool) {
 	g, err := gitutil.ParseGitRef(ref)
 	if err != nil {
 		return nil, false
@@ -153,6 +157,7 @@ func DetectGitContext(ref string, keepGit bool) (*llb.State, bool) {
 	if keepGit {
 		gitOpts = append(gitOpts, llb.KeepGitDir())
 	}
+	gitOpts = append(gitOpts, opts...)
 
 	st := llb.Git(g.Remote, commit, gitOpts...)
 	return &st, true
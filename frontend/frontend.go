@@ -33,6 +33,13 @@ type FrontendLLBBridge interface {
 	Warn(ctx context.Context, dgst digest.Digest, msg string, opts WarnOpts) error
 }
 
+// ExecPolicyEvaluator is implemented by bridges that check the processes that
+// are not run by exec ops, e.g. in gateway containers, against the exec rules
+// of the source policies of the build.
+type ExecPolicyEvaluator interface {
+	EvaluateExec(ctx context.Context, op *pb.ExecOp) error
+}
+
 type SolveRequest = gw.SolveRequest
 
 type CacheOptionsEntry = gw.CacheOptionsEntry
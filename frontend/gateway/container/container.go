@@ -36,6 +36,9 @@ type NewContainerRequest struct {
 	Mounts      []Mount
 	Platform    *opspb.Platform
 	Constraints *opspb.WorkerConstraints
+	// EvaluateExec checks the container and its processes against the exec
+	// rules of the source policies of the build.
+	EvaluateExec func(context.Context, *opspb.ExecOp) error
 }
 
 // Mount used for the gateway.Container is nearly identical to the client.Mount
@@ -47,6 +50,19 @@ type Mount struct {
 }
 
 func NewContainer(ctx context.Context, cm cache.Manager, exec executor.Executor, sm *session.Manager, g session.Group, req NewContainerRequest) (client.Container, error) {
+	var pbMounts []*opspb.Mount
+	for _, m := range req.Mounts {
+		pbMounts = append(pbMounts, m.Mount)
+	}
+	if req.EvaluateExec != nil {
+		if err := req.EvaluateExec(ctx, &opspb.ExecOp{
+			Network: req.NetMode,
+			Mounts:  pbMounts,
+		}); err != nil {
+			return nil, errors.Wrap(err, "error evaluating the source policy")
+		}
+	}
+
 	ctx, cancel := context.WithCancelCause(ctx)
 	eg, ctx := errgroup.WithContext(ctx)
 	platform := &opspb.Platform{
@@ -57,17 +73,19 @@ func NewContainer(ctx context.Context, cm cache.Manager, exec executor.Executor,
 		platform = req.Platform
 	}
 	ctr := &gatewayContainer{
-		id:         req.ContainerID,
-		netMode:    req.NetMode,
-		hostname:   req.Hostname,
-		extraHosts: req.ExtraHosts,
-		platform:   platform,
-		executor:   exec,
-		sm:         sm,
-		group:      g,
-		errGroup:   eg,
-		ctx:        ctx,
-		cancel:     cancel,
+		id:           req.ContainerID,
+		netMode:      req.NetMode,
+		pbMounts:     pbMounts,
+		evaluateExec: req.EvaluateExec,
+		hostname:     req.Hostname,
+		extraHosts:   req.ExtraHosts,
+		platform:     platform,
+		executor:     exec,
+		sm:           sm,
+		group:        g,
+		errGroup:     eg,
+		ctx:          ctx,
+		cancel:       cancel,
 	}
 
 	var (
@@ -281,22 +299,24 @@ func PrepareMounts(ctx context.Context, mm *mounts.MountManager, cm cache.Manage
 }
 
 type gatewayContainer struct {
-	id         string
-	netMode    opspb.NetMode
-	hostname   string
-	extraHosts []executor.HostIP
-	platform   *opspb.Platform
-	rootFS     executor.Mount
-	mounts     []executor.Mount
-	executor   executor.Executor
-	sm         *session.Manager
-	group      session.Group
-	started    bool
-	errGroup   *errgroup.Group
-	mu         sync.Mutex
-	cleanup    []func() error
-	ctx        context.Context
-	cancel     func(error)
+	id           string
+	netMode      opspb.NetMode
+	hostname     string
+	extraHosts   []executor.HostIP
+	platform     *opspb.Platform
+	rootFS       executor.Mount
+	mounts       []executor.Mount
+	pbMounts     []*opspb.Mount
+	evaluateExec func(context.Context, *opspb.ExecOp) error
+	executor     executor.Executor
+	sm           *session.Manager
+	group        session.Group
+	started      bool
+	errGroup     *errgroup.Group
+	mu           sync.Mutex
+	cleanup      []func() error
+	ctx          context.Context
+	cancel       func(error)
 }
 
 func (gwCtr *gatewayContainer) Start(ctx context.Context, req client.StartRequest) (client.ContainerProcess, error) {
@@ -329,6 +349,22 @@ func (gwCtr *gatewayContainer) Start(ctx context.Context, req client.StartReques
 		procInfo.Meta.Env = addDefaultEnvvar(procInfo.Meta.Env, "TERM", "xterm")
 	}
 
+	if gwCtr.evaluateExec != nil {
+		if err := gwCtr.evaluateExec(ctx, &opspb.ExecOp{
+			Meta: &opspb.Meta{
+				Args: procInfo.Meta.Args,
+				Env:  procInfo.Meta.Env,
+				Cwd:  procInfo.Meta.Cwd,
+				User: procInfo.Meta.User,
+			},
+			Network:  gwCtr.netMode,
+			Security: req.SecurityMode,
+			Mounts:   gwCtr.pbMounts,
+		}); err != nil {
+			return nil, errors.Wrap(err, "error evaluating the source policy")
+		}
+	}
+
 	secretEnv, err := gwCtr.loadSecretEnv(ctx, req.SecretEnv)
 	if err != nil {
 		return nil, err
@@ -240,6 +240,9 @@ func (c *BridgeClient) NewContainer(ctx context.Context, req client.NewContainer
 		Hostname:    req.Hostname,
 		Mounts:      make([]container.Mount, len(req.Mounts)),
 	}
+	if ev, ok := c.FrontendLLBBridge.(frontend.ExecPolicyEvaluator); ok {
+		ctrReq.EvaluateExec = ev.EvaluateExec
+	}
 
 	eg, ctx := errgroup.WithContext(ctx)
 
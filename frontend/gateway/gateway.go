@@ -1110,6 +1110,9 @@ func (lbf *llbBridgeForwarder) NewContainer(ctx context.Context, in *pb.NewConta
 		Platform:    in.Platform,
 		Constraints: in.Constraints,
 	}
+	if ev, ok := lbf.llbBridge.(frontend.ExecPolicyEvaluator); ok {
+		ctrReq.EvaluateExec = ev.EvaluateExec
+	}
 
 	for _, m := range in.Mounts {
 		var workerRef *worker.WorkerRef
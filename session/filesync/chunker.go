@@ -0,0 +1,67 @@
+package filesync
+
+import (
+	"bufio"
+	"io"
+)
+
+// Files are split into chunks with a gear based rolling hash as described in
+// the FastCDC paper. Both sides of a transfer need to use the same parameters
+// and gear table for the chunks to match.
+const (
+	minChunkSize = 16 << 10
+	maxChunkSize = 256 << 10
+	// chunkMask selects the top 16 bits of the hash for an average chunk
+	// size of about 64KiB
+	chunkMask = uint64(0xffff) << 48
+)
+
+var gearTable = func() (t [256]uint64) {
+	// splitmix64 with a fixed seed so the table is stable across versions
+	x := uint64(0x6275696c646b6974)
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// chunker splits the data read from a reader into content-defined chunks.
+type chunker struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{
+		r:   bufio.NewReaderSize(r, maxChunkSize),
+		buf: make([]byte, 0, maxChunkSize),
+	}
+}
+
+// Next returns the next chunk or io.EOF after the last chunk. The returned
+// slice is only valid until the next call to Next.
+func (c *chunker) Next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var h uint64
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(c.buf) > 0 {
+				return c.buf, nil
+			}
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		if len(c.buf) < minChunkSize {
+			continue
+		}
+		h = (h << 1) + gearTable[b]
+		if h&chunkMask == 0 || len(c.buf) >= maxChunkSize {
+			return c.buf, nil
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package filesync
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/containerd/continuity/fs"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxIndexedFiles limits the number of files in a ChunkIndex. The most
+	// recently received files are kept.
+	maxIndexedFiles = 256
+	// maxKnownChunks limits the number of chunks that the receiver
+	// advertises to the sender.
+	maxKnownChunks = 1 << 16
+)
+
+// ChunkIndex is an index of the chunks of the large files received into a
+// destination directory with the diffcopychunked protocol. The receiver
+// advertises the chunks of all the indexed files, so files that were renamed
+// or moved since the previous transfer are deduplicated as well. The caller
+// of FSSync keeps an index per destination, e.g. per shared key of a local
+// source. Passing an index to FSSync enables the chunked transfer.
+type ChunkIndex struct {
+	mu    sync.Mutex
+	files map[string]*indexedFile
+	seq   uint64
+}
+
+// indexedFile is a file in the destination. Its chunks are only used while
+// the file still has the size and modification time it was received with.
+type indexedFile struct {
+	size    int64
+	modTime int64
+	chunks  []indexedChunk
+	seq     uint64
+}
+
+type indexedChunk struct {
+	key    chunkKey
+	offset int64
+	size   int
+}
+
+func NewChunkIndex() *ChunkIndex {
+	return &ChunkIndex{
+		files: make(map[string]*indexedFile),
+	}
+}
+
+// open opens the indexed files that are unchanged in dest, most recently
+// received first. The files are kept open as fsutil replaces or removes them
+// before the content of the new files is received.
+func (idx *ChunkIndex) open(dest string) *chunkSource {
+	src := &chunkSource{
+		chunks: make(map[chunkKey]chunkRef),
+	}
+	// open files can't be replaced on Windows
+	if runtime.GOOS == "windows" {
+		return src
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, p := range idx.sorted() {
+		f := idx.files[p]
+		if len(src.known)+len(f.chunks) > maxKnownChunks {
+			continue
+		}
+		fp, err := fs.RootPath(dest, filepath.FromSlash(p))
+		if err != nil {
+			continue
+		}
+		fh, err := os.Open(fp)
+		if err != nil {
+			continue
+		}
+		if fi, err := fh.Stat(); err != nil || !f.matches(fi) {
+			fh.Close()
+			continue
+		}
+		src.files = append(src.files, fh)
+		for _, c := range f.chunks {
+			if _, ok := src.chunks[c.key]; ok {
+				continue
+			}
+			src.chunks[c.key] = chunkRef{f: fh, offset: c.offset, size: c.size}
+			src.known = append(src.known, c.key[:])
+		}
+	}
+	return src
+}
+
+// update adds the received files to the index and removes the files that
+// changed in dest.
+func (idx *ChunkIndex) update(dest string, received []*receivedFile) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, rf := range received {
+		idx.seq++
+		idx.files[rf.stat.Path] = &indexedFile{
+			size:    rf.stat.Size,
+			modTime: rf.stat.ModTime,
+			chunks:  rf.chunks,
+			seq:     idx.seq,
+		}
+	}
+	for i, p := range idx.sorted() {
+		f := idx.files[p]
+		if i < maxIndexedFiles {
+			fp, err := fs.RootPath(dest, filepath.FromSlash(p))
+			if err == nil {
+				if fi, err := os.Lstat(fp); err == nil && f.matches(fi) && f.offset() == f.size {
+					continue
+				}
+			}
+		}
+		delete(idx.files, p)
+	}
+}
+
+// sorted returns the paths of the indexed files, most recently received
+// first.
+func (idx *ChunkIndex) sorted() []string {
+	paths := make([]string, 0, len(idx.files))
+	for p := range idx.files {
+		paths = append(paths, p)
+	}
+	slices.SortFunc(paths, func(a, b string) int {
+		return cmp.Compare(idx.files[b].seq, idx.files[a].seq)
+	})
+	return paths
+}
+
+func (f *indexedFile) matches(fi os.FileInfo) bool {
+	return fi.Mode().IsRegular() && fi.Size() == f.size && fi.ModTime().UnixNano() == f.modTime
+}
+
+// offset returns the size of the file described by its chunks.
+func (f *indexedFile) offset() int64 {
+	if len(f.chunks) == 0 {
+		return 0
+	}
+	last := f.chunks[len(f.chunks)-1]
+	return last.offset + int64(last.size)
+}
+
+// chunkSource is the opened indexed files of a transfer.
+type chunkSource struct {
+	files  []*os.File
+	chunks map[chunkKey]chunkRef
+	known  [][]byte
+}
+
+type chunkRef struct {
+	f      *os.File
+	offset int64
+	size   int
+}
+
+// read appends the data of a known chunk to dt.
+func (s *chunkSource) read(dt []byte, key chunkKey) ([]byte, error) {
+	ref, ok := s.chunks[key]
+	if !ok {
+		return nil, errors.Errorf("unknown chunk %x", key[:])
+	}
+	n := len(dt)
+	dt = slices.Grow(dt, ref.size)[:n+ref.size]
+	if _, err := ref.f.ReadAt(dt[n:], ref.offset); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return dt, nil
+}
+
+func (s *chunkSource) close() {
+	for _, f := range s.files {
+		f.Close()
+	}
+}
@@ -0,0 +1,344 @@
+package filesync
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tonistiigi/fsutil"
+	fstypes "github.com/tonistiigi/fsutil/types"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+)
+
+// The diffcopychunked protocol runs the diffcopy protocol over ChunkedPacket
+// messages. With its first request for file content, the receiver sends the
+// digests of the chunks of the files in its ChunkIndex, which are the files
+// received into the destination by previous transfers. The sender then sends
+// large files as a list of chunks and only includes the data of the chunks
+// that are not known to the receiver. The receiver assembles the files from
+// the received data and the indexed files before passing them on to fsutil,
+// and adds the received files to the index.
+const (
+	// minChunkedFileSize is the minimum size of a file to be sent in chunks.
+	// Smaller files are always sent whole.
+	minChunkedFileSize = 1 << 20
+	// maxChunkBatchSize limits the size of the file content described by a
+	// single message.
+	maxChunkBatchSize = 2 << 20
+)
+
+type chunkKey [sha256.Size]byte
+
+func sendDiffCopyChunked(stream Stream, fs fsutil.FS, progress progressCb) error {
+	eg, ctx := errgroup.WithContext(stream.Context())
+	s := &chunkedSender{
+		Stream: stream,
+		ctx:    ctx,
+		fs:     fs,
+		eg:     eg,
+		files:  make(map[uint32]*fstypes.Stat),
+		known:  make(map[chunkKey]struct{}),
+	}
+	eg.Go(func() error {
+		return sendDiffCopy(s, fs, progress)
+	})
+	return eg.Wait()
+}
+
+// chunkedSender is the stream passed to fsutil.Send. It handles the requests
+// for the content of large files itself.
+type chunkedSender struct {
+	Stream
+	ctx context.Context
+	fs  fsutil.FS
+	eg  *errgroup.Group
+
+	sendMu sync.Mutex
+
+	mu    sync.Mutex
+	files map[uint32]*fstypes.Stat
+	next  uint32
+	known map[chunkKey]struct{}
+}
+
+func (s *chunkedSender) Context() context.Context {
+	return s.ctx
+}
+
+func (s *chunkedSender) SendMsg(m any) error {
+	p, ok := m.(*fstypes.Packet)
+	if !ok {
+		return errors.Errorf("invalid message type %T", m)
+	}
+	if p.Type == fstypes.PACKET_STAT && p.Stat != nil {
+		// file IDs are the index of the stat packet
+		s.mu.Lock()
+		if os.FileMode(p.Stat.Mode).IsRegular() && p.Stat.Size >= minChunkedFileSize {
+			s.files[s.next] = p.Stat
+		}
+		s.next++
+		s.mu.Unlock()
+	}
+	return s.send(&ChunkedPacket{Packet: p})
+}
+
+func (s *chunkedSender) send(cp *ChunkedPacket) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.Stream.SendMsg(cp)
+}
+
+func (s *chunkedSender) RecvMsg(m any) error {
+	p, ok := m.(*fstypes.Packet)
+	if !ok {
+		return errors.Errorf("invalid message type %T", m)
+	}
+	for {
+		var cp ChunkedPacket
+		if err := s.Stream.RecvMsg(&cp); err != nil {
+			return err
+		}
+		pkt := cp.Packet
+		if pkt == nil {
+			return errors.New("invalid chunked packet without packet")
+		}
+		if pkt.Type == fstypes.PACKET_REQ {
+			s.mu.Lock()
+			for _, dt := range cp.KnownChunks {
+				if len(dt) == sha256.Size {
+					s.known[chunkKey(dt)] = struct{}{}
+				}
+			}
+			st, ok := s.files[pkt.ID]
+			delete(s.files, pkt.ID)
+			s.mu.Unlock()
+			if ok {
+				id := pkt.ID
+				s.eg.Go(func() error {
+					if err := s.sendChunks(id, st.Path); err != nil {
+						s.send(&ChunkedPacket{Packet: &fstypes.Packet{Type: fstypes.PACKET_ERR, Data: []byte(err.Error())}})
+						return err
+					}
+					return nil
+				})
+				continue
+			}
+		}
+		p.Type = pkt.Type
+		p.Stat = pkt.Stat
+		p.ID = pkt.ID
+		p.Data = pkt.Data
+		return nil
+	}
+}
+
+func (s *chunkedSender) isKnown(key chunkKey) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.known[key]
+	return ok
+}
+
+// sendChunks sends the file in chunks, leaving out the data of the chunks
+// that the receiver already has.
+func (s *chunkedSender) sendChunks(id uint32, path string) error {
+	// like fsutil, a file that can't be opened anymore is sent empty
+	if f, err := s.fs.Open(path); err == nil {
+		defer f.Close()
+		c := newChunker(f)
+		cp := &ChunkedPacket{Packet: &fstypes.Packet{Type: fstypes.PACKET_DATA, ID: id}}
+		size := 0
+		for {
+			dt, err := c.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return errors.Wrapf(err, "failed to read %s", path)
+			}
+			key := chunkKey(sha256.Sum256(dt))
+			chunk := &Chunk{Digest: key[:]}
+			if !s.isKnown(key) {
+				chunk.Data = append([]byte(nil), dt...)
+			}
+			cp.Chunks = append(cp.Chunks, chunk)
+			size += len(dt)
+			if size >= maxChunkBatchSize {
+				if err := s.send(cp); err != nil {
+					return err
+				}
+				cp = &ChunkedPacket{Packet: &fstypes.Packet{Type: fstypes.PACKET_DATA, ID: id}}
+				size = 0
+			}
+		}
+		if len(cp.Chunks) > 0 {
+			if err := s.send(cp); err != nil {
+				return err
+			}
+		}
+	}
+	return s.send(&ChunkedPacket{Packet: &fstypes.Packet{Type: fstypes.PACKET_DATA, ID: id}})
+}
+
+func recvDiffCopyChunked(ds grpc.ClientStream, index *ChunkIndex, dest string, cu CacheUpdater, progress progressCb, differ fsutil.DiffType, filter, metadataOnlyFilter func(string, *fstypes.Stat) bool) error {
+	// the indexed files are opened before fsutil replaces or removes any of
+	// them
+	src := index.open(dest)
+	defer src.close()
+	r := &chunkedReceiver{
+		ClientStream: ds,
+		src:          src,
+		progress:     progress,
+		files:        make(map[uint32]*receivedFile),
+	}
+	defer r.done()
+	// progress is reported by chunkedReceiver as fsutil would count the
+	// size of the assembled files instead of the transferred data
+	if err := recvDiffCopy(r, dest, cu, nil, differ, filter, metadataOnlyFilter); err != nil {
+		return err
+	}
+	index.update(dest, r.received())
+	return nil
+}
+
+// chunkedReceiver is the stream passed to fsutil.Receive. It advertises the
+// chunks of the indexed files and assembles the files from the received
+// chunks.
+type chunkedReceiver struct {
+	grpc.ClientStream
+	src      *chunkSource
+	progress progressCb
+	size     int
+	next     uint32
+
+	mu         sync.Mutex
+	advertised bool
+	files      map[uint32]*receivedFile
+}
+
+// receivedFile is a large file of the transfer and the chunks it was received
+// in.
+type receivedFile struct {
+	stat   *fstypes.Stat
+	chunks []indexedChunk
+	offset int64
+	done   bool
+}
+
+func (r *chunkedReceiver) RecvMsg(m any) error {
+	p, ok := m.(*fstypes.Packet)
+	if !ok {
+		return errors.Errorf("invalid message type %T", m)
+	}
+	var cp ChunkedPacket
+	if err := r.ClientStream.RecvMsg(&cp); err != nil {
+		return err
+	}
+	if r.progress != nil {
+		r.size += cp.SizeVT()
+		r.progress(r.size, false)
+	}
+	pkt := cp.Packet
+	if pkt == nil {
+		return errors.New("invalid chunked packet without packet")
+	}
+	switch pkt.Type {
+	case fstypes.PACKET_STAT:
+		if pkt.Stat != nil {
+			if os.FileMode(pkt.Stat.Mode).IsRegular() && pkt.Stat.Size >= minChunkedFileSize {
+				r.mu.Lock()
+				r.files[r.next] = &receivedFile{stat: pkt.Stat}
+				r.mu.Unlock()
+			}
+			r.next++
+		}
+	case fstypes.PACKET_DATA:
+		r.mu.Lock()
+		rf := r.files[pkt.ID]
+		r.mu.Unlock()
+		if len(cp.Chunks) > 0 {
+			dt, err := r.assemble(pkt.ID, rf, cp.Chunks)
+			if err != nil {
+				return err
+			}
+			pkt.Data = dt
+		} else if len(pkt.Data) == 0 && rf != nil {
+			rf.done = true
+		}
+	}
+	p.Type = pkt.Type
+	p.Stat = pkt.Stat
+	p.ID = pkt.ID
+	p.Data = pkt.Data
+	return nil
+}
+
+func (r *chunkedReceiver) SendMsg(m any) error {
+	p, ok := m.(*fstypes.Packet)
+	if !ok {
+		return errors.Errorf("invalid message type %T", m)
+	}
+	cp := &ChunkedPacket{Packet: p}
+	if p.Type == fstypes.PACKET_REQ {
+		r.mu.Lock()
+		if !r.advertised {
+			cp.KnownChunks = r.src.known
+			r.advertised = true
+		}
+		r.mu.Unlock()
+	}
+	return r.ClientStream.SendMsg(cp)
+}
+
+// assemble returns the data of the chunks, reading the chunks without data
+// from the indexed files, and records the chunks of the file.
+func (r *chunkedReceiver) assemble(id uint32, rf *receivedFile, chunks []*Chunk) ([]byte, error) {
+	var dt []byte
+	for _, c := range chunks {
+		if len(c.Digest) != sha256.Size {
+			return nil, errors.Errorf("invalid chunk %x for file %d", c.Digest, id)
+		}
+		key := chunkKey(c.Digest)
+		n := len(dt)
+		if len(c.Data) > 0 {
+			// the data is indexed under the digest for later transfers
+			if chunkKey(sha256.Sum256(c.Data)) != key {
+				return nil, errors.Errorf("digest mismatch for chunk %x of file %d", c.Digest, id)
+			}
+			dt = append(dt, c.Data...)
+		} else {
+			var err error
+			if dt, err = r.src.read(dt, key); err != nil {
+				return nil, errors.Wrapf(err, "failed to read chunk for file %d", id)
+			}
+		}
+		if rf != nil {
+			rf.chunks = append(rf.chunks, indexedChunk{key: key, offset: rf.offset, size: len(dt) - n})
+			rf.offset += int64(len(dt) - n)
+		}
+	}
+	return dt, nil
+}
+
+// received returns the large files that were completely received in chunks.
+func (r *chunkedReceiver) received() []*receivedFile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*receivedFile
+	for _, rf := range r.files {
+		if rf.done && len(rf.chunks) > 0 {
+			out = append(out, rf)
+		}
+	}
+	return out
+}
+
+func (r *chunkedReceiver) done() {
+	if r.progress != nil {
+		r.progress(r.size, true)
+	}
+}
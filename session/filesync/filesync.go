@@ -72,6 +72,10 @@ func (sp *fsSyncProvider) DiffCopy(stream FileSync_DiffCopyServer) error {
 	return sp.handle("diffcopy", stream)
 }
 
+func (sp *fsSyncProvider) DiffCopyChunked(stream FileSync_DiffCopyChunkedServer) error {
+	return sp.handle("diffcopychunked", stream)
+}
+
 func (sp *fsSyncProvider) TarStream(stream FileSync_TarStreamServer) error {
 	return sp.handle("tarstream", stream)
 }
@@ -149,6 +153,12 @@ type protocol struct {
 }
 
 var supportedProtocols = []protocol{
+	{
+		// diffcopychunked is only used for requests with a ChunkIndex and
+		// receives with recvDiffCopyChunked
+		name:   "diffcopychunked",
+		sendFn: sendDiffCopyChunked,
+	},
 	{
 		name:   "diffcopy",
 		sendFn: sendDiffCopy,
@@ -169,6 +179,9 @@ type FSSendRequestOpt struct {
 	Differ             fsutil.DiffType
 	MetadataOnly       bool
 	MetadataOnlyFilter func(string, *fstypes.Stat) bool
+	// ChunkIndex enables the chunked transfer of large files. It is updated
+	// with the files received into DestDir.
+	ChunkIndex *ChunkIndex
 }
 
 // CacheUpdater is an object capable of sending notifications for the cache hash changes
@@ -182,6 +195,9 @@ type CacheUpdater interface {
 func FSSync(ctx context.Context, c session.Caller, opt FSSendRequestOpt) error {
 	var pr *protocol
 	for _, p := range supportedProtocols {
+		if p.name == "diffcopychunked" && opt.ChunkIndex == nil {
+			continue
+		}
 		if c.Supports(session.MethodURL(FileSync_ServiceDesc.ServiceName, p.name)) {
 			pr = &p
 			break
@@ -231,6 +247,12 @@ func FSSync(ctx context.Context, c session.Caller, opt FSSendRequestOpt) error {
 			return err
 		}
 		stream = cc
+	case "diffcopychunked":
+		cc, err := client.DiffCopyChunked(ctx)
+		if err != nil {
+			return err
+		}
+		stream = cc
 	default:
 		panic(fmt.Sprintf("invalid protocol: %q", pr.name))
 	}
@@ -244,6 +266,9 @@ func FSSync(ctx context.Context, c session.Caller, opt FSSendRequestOpt) error {
 		}
 	}
 
+	if pr.name == "diffcopychunked" {
+		return recvDiffCopyChunked(stream, opt.ChunkIndex, opt.DestDir, opt.CacheUpdater, opt.ProgressCb, opt.Differ, opt.Filter, metadataOnlyFilter)
+	}
 	return pr.recvFn(stream, opt.DestDir, opt.CacheUpdater, opt.ProgressCb, opt.Differ, opt.Filter, metadataOnlyFilter)
 }
 
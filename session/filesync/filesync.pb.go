@@ -67,16 +67,144 @@ func (x *BytesMessage) GetData() []byte {
 	return nil
 }
 
+// ChunkedPacket is a message of the DiffCopyChunked protocol.
+type ChunkedPacket struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// packet of the DiffCopy protocol
+	Packet *types.Packet `protobuf:"bytes,1,opt,name=packet,proto3" json:"packet,omitempty"`
+	// known_chunks is set by the receiver on its first request for file
+	// content to the digests of the chunks of the files it already has.
+	KnownChunks [][]byte `protobuf:"bytes,2,rep,name=known_chunks,json=knownChunks,proto3" json:"known_chunks,omitempty"`
+	// chunks is set by the sender on a data packet instead of the data
+	Chunks        []*Chunk `protobuf:"bytes,3,rep,name=chunks,proto3" json:"chunks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChunkedPacket) Reset() {
+	*x = ChunkedPacket{}
+	mi := &file_github_com_moby_buildkit_session_filesync_filesync_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChunkedPacket) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChunkedPacket) ProtoMessage() {}
+
+func (x *ChunkedPacket) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_moby_buildkit_session_filesync_filesync_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChunkedPacket.ProtoReflect.Descriptor instead.
+func (*ChunkedPacket) Descriptor() ([]byte, []int) {
+	return file_github_com_moby_buildkit_session_filesync_filesync_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ChunkedPacket) GetPacket() *types.Packet {
+	if x != nil {
+		return x.Packet
+	}
+	return nil
+}
+
+func (x *ChunkedPacket) GetKnownChunks() [][]byte {
+	if x != nil {
+		return x.KnownChunks
+	}
+	return nil
+}
+
+func (x *ChunkedPacket) GetChunks() []*Chunk {
+	if x != nil {
+		return x.Chunks
+	}
+	return nil
+}
+
+// Chunk is a content-defined chunk of a file.
+type Chunk struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// sha256 digest of the chunk
+	Digest []byte `protobuf:"bytes,1,opt,name=digest,proto3" json:"digest,omitempty"`
+	// data of the chunk, empty if the receiver already has the chunk
+	Data          []byte `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Chunk) Reset() {
+	*x = Chunk{}
+	mi := &file_github_com_moby_buildkit_session_filesync_filesync_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Chunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Chunk) ProtoMessage() {}
+
+func (x *Chunk) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_moby_buildkit_session_filesync_filesync_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Chunk.ProtoReflect.Descriptor instead.
+func (*Chunk) Descriptor() ([]byte, []int) {
+	return file_github_com_moby_buildkit_session_filesync_filesync_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Chunk) GetDigest() []byte {
+	if x != nil {
+		return x.Digest
+	}
+	return nil
+}
+
+func (x *Chunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
 var File_github_com_moby_buildkit_session_filesync_filesync_proto protoreflect.FileDescriptor
 
 const file_github_com_moby_buildkit_session_filesync_filesync_proto_rawDesc = "" +
 	"\n" +
 	"8github.com/moby/buildkit/session/filesync/filesync.proto\x12\x10moby.filesync.v1\x1a-github.com/tonistiigi/fsutil/types/wire.proto\"\"\n" +
 	"\fBytesMessage\x12\x12\n" +
-	"\x04data\x18\x01 \x01(\fR\x04data2\x83\x01\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\x91\x01\n" +
+	"\rChunkedPacket\x12,\n" +
+	"\x06packet\x18\x01 \x01(\v2\x14.fsutil.types.PacketR\x06packet\x12!\n" +
+	"\fknown_chunks\x18\x02 \x03(\fR\vknownChunks\x12/\n" +
+	"\x06chunks\x18\x03 \x03(\v2\x17.moby.filesync.v1.ChunkR\x06chunks\"3\n" +
+	"\x05Chunk\x12\x16\n" +
+	"\x06digest\x18\x01 \x01(\fR\x06digest\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data2\xdc\x01\n" +
 	"\bFileSync\x12:\n" +
 	"\bDiffCopy\x12\x14.fsutil.types.Packet\x1a\x14.fsutil.types.Packet(\x010\x01\x12;\n" +
-	"\tTarStream\x12\x14.fsutil.types.Packet\x1a\x14.fsutil.types.Packet(\x010\x012Z\n" +
+	"\tTarStream\x12\x14.fsutil.types.Packet\x1a\x14.fsutil.types.Packet(\x010\x01\x12W\n" +
+	"\x0fDiffCopyChunked\x12\x1f.moby.filesync.v1.ChunkedPacket\x1a\x1f.moby.filesync.v1.ChunkedPacket(\x010\x012Z\n" +
 	"\bFileSend\x12N\n" +
 	"\bDiffCopy\x12\x1e.moby.filesync.v1.BytesMessage\x1a\x1e.moby.filesync.v1.BytesMessage(\x010\x01B+Z)github.com/moby/buildkit/session/filesyncb\x06proto3"
 
@@ -92,23 +220,29 @@ func file_github_com_moby_buildkit_session_filesync_filesync_proto_rawDescGZIP()
 	return file_github_com_moby_buildkit_session_filesync_filesync_proto_rawDescData
 }
 
-var file_github_com_moby_buildkit_session_filesync_filesync_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_github_com_moby_buildkit_session_filesync_filesync_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
 var file_github_com_moby_buildkit_session_filesync_filesync_proto_goTypes = []any{
-	(*BytesMessage)(nil), // 0: moby.filesync.v1.BytesMessage
-	(*types.Packet)(nil), // 1: fsutil.types.Packet
+	(*BytesMessage)(nil),  // 0: moby.filesync.v1.BytesMessage
+	(*ChunkedPacket)(nil), // 1: moby.filesync.v1.ChunkedPacket
+	(*Chunk)(nil),         // 2: moby.filesync.v1.Chunk
+	(*types.Packet)(nil),  // 3: fsutil.types.Packet
 }
 var file_github_com_moby_buildkit_session_filesync_filesync_proto_depIdxs = []int32{
-	1, // 0: moby.filesync.v1.FileSync.DiffCopy:input_type -> fsutil.types.Packet
-	1, // 1: moby.filesync.v1.FileSync.TarStream:input_type -> fsutil.types.Packet
-	0, // 2: moby.filesync.v1.FileSend.DiffCopy:input_type -> moby.filesync.v1.BytesMessage
-	1, // 3: moby.filesync.v1.FileSync.DiffCopy:output_type -> fsutil.types.Packet
-	1, // 4: moby.filesync.v1.FileSync.TarStream:output_type -> fsutil.types.Packet
-	0, // 5: moby.filesync.v1.FileSend.DiffCopy:output_type -> moby.filesync.v1.BytesMessage
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	3, // 0: moby.filesync.v1.ChunkedPacket.packet:type_name -> fsutil.types.Packet
+	2, // 1: moby.filesync.v1.ChunkedPacket.chunks:type_name -> moby.filesync.v1.Chunk
+	3, // 2: moby.filesync.v1.FileSync.DiffCopy:input_type -> fsutil.types.Packet
+	3, // 3: moby.filesync.v1.FileSync.TarStream:input_type -> fsutil.types.Packet
+	1, // 4: moby.filesync.v1.FileSync.DiffCopyChunked:input_type -> moby.filesync.v1.ChunkedPacket
+	0, // 5: moby.filesync.v1.FileSend.DiffCopy:input_type -> moby.filesync.v1.BytesMessage
+	3, // 6: moby.filesync.v1.FileSync.DiffCopy:output_type -> fsutil.types.Packet
+	3, // 7: moby.filesync.v1.FileSync.TarStream:output_type -> fsutil.types.Packet
+	1, // 8: moby.filesync.v1.FileSync.DiffCopyChunked:output_type -> moby.filesync.v1.ChunkedPacket
+	0, // 9: moby.filesync.v1.FileSend.DiffCopy:output_type -> moby.filesync.v1.BytesMessage
+	6, // [6:10] is the sub-list for method output_type
+	2, // [2:6] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
 }
 
 func init() { file_github_com_moby_buildkit_session_filesync_filesync_proto_init() }
@@ -122,7 +256,7 @@ func file_github_com_moby_buildkit_session_filesync_filesync_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_github_com_moby_buildkit_session_filesync_filesync_proto_rawDesc), len(file_github_com_moby_buildkit_session_filesync_filesync_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   1,
+			NumMessages:   3,
 			NumExtensions: 0,
 			NumServices:   2,
 		},
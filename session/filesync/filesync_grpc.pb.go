@@ -20,8 +20,9 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	FileSync_DiffCopy_FullMethodName  = "/moby.filesync.v1.FileSync/DiffCopy"
-	FileSync_TarStream_FullMethodName = "/moby.filesync.v1.FileSync/TarStream"
+	FileSync_DiffCopy_FullMethodName        = "/moby.filesync.v1.FileSync/DiffCopy"
+	FileSync_TarStream_FullMethodName       = "/moby.filesync.v1.FileSync/TarStream"
+	FileSync_DiffCopyChunked_FullMethodName = "/moby.filesync.v1.FileSync/DiffCopyChunked"
 )
 
 // FileSyncClient is the client API for FileSync service.
@@ -32,6 +33,10 @@ const (
 type FileSyncClient interface {
 	DiffCopy(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[types.Packet, types.Packet], error)
 	TarStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[types.Packet, types.Packet], error)
+	// DiffCopyChunked works like DiffCopy but the content of large files is
+	// sent as content-defined chunks.
+	// Only the chunks that the receiver doesn't have yet contain data.
+	DiffCopyChunked(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ChunkedPacket, ChunkedPacket], error)
 }
 
 type fileSyncClient struct {
@@ -68,6 +73,19 @@ func (c *fileSyncClient) TarStream(ctx context.Context, opts ...grpc.CallOption)
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type FileSync_TarStreamClient = grpc.BidiStreamingClient[types.Packet, types.Packet]
 
+func (c *fileSyncClient) DiffCopyChunked(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ChunkedPacket, ChunkedPacket], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileSync_ServiceDesc.Streams[2], FileSync_DiffCopyChunked_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ChunkedPacket, ChunkedPacket]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSync_DiffCopyChunkedClient = grpc.BidiStreamingClient[ChunkedPacket, ChunkedPacket]
+
 // FileSyncServer is the server API for FileSync service.
 // All implementations should embed UnimplementedFileSyncServer
 // for forward compatibility.
@@ -76,6 +94,10 @@ type FileSync_TarStreamClient = grpc.BidiStreamingClient[types.Packet, types.Pac
 type FileSyncServer interface {
 	DiffCopy(grpc.BidiStreamingServer[types.Packet, types.Packet]) error
 	TarStream(grpc.BidiStreamingServer[types.Packet, types.Packet]) error
+	// DiffCopyChunked works like DiffCopy but the content of large files is
+	// sent as content-defined chunks.
+	// Only the chunks that the receiver doesn't have yet contain data.
+	DiffCopyChunked(grpc.BidiStreamingServer[ChunkedPacket, ChunkedPacket]) error
 }
 
 // UnimplementedFileSyncServer should be embedded to have
@@ -91,6 +113,9 @@ func (UnimplementedFileSyncServer) DiffCopy(grpc.BidiStreamingServer[types.Packe
 func (UnimplementedFileSyncServer) TarStream(grpc.BidiStreamingServer[types.Packet, types.Packet]) error {
 	return status.Errorf(codes.Unimplemented, "method TarStream not implemented")
 }
+func (UnimplementedFileSyncServer) DiffCopyChunked(grpc.BidiStreamingServer[ChunkedPacket, ChunkedPacket]) error {
+	return status.Errorf(codes.Unimplemented, "method DiffCopyChunked not implemented")
+}
 func (UnimplementedFileSyncServer) testEmbeddedByValue() {}
 
 // UnsafeFileSyncServer may be embedded to opt out of forward compatibility for this service.
@@ -125,6 +150,13 @@ func _FileSync_TarStream_Handler(srv interface{}, stream grpc.ServerStream) erro
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type FileSync_TarStreamServer = grpc.BidiStreamingServer[types.Packet, types.Packet]
 
+func _FileSync_DiffCopyChunked_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileSyncServer).DiffCopyChunked(&grpc.GenericServerStream[ChunkedPacket, ChunkedPacket]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileSync_DiffCopyChunkedServer = grpc.BidiStreamingServer[ChunkedPacket, ChunkedPacket]
+
 // FileSync_ServiceDesc is the grpc.ServiceDesc for FileSync service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -145,6 +177,12 @@ var FileSync_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "DiffCopyChunked",
+			Handler:       _FileSync_DiffCopyChunked_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "github.com/moby/buildkit/session/filesync/filesync.proto",
 }
@@ -1,13 +1,20 @@
 package filesync
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"testing"
 
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/session/testutil"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -82,3 +89,199 @@ func TestFileSyncIncludePatterns(t *testing.T) {
 	err = g.Wait()
 	require.NoError(t, err)
 }
+
+func TestFileSyncChunked(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("previous versions of files are not kept open on Windows")
+	}
+	ctx := context.TODO()
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	tmpFS, err := fsutil.NewFS(tmpDir)
+	require.NoError(t, err)
+	destDir := t.TempDir()
+
+	dt := make([]byte, 8<<20)
+	_, err = rand.Read(dt)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tmpDir, "large"), dt, 0600)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tmpDir, "small"), []byte("content1"), 0600)
+	require.NoError(t, err)
+
+	s, err := session.NewSession(ctx, "bar")
+	require.NoError(t, err)
+
+	m, err := session.NewManager()
+	require.NoError(t, err)
+
+	fs := NewFSSyncProvider(StaticDirSource{"test0": tmpFS})
+	s.Allow(fs)
+
+	dialer := session.Dialer(testutil.TestStream(testutil.Handler(m.HandleConn)))
+
+	g, ctx := errgroup.WithContext(context.Background())
+
+	g.Go(func() error {
+		return s.Run(ctx, dialer)
+	})
+
+	index := NewChunkIndex()
+	sync := func(c session.Caller, index *ChunkIndex) (int, error) {
+		var transferred int
+		err := FSSync(ctx, c, FSSendRequestOpt{
+			Name:       "test0",
+			DestDir:    destDir,
+			ChunkIndex: index,
+			ProgressCb: func(size int, last bool) {
+				if last {
+					transferred = size
+				}
+			},
+		})
+		return transferred, err
+	}
+
+	g.Go(func() (reterr error) {
+		defer func() {
+			err := s.Close()
+			if reterr == nil {
+				reterr = err
+			}
+		}()
+
+		c, err := m.Get(ctx, s.ID(), false)
+		if err != nil {
+			return err
+		}
+		if !c.Supports(session.MethodURL(FileSync_ServiceDesc.ServiceName, "diffcopychunked")) {
+			return errors.Errorf("chunked transfer not supported")
+		}
+
+		transferred, err := sync(c, index)
+		if err != nil {
+			return err
+		}
+		assert.Greater(t, transferred, len(dt))
+
+		// change a few bytes in the middle, append some data and move the
+		// file to another directory
+		copy(dt[3<<20:], "modified")
+		dt = append(dt, []byte("appended")...)
+		if err := os.Remove(filepath.Join(tmpDir, "large")); err != nil {
+			return err
+		}
+		if err := os.Mkdir(filepath.Join(tmpDir, "moved"), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, "moved", "large"), dt, 0600); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, "small"), []byte("content2"), 0600); err != nil {
+			return err
+		}
+
+		transferred, err = sync(c, index)
+		if err != nil {
+			return err
+		}
+		assert.Less(t, transferred, 1<<20)
+
+		if _, err := os.Stat(filepath.Join(destDir, "large")); !errors.Is(err, os.ErrNotExist) {
+			return errors.Errorf("expected large to be removed: %v", err)
+		}
+		dt2, err := os.ReadFile(filepath.Join(destDir, "moved", "large"))
+		if err != nil {
+			return err
+		}
+		assert.True(t, bytes.Equal(dt, dt2))
+
+		dt2, err = os.ReadFile(filepath.Join(destDir, "small"))
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, "content2", string(dt2))
+
+		// without an index the files are sent whole
+		copy(dt[5<<20:], "modified")
+		if err := os.WriteFile(filepath.Join(tmpDir, "moved", "large"), dt, 0600); err != nil {
+			return err
+		}
+		transferred, err = sync(c, nil)
+		if err != nil {
+			return err
+		}
+		assert.Greater(t, transferred, len(dt))
+
+		dt2, err = os.ReadFile(filepath.Join(destDir, "moved", "large"))
+		if err != nil {
+			return err
+		}
+		assert.True(t, bytes.Equal(dt, dt2))
+		return nil
+	})
+
+	err = g.Wait()
+	require.NoError(t, err)
+}
+
+func TestChunker(t *testing.T) {
+	t.Parallel()
+
+	dt := make([]byte, 4<<20)
+	_, err := rand.Read(dt)
+	require.NoError(t, err)
+
+	chunks := func(dt []byte) []string {
+		var out []string
+		c := newChunker(bytes.NewReader(dt))
+		var total int
+		for {
+			chunk, err := c.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(chunk), maxChunkSize)
+			total += len(chunk)
+			out = append(out, digest.FromBytes(chunk).String())
+		}
+		require.Equal(t, len(dt), total)
+		return out
+	}
+
+	c1 := chunks(dt)
+	require.Greater(t, len(c1), 16)
+	require.Equal(t, c1, chunks(dt))
+
+	// inserting data only changes the chunks around the insertion
+	dt2 := slices.Concat(dt[:1<<20], []byte("inserted"), dt[1<<20:])
+	c2 := chunks(dt2)
+	var same int
+	for _, c := range c2 {
+		if slices.Contains(c1, c) {
+			same++
+		}
+	}
+	require.GreaterOrEqual(t, same, len(c1)-2)
+}
+
+func TestChunkedReceiverDigestMismatch(t *testing.T) {
+	t.Parallel()
+
+	r := &chunkedReceiver{src: &chunkSource{chunks: make(map[chunkKey]chunkRef)}}
+	rf := &receivedFile{}
+	data := []byte("chunk data")
+	key := sha256.Sum256(data)
+
+	dt, err := r.assemble(0, rf, []*Chunk{{Digest: key[:], Data: data}})
+	require.NoError(t, err)
+	require.Equal(t, data, dt)
+	require.Len(t, rf.chunks, 1)
+
+	other := sha256.Sum256([]byte("other data"))
+	_, err = r.assemble(0, rf, []*Chunk{{Digest: other[:], Data: data}})
+	require.ErrorContains(t, err, "digest mismatch")
+	require.Len(t, rf.chunks, 1)
+}
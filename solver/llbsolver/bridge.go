@@ -42,6 +42,9 @@ type llbBridge struct {
 	cms                       map[string]solver.CacheManager
 	cmsMu                     sync.Mutex
 	sm                        *session.Manager
+	sourcePolicy              *DaemonSourcePolicy
+	pins                      sourcePins
+	policyWarnings            policyWarnings
 
 	executorOnce sync.Once
 	executorErr  error
@@ -71,6 +74,54 @@ func (b *llbBridge) Warn(ctx context.Context, dgst digest.Digest, msg string, op
 	})
 }
 
+// policyEngine returns the evaluator of the daemon policies, the source
+// policy of the build and the additional policies pol. Nil is returned if
+// there are no policies.
+func (b *llbBridge) policyEngine(w worker.Worker, ent entitlements.Set, pol []*spb.Policy) (SourcePolicyEvaluator, error) {
+	srcPol, err := loadSourcePolicy(b.builder)
+	if err != nil {
+		return nil, err
+	}
+	daemonPol := b.sourcePolicy.policies(w, ent)
+	if srcPol == nil && len(pol) == 0 && len(daemonPol) == 0 {
+		return nil, nil
+	}
+	for _, p := range pol {
+		if p == nil {
+			return nil, errors.Errorf("invalid nil policy")
+		}
+		if err := validateSourcePolicy(p); err != nil {
+			return nil, err
+		}
+	}
+	if srcPol != nil {
+		pol = append([]*spb.Policy{srcPol}, pol...)
+	}
+	return &pinningEvaluator{
+		SourcePolicyEvaluator: sourcepolicy.NewEngine(withDaemonPolicies(daemonPol, pol), sourcepolicy.WithDecisionHandler(b.onPolicyDecision)),
+		pins:                  &b.pins,
+	}, nil
+}
+
+// EvaluateExec evaluates a process that is not run by an exec op, e.g. a
+// custom exporter or a gateway container, against the exec rules of the
+// policies of the build.
+func (b *llbBridge) EvaluateExec(ctx context.Context, op *pb.ExecOp) error {
+	w, err := b.resolveWorker()
+	if err != nil {
+		return err
+	}
+	ent, err := loadEntitlements(b.builder)
+	if err != nil {
+		return err
+	}
+	polEngine, err := b.policyEngine(w, ent, nil)
+	if err != nil || polEngine == nil {
+		return err
+	}
+	return polEngine.EvaluateExec(ctx, op)
+}
+
 func (b *llbBridge) loadResult(ctx context.Context, def *pb.Definition, cacheImports []gw.CacheOptionsEntry, pol []*spb.Policy) (solver.CachedResultWithProvenance, error) {
 	w, err := b.resolveWorker()
 	if err != nil {
@@ -80,25 +131,10 @@ func (b *llbBridge) loadResult(ctx context.Context, def *pb.Definition, cacheImp
 	if err != nil {
 		return nil, err
 	}
-	srcPol, err := loadSourcePolicy(b.builder)
+	polEngine, err := b.policyEngine(w, ent, pol)
 	if err != nil {
 		return nil, err
 	}
-	var polEngine SourcePolicyEvaluator
-	if srcPol != nil || len(pol) > 0 {
-		for _, p := range pol {
-			if p == nil {
-				return nil, errors.Errorf("invalid nil policy")
-			}
-			if err := validateSourcePolicy(p); err != nil {
-				return nil, err
-			}
-		}
-		if srcPol != nil {
-			pol = append([]*spb.Policy{srcPol}, pol...)
-		}
-		polEngine = sourcepolicy.NewEngine(pol)
-	}
 	var cms []solver.CacheManager
 	for _, im := range cacheImports {
 		cmID, err := cmKey(im)
@@ -329,6 +365,9 @@ func (rp *resultProxy) Result(ctx context.Context) (res solver.CachedResult, err
 		if err == nil {
 			var capture *provenance.Capture
 			capture, err = captureProvenance(ctx, v)
+			if err == nil {
+				err = rp.b.pins.capture(ctx, v)
+			}
 			if err != nil {
 				err = errors.Errorf("failed to capture provenance: %v", err)
 				v.Release(context.TODO())
@@ -365,8 +404,14 @@ func (b *llbBridge) ResolveSourceMetadata(ctx context.Context, op *pb.SourceOp,
 	if pol != nil {
 		opt.SourcePolicies = append(opt.SourcePolicies, pol)
 	}
+	ent, err := loadEntitlements(b.builder)
+	if err != nil {
+		return nil, err
+	}
+	opt.SourcePolicies = withDaemonPolicies(b.sourcePolicy.policies(w, ent), opt.SourcePolicies)
 
-	if _, err := sourcepolicy.NewEngine(opt.SourcePolicies).Evaluate(ctx, op); err != nil {
+	polEngine := sourcepolicy.NewEngine(opt.SourcePolicies, sourcepolicy.WithDecisionHandler(b.onPolicyDecision))
+	if _, err := polEngine.Evaluate(ctx, op); err != nil {
 		return nil, errors.Wrap(err, "could not resolve image due to policy")
 	}
 
@@ -380,6 +425,9 @@ func (b *llbBridge) ResolveSourceMetadata(ctx context.Context, op *pb.SourceOp,
 	if err != nil {
 		return nil, err
 	}
+	if resp != nil && resp.Image != nil {
+		b.pins.resolve(op.Identifier, resp.Image.Digest)
+	}
 	return resp, nil
 }
 
@@ -0,0 +1,109 @@
+package llbsolver
+
+import (
+	"context"
+
+	"github.com/containerd/platforms"
+	"github.com/distribution/reference"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/client/llb/sourceresolver"
+	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/custom"
+	"github.com/moby/buildkit/frontend"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/util/entitlements"
+	"github.com/moby/buildkit/worker"
+	"github.com/pkg/errors"
+)
+
+// customExporter is implemented by exporters that run a container image.
+type customExporter interface {
+	SetBuild(custom.Build)
+}
+
+// setCustomExporterBuild sets the build of the exporters that run a container
+// image. They require the exporter.custom entitlement.
+func (s *Solver) setCustomExporterBuild(exporters []exporter.ExporterInstance, j *solver.Job) error {
+	var ent entitlements.Set
+	for _, exp := range exporters {
+		ce, ok := exp.(customExporter)
+		if !ok {
+			continue
+		}
+		if ent == nil {
+			var err error
+			if ent, err = loadEntitlements(j); err != nil {
+				return err
+			}
+		}
+		if !ent.Allowed(entitlements.EntitlementExporterCustom) {
+			return errors.Errorf("%s exporter requires the %s entitlement", client.ExporterCustom, entitlements.EntitlementExporterCustom)
+		}
+		br := s.bridge(j)
+		ce.SetBuild(custom.Build{
+			LoadImage: func(ctx context.Context, ref string, g session.Group) (cache.ImmutableRef, []byte, error) {
+				return loadExporterImage(ctx, br, ref, j.SessionID)
+			},
+			EvaluateExec: br.EvaluateExec,
+			NetworkHost:  ent.Allowed(entitlements.EntitlementNetworkHost),
+		})
+	}
+	return nil
+}
+
+// loadExporterImage pulls the image of a custom exporter for the default
+// platform through the bridge, the same way as the images of gateway
+// frontends, and returns its root filesystem and config.
+func loadExporterImage(ctx context.Context, br frontend.FrontendLLBBridge, ref string, sid string) (cache.ImmutableRef, []byte, error) {
+	platform := platforms.Normalize(platforms.DefaultSpec())
+	imr := sourceresolver.NewImageMetaResolver(br)
+	ref, dgst, config, err := imr.ResolveImageConfig(ctx, ref, sourceresolver.Opt{
+		Platform: &platform,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dgst != "" {
+		if named, err = reference.WithDigest(named, dgst); err != nil {
+			return nil, nil, err
+		}
+	}
+	def, err := llb.Image(named.String(), llb.Platform(platform)).Marshal(ctx, llb.Platform(platform))
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := br.Solve(ctx, frontend.SolveRequest{
+		Definition: def.ToPB(),
+	}, sid)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		ctx := context.WithoutCancel(ctx)
+		res.EachRef(func(ref solver.ResultProxy) error {
+			return ref.Release(ctx)
+		})
+	}()
+	if res.Ref == nil {
+		return nil, nil, errors.Errorf("exporter image %s didn't return default result", ref)
+	}
+	r, err := res.Ref.Result(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	workerRef, ok := r.Sys().(*worker.WorkerRef)
+	if !ok {
+		return nil, nil, errors.Errorf("invalid ref: %T", r.Sys())
+	}
+	if workerRef.ImmutableRef == nil {
+		return nil, config, nil
+	}
+	return workerRef.ImmutableRef.Clone(), config, nil
+}
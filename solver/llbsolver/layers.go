@@ -0,0 +1,165 @@
+package llbsolver
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/v2/pkg/labels"
+	"github.com/moby/buildkit/cache/config"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/util/compression"
+	"github.com/moby/buildkit/worker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// LayerSource is the build step that created a layer of a result.
+type LayerSource struct {
+	// DiffID is the digest of the uncompressed layer.
+	DiffID digest.Digest
+	// Vertex is the digest of the LLB vertex that created the layer. It is
+	// empty if the vertex isn't part of the definition of the result.
+	Vertex digest.Digest
+	// Name is the name of the vertex. For Dockerfile builds, it contains the
+	// stage and the instruction, e.g. "[build 2/4] RUN apk add git".
+	Name string
+	// Locations are the locations of the vertex in the source files of the
+	// build, from the source map of the definition.
+	Locations []SourceLocation
+}
+
+// SourceLocation is a range of lines of a source file.
+type SourceLocation struct {
+	Filename  string
+	StartLine int32
+	EndLine   int32
+}
+
+// LayerSources returns the build steps that created the layers of a result,
+// in the order of its layer chain. The blobs of the layers are created with
+// the default compression if they don't exist yet.
+//
+// A layer is attributed to the first vertex with a result that contains the
+// layer, so the layers of a base image are attributed to its source vertex.
+func LayerSources(ctx context.Context, res solver.ResultProxy, g session.Group) ([]LayerSource, error) {
+	r, err := res.Result(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wref, ok := r.Sys().(*worker.WorkerRef)
+	if !ok {
+		return nil, errors.Errorf("invalid worker ref %T", r.Sys())
+	}
+	if wref.ImmutableRef == nil {
+		return nil, nil
+	}
+	ctx = withDescHandlerCacheOpts(ctx, wref.ImmutableRef)
+
+	remotes, err := wref.ImmutableRef.GetRemotes(ctx, true, config.RefConfig{Compression: compression.New(compression.Default)}, false, g)
+	if err != nil {
+		return nil, err
+	}
+	if len(remotes) == 0 {
+		return nil, nil
+	}
+	out := make([]LayerSource, len(remotes[0].Descriptors))
+	for i, desc := range remotes[0].Descriptors {
+		out[i].DiffID = layerDiffID(desc)
+	}
+
+	e := newCacheExporter()
+	if _, err := r.CacheKeys()[0].Exporter.ExportTo(ctx, e, solver.CacheExportOpt{
+		ResolveRemotes:  resolveRemotes,
+		Mode:            solver.CacheExportModeRemoteOnly,
+		ExportRoots:     true,
+		IgnoreBacklinks: true,
+	}); err != nil {
+		return nil, err
+	}
+
+	def := res.Definition()
+	_, indexes, err := toBuildSteps(def, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// chainLen is the length of the shortest chain containing each layer
+	chainLen := make([]int, len(out))
+	for l, chains := range e.diffIDs {
+		idx, ok := indexes[l.digest]
+		if !ok {
+			continue
+		}
+		for _, chain := range chains {
+			if !isChainPrefix(chain, out) {
+				continue
+			}
+			for i := range chain {
+				if cur := out[i].Vertex; cur != "" && (chainLen[i] < len(chain) || chainLen[i] == len(chain) && indexes[cur] < idx) {
+					continue
+				}
+				out[i].Vertex = l.digest
+				chainLen[i] = len(chain)
+			}
+		}
+	}
+
+	for i, ls := range out {
+		if ls.Vertex == "" {
+			continue
+		}
+		if md, ok := def.Metadata[string(ls.Vertex)]; ok {
+			out[i].Name = md.Description["llb.customname"]
+		}
+		out[i].Locations = sourceLocations(def, ls.Vertex)
+	}
+	return out, nil
+}
+
+func isChainPrefix(chain []digest.Digest, layers []LayerSource) bool {
+	if len(chain) == 0 || len(chain) > len(layers) {
+		return false
+	}
+	for i, dgst := range chain {
+		if layers[i].DiffID != dgst {
+			return false
+		}
+	}
+	return true
+}
+
+func sourceLocations(def *pb.Definition, dgst digest.Digest) []SourceLocation {
+	if def.Source == nil {
+		return nil
+	}
+	locs, ok := def.Source.Locations[string(dgst)]
+	if !ok {
+		return nil
+	}
+	var out []SourceLocation
+	for _, loc := range locs.Locations {
+		if loc.SourceIndex < 0 || int(loc.SourceIndex) >= len(def.Source.Infos) {
+			continue
+		}
+		filename := def.Source.Infos[loc.SourceIndex].Filename
+		for _, r := range loc.Ranges {
+			out = append(out, SourceLocation{
+				Filename:  filename,
+				StartLine: r.GetStart().GetLine(),
+				EndLine:   r.GetEnd().GetLine(),
+			})
+		}
+	}
+	return out
+}
+
+// layerDiffID returns the uncompressed digest of a layer, falling back to
+// the digest for layers without the uncompressed annotation.
+func layerDiffID(desc ocispecs.Descriptor) digest.Digest {
+	if v, ok := desc.Annotations[labels.LabelUncompressed]; ok {
+		return digest.Digest(v)
+	}
+	return desc.Digest
+}
@@ -0,0 +1,48 @@
+package llbsolver
+
+import (
+	"testing"
+
+	"github.com/moby/buildkit/solver/pb"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsChainPrefix(t *testing.T) {
+	layers := []LayerSource{
+		{DiffID: digest.FromString("a")},
+		{DiffID: digest.FromString("b")},
+		{DiffID: digest.FromString("c")},
+	}
+	require.True(t, isChainPrefix([]digest.Digest{digest.FromString("a")}, layers))
+	require.True(t, isChainPrefix([]digest.Digest{digest.FromString("a"), digest.FromString("b"), digest.FromString("c")}, layers))
+	require.False(t, isChainPrefix(nil, layers))
+	require.False(t, isChainPrefix([]digest.Digest{digest.FromString("b")}, layers))
+	require.False(t, isChainPrefix([]digest.Digest{digest.FromString("a"), digest.FromString("b"), digest.FromString("c"), digest.FromString("d")}, layers))
+}
+
+func TestSourceLocations(t *testing.T) {
+	dgst := digest.FromString("op")
+	def := &pb.Definition{
+		Source: &pb.Source{
+			Infos: []*pb.SourceInfo{{Filename: "Dockerfile"}},
+			Locations: map[string]*pb.Locations{
+				string(dgst): {
+					Locations: []*pb.Location{
+						{
+							SourceIndex: 0,
+							Ranges: []*pb.Range{
+								{Start: &pb.Position{Line: 3}, End: &pb.Position{Line: 4}},
+							},
+						},
+						// invalid source indexes are ignored
+						{SourceIndex: 1, Ranges: []*pb.Range{{Start: &pb.Position{Line: 1}}}},
+					},
+				},
+			},
+		},
+	}
+	require.Equal(t, []SourceLocation{{Filename: "Dockerfile", StartLine: 3, EndLine: 4}}, sourceLocations(def, dgst))
+	require.Nil(t, sourceLocations(def, digest.FromString("other")))
+	require.Nil(t, sourceLocations(&pb.Definition{}, dgst))
+}
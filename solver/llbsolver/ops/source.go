@@ -5,14 +5,17 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/moby/buildkit/cache/contenthash"
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/solver/llbsolver/ops/opsutils"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/source"
+	srctypes "github.com/moby/buildkit/source/types"
 	"github.com/moby/buildkit/util/cachedigest"
 	"github.com/moby/buildkit/worker"
 	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
 	"golang.org/x/sync/semaphore"
 )
 
@@ -51,6 +54,10 @@ func NewSourceOp(vtx solver.Vertex, op *pb.Op_Source, platform *pb.Platform, sm
 
 func (s *SourceOp) IsProvenanceProvider() {}
 
+func (s *SourceOp) Proto() *pb.SourceOp {
+	return s.op.Source
+}
+
 func (s *SourceOp) Pin() (source.Identifier, string) {
 	return s.id, s.pin
 }
@@ -113,6 +120,18 @@ func (s *SourceOp) Exec(ctx context.Context, g session.Group, _ []solver.Result)
 	if err != nil {
 		return nil, err
 	}
+	if s.id.Scheme() == srctypes.LocalScheme && ref != nil {
+		// local sources are pinned by the checksum of the transferred files
+		// for provenance. The checksums were computed during the transfer.
+		dgst, err := contenthash.Checksum(ctx, ref, "/", contenthash.ChecksumOpts{}, g)
+		if err != nil {
+			ref.Release(context.WithoutCancel(ctx))
+			return nil, errors.Wrap(err, "failed to calculate checksum of local source")
+		}
+		s.mu.Lock()
+		s.pin = dgst.String()
+		s.mu.Unlock()
+	}
 	return []solver.Result{worker.NewWorkerRefResult(ref, s.w)}, nil
 }
 
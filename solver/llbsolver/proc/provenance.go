@@ -31,6 +31,15 @@ func ProvenanceProcessor(slsaVersion provenancetypes.ProvenanceSLSA, attrs map[s
 			inlineOnly = true
 		}
 
+		var sign bool
+		if v, ok := attrs["sign"]; ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse sign flag %q", v)
+			}
+			sign = b
+		}
+
 		for _, p := range ps.Platforms {
 			cp, ok := res.Provenance.FindRef(p.ID)
 			if !ok {
@@ -61,6 +70,7 @@ func ProvenanceProcessor(slsaVersion provenancetypes.ProvenanceSLSA, attrs map[s
 				Metadata: map[string][]byte{
 					result.AttestationReasonKey:     []byte(result.AttestationReasonProvenance),
 					result.AttestationInlineOnlyKey: []byte(strconv.FormatBool(inlineOnly)),
+					result.AttestationSignKey:       []byte(strconv.FormatBool(sign)),
 				},
 				InToto: result.InTotoAttestation{
 					PredicateType: pc.PredicateType(),
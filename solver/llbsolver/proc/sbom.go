@@ -2,17 +2,29 @@ package proc
 
 import (
 	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/moby/buildkit/cache"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/client/llb/sourceresolver"
 	"github.com/moby/buildkit/executor/resources"
 	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	commonexptypes "github.com/moby/buildkit/exporter/exptypes"
 	"github.com/moby/buildkit/frontend"
 	"github.com/moby/buildkit/frontend/attestations/sbom"
+	gatewaypb "github.com/moby/buildkit/frontend/gateway/pb"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/solver/llbsolver"
+	builtinsbom "github.com/moby/buildkit/solver/llbsolver/sbom"
 	"github.com/moby/buildkit/solver/result"
 	"github.com/moby/buildkit/util/tracing"
+	"github.com/moby/buildkit/worker"
 	"github.com/pkg/errors"
 )
 
@@ -88,3 +100,259 @@ func SBOMProcessor(scannerRef string, useCache bool, resolveMode string, params
 		return res, nil
 	}
 }
+
+// BuiltinSBOMProcessor generates the SBOMs with the generator built into the
+// daemon, which scans the result filesystems without running a scanner image.
+// The format parameter selects an SPDX or CycloneDX document, and the
+// attribution parameter attributes the packages to the build steps that
+// introduced them.
+func BuiltinSBOMProcessor(params map[string]string) (llbsolver.Processor, error) {
+	var format builtinsbom.Format
+	var attribution bool
+	for k, v := range params {
+		switch k {
+		case "format":
+			var err error
+			if format, err = builtinsbom.ParseFormat(v); err != nil {
+				return nil, err
+			}
+		case "attribution":
+			var err error
+			if attribution, err = strconv.ParseBool(v); err != nil {
+				return nil, errors.Wrapf(err, "invalid sbom attribution %q", v)
+			}
+		default:
+			return nil, errors.Errorf("unsupported parameter %s for builtin sbom generator", k)
+		}
+	}
+	if format == "" {
+		format = builtinsbom.FormatSPDX
+	}
+
+	return func(ctx context.Context, res *llbsolver.Result, s *llbsolver.Solver, j *solver.Job, usage *resources.SysSampler) (*llbsolver.Result, error) {
+		// skip sbom generation if we already have an sbom
+		if sbom.HasSBOM(res.Result) {
+			return res, nil
+		}
+
+		ps, err := exptypes.ParsePlatforms(res.Metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		created := time.Now()
+		if v, ok := res.Metadata[commonexptypes.ExporterEpochKey]; ok && len(v) > 0 {
+			sde, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid SOURCE_DATE_EPOCH from frontend: %q", v)
+			}
+			created = time.Unix(sde, 0)
+		}
+
+		for _, p := range ps.Platforms {
+			ref, ok := res.FindRef(p.ID)
+			if !ok {
+				return nil, errors.Errorf("could not find ref %s", p.ID)
+			}
+			if ref == nil {
+				continue
+			}
+
+			res.AddAttestation(p.ID, llbsolver.Attestation{
+				Kind: gatewaypb.AttestationKind_InToto,
+				Metadata: map[string][]byte{
+					result.AttestationReasonKey: []byte(result.AttestationReasonSBOM),
+					result.AttestationSBOMCore:  []byte(sbom.CoreSBOMName),
+				},
+				InToto: result.InTotoAttestation{
+					PredicateType: format.PredicateType(),
+				},
+				Path: sbom.CoreSBOMName + format.Extension(),
+				ContentFunc: func(ctx context.Context) ([]byte, error) {
+					span, ctx := tracing.StartSpan(ctx, "create sbom attestation")
+					defer span.End()
+
+					c, err := scanRef(ctx, ref, j.SessionID, attribution)
+					if err != nil {
+						return nil, err
+					}
+					return builtinsbom.Encode(c, format, p.ID, created)
+				},
+			})
+		}
+		return res, nil
+	}, nil
+}
+
+// scanRef scans the filesystem of a result with the builtin sbom generator.
+func scanRef(ctx context.Context, ref solver.ResultProxy, sessionID string, attribution bool) (*builtinsbom.Catalog, error) {
+	r, err := ref.Result(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wref, ok := r.Sys().(*worker.WorkerRef)
+	if !ok {
+		return nil, errors.Errorf("invalid worker ref %T", r.Sys())
+	}
+	if wref.ImmutableRef == nil {
+		// the result is an empty filesystem
+		return &builtinsbom.Catalog{}, nil
+	}
+
+	g := session.NewGroup(sessionID)
+	m, err := wref.ImmutableRef.Mount(ctx, true, g)
+	if err != nil {
+		return nil, err
+	}
+	lm := snapshot.LocalMounter(m)
+	root, err := lm.Mount()
+	if err != nil {
+		return nil, err
+	}
+	defer lm.Unmount()
+
+	c, err := builtinsbom.Scan(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if attribution {
+		if err := attributePackages(ctx, c, ref, wref.ImmutableRef, g); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// attributePackages attributes the packages to the build steps that created
+// the layers they were added in.
+func attributePackages(ctx context.Context, c *builtinsbom.Catalog, res solver.ResultProxy, ref cache.ImmutableRef, g session.Group) error {
+	sources, err := llbsolver.LayerSources(ctx, res, g)
+	if err != nil {
+		return err
+	}
+	chain := ref.LayerChain()
+	defer chain.Release(context.WithoutCancel(ctx))
+	if len(chain) != len(sources) {
+		return errors.New("layer chain and layer sources are not the same length")
+	}
+
+	files := make([]map[string]struct{}, len(chain))
+	for i, r := range chain {
+		list, err := r.FileList(ctx, g)
+		if err != nil {
+			return err
+		}
+		files[i] = map[string]struct{}{}
+		for _, f := range list {
+			f = path.Join("/", f)
+			// deleted files count as changed in the layer
+			if base, ok := strings.CutPrefix(path.Base(f), ".wh."); ok {
+				f = path.Join(path.Dir(f), base)
+			}
+			files[i][f] = struct{}{}
+		}
+	}
+
+	layers, err := packageLayers(c.Packages, files, func(i int, p string) ([]builtinsbom.Package, error) {
+		m, err := chain[i].Mount(ctx, true, g)
+		if err != nil {
+			return nil, err
+		}
+		lm := snapshot.LocalMounter(m)
+		root, err := lm.Mount()
+		if err != nil {
+			return nil, err
+		}
+		defer lm.Unmount()
+		return builtinsbom.ScanFile(root, p)
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, idx := range layers {
+		if idx < 0 {
+			continue
+		}
+		src := sources[idx]
+		a := &builtinsbom.Attribution{
+			Layer:  src.DiffID.String(),
+			Vertex: src.Vertex.String(),
+			Name:   src.Name,
+		}
+		for _, loc := range src.Locations {
+			s := fmt.Sprintf("%s:%d", loc.Filename, loc.StartLine)
+			if loc.EndLine > loc.StartLine {
+				s += fmt.Sprintf("-%d", loc.EndLine)
+			}
+			a.Sources = append(a.Sources, s)
+		}
+		c.Packages[i].Attribution = a
+	}
+	return nil
+}
+
+type packageKey struct {
+	Type, Name, Version string
+}
+
+// packageLayers returns the index of the layer each package was added in, or
+// -1 if no layer contains its location. files are the files changed by each
+// layer, and read returns the packages in a file as of a layer.
+//
+// A package is attributed to the topmost layer that changed its location,
+// except for packages that share their location with other packages, like
+// the ones in the dpkg, apk and rpm databases. The database is read in every
+// layer that changed it and these packages are attributed to the layer in
+// which their entry was added.
+func packageLayers(pkgs []builtinsbom.Package, files []map[string]struct{}, read func(i int, p string) ([]builtinsbom.Package, error)) ([]int, error) {
+	out := make([]int, len(pkgs))
+	byLocation := map[string][]int{}
+	for i, p := range pkgs {
+		out[i] = -1
+		for l := len(files) - 1; l >= 0; l-- {
+			if _, ok := files[l][p.Location]; ok {
+				out[i] = l
+				break
+			}
+		}
+		byLocation[p.Location] = append(byLocation[p.Location], i)
+	}
+
+	for loc, idxs := range byLocation {
+		if len(idxs) < 2 {
+			continue
+		}
+		added := map[packageKey]int{}
+		for l := range files {
+			if _, ok := files[l][loc]; !ok {
+				continue
+			}
+			lpkgs, err := read(l, loc)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read packages from %s in layer %d", loc, l)
+			}
+			current := make(map[packageKey]struct{}, len(lpkgs))
+			for _, p := range lpkgs {
+				k := packageKey{Type: p.Type, Name: p.Name, Version: p.Version}
+				current[k] = struct{}{}
+				if _, ok := added[k]; !ok {
+					added[k] = l
+				}
+			}
+			// packages removed in this layer are added again by a later one
+			for k := range added {
+				if _, ok := current[k]; !ok {
+					delete(added, k)
+				}
+			}
+		}
+		for _, i := range idxs {
+			p := pkgs[i]
+			if l, ok := added[packageKey{Type: p.Type, Name: p.Name, Version: p.Version}]; ok {
+				out[i] = l
+			}
+		}
+	}
+	return out, nil
+}
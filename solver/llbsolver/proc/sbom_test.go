@@ -0,0 +1,58 @@
+package proc
+
+import (
+	"testing"
+
+	builtinsbom "github.com/moby/buildkit/solver/llbsolver/sbom"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageLayers(t *testing.T) {
+	const status = "/var/lib/dpkg/status"
+	deb := func(name, version string) builtinsbom.Package {
+		return builtinsbom.Package{Type: "deb", Name: name, Version: version, Location: status}
+	}
+
+	// layer 0 is the base image, layers 1 and 2 both install packages, layer
+	// 3 adds a binary and layer 4 upgrades a package and removes another
+	db := [][]builtinsbom.Package{
+		{deb("base-files", "12"), deb("libc6", "2.36")},
+		{deb("base-files", "12"), deb("libc6", "2.36"), deb("curl", "7.88")},
+		{deb("base-files", "12"), deb("libc6", "2.36"), deb("curl", "7.88"), deb("git", "2.39")},
+		nil,
+		{deb("base-files", "12"), deb("libc6", "2.37"), deb("git", "2.39")},
+	}
+	files := []map[string]struct{}{
+		{status: {}, "/etc/os-release": {}},
+		{status: {}, "/usr/bin/curl": {}},
+		{status: {}, "/usr/bin/git": {}},
+		{"/usr/local/bin/app": {}},
+		{status: {}},
+	}
+	var reads []int
+	read := func(i int, p string) ([]builtinsbom.Package, error) {
+		require.Equal(t, status, p)
+		reads = append(reads, i)
+		return db[i], nil
+	}
+
+	pkgs := []builtinsbom.Package{
+		deb("base-files", "12"),
+		deb("git", "2.39"),
+		deb("libc6", "2.37"),
+		{Type: "golang", Name: "example.com/app", Version: "v1.0.0", Location: "/usr/local/bin/app"},
+		{Type: "golang", Name: "example.com/other", Version: "v1.0.0", Location: "/usr/local/bin/other"},
+	}
+	layers, err := packageLayers(pkgs, files, read)
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 2, 4, 3, -1}, layers)
+	require.Equal(t, []int{0, 1, 2, 4}, reads)
+
+	// a package removed and installed again is attributed to the layer that
+	// installed it again
+	db = append(db, []builtinsbom.Package{deb("base-files", "12"), deb("libc6", "2.37"), deb("git", "2.39"), deb("curl", "7.88")})
+	files = append(files, map[string]struct{}{status: {}})
+	layers, err = packageLayers([]builtinsbom.Package{deb("curl", "7.88"), deb("git", "2.39")}, files, read)
+	require.NoError(t, err)
+	require.Equal(t, []int{5, 2}, layers)
+}
@@ -3,6 +3,7 @@ package llbsolver
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -333,6 +334,7 @@ func captureProvenance(ctx context.Context, res solver.CachedResultWithProvenanc
 
 type ProvenanceCreator struct {
 	pr          *provenancetypes.ProvenancePredicateSLSA02
+	localDeps   []slsa1.ResourceDescriptor
 	slsaVersion provenancetypes.ProvenanceSLSA
 	j           *solver.Job
 	sampler     *resources.SysSampler
@@ -453,6 +455,7 @@ func NewProvenanceCreator(ctx context.Context, slsaVersion provenancetypes.Prove
 
 	pc := &ProvenanceCreator{
 		pr:          pr,
+		localDeps:   provenance.LocalDependencies(cp),
 		slsaVersion: slsaVersion,
 		j:           j,
 		addLayers:   addLayers,
@@ -489,7 +492,9 @@ func (p *ProvenanceCreator) Predicate(ctx context.Context) (any, error) {
 	}
 
 	if p.slsaVersion == provenancetypes.ProvenanceSLSA1 {
-		return p.pr.ConvertToSLSA1(), nil
+		pr := p.pr.ConvertToSLSA1()
+		pr.BuildDefinition.ResolvedDependencies = append(pr.BuildDefinition.ResolvedDependencies, p.localDeps...)
+		return pr, nil
 	}
 
 	return p.pr, nil
@@ -502,14 +507,18 @@ type edge struct {
 
 func newCacheExporter() *cacheExporter {
 	return &cacheExporter{
-		m:      map[any]struct{}{},
-		layers: map[edge][][]ocispecs.Descriptor{},
+		m:       map[any]struct{}{},
+		layers:  map[edge][][]ocispecs.Descriptor{},
+		diffIDs: map[edge][][]digest.Digest{},
 	}
 }
 
 type cacheExporter struct {
 	layers map[edge][][]ocispecs.Descriptor
-	m      map[any]struct{}
+	// diffIDs are the layer chains identified by the uncompressed digests,
+	// which are the same for all the compression variants.
+	diffIDs map[edge][][]digest.Digest
+	m       map[any]struct{}
 }
 
 func (ce *cacheExporter) Add(dgst digest.Digest) solver.CacheExporterRecord {
@@ -540,12 +549,19 @@ func (c *cacheRecord) AddResult(dgst digest.Digest, idx int, createdAt time.Time
 		index:  idx,
 	}
 	descs := make([]ocispecs.Descriptor, len(result.Descriptors))
+	diffIDs := make([]digest.Digest, len(result.Descriptors))
 	for i, desc := range result.Descriptors {
 		d := desc
 		d.Annotations = containerimage.RemoveInternalLayerAnnotations(d.Annotations, true)
 		descs[i] = d
+		diffIDs[i] = layerDiffID(desc)
 	}
 	c.ce.layers[e] = appendLayerChain(c.ce.layers[e], descs)
+	if !slices.ContainsFunc(c.ce.diffIDs[e], func(chain []digest.Digest) bool {
+		return slices.Equal(chain, diffIDs)
+	}) {
+		c.ce.diffIDs[e] = append(c.ce.diffIDs[e], diffIDs)
+	}
 }
 
 func (c *cacheRecord) LinkFrom(rec solver.CacheExporterRecord, index int, selector string) {
@@ -61,7 +61,7 @@ func (c *Capture) Sort() {
 		return cmp.Compare(a.Ref, b.Ref)
 	})
 	slices.SortFunc(c.Sources.Local, func(a, b provenancetypes.LocalSource) int {
-		return cmp.Compare(a.Name, b.Name)
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Digest, b.Digest))
 	})
 	slices.SortFunc(c.Sources.Git, func(a, b provenancetypes.GitSource) int {
 		return cmp.Compare(a.URL, b.URL)
@@ -128,7 +128,7 @@ func (c *Capture) AddImage(i provenancetypes.ImageSource) {
 
 func (c *Capture) AddLocal(l provenancetypes.LocalSource) {
 	for _, v := range c.Sources.Local {
-		if v.Name == l.Name {
+		if v.Name == l.Name && v.Digest == l.Digest {
 			return
 		}
 	}
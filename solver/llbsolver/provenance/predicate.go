@@ -1,11 +1,13 @@
 package provenance
 
 import (
+	"slices"
 	"strings"
 
 	"github.com/containerd/platforms"
 	slsa "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/common"
 	slsa02 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v0.2"
+	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
 	provenancetypes "github.com/moby/buildkit/solver/llbsolver/provenance/types"
 	"github.com/moby/buildkit/util/purl"
 	"github.com/moby/buildkit/util/urlutil"
@@ -83,6 +85,25 @@ func findMaterial(srcs provenancetypes.Sources, uri string) (*slsa.ProvenanceMat
 	return nil, false
 }
 
+// LocalDependencies returns the SLSA v1 resolved dependencies for the local
+// sources with a checksum. Local sources don't have a URI and are identified
+// by their name and the checksum of the transferred files.
+func LocalDependencies(c *Capture) []slsa1.ResourceDescriptor {
+	var out []slsa1.ResourceDescriptor
+	for _, s := range c.Sources.Local {
+		if s.Digest == "" {
+			continue
+		}
+		out = append(out, slsa1.ResourceDescriptor{
+			Name: provenancetypes.LocalDependencyPrefix + s.Name,
+			Digest: slsa.DigestSet{
+				s.Digest.Algorithm().String(): s.Digest.Hex(),
+			},
+		})
+	}
+	return out
+}
+
 func NewPredicate(c *Capture) (*provenancetypes.ProvenancePredicateSLSA02, error) {
 	materials, err := slsaMaterials(c.Sources)
 	if err != nil {
@@ -142,6 +163,13 @@ func NewPredicate(c *Capture) (*provenancetypes.ProvenancePredicateSLSA02, error
 		})
 	}
 	for _, s := range c.Sources.Local {
+		// the same local source can be transferred multiple times with
+		// different filters
+		if slices.ContainsFunc(inv.Parameters.Locals, func(l *provenancetypes.LocalSource) bool {
+			return l.Name == s.Name
+		}) {
+			continue
+		}
 		inv.Parameters.Locals = append(inv.Parameters.Locals, &provenancetypes.LocalSource{
 			Name: s.Name,
 		})
@@ -0,0 +1,43 @@
+package provenance
+
+import (
+	"testing"
+
+	provenancetypes "github.com/moby/buildkit/solver/llbsolver/provenance/types"
+	"github.com/moby/buildkit/version"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalDependencies(t *testing.T) {
+	dgst1 := digest.FromString("context")
+	dgst2 := digest.FromString("dockerignore")
+	c := &Capture{}
+	c.AddLocal(provenancetypes.LocalSource{Name: "context", Digest: dgst1})
+	c.AddLocal(provenancetypes.LocalSource{Name: "context", Digest: dgst2})
+	c.AddLocal(provenancetypes.LocalSource{Name: "context", Digest: dgst1})
+	c.AddLocal(provenancetypes.LocalSource{Name: "dockerfile"})
+	c.AddGit(provenancetypes.GitSource{URL: "https://github.com/moby/buildkit.git", Commit: "abc"})
+	c.Sort()
+
+	pr, err := NewPredicate(c)
+	require.NoError(t, err)
+	require.Equal(t, []*provenancetypes.LocalSource{{Name: "context"}, {Name: "dockerfile"}}, pr.Invocation.Parameters.Locals)
+	require.False(t, pr.Metadata.Completeness.Materials)
+
+	deps := LocalDependencies(c)
+	require.Len(t, deps, 2)
+	for _, d := range deps {
+		require.Equal(t, "local:context", d.Name)
+		require.Empty(t, d.URI)
+	}
+	require.ElementsMatch(t, []string{dgst1.Hex(), dgst2.Hex()}, []string{deps[0].Digest["sha256"], deps[1].Digest["sha256"]})
+
+	pr1 := pr.ConvertToSLSA1()
+	require.Equal(t, map[string]string{"buildkit": version.Version}, pr1.RunDetails.Builder.Version)
+	require.Len(t, pr1.BuildDefinition.ResolvedDependencies, 1)
+
+	// local dependencies without a URI are not converted to materials
+	pr1.BuildDefinition.ResolvedDependencies = append(pr1.BuildDefinition.ResolvedDependencies, deps...)
+	require.Len(t, pr1.ConvertToSLSA02().Materials, 1)
+}
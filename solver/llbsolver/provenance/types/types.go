@@ -8,6 +8,7 @@ import (
 	slsa1 "github.com/in-toto/in-toto-golang/in_toto/slsa_provenance/v1"
 	resourcestypes "github.com/moby/buildkit/executor/resources/types"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/version"
 	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
@@ -17,6 +18,10 @@ const (
 	BuildKitBuildType1  = "https://github.com/moby/buildkit/blob/master/docs/attestations/slsa-definitions.md"
 	BuildKitBuildType02 = "https://mobyproject.org/buildkit@v1"
 
+	// LocalDependencyPrefix is the prefix of the names of the resolved
+	// dependencies for local sources.
+	LocalDependencyPrefix = "local:"
+
 	ProvenanceSLSA1  = ProvenanceSLSA("v1")
 	ProvenanceSLSA02 = ProvenanceSLSA("v0.2")
 )
@@ -72,6 +77,8 @@ type HTTPSource struct {
 
 type LocalSource struct {
 	Name string `json:"name"`
+	// Digest is the checksum of the files transferred from the client.
+	Digest digest.Digest `json:"digest,omitempty"`
 }
 
 type Secret struct {
@@ -191,6 +198,10 @@ type BuildKitComplete struct {
 func (p *ProvenancePredicateSLSA1) ConvertToSLSA02() *ProvenancePredicateSLSA02 {
 	var materials []slsa02.ProvenanceMaterial
 	for _, m := range p.BuildDefinition.ResolvedDependencies {
+		if m.URI == "" {
+			// local sources are only recorded by name in the parameters
+			continue
+		}
 		materials = append(materials, slsa02.ProvenanceMaterial{
 			URI:    m.URI,
 			Digest: m.Digest,
@@ -291,10 +302,9 @@ func (p *ProvenancePredicateSLSA02) ConvertToSLSA1() *ProvenancePredicateSLSA1 {
 		ProvenanceRunDetails: slsa1.ProvenanceRunDetails{
 			Builder: slsa1.Builder{
 				ID: p.Builder.ID,
-				// TODO: handle builder components versions
-				// Version: map[string]string{
-				// 	"buildkit": version.Version,
-				// },
+				Version: map[string]string{
+					"buildkit": version.Version,
+				},
 			},
 		},
 		Metadata: meta,
@@ -0,0 +1,138 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/version"
+	"github.com/pkg/errors"
+)
+
+const cycloneDXSpecVersion = "1.5"
+
+// cycloneDXBOM is the subset of a CycloneDX document written by the
+// generator.
+type cycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components,omitempty"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string              `json:"timestamp"`
+	Tools     cycloneDXTools      `json:"tools"`
+	Component *cycloneDXComponent `json:"component,omitempty"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	BOMRef      string              `json:"bom-ref,omitempty"`
+	Type        string              `json:"type"`
+	Name        string              `json:"name"`
+	Version     string              `json:"version,omitempty"`
+	Description string              `json:"description,omitempty"`
+	PURL        string              `json:"purl,omitempty"`
+	Licenses    []cycloneDXLicense  `json:"licenses,omitempty"`
+	Properties  []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXLicense struct {
+	Expression string `json:"expression"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func encodeCycloneDX(c *Catalog, name string, created time.Time) ([]byte, error) {
+	dgst, err := catalogDigest(c, name)
+	if err != nil {
+		return nil, err
+	}
+	// the serial number is a UUID derived from the digest
+	h := dgst.Encoded()
+	bom := cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  cycloneDXSpecVersion,
+		SerialNumber: fmt.Sprintf("urn:uuid:%s-%s-5%s-8%s-%s", h[:8], h[8:12], h[13:16], h[17:20], h[20:32]),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: created.UTC().Format(time.RFC3339),
+			Tools: cycloneDXTools{
+				Components: []cycloneDXComponent{{
+					Type:    "application",
+					Name:    "buildkit",
+					Version: version.Version,
+				}},
+			},
+			Component: &cycloneDXComponent{
+				Type: "container",
+				Name: name,
+			},
+		},
+	}
+
+	files := map[string]File{}
+	for _, f := range c.Files {
+		files[f.Path] = f
+	}
+	for i, p := range c.Packages {
+		comp := cycloneDXComponent{
+			BOMRef:  fmt.Sprintf("%s-%d", p.Type, i),
+			Type:    "library",
+			Name:    p.Name,
+			Version: p.Version,
+			PURL:    p.PURL,
+			Properties: []cycloneDXProperty{
+				{Name: "buildkit:package:type", Value: p.Type},
+				{Name: "buildkit:location:0:path", Value: p.Location},
+			},
+		}
+		if len(p.Licenses) > 0 {
+			comp.Licenses = []cycloneDXLicense{{Expression: strings.Join(p.Licenses, " AND ")}}
+		}
+		if f, ok := files[p.Location]; ok {
+			comp.Properties = append(comp.Properties, cycloneDXProperty{
+				Name:  "buildkit:location:0:sha256",
+				Value: f.SHA256,
+			})
+		}
+		if a := p.Attribution; a != nil {
+			comp.Properties = append(comp.Properties, cycloneDXProperty{Name: "buildkit:layer:diffID", Value: a.Layer})
+			if a.Vertex != "" {
+				comp.Properties = append(comp.Properties, cycloneDXProperty{Name: "buildkit:vertex:digest", Value: a.Vertex})
+			}
+			if a.Name != "" {
+				comp.Properties = append(comp.Properties, cycloneDXProperty{Name: "buildkit:vertex:name", Value: a.Name})
+			}
+			for i, src := range a.Sources {
+				comp.Properties = append(comp.Properties, cycloneDXProperty{Name: fmt.Sprintf("buildkit:source:%d", i), Value: src})
+			}
+		}
+		bom.Components = append(bom.Components, comp)
+	}
+	if d := c.Distro; d != nil {
+		bom.Components = append(bom.Components, cycloneDXComponent{
+			BOMRef:      "os-" + d.qualifier(),
+			Type:        "operating-system",
+			Name:        d.ID,
+			Version:     d.VersionID,
+			Description: d.PrettyName,
+		})
+	}
+
+	dt, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode cyclonedx")
+	}
+	return dt, nil
+}
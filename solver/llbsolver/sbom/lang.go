@@ -0,0 +1,272 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"debug/buildinfo"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/package-url/packageurl-go"
+	"github.com/pelletier/go-toml"
+	"github.com/pkg/errors"
+)
+
+// executableMagics are the headers of the executable formats of Go
+// binaries: ELF, PE and Mach-O.
+var executableMagics = [][]byte{
+	[]byte("\x7fELF"),
+	[]byte("MZ"),
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xcf, 0xfa, 0xed, 0xfe},
+}
+
+func matchExecutable(_ string, d fs.DirEntry) bool {
+	fi, err := d.Info()
+	return err == nil && fi.Mode().Perm()&0o111 != 0
+}
+
+// parseGoBinary returns the main module, the dependencies and the standard
+// library of a Go binary. Other executables have no packages.
+func parseGoBinary(_ *scan, _ string, r io.ReaderAt, size int64) ([]Package, error) {
+	magic := make([]byte, 4)
+	if n, _ := r.ReadAt(magic, 0); n < len(magic) {
+		return nil, nil
+	}
+	isExecutable := false
+	for _, m := range executableMagics {
+		if bytes.HasPrefix(magic, m) {
+			isExecutable = true
+			break
+		}
+	}
+	if !isExecutable {
+		return nil, nil
+	}
+	bi, err := buildinfo.Read(r)
+	if err != nil {
+		// not a Go binary, or built without module support
+		return nil, nil
+	}
+
+	var pkgs []Package
+	add := func(name, version string) {
+		if name == "" {
+			return
+		}
+		ns, n := path.Split(name)
+		pkgs = append(pkgs, Package{
+			Type:    packageurl.TypeGolang,
+			Name:    name,
+			Version: version,
+			PURL:    newPURL(packageurl.TypeGolang, strings.TrimSuffix(ns, "/"), n, version, nil),
+		})
+	}
+	add(bi.Main.Path, bi.Main.Version)
+	for _, dep := range bi.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		add(dep.Path, dep.Version)
+	}
+	add("stdlib", bi.GoVersion)
+	return pkgs, nil
+}
+
+func matchNpm(p string, _ fs.DirEntry) bool {
+	switch base := path.Base(p); base {
+	case "package-lock.json", "npm-shrinkwrap.json":
+		return !strings.Contains(p, "/node_modules/")
+	case ".package-lock.json":
+		// hidden lockfile of the installed packages
+		return path.Base(path.Dir(p)) == "node_modules"
+	}
+	return false
+}
+
+type npmLockfile struct {
+	LockfileVersion int                          `json:"lockfileVersion"`
+	Packages        map[string]npmLockPackage    `json:"packages"`
+	Dependencies    map[string]npmLockDependency `json:"dependencies"`
+}
+
+type npmLockPackage struct {
+	Name    string          `json:"name"`
+	Version string          `json:"version"`
+	License json.RawMessage `json:"license"`
+	Link    bool            `json:"link"`
+}
+
+type npmLockDependency struct {
+	Version      string                       `json:"version"`
+	Dependencies map[string]npmLockDependency `json:"dependencies"`
+}
+
+// parseNpm parses the packages of an npm lockfile. The packages map of
+// lockfile versions 2 and 3 is preferred over the nested dependencies of
+// version 1.
+func parseNpm(_ *scan, _ string, r io.ReaderAt, size int64) ([]Package, error) {
+	var lf npmLockfile
+	if err := json.NewDecoder(io.NewSectionReader(r, 0, size)).Decode(&lf); err != nil {
+		return nil, errors.Wrap(err, "invalid npm lockfile")
+	}
+	seen := map[string]struct{}{}
+	var pkgs []Package
+	add := func(name, version string, licenses []string) {
+		if name == "" || version == "" {
+			return
+		}
+		if _, ok := seen[name+"@"+version]; ok {
+			return
+		}
+		seen[name+"@"+version] = struct{}{}
+		ns, n := "", name
+		if strings.HasPrefix(name, "@") {
+			ns, n, _ = strings.Cut(name, "/")
+		}
+		pkgs = append(pkgs, Package{
+			Type:     packageurl.TypeNPM,
+			Name:     name,
+			Version:  version,
+			PURL:     newPURL(packageurl.TypeNPM, ns, n, version, nil),
+			Licenses: licenses,
+		})
+	}
+	if len(lf.Packages) > 0 {
+		for p, pkg := range lf.Packages {
+			if p == "" || pkg.Link {
+				continue
+			}
+			name := pkg.Name
+			if name == "" {
+				_, name, _ = cutLast(p, "node_modules/")
+			}
+			add(name, pkg.Version, npmLicenses(pkg.License))
+		}
+		return pkgs, nil
+	}
+	var walk func(deps map[string]npmLockDependency)
+	walk = func(deps map[string]npmLockDependency) {
+		for name, dep := range deps {
+			add(name, dep.Version, nil)
+			walk(dep.Dependencies)
+		}
+	}
+	walk(lf.Dependencies)
+	return pkgs, nil
+}
+
+// npmLicenses returns the licenses of a license field, which is either an
+// SPDX expression or a deprecated object with a type.
+func npmLicenses(dt json.RawMessage) []string {
+	if len(dt) == 0 {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(dt, &s); err == nil && s != "" {
+		return []string{s}
+	}
+	var obj struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(dt, &obj); err == nil && obj.Type != "" {
+		return []string{obj.Type}
+	}
+	return nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func matchPip(p string, _ fs.DirEntry) bool {
+	switch base := path.Base(p); {
+	case base == "Pipfile.lock", base == "poetry.lock":
+		return true
+	case strings.HasPrefix(base, "requirements") && strings.HasSuffix(base, ".txt"):
+		return !strings.Contains(p, "/site-packages/") && !strings.Contains(p, "/dist-packages/")
+	}
+	return false
+}
+
+// pipRequirement matches the pinned requirements of a requirements file.
+var pipRequirement = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*===?\s*([^\s;#,]+)`)
+
+// parsePip parses the pinned packages of a requirements file, a Pipfile.lock
+// or a poetry.lock.
+func parsePip(_ *scan, p string, r io.ReaderAt, size int64) ([]Package, error) {
+	var pkgs []Package
+	add := func(name, version string) {
+		if name == "" || version == "" {
+			return
+		}
+		name = normalizePythonName(name)
+		pkgs = append(pkgs, Package{
+			Type:    packageurl.TypePyPi,
+			Name:    name,
+			Version: version,
+			PURL:    newPURL(packageurl.TypePyPi, "", name, version, nil),
+		})
+	}
+	sr := io.NewSectionReader(r, 0, size)
+	switch path.Base(p) {
+	case "Pipfile.lock":
+		var lf map[string]json.RawMessage
+		if err := json.NewDecoder(sr).Decode(&lf); err != nil {
+			return nil, errors.Wrap(err, "invalid Pipfile.lock")
+		}
+		for _, section := range []string{"default", "develop"} {
+			var deps map[string]struct {
+				Version string `json:"version"`
+			}
+			if dt, ok := lf[section]; ok {
+				if err := json.Unmarshal(dt, &deps); err != nil {
+					return nil, errors.Wrap(err, "invalid Pipfile.lock")
+				}
+			}
+			for name, dep := range deps {
+				add(name, strings.TrimPrefix(dep.Version, "=="))
+			}
+		}
+	case "poetry.lock":
+		var lf struct {
+			Package []struct {
+				Name    string `toml:"name"`
+				Version string `toml:"version"`
+			} `toml:"package"`
+		}
+		if err := toml.NewDecoder(sr).Decode(&lf); err != nil {
+			return nil, errors.Wrap(err, "invalid poetry.lock")
+		}
+		for _, pkg := range lf.Package {
+			add(pkg.Name, pkg.Version)
+		}
+	default:
+		s := bufio.NewScanner(sr)
+		for s.Scan() {
+			if m := pipRequirement.FindStringSubmatch(strings.TrimSpace(s.Text())); m != nil {
+				add(m[1], m[3])
+			}
+		}
+		if err := s.Err(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return pkgs, nil
+}
+
+var pythonNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePythonName normalizes a Python package name as in PEP 503.
+func normalizePythonName(name string) string {
+	return strings.ToLower(pythonNameSeparators.ReplaceAllString(name, "-"))
+}
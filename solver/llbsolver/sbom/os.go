@@ -0,0 +1,276 @@
+package sbom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/package-url/packageurl-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	dpkgStatus        = "/var/lib/dpkg/status"
+	dpkgStatusDir     = "/var/lib/dpkg/status.d"
+	apkInstalled      = "/lib/apk/db/installed"
+	rpmSQLite         = "/var/lib/rpm/rpmdb.sqlite"
+	rpmSQLiteSysimage = "/usr/lib/sysimage/rpm/rpmdb.sqlite"
+)
+
+func matchDpkg(p string, _ fs.DirEntry) bool {
+	return p == dpkgStatus || path.Dir(p) == dpkgStatusDir && !strings.HasSuffix(p, ".md5sums")
+}
+
+// parseDpkg parses the dpkg status file, or a file of the status.d
+// directory used by distroless images.
+func parseDpkg(c *scan, p string, r io.ReaderAt, size int64) ([]Package, error) {
+	var pkgs []Package
+	err := readStanzas(io.NewSectionReader(r, 0, size), ":", func(fields map[string]string) {
+		name, version := fields["Package"], fields["Version"]
+		if name == "" || version == "" {
+			return
+		}
+		if status, ok := fields["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			return
+		}
+		q := map[string]string{
+			"arch":   fields["Architecture"],
+			"distro": c.distro.qualifier(),
+		}
+		if src := fields["Source"]; src != "" {
+			// the source may be followed by its version in parentheses
+			src, _, _ = strings.Cut(src, " ")
+			if src != name {
+				q["upstream"] = src
+			}
+		}
+		pkgs = append(pkgs, Package{
+			Type:    packageurl.TypeDebian,
+			Name:    name,
+			Version: version,
+			PURL:    newPURL(packageurl.TypeDebian, c.distroNamespace("debian"), name, version, q),
+		})
+	})
+	return pkgs, err
+}
+
+func matchApk(p string, _ fs.DirEntry) bool {
+	return p == apkInstalled
+}
+
+// parseApk parses the apk database, in which the stanzas have single letter
+// keys.
+func parseApk(c *scan, p string, r io.ReaderAt, size int64) ([]Package, error) {
+	var pkgs []Package
+	err := readStanzas(io.NewSectionReader(r, 0, size), ":", func(fields map[string]string) {
+		name, version := fields["P"], fields["V"]
+		if name == "" || version == "" {
+			return
+		}
+		q := map[string]string{
+			"arch":   fields["A"],
+			"distro": c.distro.qualifier(),
+		}
+		if origin := fields["o"]; origin != "" && origin != name {
+			q["upstream"] = origin
+		}
+		var licenses []string
+		if l := fields["L"]; l != "" {
+			licenses = []string{l}
+		}
+		pkgs = append(pkgs, Package{
+			Type:     "apk",
+			Name:     name,
+			Version:  version,
+			PURL:     newPURL("apk", c.distroNamespace("alpine"), name, version, q),
+			Licenses: licenses,
+		})
+	})
+	return pkgs, err
+}
+
+// readStanzas calls fn with the fields of each stanza of a file made of
+// "key<sep> value" lines separated by blank lines. The continuation lines
+// of multi-line values are ignored.
+func readStanzas(r io.Reader, sep string, fn func(map[string]string)) error {
+	fields := map[string]string{}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		l := s.Text()
+		if strings.TrimSpace(l) == "" {
+			if len(fields) > 0 {
+				fn(fields)
+				fields = map[string]string{}
+			}
+			continue
+		}
+		if l[0] == ' ' || l[0] == '\t' {
+			continue
+		}
+		if k, v, ok := strings.Cut(l, sep); ok {
+			fields[k] = strings.TrimSpace(v)
+		}
+	}
+	if len(fields) > 0 {
+		fn(fields)
+	}
+	return errors.WithStack(s.Err())
+}
+
+func matchRPM(p string, _ fs.DirEntry) bool {
+	return p == rpmSQLite || p == rpmSQLiteSysimage
+}
+
+// rpm header tags
+const (
+	rpmTagName      = 1000
+	rpmTagVersion   = 1001
+	rpmTagRelease   = 1002
+	rpmTagEpoch     = 1003
+	rpmTagLicense   = 1014
+	rpmTagArch      = 1022
+	rpmTagSourceRPM = 1044
+)
+
+// rpm header data types
+const (
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// parseRPM parses the sqlite rpm database. The BerkeleyDB and ndb formats
+// of older and SUSE based distributions are not supported.
+func parseRPM(c *scan, p string, r io.ReaderAt, size int64) ([]Package, error) {
+	db, err := openSQLite(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	err = db.table("Packages", func(cols []any) error {
+		if len(cols) < 2 {
+			return nil
+		}
+		blob, ok := cols[1].([]byte)
+		if !ok {
+			return nil
+		}
+		h, err := parseRPMHeader(blob)
+		if err != nil {
+			return err
+		}
+		name := h.str(rpmTagName)
+		if name == "" || name == "gpg-pubkey" {
+			return nil
+		}
+		version := h.str(rpmTagVersion)
+		if release := h.str(rpmTagRelease); release != "" {
+			version += "-" + release
+		}
+		q := map[string]string{
+			"arch":   h.str(rpmTagArch),
+			"distro": c.distro.qualifier(),
+		}
+		if epoch, ok := h.int(rpmTagEpoch); ok {
+			q["epoch"] = strconv.Itoa(int(epoch))
+		}
+		if src := h.str(rpmTagSourceRPM); src != "" {
+			q["upstream"] = src
+		}
+		var licenses []string
+		if l := h.str(rpmTagLicense); l != "" {
+			licenses = []string{l}
+		}
+		pkgs = append(pkgs, Package{
+			Type:     packageurl.TypeRPM,
+			Name:     name,
+			Version:  version,
+			PURL:     newPURL(packageurl.TypeRPM, c.distroNamespace(""), name, version, q),
+			Licenses: licenses,
+		})
+		return nil
+	})
+	return pkgs, err
+}
+
+type rpmHeader struct {
+	entries map[int32]rpmEntry
+	data    []byte
+}
+
+type rpmEntry struct {
+	typ    uint32
+	offset int32
+}
+
+// parseRPMHeader parses a header blob of the rpm database, which is the
+// header without its magic.
+func parseRPMHeader(b []byte) (*rpmHeader, error) {
+	if len(b) < 8 {
+		return nil, errors.New("rpm header is too short")
+	}
+	il := binary.BigEndian.Uint32(b)
+	dl := binary.BigEndian.Uint32(b[4:])
+	if uint64(il)*16+uint64(dl)+8 > uint64(len(b)) {
+		return nil, errors.New("rpm header is truncated")
+	}
+	h := &rpmHeader{
+		entries: make(map[int32]rpmEntry, il),
+		data:    b[8+il*16 : 8+il*16+dl],
+	}
+	for i := range il {
+		e := b[8+i*16:]
+		h.entries[int32(binary.BigEndian.Uint32(e))] = rpmEntry{
+			typ:    binary.BigEndian.Uint32(e[4:]),
+			offset: int32(binary.BigEndian.Uint32(e[8:])),
+		}
+	}
+	return h, nil
+}
+
+// str returns the value of a string tag, or the first value of a string
+// array tag.
+func (h *rpmHeader) str(tag int32) string {
+	e, ok := h.entries[tag]
+	if !ok || e.offset < 0 || int(e.offset) >= len(h.data) {
+		return ""
+	}
+	switch e.typ {
+	case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+		s, _, _ := strings.Cut(string(h.data[e.offset:]), "\x00")
+		return s
+	}
+	return ""
+}
+
+func (h *rpmHeader) int(tag int32) (int32, bool) {
+	e, ok := h.entries[tag]
+	if !ok || e.typ != rpmTypeInt32 || e.offset < 0 || int(e.offset)+4 > len(h.data) {
+		return 0, false
+	}
+	return int32(binary.BigEndian.Uint32(h.data[e.offset:])), true
+}
+
+// distroNamespace returns the package URL namespace of the distribution
+// packages, which is the distribution ID.
+func (c *scan) distroNamespace(def string) string {
+	if c.distro != nil {
+		return c.distro.ID
+	}
+	return def
+}
+
+func newPURL(typ, namespace, name, version string, qualifiers map[string]string) string {
+	for k, v := range qualifiers {
+		if v == "" {
+			delete(qualifiers, k)
+		}
+	}
+	return packageurl.NewPackageURL(typ, namespace, name, version, packageurl.QualifiersFromMap(qualifiers), "").ToString()
+}
@@ -0,0 +1,331 @@
+// Package sbom generates SBOMs of a root filesystem in the daemon, without
+// running a scanner image. The packages are read from the dpkg, apk and rpm
+// databases, the build information of Go binaries and the npm and pip
+// lockfiles.
+package sbom
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha1" //nolint:gosec // SHA1 checksums are required by SPDX
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	fsutil "github.com/containerd/continuity/fs"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// Package is a software package found in the root filesystem.
+type Package struct {
+	// Type is the package URL type, e.g. deb or npm.
+	Type    string
+	Name    string
+	Version string
+	PURL    string
+	// Licenses are the declared licenses, as found in the package metadata.
+	Licenses []string
+	// Location is the path of the file the package was found in.
+	Location string
+	// Attribution is the build step that introduced the package. It is only
+	// set if attribution was requested.
+	Attribution *Attribution
+}
+
+// Attribution is the build step that introduced a package, found from the
+// layer in which the package was added.
+type Attribution struct {
+	// Layer is the diffID of the layer.
+	Layer string
+	// Vertex is the digest of the LLB vertex that created the layer.
+	Vertex string
+	// Name is the name of the vertex, which contains the stage of Dockerfile
+	// builds.
+	Name string
+	// Sources are the locations of the vertex in the source files, as
+	// "<filename>:<line>" or "<filename>:<start>-<end>".
+	Sources []string
+}
+
+// File is a file in which packages were found.
+type File struct {
+	Path   string
+	SHA1   string
+	SHA256 string
+}
+
+// Distro is the distribution of the root filesystem, from os-release.
+type Distro struct {
+	ID         string
+	VersionID  string
+	PrettyName string
+}
+
+// Catalog is the result of scanning a root filesystem.
+type Catalog struct {
+	Distro   *Distro
+	Packages []Package
+	Files    []File
+}
+
+// cataloger finds the packages in a file. The path is absolute within the
+// root filesystem.
+type cataloger struct {
+	match func(p string, d fs.DirEntry) bool
+	parse func(c *scan, p string, r io.ReaderAt, size int64) ([]Package, error)
+}
+
+var catalogers = []cataloger{
+	{match: matchDpkg, parse: parseDpkg},
+	{match: matchApk, parse: parseApk},
+	{match: matchRPM, parse: parseRPM},
+	{match: matchNpm, parse: parseNpm},
+	{match: matchPip, parse: parsePip},
+	{match: matchExecutable, parse: parseGoBinary},
+}
+
+// skipDirs are the directories of the root filesystem that are not scanned.
+var skipDirs = []string{"/proc", "/sys", "/dev"}
+
+type scan struct {
+	distro *Distro
+}
+
+// Scan returns the catalog of the packages in the root filesystem at root.
+func Scan(ctx context.Context, root string) (*Catalog, error) {
+	c := &scan{distro: readDistro(root)}
+	out := &Catalog{Distro: c.distro}
+	err := filepath.WalkDir(root, func(fp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, fp)
+		if err != nil {
+			return err
+		}
+		p := path.Join("/", filepath.ToSlash(rel))
+		if d.IsDir() {
+			if slices.Contains(skipDirs, p) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		for _, cl := range catalogers {
+			if !cl.match(p, d) {
+				continue
+			}
+			pkgs, err := c.parseFile(cl, fp, p)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read packages from %s", p)
+			}
+			if len(pkgs) == 0 {
+				continue
+			}
+			f, err := checksumFile(fp, p)
+			if err != nil {
+				return err
+			}
+			out.Packages = append(out.Packages, pkgs...)
+			out.Files = append(out.Files, f)
+			break
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(out.Packages, func(a, b Package) int {
+		return cmp.Or(
+			cmp.Compare(a.Type, b.Type),
+			cmp.Compare(a.Name, b.Name),
+			cmp.Compare(a.Version, b.Version),
+			cmp.Compare(a.Location, b.Location),
+		)
+	})
+	return out, nil
+}
+
+// ScanFile returns the packages in the file at the absolute path p of the root
+// filesystem at root. It returns no packages if the file doesn't exist or isn't
+// a package file found by Scan.
+func ScanFile(root, p string) ([]Package, error) {
+	fp, err := fsutil.RootPath(root, p)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Lstat(fp)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, nil
+	}
+	c := &scan{distro: readDistro(root)}
+	for _, cl := range catalogers {
+		if cl.match(p, fs.FileInfoToDirEntry(fi)) {
+			return c.parseFile(cl, fp, p)
+		}
+	}
+	return nil, nil
+}
+
+func (c *scan) parseFile(cl cataloger, fp, p string) ([]Package, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := cl.parse(c, p, f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	for i := range pkgs {
+		pkgs[i].Location = p
+	}
+	return pkgs, nil
+}
+
+func checksumFile(fp, p string) (File, error) {
+	f, err := os.Open(fp)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	h1 := sha1.New() //nolint:gosec // SHA1 checksums are required by SPDX
+	h256 := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h1, h256), f); err != nil {
+		return File{}, errors.Wrapf(err, "failed to read %s", p)
+	}
+	return File{
+		Path:   p,
+		SHA1:   hex.EncodeToString(h1.Sum(nil)),
+		SHA256: hex.EncodeToString(h256.Sum(nil)),
+	}, nil
+}
+
+// readDistro reads the distribution from os-release. Nil is returned if the
+// root filesystem doesn't have os-release.
+func readDistro(root string) *Distro {
+	for _, p := range []string{"etc/os-release", "usr/lib/os-release"} {
+		dt, err := os.ReadFile(filepath.Join(root, p))
+		if err != nil {
+			continue
+		}
+		d := &Distro{}
+		for _, l := range strings.Split(string(dt), "\n") {
+			k, v, ok := strings.Cut(strings.TrimSpace(l), "=")
+			if !ok {
+				continue
+			}
+			v = strings.Trim(v, `"'`)
+			switch k {
+			case "ID":
+				d.ID = v
+			case "VERSION_ID":
+				d.VersionID = v
+			case "PRETTY_NAME":
+				d.PrettyName = v
+			}
+		}
+		if d.ID != "" {
+			return d
+		}
+	}
+	return nil
+}
+
+// qualifier returns the distro qualifier of the package URLs of the
+// distribution packages.
+func (d *Distro) qualifier() string {
+	if d == nil {
+		return ""
+	}
+	if d.VersionID == "" {
+		return d.ID
+	}
+	return d.ID + "-" + d.VersionID
+}
+
+// Format is the format of a generated SBOM document.
+type Format string
+
+const (
+	FormatSPDX      Format = "spdx"
+	FormatCycloneDX Format = "cyclonedx"
+)
+
+// ParseFormat parses the name of an SBOM format. An empty name is SPDX.
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "", FormatSPDX:
+		return FormatSPDX, nil
+	case FormatCycloneDX:
+		return FormatCycloneDX, nil
+	}
+	return "", errors.Errorf("unsupported sbom format %q", s)
+}
+
+// PredicateType returns the in-toto predicate type of the documents in the
+// format.
+func (f Format) PredicateType() string {
+	if f == FormatCycloneDX {
+		return intoto.PredicateCycloneDX
+	}
+	return intoto.PredicateSPDX
+}
+
+// Extension returns the file extension of the documents in the format.
+func (f Format) Extension() string {
+	if f == FormatCycloneDX {
+		return ".cdx.json"
+	}
+	return ".spdx.json"
+}
+
+// Encode encodes the catalog as a JSON document in the format. The document
+// only depends on its inputs, so that it is reproducible with a fixed
+// creation time.
+func Encode(c *Catalog, f Format, name string, created time.Time) ([]byte, error) {
+	if f == FormatCycloneDX {
+		return encodeCycloneDX(c, name, created)
+	}
+	return encodeSPDX(c, name, created)
+}
+
+// catalogDigest returns a digest identifying the catalog and name.
+func catalogDigest(c *Catalog, name string) (digest.Digest, error) {
+	dt, err := json.Marshal(struct {
+		Name    string
+		Catalog *Catalog
+	}{name, c})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return digest.FromBytes(dt), nil
+}
@@ -0,0 +1,336 @@
+package sbom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	spdx_json "github.com/spdx/tools-golang/json"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for p, dt := range files {
+		fp := filepath.Join(root, p)
+		require.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		require.NoError(t, os.WriteFile(fp, []byte(dt), 0644))
+	}
+}
+
+func findPackage(t *testing.T, c *Catalog, typ, name string) Package {
+	for _, p := range c.Packages {
+		if p.Type == typ && p.Name == name {
+			return p
+		}
+	}
+	require.Failf(t, "package not found", "%s %s", typ, name)
+	return Package{}
+}
+
+func TestScanDpkg(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"etc/os-release": "ID=debian\nVERSION_ID=\"12\"\nPRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\n",
+		"var/lib/dpkg/status": `Package: libc6
+Status: install ok installed
+Architecture: amd64
+Source: glibc
+Version: 2.36-9+deb12u4
+Description: GNU C Library: Shared libraries
+ Contains the standard libraries.
+
+Package: removed
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+`,
+		"var/lib/dpkg/status.d/base-files": "Package: base-files\nArchitecture: amd64\nVersion: 12.4+deb12u5\n",
+	})
+
+	c, err := Scan(context.TODO(), root)
+	require.NoError(t, err)
+	require.Equal(t, &Distro{ID: "debian", VersionID: "12", PrettyName: "Debian GNU/Linux 12 (bookworm)"}, c.Distro)
+	require.Len(t, c.Packages, 2)
+	require.Len(t, c.Files, 2)
+
+	p := findPackage(t, c, "deb", "libc6")
+	require.Equal(t, "2.36-9+deb12u4", p.Version)
+	require.Equal(t, "/var/lib/dpkg/status", p.Location)
+	require.Equal(t, "pkg:deb/debian/libc6@2.36-9+deb12u4?arch=amd64&distro=debian-12&upstream=glibc", p.PURL)
+
+	p = findPackage(t, c, "deb", "base-files")
+	require.Equal(t, "/var/lib/dpkg/status.d/base-files", p.Location)
+}
+
+func TestScanApk(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"etc/os-release": "ID=alpine\nVERSION_ID=3.20.0\n",
+		"lib/apk/db/installed": `C:Q1abc=
+P:musl
+V:1.2.5-r0
+A:x86_64
+L:MIT
+o:musl
+
+P:libcrypto3
+V:3.3.0-r2
+A:x86_64
+L:Apache-2.0
+o:openssl
+`,
+	})
+
+	c, err := Scan(context.TODO(), root)
+	require.NoError(t, err)
+	require.Len(t, c.Packages, 2)
+
+	p := findPackage(t, c, "apk", "libcrypto3")
+	require.Equal(t, "3.3.0-r2", p.Version)
+	require.Equal(t, []string{"Apache-2.0"}, p.Licenses)
+	require.Equal(t, "pkg:apk/alpine/libcrypto3@3.3.0-r2?arch=x86_64&distro=alpine-3.20.0&upstream=openssl", p.PURL)
+
+	p = findPackage(t, c, "apk", "musl")
+	require.Equal(t, "pkg:apk/alpine/musl@1.2.5-r0?arch=x86_64&distro=alpine-3.20.0", p.PURL)
+}
+
+func TestScanFile(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"etc/os-release":       "ID=alpine\nVERSION_ID=3.20.0\n",
+		"lib/apk/db/installed": "P:musl\nV:1.2.5-r0\nA:x86_64\n",
+		"etc/hostname":         "host\n",
+	})
+
+	pkgs, err := ScanFile(root, "/lib/apk/db/installed")
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	require.Equal(t, "musl", pkgs[0].Name)
+	require.Equal(t, "/lib/apk/db/installed", pkgs[0].Location)
+
+	pkgs, err = ScanFile(root, "/etc/hostname")
+	require.NoError(t, err)
+	require.Empty(t, pkgs)
+
+	pkgs, err = ScanFile(root, "/var/lib/dpkg/status")
+	require.NoError(t, err)
+	require.Empty(t, pkgs)
+}
+
+func TestScanRPM(t *testing.T) {
+	dt, err := os.ReadFile("testdata/rpmdb.sqlite")
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"etc/os-release":           "ID=\"rocky\"\nVERSION_ID=\"9.3\"\n",
+		"var/lib/rpm/rpmdb.sqlite": string(dt),
+	})
+
+	c, err := Scan(context.TODO(), root)
+	require.NoError(t, err)
+	// the gpg-pubkey entries are not packages
+	require.Len(t, c.Packages, 2)
+
+	p := findPackage(t, c, "rpm", "bash")
+	require.Equal(t, "5.1.8-9.el9", p.Version)
+	require.Equal(t, []string{"GPLv3+"}, p.Licenses)
+	require.Equal(t, "pkg:rpm/rocky/bash@5.1.8-9.el9?arch=x86_64&distro=rocky-9.3&upstream=bash-5.1.8-9.el9.src.rpm", p.PURL)
+
+	// the header of this package is stored in overflow pages
+	p = findPackage(t, c, "rpm", "openssl-libs")
+	require.Equal(t, "3.0.7-27.el9", p.Version)
+	require.Equal(t, "pkg:rpm/rocky/openssl-libs@3.0.7-27.el9?arch=x86_64&distro=rocky-9.3&epoch=1&upstream=openssl-3.0.7-27.el9.src.rpm", p.PURL)
+}
+
+func TestScanNpm(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"app/package-lock.json": `{
+  "name": "app",
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "app", "version": "1.0.0"},
+    "node_modules/express": {"version": "4.19.2", "license": "MIT"},
+    "node_modules/@types/node": {"version": "20.12.7", "license": {"type": "MIT"}},
+    "node_modules/express/node_modules/debug": {"version": "2.6.9"},
+    "node_modules/lib": {"resolved": "packages/lib", "link": true}
+  }
+}`,
+		"old/package-lock.json": `{
+  "lockfileVersion": 1,
+  "dependencies": {
+    "lodash": {"version": "4.17.21", "dependencies": {"nested": {"version": "0.1.0"}}}
+  }
+}`,
+	})
+
+	c, err := Scan(context.TODO(), root)
+	require.NoError(t, err)
+	require.Nil(t, c.Distro)
+	require.Len(t, c.Packages, 5)
+
+	p := findPackage(t, c, "npm", "@types/node")
+	require.Equal(t, "pkg:npm/%40types/node@20.12.7", p.PURL)
+	require.Equal(t, []string{"MIT"}, p.Licenses)
+
+	p = findPackage(t, c, "npm", "debug")
+	require.Equal(t, "2.6.9", p.Version)
+	require.Equal(t, "/app/package-lock.json", p.Location)
+
+	p = findPackage(t, c, "npm", "nested")
+	require.Equal(t, "/old/package-lock.json", p.Location)
+}
+
+func TestScanPip(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"app/requirements.txt": `# pinned
+Flask[async]==3.0.3 ; python_version >= "3.8"
+requests>=2.0
+zope.interface==6.4
+`,
+		"svc/Pipfile.lock": `{"default": {"urllib3": {"version": "==2.2.1"}}, "develop": {"pytest": {"version": "==8.2.0"}}}`,
+		"tool/poetry.lock": `[[package]]
+name = "Click"
+version = "8.1.7"
+
+[[package]]
+name = "colorama"
+version = "0.4.6"
+`,
+	})
+
+	c, err := Scan(context.TODO(), root)
+	require.NoError(t, err)
+	require.Len(t, c.Packages, 6)
+
+	p := findPackage(t, c, "pypi", "flask")
+	require.Equal(t, "3.0.3", p.Version)
+	require.Equal(t, "pkg:pypi/flask@3.0.3", p.PURL)
+
+	findPackage(t, c, "pypi", "zope-interface")
+	findPackage(t, c, "pypi", "urllib3")
+	findPackage(t, c, "pypi", "pytest")
+	findPackage(t, c, "pypi", "click")
+	findPackage(t, c, "pypi", "colorama")
+}
+
+func TestScanGoBinary(t *testing.T) {
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	dt, err := os.ReadFile(exe)
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/app"), dt, 0755))
+	// files that are not executable are not read
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/copy"), dt, 0644))
+
+	c, err := Scan(context.TODO(), root)
+	require.NoError(t, err)
+	require.Len(t, c.Files, 1)
+	require.Equal(t, "/usr/bin/app", c.Files[0].Path)
+
+	p := findPackage(t, c, "golang", "stdlib")
+	require.NotEmpty(t, p.Version)
+	findPackage(t, c, "golang", "github.com/stretchr/testify")
+}
+
+func TestEncode(t *testing.T) {
+	c := &Catalog{
+		Distro: &Distro{ID: "alpine", VersionID: "3.20.0"},
+		Packages: []Package{{
+			Type:     "apk",
+			Name:     "musl",
+			Version:  "1.2.5-r0",
+			PURL:     "pkg:apk/alpine/musl@1.2.5-r0?arch=x86_64&distro=alpine-3.20.0",
+			Licenses: []string{"MIT"},
+			Location: "/lib/apk/db/installed",
+		}},
+		Files: []File{{Path: "/lib/apk/db/installed", SHA1: "da39a3ee5e6b4b0d3255bfef95601890afd80709", SHA256: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}},
+	}
+	created := time.Unix(1700000000, 0)
+
+	dt, err := Encode(c, FormatSPDX, "linux/amd64", created)
+	require.NoError(t, err)
+	dt2, err := Encode(c, FormatSPDX, "linux/amd64", created)
+	require.NoError(t, err)
+	require.Equal(t, dt, dt2)
+
+	doc, err := spdx_json.Read(bytes.NewReader(dt))
+	require.NoError(t, err)
+	require.Equal(t, "2023-11-14T22:13:20Z", doc.CreationInfo.Created)
+	require.Len(t, doc.Packages, 1)
+	require.Equal(t, "MIT", doc.Packages[0].PackageLicenseDeclared)
+	require.Equal(t, "pkg:apk/alpine/musl@1.2.5-r0?arch=x86_64&distro=alpine-3.20.0", doc.Packages[0].PackageExternalReferences[0].Locator)
+	require.Len(t, doc.Files, 1)
+	require.Equal(t, "/lib/apk/db/installed", doc.Files[0].FileName)
+	require.Len(t, doc.Relationships, 2)
+
+	dt, err = Encode(c, FormatCycloneDX, "linux/amd64", created)
+	require.NoError(t, err)
+	var bom cycloneDXBOM
+	require.NoError(t, json.Unmarshal(dt, &bom))
+	require.Equal(t, "CycloneDX", bom.BOMFormat)
+	require.Equal(t, "2023-11-14T22:13:20Z", bom.Metadata.Timestamp)
+	require.Len(t, bom.Components, 2)
+	require.Equal(t, "musl", bom.Components[0].Name)
+	require.Equal(t, "MIT", bom.Components[0].Licenses[0].Expression)
+	require.Equal(t, "operating-system", bom.Components[1].Type)
+
+	f, err := ParseFormat("CycloneDX")
+	require.NoError(t, err)
+	require.Equal(t, FormatCycloneDX, f)
+	_, err = ParseFormat("swid")
+	require.ErrorContains(t, err, "unsupported sbom format")
+}
+
+func TestEncodeAttribution(t *testing.T) {
+	c := &Catalog{
+		Packages: []Package{{
+			Type:     "apk",
+			Name:     "git",
+			Version:  "2.45.2-r0",
+			Location: "/lib/apk/db/installed",
+			Attribution: &Attribution{
+				Layer:   "sha256:2b1f2b9e1b0c2fe4d8e5c9b8f0bd3a0d3f0f3e3c5bdfd1f1d58bbf4c2b46c1d3",
+				Vertex:  "sha256:8a8f4bb0f0e0a0d4be7a5dbf3a1b7e0f45b1c8d2fdb3a7a1ce36d4f37c29bd0c",
+				Name:    "[build 2/4] RUN apk add git",
+				Sources: []string{"Dockerfile:3-4"},
+			},
+		}},
+	}
+	created := time.Unix(1700000000, 0)
+
+	dt, err := Encode(c, FormatSPDX, "linux/amd64", created)
+	require.NoError(t, err)
+	doc, err := spdx_json.Read(bytes.NewReader(dt))
+	require.NoError(t, err)
+	require.Len(t, doc.Packages, 1)
+	var comments []string
+	for _, a := range doc.Packages[0].Annotations {
+		require.Equal(t, "OTHER", a.AnnotationType)
+		require.Equal(t, "Tool", a.Annotator.AnnotatorType)
+		comments = append(comments, a.AnnotationComment)
+	}
+	require.Equal(t, []string{
+		"layerDiffID: sha256:2b1f2b9e1b0c2fe4d8e5c9b8f0bd3a0d3f0f3e3c5bdfd1f1d58bbf4c2b46c1d3",
+		"vertex: sha256:8a8f4bb0f0e0a0d4be7a5dbf3a1b7e0f45b1c8d2fdb3a7a1ce36d4f37c29bd0c",
+		"vertexName: [build 2/4] RUN apk add git",
+		"source: Dockerfile:3-4",
+	}, comments)
+
+	dt, err = Encode(c, FormatCycloneDX, "linux/amd64", created)
+	require.NoError(t, err)
+	var bom cycloneDXBOM
+	require.NoError(t, json.Unmarshal(dt, &bom))
+	require.Len(t, bom.Components, 1)
+	require.Contains(t, bom.Components[0].Properties, cycloneDXProperty{Name: "buildkit:vertex:name", Value: "[build 2/4] RUN apk add git"})
+	require.Contains(t, bom.Components[0].Properties, cycloneDXProperty{Name: "buildkit:source:0", Value: "Dockerfile:3-4"})
+}
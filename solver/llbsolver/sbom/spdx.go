@@ -0,0 +1,149 @@
+package sbom
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/version"
+	"github.com/pkg/errors"
+	spdx_json "github.com/spdx/tools-golang/json"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+)
+
+const (
+	spdxNoAssertion = "NOASSERTION"
+
+	// spdxEvidentBy is the comment of the relationships between the
+	// packages and the files they were found in.
+	spdxEvidentBy = "evident-by: indicates the package's existence is evident by the given file"
+)
+
+func encodeSPDX(c *Catalog, name string, created time.Time) ([]byte, error) {
+	dgst, err := catalogDigest(c, name)
+	if err != nil {
+		return nil, err
+	}
+	doc := &spdx.Document{
+		SPDXVersion:       spdx.Version,
+		DataLicense:       spdx.DataLicense,
+		SPDXIdentifier:    "DOCUMENT",
+		DocumentName:      name,
+		DocumentNamespace: "https://mobyproject.org/buildkit/sbom/" + dgst.Encoded(),
+		CreationInfo: &spdx.CreationInfo{
+			Creators: []common.Creator{{
+				CreatorType: "Tool",
+				Creator:     "buildkit-" + version.Version,
+			}},
+			Created: created.UTC().Format(time.RFC3339),
+		},
+	}
+	if c.Distro != nil {
+		doc.DocumentComment = "distro: " + c.Distro.qualifier()
+	}
+
+	files := map[string]spdx.ElementID{}
+	for i, f := range c.Files {
+		id := spdx.ElementID(fmt.Sprintf("File-%d", i))
+		files[f.Path] = id
+		doc.Files = append(doc.Files, &spdx.File{
+			FileName:           f.Path,
+			FileSPDXIdentifier: id,
+			Checksums: []spdx.Checksum{
+				{Algorithm: common.SHA1, Value: f.SHA1},
+				{Algorithm: common.SHA256, Value: f.SHA256},
+			},
+			LicenseConcluded:  spdxNoAssertion,
+			FileCopyrightText: spdxNoAssertion,
+		})
+	}
+	for i, p := range c.Packages {
+		id := spdx.ElementID(fmt.Sprintf("Package-%s-%d", spdxIDString(p.Type), i))
+		license := spdxNoAssertion
+		if len(p.Licenses) > 0 {
+			license = strings.Join(p.Licenses, " AND ")
+		}
+		pkg := &spdx.Package{
+			PackageName:             p.Name,
+			PackageSPDXIdentifier:   id,
+			PackageVersion:          p.Version,
+			PackageDownloadLocation: spdxNoAssertion,
+			PackageLicenseConcluded: spdxNoAssertion,
+			PackageLicenseDeclared:  license,
+			PackageCopyrightText:    spdxNoAssertion,
+			PackageSourceInfo:       "acquired package info from " + p.Location,
+		}
+		if p.PURL != "" {
+			pkg.PackageExternalReferences = []*spdx.PackageExternalReference{{
+				Category: common.CategoryPackageManager,
+				RefType:  common.TypePackageManagerPURL,
+				Locator:  p.PURL,
+			}}
+		}
+		if a := p.Attribution; a != nil {
+			pkg.Annotations = spdxAttribution(a, doc.CreationInfo)
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, &spdx.Relationship{
+			RefA:         common.MakeDocElementID("", "DOCUMENT"),
+			RefB:         common.MakeDocElementID("", string(id)),
+			Relationship: common.TypeRelationshipDescribe,
+		})
+		if fid, ok := files[p.Location]; ok {
+			doc.Relationships = append(doc.Relationships, &spdx.Relationship{
+				RefA:                common.MakeDocElementID("", string(id)),
+				RefB:                common.MakeDocElementID("", string(fid)),
+				Relationship:        common.TypeRelationshipOther,
+				RelationshipComment: spdxEvidentBy,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := spdx_json.Write(doc, &buf); err != nil {
+		return nil, errors.Wrap(err, "failed to encode spdx")
+	}
+	return buf.Bytes(), nil
+}
+
+// spdxIDString replaces the characters that are not allowed in SPDX
+// identifiers.
+func spdxIDString(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// spdxAttribution returns the annotations of the build step that introduced
+// a package. The comments use the "key: value" form of the layerID comments
+// added to the files by the image exporter.
+func spdxAttribution(a *Attribution, ci *spdx.CreationInfo) []spdx.Annotation {
+	comments := []string{"layerDiffID: " + a.Layer}
+	if a.Vertex != "" {
+		comments = append(comments, "vertex: "+a.Vertex)
+	}
+	if a.Name != "" {
+		comments = append(comments, "vertexName: "+a.Name)
+	}
+	for _, src := range a.Sources {
+		comments = append(comments, "source: "+src)
+	}
+	out := make([]spdx.Annotation, len(comments))
+	for i, c := range comments {
+		out[i] = spdx.Annotation{
+			Annotator: common.Annotator{
+				AnnotatorType: ci.Creators[0].CreatorType,
+				Annotator:     ci.Creators[0].Creator,
+			},
+			AnnotationDate:    ci.Created,
+			AnnotationType:    "OTHER",
+			AnnotationComment: c,
+		}
+	}
+	return out
+}
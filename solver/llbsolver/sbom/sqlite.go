@@ -0,0 +1,283 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// sqliteDB is a minimal reader of the tables of a SQLite database file, as
+// used by the rpm database. Only the main database file is read, so changes
+// that were not checkpointed from the write-ahead log are not seen.
+type sqliteDB struct {
+	r        io.ReaderAt
+	size     int64
+	pageSize int
+	usable   int
+}
+
+const (
+	sqliteMagic = "SQLite format 3\x00"
+
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+
+	// sqliteMaxDepth limits the depth of the table b-trees, which is
+	// much lower in practice.
+	sqliteMaxDepth = 32
+
+	// sqliteMaxPayload limits the size of a single row. The rpm headers
+	// stored in the database are much smaller in practice.
+	sqliteMaxPayload = 64 << 20
+)
+
+// openSQLite opens the database file of the given size.
+func openSQLite(r io.ReaderAt, size int64) (*sqliteDB, error) {
+	hdr := make([]byte, 100)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, errors.Wrap(err, "failed to read sqlite header")
+	}
+	if string(hdr[:16]) != sqliteMagic {
+		return nil, errors.New("not a sqlite database")
+	}
+	pageSize := int(binary.BigEndian.Uint16(hdr[16:18]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	if pageSize < 512 || pageSize&(pageSize-1) != 0 {
+		return nil, errors.Errorf("invalid sqlite page size %d", pageSize)
+	}
+	if enc := binary.BigEndian.Uint32(hdr[56:60]); enc > 1 {
+		return nil, errors.Errorf("unsupported sqlite text encoding %d", enc)
+	}
+	return &sqliteDB{
+		r:        r,
+		size:     size,
+		pageSize: pageSize,
+		usable:   pageSize - int(hdr[20]),
+	}, nil
+}
+
+func (db *sqliteDB) page(n uint32) ([]byte, error) {
+	if n == 0 {
+		return nil, errors.New("invalid sqlite page number 0")
+	}
+	b := make([]byte, db.pageSize)
+	if _, err := db.r.ReadAt(b, int64(n-1)*int64(db.pageSize)); err != nil && !(errors.Is(err, io.EOF) && n > 1) {
+		return nil, errors.Wrapf(err, "failed to read sqlite page %d", n)
+	}
+	return b, nil
+}
+
+// table calls fn with the columns of each row of the named table.
+func (db *sqliteDB) table(name string, fn func([]any) error) error {
+	var root int64
+	if err := db.walk(1, 0, map[uint32]struct{}{}, func(cols []any) error {
+		if len(cols) < 4 || root != 0 {
+			return nil
+		}
+		if typ, _ := cols[0].(string); typ != "table" {
+			return nil
+		}
+		if n, _ := cols[1].(string); n == name {
+			root, _ = cols[3].(int64)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if root <= 0 || root > math.MaxUint32 {
+		return errors.Errorf("sqlite table %s not found", name)
+	}
+	return db.walk(uint32(root), 0, map[uint32]struct{}{}, fn)
+}
+
+func (db *sqliteDB) walk(n uint32, depth int, visited map[uint32]struct{}, fn func([]any) error) error {
+	if depth > sqliteMaxDepth {
+		return errors.New("sqlite b-tree is too deep")
+	}
+	if _, ok := visited[n]; ok {
+		return errors.Errorf("sqlite page %d is referenced twice", n)
+	}
+	visited[n] = struct{}{}
+
+	p, err := db.page(n)
+	if err != nil {
+		return err
+	}
+	hdr := p
+	if n == 1 {
+		hdr = p[100:]
+	}
+	if len(hdr) < 8 {
+		return errors.Errorf("invalid sqlite page %d", n)
+	}
+	typ := hdr[0]
+	cells := int(binary.BigEndian.Uint16(hdr[3:5]))
+	hdrSize := 8
+	if typ == sqliteInteriorTable {
+		hdrSize = 12
+	} else if typ != sqliteLeafTable {
+		return errors.Errorf("unexpected sqlite page type %#x in table", typ)
+	}
+	if len(hdr) < hdrSize+2*cells {
+		return errors.Errorf("invalid sqlite page %d", n)
+	}
+	for i := range cells {
+		off := int(binary.BigEndian.Uint16(hdr[hdrSize+2*i:]))
+		if off >= len(p) {
+			return errors.Errorf("invalid sqlite cell offset in page %d", n)
+		}
+		cell := p[off:]
+		if typ == sqliteInteriorTable {
+			if len(cell) < 4 {
+				return errors.Errorf("invalid sqlite cell in page %d", n)
+			}
+			if err := db.walk(binary.BigEndian.Uint32(cell), depth+1, visited, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		payload, err := db.payload(cell)
+		if err != nil {
+			return errors.Wrapf(err, "invalid sqlite cell in page %d", n)
+		}
+		cols, err := sqliteRecord(payload)
+		if err != nil {
+			return errors.Wrapf(err, "invalid sqlite record in page %d", n)
+		}
+		if err := fn(cols); err != nil {
+			return err
+		}
+	}
+	if typ == sqliteInteriorTable {
+		return db.walk(binary.BigEndian.Uint32(hdr[8:12]), depth+1, visited, fn)
+	}
+	return nil
+}
+
+// payload returns the payload of a table leaf cell, following the
+// overflow pages.
+func (db *sqliteDB) payload(cell []byte) ([]byte, error) {
+	size, n := sqliteVarint(cell)
+	if n == 0 || size < 0 || size > db.size || size > sqliteMaxPayload {
+		return nil, errors.Errorf("invalid payload size %d", size)
+	}
+	cell = cell[n:]
+	if _, n = sqliteVarint(cell); n == 0 { // rowid
+		return nil, errors.New("invalid rowid")
+	}
+	cell = cell[n:]
+
+	maxLocal := int64(db.usable - 35)
+	if size <= maxLocal {
+		if int64(len(cell)) < size {
+			return nil, errors.New("truncated payload")
+		}
+		return cell[:size], nil
+	}
+	minLocal := int64((db.usable-12)*32/255 - 23)
+	local := minLocal + (size-minLocal)%int64(db.usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	if int64(len(cell)) < local+4 {
+		return nil, errors.New("truncated payload")
+	}
+	// the size comes from the file, so out grows with the overflow pages
+	// that were actually read instead of being allocated upfront
+	out := bytes.Clone(cell[:local])
+	next := binary.BigEndian.Uint32(cell[local:])
+	visited := map[uint32]struct{}{}
+	for int64(len(out)) < size {
+		if _, ok := visited[next]; ok || next == 0 {
+			return nil, errors.New("invalid overflow page chain")
+		}
+		visited[next] = struct{}{}
+		p, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = binary.BigEndian.Uint32(p)
+		out = append(out, p[4:min(int64(db.usable), 4+size-int64(len(out)))]...)
+	}
+	return out, nil
+}
+
+// sqliteRecord decodes the columns of a record. Integers are returned as
+// int64, floats as float64, text as string and blobs as []byte.
+func sqliteRecord(b []byte) ([]any, error) {
+	hdrSize, n := sqliteVarint(b)
+	if n == 0 || hdrSize < int64(n) || hdrSize > int64(len(b)) {
+		return nil, errors.New("invalid record header")
+	}
+	hdr := b[n:hdrSize]
+	body := b[hdrSize:]
+	var cols []any
+	for len(hdr) > 0 {
+		typ, n := sqliteVarint(hdr)
+		if n == 0 {
+			return nil, errors.New("invalid serial type")
+		}
+		hdr = hdr[n:]
+		var size int64
+		switch {
+		case typ == 0 || typ == 8 || typ == 9:
+		case typ >= 1 && typ <= 4:
+			size = typ
+		case typ == 5:
+			size = 6
+		case typ == 6 || typ == 7:
+			size = 8
+		case typ >= 12:
+			size = (typ - 12) / 2
+		default:
+			return nil, errors.Errorf("invalid serial type %d", typ)
+		}
+		if int64(len(body)) < size {
+			return nil, errors.New("truncated record")
+		}
+		v := body[:size]
+		body = body[size:]
+		switch {
+		case typ == 0:
+			cols = append(cols, nil)
+		case typ == 8:
+			cols = append(cols, int64(0))
+		case typ == 9:
+			cols = append(cols, int64(1))
+		case typ <= 6:
+			i := int64(int8(v[0]))
+			for _, c := range v[1:] {
+				i = i<<8 | int64(c)
+			}
+			cols = append(cols, i)
+		case typ == 7:
+			cols = append(cols, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case typ%2 == 0:
+			cols = append(cols, bytes.Clone(v))
+		default:
+			cols = append(cols, string(v))
+		}
+	}
+	return cols, nil
+}
+
+// sqliteVarint decodes a big-endian SQLite varint, returning the number of
+// bytes read or 0 if b is too short.
+func sqliteVarint(b []byte) (int64, int) {
+	var v uint64
+	for i := range min(len(b), 9) {
+		if i == 8 {
+			return int64(v<<8 | uint64(b[i])), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return int64(v), i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,44 @@
+package sbom
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteOversizedPayload(t *testing.T) {
+	dt, err := os.ReadFile("testdata/rpmdb.sqlite")
+	require.NoError(t, err)
+
+	db, err := openSQLite(bytes.NewReader(dt), int64(len(dt)))
+	require.NoError(t, err)
+
+	// a payload size of 2^57 in a 9 byte varint, followed by the rowid
+	cell := []byte{0x81, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00, 0x01}
+	_, err = db.payload(cell)
+	require.ErrorContains(t, err, "invalid payload size")
+}
+
+func FuzzSQLiteTable(f *testing.F) {
+	dt, err := os.ReadFile("testdata/rpmdb.sqlite")
+	require.NoError(f, err)
+	f.Add(dt)
+	f.Add(dt[:4096])
+
+	f.Fuzz(func(t *testing.T, dt []byte) {
+		db, err := openSQLite(bytes.NewReader(dt), int64(len(dt)))
+		if err != nil {
+			return
+		}
+		_ = db.table("Packages", func(cols []any) error {
+			if len(cols) > 1 {
+				if blob, ok := cols[1].([]byte); ok {
+					_, _ = parseRPMHeader(blob)
+				}
+			}
+			return nil
+		})
+	})
+}
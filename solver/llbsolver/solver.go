@@ -2,6 +2,7 @@ package llbsolver
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"maps"
@@ -34,6 +35,7 @@ import (
 	"github.com/moby/buildkit/solver/llbsolver/provenance"
 	provenancetypes "github.com/moby/buildkit/solver/llbsolver/provenance/types"
 	"github.com/moby/buildkit/solver/result"
+	"github.com/moby/buildkit/sourcepolicy"
 	spb "github.com/moby/buildkit/sourcepolicy/pb"
 	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/compression"
@@ -82,6 +84,7 @@ type Opt struct {
 	WorkerController *worker.Controller
 	HistoryQueue     *HistoryQueue
 	ResourceMonitor  *resources.Monitor
+	SourcePolicy     *DaemonSourcePolicy
 }
 
 type Solver struct {
@@ -96,6 +99,7 @@ type Solver struct {
 	entitlements              []string
 	history                   *HistoryQueue
 	sysSampler                *resources.Sampler[*resourcestypes.SysSample]
+	sourcePolicy              *DaemonSourcePolicy
 }
 
 // Processor defines a processing function to be applied after solving, but
@@ -103,6 +107,9 @@ type Solver struct {
 type Processor func(ctx context.Context, result *Result, s *Solver, j *solver.Job, usage *resources.SysSampler) (*Result, error)
 
 func New(opt Opt) (*Solver, error) {
+	if err := opt.SourcePolicy.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid daemon source policy")
+	}
 	s := &Solver{
 		workerController:          opt.WorkerController,
 		resolveWorker:             defaultResolver(opt.WorkerController),
@@ -113,6 +120,7 @@ func New(opt Opt) (*Solver, error) {
 		sm:                        opt.SessionManager,
 		entitlements:              opt.Entitlements,
 		history:                   opt.HistoryQueue,
+		sourcePolicy:              opt.SourcePolicy,
 	}
 
 	sampler, err := resources.NewSysSampler()
@@ -155,6 +163,7 @@ func (s *Solver) bridge(b solver.Builder) *provenanceBridge {
 		resolveCacheImporterFuncs: s.resolveCacheImporterFuncs,
 		cms:                       map[string]solver.CacheManager{},
 		sm:                        s.sm,
+		sourcePolicy:              s.sourcePolicy,
 	}}
 }
 
@@ -676,6 +685,13 @@ func (s *Solver) Solve(ctx context.Context, id string, sessionID string, req fro
 			exporterResponse[k] = v
 		}
 	}
+	if lock := br.pins.lockfile(); lock != nil {
+		dt, err := json.Marshal(lock)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to marshal source policy lockfile")
+		}
+		exporterResponse[sourcepolicy.LockResponseKey] = base64.StdEncoding.EncodeToString(dt)
+	}
 
 	return &client.SolveResponse{
 		ExporterResponse: exporterResponse,
@@ -748,6 +764,16 @@ func validateSourcePolicy(pol *spb.Policy) error {
 				return errors.New("invalid nil constraint in policy")
 			}
 		}
+		if sel := r.Selector.Exec; sel != nil {
+			switch r.Action {
+			case spb.PolicyAction_ALLOW, spb.PolicyAction_DENY, spb.PolicyAction_AUDIT:
+			default:
+				return errors.Errorf("invalid action %s for exec selector in policy", r.Action)
+			}
+			if err := sourcepolicy.ValidateExecSelector(sel); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -828,6 +854,9 @@ func (s *Solver) runExporters(ctx context.Context, exporters []exporter.Exporter
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := s.setCustomExporterBuild(exporters, job); err != nil {
+		return nil, nil, err
+	}
 
 	eg, ctx := errgroup.WithContext(ctx)
 	resps := make([]map[string]string, len(exporters))
@@ -1187,6 +1216,9 @@ func supportedEntitlements(ents []string) []entitlements.Entitlement {
 		if e == string(entitlements.EntitlementDevice) {
 			out = append(out, entitlements.EntitlementDevice)
 		}
+		if e == string(entitlements.EntitlementExporterCustom) {
+			out = append(out, entitlements.EntitlementExporterCustom)
+		}
 	}
 	return out
 }
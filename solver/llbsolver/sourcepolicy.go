@@ -2,10 +2,452 @@ package llbsolver
 
 import (
 	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
 
+	"github.com/distribution/reference"
+	"github.com/moby/buildkit/frontend"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/llbsolver/ops"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/source"
+	"github.com/moby/buildkit/source/containerimage"
+	"github.com/moby/buildkit/source/git"
+	httpsource "github.com/moby/buildkit/source/http"
+	"github.com/moby/buildkit/source/lockfile"
+	srctypes "github.com/moby/buildkit/source/types"
+	"github.com/moby/buildkit/sourcepolicy"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/entitlements"
+	"github.com/moby/buildkit/worker"
+	"github.com/moby/buildkit/worker/label"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
 )
 
 type SourcePolicyEvaluator interface {
 	Evaluate(ctx context.Context, op *pb.SourceOp) (bool, error)
+	EvaluateExec(ctx context.Context, op *pb.ExecOp) error
+}
+
+// DaemonSourcePolicy are the source policies configured on the daemon.
+//
+// Daemon policies are evaluated ahead of the policies from the client and the
+// frontend. Each policy is evaluated separately, so sources and execs denied
+// by the daemon can't be allowed again by the client.
+type DaemonSourcePolicy struct {
+	Policies  []*spb.Policy
+	Overrides []DaemonSourcePolicyOverride
+}
+
+// DaemonSourcePolicyOverride replaces the default daemon policies for builds
+// matching the namespace and entitlements.
+type DaemonSourcePolicyOverride struct {
+	// Namespace matches the containerd namespace of the worker. Empty matches
+	// all workers.
+	Namespace string
+	// Entitlements need to be granted to the build for the override to match.
+	Entitlements []entitlements.Entitlement
+	Policies     []*spb.Policy
+}
+
+func (p *DaemonSourcePolicy) validate() error {
+	if p == nil {
+		return nil
+	}
+	pols := p.Policies
+	for _, o := range p.Overrides {
+		pols = append(pols, o.Policies...)
+	}
+	for _, pol := range pols {
+		if err := validateSourcePolicy(pol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// policies returns the daemon policies for a build on the worker with the
+// granted entitlements.
+func (p *DaemonSourcePolicy) policies(w worker.Worker, ent entitlements.Set) []*spb.Policy {
+	if p == nil {
+		return nil
+	}
+	for _, o := range p.Overrides {
+		if o.matches(w, ent) {
+			return o.Policies
+		}
+	}
+	return p.Policies
+}
+
+func (o *DaemonSourcePolicyOverride) matches(w worker.Worker, ent entitlements.Set) bool {
+	if o.Namespace != "" && (w == nil || w.Labels()[label.ContainerdNamespace] != o.Namespace) {
+		return false
+	}
+	for _, e := range o.Entitlements {
+		if !ent.Allowed(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// withDaemonPolicies prepends the daemon policies to the client and frontend
+// policies.
+func withDaemonPolicies(daemon []*spb.Policy, pol []*spb.Policy) []*spb.Policy {
+	if len(daemon) == 0 {
+		return pol
+	}
+	out := make([]*spb.Policy, 0, len(daemon)+len(pol))
+	out = append(out, daemon...)
+	return append(out, pol...)
+}
+
+// evaluateLockfile evaluates the source policy for every entry of a lockfile
+// source the same way as for an HTTP source with the entry's checksum. Entries
+// converted by the policy are replaced in the lockfile. Other sources are
+// ignored.
+func evaluateLockfile(ctx context.Context, polEngine SourcePolicyEvaluator, op *pb.SourceOp) error {
+	if op == nil || !strings.HasPrefix(op.Identifier, srctypes.LockfileScheme+"://") {
+		return nil
+	}
+	var entries []lockfile.Entry
+	if err := json.Unmarshal([]byte(op.Attrs[pb.AttrLockfileEntries]), &entries); err != nil {
+		return errors.Wrap(err, "failed to parse lockfile entries")
+	}
+	var mutated bool
+	for i, e := range entries {
+		attrs := map[string]string{
+			pb.AttrHTTPChecksum: e.Digest.String(),
+		}
+		if e.Filename != "" {
+			attrs[pb.AttrHTTPFilename] = e.Filename
+		}
+		src := &pb.SourceOp{Identifier: e.URL, Attrs: attrs}
+		mut, err := polEngine.Evaluate(ctx, src)
+		if err != nil {
+			return errors.Wrapf(err, "lockfile entry %s", e.URL)
+		}
+		if !mut {
+			continue
+		}
+		scheme, _, _ := strings.Cut(src.Identifier, "://")
+		if scheme != srctypes.HTTPScheme && scheme != srctypes.HTTPSScheme {
+			return errors.Errorf("lockfile entry %s converted to unsupported source %s", e.URL, src.Identifier)
+		}
+		entries[i] = lockfile.Entry{
+			URL:      src.Identifier,
+			Digest:   digest.Digest(src.Attrs[pb.AttrHTTPChecksum]),
+			Filename: src.Attrs[pb.AttrHTTPFilename],
+		}
+		mutated = true
+	}
+	if !mutated {
+		return nil
+	}
+	dt, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	op.Attrs[pb.AttrLockfileEntries] = string(dt)
+	op.Identifier = srctypes.LockfileScheme + "://" + digest.FromBytes(dt).Encoded()
+	return nil
+}
+
+type policyVertexKey struct{}
+
+// withPolicyVertex sets the digest of the LLB vertex that is evaluated by the
+// source policy, so that policy warnings are reported for it.
+func withPolicyVertex(ctx context.Context, dgst digest.Digest) context.Context {
+	return context.WithValue(ctx, policyVertexKey{}, dgst)
+}
+
+func (b *llbBridge) onPolicyDecision(ctx context.Context, d sourcepolicy.Decision) {
+	if b.policyWarnings.add(d) {
+		b.policyWarning(ctx, d)
+	}
+	if d.Action == spb.PolicyAction_PIN {
+		ident := d.Updated
+		if ident == "" {
+			ident = d.Identifier
+		}
+		b.pins.match(d.Identifier, ident)
+	}
+}
+
+// policyWarning reports the match of a policy rule as a build warning. The
+// decision is added as the detail of the warning so that it is kept in the
+// build history.
+func (b *llbBridge) policyWarning(ctx context.Context, d sourcepolicy.Decision) {
+	dgst, _ := ctx.Value(policyVertexKey{}).(digest.Digest)
+	dt, err := json.Marshal(d)
+	if err != nil {
+		bklog.G(ctx).WithError(err).Warn("failed to marshal source policy decision")
+		return
+	}
+	msg := "source policy: "
+	if d.Action == spb.PolicyAction_AUDIT {
+		msg = "source policy audit: "
+	}
+	if err := b.Warn(ctx, dgst, msg+d.String(), frontend.WarnOpts{Detail: [][]byte{dt}}); err != nil {
+		bklog.G(ctx).WithError(err).Warn("failed to report source policy decision")
+	}
+}
+
+// policyWarnings is the set of policy decisions that were reported as build
+// warnings. Sources are evaluated every time they are loaded, e.g. when the
+// frontend resolves an image config and again when the definition is solved,
+// so the same match is only reported once per build.
+type policyWarnings struct {
+	mu   sync.Mutex
+	seen map[policyWarningKey]struct{}
+}
+
+type policyWarningKey struct {
+	policy, rule int
+	identifier   string
+	updated      string
+	args         string
+}
+
+// add returns true if the decision wasn't reported yet.
+func (w *policyWarnings) add(d sourcepolicy.Decision) bool {
+	k := policyWarningKey{
+		policy:     d.Policy,
+		rule:       d.Rule,
+		identifier: d.Identifier,
+		updated:    d.Updated,
+		args:       strings.Join(d.Args, "\x00"),
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.seen[k]; ok {
+		return false
+	}
+	if w.seen == nil {
+		w.seen = map[policyWarningKey]struct{}{}
+	}
+	w.seen[k] = struct{}{}
+	return true
+}
+
+// sourcePins collects the sources matched by PIN rules and the lockfile
+// rules for their resolved immutable form.
+type sourcePins struct {
+	mu sync.Mutex
+	// matched maps the identifiers of the matched sources after all
+	// conversions to the identifiers in the build definition
+	matched map[string]string
+	// pinned maps the identifiers of the matched images that were resolved
+	// by the frontend to their immutable form
+	pinned map[string]string
+	rules  map[string]*spb.Rule
+}
+
+// match records a source matched by a PIN rule. A source that was matched
+// before keeps its original identifier, so that an image the frontend
+// resolved to tag@digest maps back to the tag.
+func (p *sourcePins) match(orig, ident string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.matched == nil {
+		p.matched = map[string]string{}
+	}
+	if _, ok := p.matched[ident]; !ok {
+		p.matched[ident] = orig
+	}
+}
+
+// resolve records the digest that a matched image was resolved to by
+// ResolveSourceMetadata. Frontends like the Dockerfile frontend load the
+// image as tag@digest, which is matched to the original identifier of the tag.
+func (p *sourcePins) resolve(ident string, dgst digest.Digest) {
+	if dgst == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	orig, ok := p.matched[ident]
+	if !ok {
+		return
+	}
+	pinned, ok := pinnedImage(ident, dgst)
+	if !ok {
+		return
+	}
+	if p.pinned == nil {
+		p.pinned = map[string]string{}
+	}
+	p.pinned[ident] = pinned
+	if _, ok := p.matched[pinned]; !ok {
+		p.matched[pinned] = orig
+	}
+}
+
+// pin converts a source that was already resolved in the build to its
+// immutable form, so that the build uses the same image as the lockfile.
+func (p *sourcePins) pin(op *pb.SourceOp) bool {
+	if op == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pinned, ok := p.pinned[op.Identifier]
+	if !ok {
+		return false
+	}
+	op.Identifier = pinned
+	return true
+}
+
+func (p *sourcePins) original(ident string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	orig, ok := p.matched[ident]
+	return orig, ok
+}
+
+// capture records the lockfile rules for the sources of the result that
+// were matched by PIN rules.
+func (p *sourcePins) capture(ctx context.Context, res solver.CachedResultWithProvenance) error {
+	p.mu.Lock()
+	enabled := len(p.matched) > 0
+	p.mu.Unlock()
+	if !enabled || res == nil {
+		return nil
+	}
+	return res.WalkProvenance(ctx, func(pp solver.ProvenanceProvider) error {
+		op, ok := pp.(*ops.SourceOp)
+		if !ok {
+			return nil
+		}
+		src := op.Proto()
+		orig, ok := p.original(src.Identifier)
+		if !ok {
+			return nil
+		}
+		id, pin := op.Pin()
+		rule := pinRule(orig, src, id, pin)
+		if rule == nil {
+			return nil
+		}
+		p.mu.Lock()
+		if p.rules == nil {
+			p.rules = map[string]*spb.Rule{}
+		}
+		p.rules[orig] = rule
+		p.mu.Unlock()
+		return nil
+	})
+}
+
+// lockfile returns the policy with the rules for the pinned sources, or nil
+// if no sources were pinned.
+func (p *sourcePins) lockfile() *spb.Policy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.rules) == 0 {
+		return nil
+	}
+	pol := &spb.Policy{}
+	for _, r := range p.rules {
+		pol.Rules = append(pol.Rules, r)
+	}
+	sort.Slice(pol.Rules, func(i, j int) bool {
+		return pol.Rules[i].Selector.Identifier < pol.Rules[j].Selector.Identifier
+	})
+	return pol
+}
+
+// pinnedImage returns the identifier of the image ident with the digest dgst.
+// It returns false if ident is not an image or already has a digest.
+func pinnedImage(ident string, dgst digest.Digest) (string, bool) {
+	ref, ok := strings.CutPrefix(ident, srctypes.DockerImageScheme+"://")
+	if !ok {
+		return "", false
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", false
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return "", false
+	}
+	named, err = reference.WithDigest(named, dgst)
+	if err != nil {
+		return "", false
+	}
+	return srctypes.DockerImageScheme + "://" + named.String(), true
+}
+
+// pinningEvaluator converts the sources matched by PIN rules to the
+// immutable form they were already resolved to in the build after the
+// policies are evaluated.
+type pinningEvaluator struct {
+	SourcePolicyEvaluator
+	pins *sourcePins
+}
+
+func (e *pinningEvaluator) Evaluate(ctx context.Context, op *pb.SourceOp) (bool, error) {
+	mut, err := e.SourcePolicyEvaluator.Evaluate(ctx, op)
+	if err != nil {
+		return mut, err
+	}
+	if e.pins.pin(op) {
+		mut = true
+	}
+	return mut, nil
+}
+
+// pinRule returns the rule converting the source with the original
+// identifier orig to the immutable form resolved by the build. Sources that
+// were already pinned by an earlier lockfile keep their pinned form. It
+// returns nil for sources that are pinned in the build definition or can't be
+// pinned.
+func pinRule(orig string, src *pb.SourceOp, id source.Identifier, pin string) *spb.Rule {
+	if pin == "" {
+		return nil
+	}
+	updates := &spb.Update{Identifier: src.Identifier}
+	switch id := id.(type) {
+	case *containerimage.ImageIdentifier:
+		if id.Reference.Digest() == "" {
+			updates.Identifier = src.Identifier + "@" + pin
+		}
+	case *git.GitIdentifier:
+		if id.Ref != pin {
+			base, frag, _ := strings.Cut(src.Identifier, "#")
+			ref := pin
+			if _, subdir, ok := strings.Cut(frag, ":"); ok {
+				ref += ":" + subdir
+			}
+			updates.Identifier = base + "#" + ref
+		}
+	case *httpsource.HTTPIdentifier:
+		checksum := id.Checksum.String()
+		if checksum == "" {
+			checksum = pin
+		}
+		updates.Attrs = map[string]string{pb.AttrHTTPChecksum: checksum}
+	default:
+		return nil
+	}
+	if updates.Identifier == orig && updates.Attrs == nil {
+		return nil
+	}
+	if updates.Identifier == orig {
+		updates.Identifier = ""
+	}
+	return &spb.Rule{
+		Action: spb.PolicyAction_CONVERT,
+		Selector: &spb.Selector{
+			Identifier: orig,
+			MatchType:  spb.MatchType_EXACT,
+		},
+		Updates: updates,
+	}
 }
@@ -0,0 +1,250 @@
+package llbsolver
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/source/containerimage"
+	"github.com/moby/buildkit/source/git"
+	httpsource "github.com/moby/buildkit/source/http"
+	"github.com/moby/buildkit/source/lockfile"
+	"github.com/moby/buildkit/sourcepolicy"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+	"github.com/moby/buildkit/util/entitlements"
+	"github.com/moby/buildkit/worker"
+	"github.com/moby/buildkit/worker/label"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+type labelWorker struct {
+	worker.Worker
+	labels map[string]string
+}
+
+func (w *labelWorker) Labels() map[string]string {
+	return w.labels
+}
+
+func TestDaemonSourcePolicy(t *testing.T) {
+	deny := func(ident string) *spb.Policy {
+		return &spb.Policy{Rules: []*spb.Rule{{
+			Action:   spb.PolicyAction_DENY,
+			Selector: &spb.Selector{Identifier: ident},
+		}}}
+	}
+	defaultPol := deny("docker-image://docker.io/library/*")
+	nsPol := deny("docker-image://docker.io/myorg/*")
+	entPol := deny("git://*")
+
+	p := &DaemonSourcePolicy{
+		Policies: []*spb.Policy{defaultPol},
+		Overrides: []DaemonSourcePolicyOverride{
+			{Namespace: "restricted", Policies: []*spb.Policy{nsPol}},
+			{Entitlements: []entitlements.Entitlement{entitlements.EntitlementNetworkHost}, Policies: []*spb.Policy{entPol}},
+		},
+	}
+	require.NoError(t, p.validate())
+
+	w := &labelWorker{labels: map[string]string{label.ContainerdNamespace: "buildkit"}}
+	require.Equal(t, []*spb.Policy{defaultPol}, p.policies(w, nil))
+	require.Equal(t, []*spb.Policy{entPol}, p.policies(w, entitlements.Set{entitlements.EntitlementNetworkHost: nil}))
+
+	w = &labelWorker{labels: map[string]string{label.ContainerdNamespace: "restricted"}}
+	require.Equal(t, []*spb.Policy{nsPol}, p.policies(w, entitlements.Set{entitlements.EntitlementNetworkHost: nil}))
+
+	var nilPol *DaemonSourcePolicy
+	require.Nil(t, nilPol.policies(w, nil))
+	require.NoError(t, nilPol.validate())
+}
+
+func TestDaemonSourcePolicyNoOverride(t *testing.T) {
+	daemon := []*spb.Policy{{Rules: []*spb.Rule{{
+		Action:   spb.PolicyAction_DENY,
+		Selector: &spb.Selector{Identifier: "docker-image://docker.io/library/alpine:*"},
+	}}}}
+	client := []*spb.Policy{{Rules: []*spb.Rule{{
+		Action:   spb.PolicyAction_ALLOW,
+		Selector: &spb.Selector{Identifier: "docker-image://docker.io/library/alpine:latest"},
+	}}}}
+
+	e := sourcepolicy.NewEngine(withDaemonPolicies(daemon, client))
+	_, err := e.Evaluate(context.TODO(), &pb.SourceOp{Identifier: "docker-image://docker.io/library/alpine:latest"})
+	require.ErrorIs(t, err, sourcepolicy.ErrSourceDenied)
+
+	// converting to a denied source is denied as well
+	client = []*spb.Policy{{Rules: []*spb.Rule{{
+		Action:   spb.PolicyAction_CONVERT,
+		Selector: &spb.Selector{Identifier: "docker-image://docker.io/library/busybox:latest"},
+		Updates:  &spb.Update{Identifier: "docker-image://docker.io/library/alpine:latest"},
+	}}}}
+	e = sourcepolicy.NewEngine(withDaemonPolicies(daemon, client))
+	_, err = e.Evaluate(context.TODO(), &pb.SourceOp{Identifier: "docker-image://docker.io/library/busybox:latest"})
+	require.ErrorIs(t, err, sourcepolicy.ErrSourceDenied)
+}
+
+func TestPinRule(t *testing.T) {
+	const dgst = "sha256:4edbd2beb5f78b1014028f4fbb99f3237d9561100b6881aabbf5acce2c4f9454"
+	const commit = "c7f6ab0a2e9a5a0f37c1a1fce4a0c2c1f1e19a6b"
+
+	imgID, err := containerimage.NewImageIdentifier("docker.io/library/alpine:latest")
+	require.NoError(t, err)
+	rule := pinRule("docker-image://docker.io/library/alpine:latest", &pb.SourceOp{Identifier: "docker-image://docker.io/library/alpine:latest"}, imgID, dgst)
+	require.NotNil(t, rule)
+	require.Equal(t, spb.PolicyAction_CONVERT, rule.Action)
+	require.Equal(t, spb.MatchType_EXACT, rule.Selector.MatchType)
+	require.Equal(t, "docker-image://docker.io/library/alpine:latest", rule.Selector.Identifier)
+	require.Equal(t, "docker-image://docker.io/library/alpine:latest@"+dgst, rule.Updates.Identifier)
+
+	imgID, err = containerimage.NewImageIdentifier("docker.io/library/alpine:latest@" + dgst)
+	require.NoError(t, err)
+	require.Nil(t, pinRule("docker-image://docker.io/library/alpine:latest@"+dgst, &pb.SourceOp{Identifier: "docker-image://docker.io/library/alpine:latest@" + dgst}, imgID, dgst))
+	// sources pinned by an earlier lockfile keep their pinned form
+	rule = pinRule("docker-image://docker.io/library/alpine:latest", &pb.SourceOp{Identifier: "docker-image://docker.io/library/alpine:latest@" + dgst}, imgID, dgst)
+	require.NotNil(t, rule)
+	require.Equal(t, "docker-image://docker.io/library/alpine:latest", rule.Selector.Identifier)
+	require.Equal(t, "docker-image://docker.io/library/alpine:latest@"+dgst, rule.Updates.Identifier)
+
+	gitID, err := git.NewGitIdentifier("github.com/moby/buildkit.git#master:docs")
+	require.NoError(t, err)
+	rule = pinRule("git://github.com/moby/buildkit.git#master:docs", &pb.SourceOp{Identifier: "git://github.com/moby/buildkit.git#master:docs"}, gitID, commit)
+	require.NotNil(t, rule)
+	require.Equal(t, "git://github.com/moby/buildkit.git#"+commit+":docs", rule.Updates.Identifier)
+
+	httpID, err := httpsource.NewHTTPIdentifier("example.com/foo.tar", true)
+	require.NoError(t, err)
+	rule = pinRule("https://example.com/foo.tar", &pb.SourceOp{Identifier: "https://example.com/foo.tar"}, httpID, dgst)
+	require.NotNil(t, rule)
+	require.Empty(t, rule.Updates.Identifier)
+	require.Equal(t, map[string]string{pb.AttrHTTPChecksum: dgst}, rule.Updates.Attrs)
+
+	// replaying the lockfile as a policy pins the source
+	e := sourcepolicy.NewEngine([]*spb.Policy{{Rules: []*spb.Rule{rule}}})
+	op := &pb.SourceOp{Identifier: "https://example.com/foo.tar", Attrs: map[string]string{pb.AttrHTTPFilename: "foo.tar"}}
+	mutated, err := e.Evaluate(context.TODO(), op)
+	require.NoError(t, err)
+	require.True(t, mutated)
+	require.Equal(t, dgst, op.Attrs[pb.AttrHTTPChecksum])
+	require.Equal(t, "foo.tar", op.Attrs[pb.AttrHTTPFilename])
+}
+
+func TestSourcePinsLockfile(t *testing.T) {
+	var p sourcePins
+	require.Nil(t, p.lockfile())
+
+	p.match("docker-image://docker.io/library/busybox:latest", "docker-image://docker.io/library/busybox:1.36")
+	orig, ok := p.original("docker-image://docker.io/library/busybox:1.36")
+	require.True(t, ok)
+	require.Equal(t, "docker-image://docker.io/library/busybox:latest", orig)
+	_, ok = p.original("docker-image://docker.io/library/alpine:latest")
+	require.False(t, ok)
+
+	p.rules = map[string]*spb.Rule{
+		"b": {Selector: &spb.Selector{Identifier: "b"}},
+		"a": {Selector: &spb.Selector{Identifier: "a"}},
+	}
+	lock := p.lockfile()
+	require.Len(t, lock.Rules, 2)
+	require.Equal(t, "a", lock.Rules[0].Selector.Identifier)
+}
+
+func TestSourcePinsResolve(t *testing.T) {
+	const dgst = "sha256:4edbd2beb5f78b1014028f4fbb99f3237d9561100b6881aabbf5acce2c4f9454"
+	const tag = "docker-image://docker.io/library/alpine:latest"
+
+	var p sourcePins
+	// images that were not matched by a PIN rule are not pinned
+	p.resolve("docker-image://docker.io/library/busybox:latest", dgst)
+	require.False(t, p.pin(&pb.SourceOp{Identifier: "docker-image://docker.io/library/busybox:latest"}))
+
+	p.match(tag, tag)
+	p.resolve(tag, dgst)
+
+	// the tag@digest form loaded by the frontend maps to the tag, even if
+	// it is matched again
+	p.match(tag+"@"+dgst, tag+"@"+dgst)
+	orig, ok := p.original(tag + "@" + dgst)
+	require.True(t, ok)
+	require.Equal(t, tag, orig)
+
+	// the tag is converted to the resolved digest in the build
+	op := &pb.SourceOp{Identifier: tag}
+	require.True(t, p.pin(op))
+	require.Equal(t, tag+"@"+dgst, op.Identifier)
+	require.False(t, p.pin(op))
+}
+
+func TestPolicyWarnings(t *testing.T) {
+	var w policyWarnings
+	d := sourcepolicy.Decision{
+		Policy:     0,
+		Rule:       1,
+		Action:     spb.PolicyAction_ALLOW,
+		Identifier: "docker-image://docker.io/library/busybox:latest",
+	}
+	require.True(t, w.add(d))
+	require.False(t, w.add(d))
+
+	d2 := d
+	d2.Rule = 2
+	require.True(t, w.add(d2))
+
+	d3 := d
+	d3.Identifier = "docker-image://docker.io/library/alpine:latest"
+	require.True(t, w.add(d3))
+	require.False(t, w.add(d3))
+}
+
+func TestEvaluateLockfile(t *testing.T) {
+	ctx := context.TODO()
+	sum := digest.FromString("content")
+	newOp := func() *pb.SourceOp {
+		dt, err := json.Marshal([]lockfile.Entry{
+			{URL: "https://example.com/a.tar", Digest: sum},
+			{URL: "https://example.org/b.tar", Digest: sum, Filename: "b"},
+		})
+		require.NoError(t, err)
+		return &pb.SourceOp{
+			Identifier: "lockfile://" + digest.FromBytes(dt).Encoded(),
+			Attrs:      map[string]string{pb.AttrLockfileEntries: string(dt)},
+		}
+	}
+
+	op := newOp()
+	err := evaluateLockfile(ctx, sourcepolicy.NewEngine([]*spb.Policy{{Rules: []*spb.Rule{{
+		Action:   spb.PolicyAction_DENY,
+		Selector: &spb.Selector{Identifier: "https://example.org/*"},
+	}}}}), op)
+	require.ErrorIs(t, err, sourcepolicy.ErrSourceDenied)
+	require.ErrorContains(t, err, "https://example.org/b.tar")
+
+	op = newOp()
+	orig := op.Identifier
+	require.NoError(t, evaluateLockfile(ctx, sourcepolicy.NewEngine([]*spb.Policy{{Rules: []*spb.Rule{{
+		Action:   spb.PolicyAction_CONVERT,
+		Selector: &spb.Selector{Identifier: "https://example.com/*", MatchType: spb.MatchType_WILDCARD},
+		Updates:  &spb.Update{Identifier: "https://mirror.example.com/${1}"},
+	}}}}), op))
+	require.NotEqual(t, orig, op.Identifier)
+	var entries []lockfile.Entry
+	require.NoError(t, json.Unmarshal([]byte(op.Attrs[pb.AttrLockfileEntries]), &entries))
+	require.Equal(t, []lockfile.Entry{
+		{URL: "https://mirror.example.com/a.tar", Digest: sum},
+		{URL: "https://example.org/b.tar", Digest: sum, Filename: "b"},
+	}, entries)
+
+	op = newOp()
+	err = evaluateLockfile(ctx, sourcepolicy.NewEngine([]*spb.Policy{{Rules: []*spb.Rule{{
+		Action:   spb.PolicyAction_CONVERT,
+		Selector: &spb.Selector{Identifier: "https://example.com/a.tar"},
+		Updates:  &spb.Update{Identifier: "docker-image://alpine"},
+	}}}}), op)
+	require.ErrorContains(t, err, "unsupported source")
+
+	// other sources are not changed
+	op = &pb.SourceOp{Identifier: "https://example.com/a.tar"}
+	require.NoError(t, evaluateLockfile(ctx, sourcepolicy.NewEngine(nil), op))
+	require.Equal(t, "https://example.com/a.tar", op.Identifier)
+}
@@ -334,9 +334,16 @@ func loadLLB(ctx context.Context, def *pb.Definition, polEngine SourcePolicyEval
 		}
 		dgst := digest.FromBytes(dt)
 		if polEngine != nil {
+			ctx := withPolicyVertex(ctx, dgst)
 			if _, err := polEngine.Evaluate(ctx, pbop.GetSource()); err != nil {
 				return solver.Edge{}, errors.Wrap(err, "error evaluating the source policy")
 			}
+			if err := evaluateLockfile(ctx, polEngine, pbop.GetSource()); err != nil {
+				return solver.Edge{}, errors.Wrap(err, "error evaluating the source policy")
+			}
+			if err := polEngine.EvaluateExec(ctx, pbop.GetExec()); err != nil {
+				return solver.Edge{}, errors.Wrap(err, "error evaluating the source policy")
+			}
 		}
 		allOps[dgst] = &op{
 			Op:       &pbop,
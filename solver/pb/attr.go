@@ -7,6 +7,7 @@ const AttrAuthTokenSecret = "git.authtokensecret"
 const AttrKnownSSHHosts = "git.knownsshhosts"
 const AttrMountSSHSock = "git.mountsshsock"
 const AttrGitChecksum = "git.checksum"
+const AttrGitSubdirTreeKey = "git.subdirtreekey"
 
 const AttrLocalSessionID = "local.session"
 const AttrLocalUniqueID = "local.unique"
@@ -26,6 +27,13 @@ const AttrHTTPUID = "http.uid"
 const AttrHTTPGID = "http.gid"
 const AttrHTTPAuthHeaderSecret = "http.authheadersecret"
 const AttrHTTPHeaderPrefix = "http.header."
+const AttrHTTPMirrors = "http.mirrors"
+const AttrHTTPRetries = "http.retries"
+const AttrHTTPChecksumURL = "http.checksumurl"
+const AttrHTTPSignatureURL = "http.signatureurl"
+const AttrHTTPSignatureKey = "http.signaturekey"
+
+const AttrLockfileEntries = "lockfile.entries"
 
 const AttrImageResolveMode = "image.resolvemode"
 const AttrImageResolveModeDefault = "default"
@@ -33,13 +41,20 @@ const AttrImageResolveModeForcePull = "pull"
 const AttrImageResolveModePreferLocal = "local"
 const AttrImageRecordType = "image.recordtype"
 const AttrImageLayerLimit = "image.layerlimit"
+const AttrImageSignatureKey = "image.signaturekey"
+const AttrImageAttestations = "image.attestations"
+const AttrImageRequiredPaths = "image.requiredpaths"
 
 const AttrOCILayoutSessionID = "oci.session"
 const AttrOCILayoutStoreID = "oci.store"
 const AttrOCILayoutLayerLimit = "oci.layerlimit"
 
+const AttrOCIArtifactMediaTypes = "ociartifact.mediatypes"
+const AttrOCIArtifactAnnotationPrefix = "ociartifact.annotation."
+
 const AttrLocalDiffer = "local.differ"
 const AttrLocalDifferNone = "none"
 const AttrLocalDifferMetadata = "metadata"
+const AttrLocalChunkedTransfer = "local.chunkedtransfer"
 
 type IsFileAction = isFileAction_Action
@@ -9,9 +9,11 @@ var Caps apicaps.CapList
 // considered immutable. After a capability is marked stable it should not be disabled.
 
 const (
-	CapSourceImage            apicaps.CapID = "source.image"
-	CapSourceImageResolveMode apicaps.CapID = "source.image.resolvemode"
-	CapSourceImageLayerLimit  apicaps.CapID = "source.image.layerlimit"
+	CapSourceImage              apicaps.CapID = "source.image"
+	CapSourceImageResolveMode   apicaps.CapID = "source.image.resolvemode"
+	CapSourceImageLayerLimit    apicaps.CapID = "source.image.layerlimit"
+	CapSourceImageVerify        apicaps.CapID = "source.image.verify"
+	CapSourceImageRequiredPaths apicaps.CapID = "source.image.requiredpaths"
 
 	CapSourceLocal                apicaps.CapID = "source.local"
 	CapSourceLocalUnique          apicaps.CapID = "source.local.unique"
@@ -22,6 +24,7 @@ const (
 	CapSourceLocalSharedKeyHint   apicaps.CapID = "source.local.sharedkeyhint"
 	CapSourceLocalDiffer          apicaps.CapID = "source.local.differ"
 	CapSourceMetadataTransfer     apicaps.CapID = "source.local.metadatatransfer"
+	CapSourceLocalChunkedTransfer apicaps.CapID = "source.local.chunkedtransfer"
 
 	CapSourceGit              apicaps.CapID = "source.git"
 	CapSourceGitKeepDir       apicaps.CapID = "source.git.keepgitdir"
@@ -31,16 +34,24 @@ const (
 	CapSourceGitMountSSHSock  apicaps.CapID = "source.git.mountsshsock"
 	CapSourceGitSubdir        apicaps.CapID = "source.git.subdir"
 	CapSourceGitChecksum      apicaps.CapID = "source.git.checksum"
+	CapSourceGitSubdirTreeKey apicaps.CapID = "source.git.subdirtreekey"
 
 	CapSourceHTTP         apicaps.CapID = "source.http"
 	CapSourceHTTPAuth     apicaps.CapID = "source.http.auth"
 	CapSourceHTTPChecksum apicaps.CapID = "source.http.checksum"
 	CapSourceHTTPPerm     apicaps.CapID = "source.http.perm"
 	// NOTE the historical typo
-	CapSourceHTTPUIDGID apicaps.CapID = "soruce.http.uidgid"
-	CapSourceHTTPHeader apicaps.CapID = "source.http.header"
+	CapSourceHTTPUIDGID      apicaps.CapID = "soruce.http.uidgid"
+	CapSourceHTTPHeader      apicaps.CapID = "source.http.header"
+	CapSourceHTTPMirrors     apicaps.CapID = "source.http.mirrors"
+	CapSourceHTTPRetries     apicaps.CapID = "source.http.retries"
+	CapSourceHTTPChecksumURL apicaps.CapID = "source.http.checksumurl"
+	CapSourceHTTPSignature   apicaps.CapID = "source.http.signature"
 
-	CapSourceOCILayout apicaps.CapID = "source.ocilayout"
+	CapSourceOCILayout   apicaps.CapID = "source.ocilayout"
+	CapSourceOCIArtifact apicaps.CapID = "source.ociartifact"
+
+	CapSourceLockfile apicaps.CapID = "source.lockfile"
 
 	CapBuildOpLLBFileName apicaps.CapID = "source.buildop.llbfilename"
 
@@ -127,6 +138,18 @@ func init() {
 		Status:  apicaps.CapStatusExperimental,
 	})
 
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceImageVerify,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceImageRequiredPaths,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
 	Caps.Init(apicaps.Cap{
 		ID:      CapSourceLocal,
 		Enabled: true,
@@ -181,6 +204,12 @@ func init() {
 		Status:  apicaps.CapStatusExperimental,
 	})
 
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceLocalChunkedTransfer,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
 	Caps.Init(apicaps.Cap{
 		ID:      CapSourceGit,
 		Enabled: true,
@@ -229,6 +258,12 @@ func init() {
 		Status:  apicaps.CapStatusExperimental,
 	})
 
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceGitSubdirTreeKey,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
 	Caps.Init(apicaps.Cap{
 		ID:      CapSourceHTTP,
 		Enabled: true,
@@ -265,12 +300,48 @@ func init() {
 		Status:  apicaps.CapStatusExperimental,
 	})
 
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceHTTPMirrors,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceHTTPRetries,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceHTTPChecksumURL,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceHTTPSignature,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
 	Caps.Init(apicaps.Cap{
 		ID:      CapSourceOCILayout,
 		Enabled: true,
 		Status:  apicaps.CapStatusExperimental,
 	})
 
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceOCIArtifact,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
+	Caps.Init(apicaps.Cap{
+		ID:      CapSourceLockfile,
+		Enabled: true,
+		Status:  apicaps.CapStatusExperimental,
+	})
+
 	Caps.Init(apicaps.Cap{
 		ID:      CapBuildOpLLBFileName,
 		Enabled: true,
@@ -11,6 +11,7 @@ const (
 	AttestationReasonKey     = "reason"
 	AttestationSBOMCore      = "sbom-core"
 	AttestationInlineOnlyKey = "inline-only"
+	AttestationSignKey       = "sign"
 )
 
 const (
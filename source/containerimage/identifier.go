@@ -19,6 +19,15 @@ type ImageIdentifier struct {
 	ResolveMode resolver.ResolveMode
 	RecordType  client.UsageRecordType
 	LayerLimit  *int
+	// RequiredPaths limits the pulled layers to the ones containing the
+	// paths.
+	RequiredPaths []string
+	// SignatureKey contains PEM encoded public keys the image needs to be
+	// signed with.
+	SignatureKey []byte
+	// Attestations are the predicate types of the attestations the image
+	// needs to have.
+	Attestations []string
 }
 
 func NewImageIdentifier(str string) (*ImageIdentifier, error) {
@@ -13,6 +13,7 @@ import (
 	"github.com/containerd/containerd/v2/core/remotes"
 	"github.com/containerd/containerd/v2/core/remotes/docker"
 	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/pkg/labels"
 	"github.com/containerd/containerd/v2/pkg/snapshotters"
 	cerrdefs "github.com/containerd/errdefs"
 	"github.com/moby/buildkit/cache"
@@ -21,6 +22,7 @@ import (
 	"github.com/moby/buildkit/session"
 	"github.com/moby/buildkit/solver"
 	"github.com/moby/buildkit/solver/errdefs"
+	"github.com/moby/buildkit/util/contentutil"
 	"github.com/moby/buildkit/util/estargz"
 	"github.com/moby/buildkit/util/flightcontrol"
 	"github.com/moby/buildkit/util/imageutil"
@@ -45,11 +47,14 @@ type puller struct {
 	Ref            string
 	SessionManager *session.Manager
 	layerLimit     *int
+	verify         []verifyPolicy
+	requiredPaths  []string
 	vtx            solver.Vertex
 	ResolverType
 	store sourceresolver.ResolveImageConfigOptStore
 
 	g                flightcontrol.Group[struct{}]
+	layersSelected   bool
 	cacheKeyErr      error
 	cacheKeyDone     bool
 	releaseTmpLeases func(context.Context) error
@@ -60,7 +65,7 @@ type puller struct {
 	*pull.Puller
 }
 
-func mainManifestKey(desc ocispecs.Descriptor, platform ocispecs.Platform, layerLimit *int) (digest.Digest, error) {
+func mainManifestKey(desc ocispecs.Descriptor, platform ocispecs.Platform, layerLimit *int, requiredPaths []string) (digest.Digest, error) {
 	dt, err := json.Marshal(struct {
 		Digest     digest.Digest
 		OS         string
@@ -69,6 +74,7 @@ func mainManifestKey(desc ocispecs.Descriptor, platform ocispecs.Platform, layer
 		OSVersion  string   `json:",omitempty"`
 		OSFeatures []string `json:",omitempty"`
 		Limit      *int     `json:",omitempty"`
+		Paths      []string `json:",omitempty"`
 	}{
 		Digest:     desc.Digest,
 		OS:         platform.OS,
@@ -77,6 +83,7 @@ func mainManifestKey(desc ocispecs.Descriptor, platform ocispecs.Platform, layer
 		OSVersion:  platform.OSVersion,
 		OSFeatures: platform.OSFeatures,
 		Limit:      layerLimit,
+		Paths:      requiredPaths,
 	})
 	if err != nil {
 		return "", err
@@ -129,6 +136,12 @@ func (p *puller) CacheKey(ctx context.Context, g session.Group, index int) (cach
 			return struct{}{}, err
 		}
 
+		if len(p.verify) > 0 {
+			if err := p.verifyImage(ctx); err != nil {
+				return struct{}{}, err
+			}
+		}
+
 		if ll := p.layerLimit; ll != nil {
 			if *ll > len(p.manifest.Descriptors) {
 				return struct{}{}, errors.Errorf("layer limit %d is greater than the number of layers in the image %d", *ll, len(p.manifest.Descriptors))
@@ -136,6 +149,11 @@ func (p *puller) CacheKey(ctx context.Context, g session.Group, index int) (cach
 			p.manifest.Descriptors = p.manifest.Descriptors[:*ll]
 		}
 
+		if len(p.requiredPaths) > 0 && len(p.manifest.Descriptors) > 0 {
+			provider := contentutil.NewStoreWithProvider(p.ContentStore, p.manifest.Provider(g))
+			p.manifest.Descriptors, p.layersSelected = selectLayers(ctx, provider, p.manifest.Descriptors, p.requiredPaths)
+		}
+
 		if len(p.manifest.Descriptors) > 0 {
 			progressController := &controller.Controller{
 				WriterFactory: progressFactory,
@@ -166,12 +184,20 @@ func (p *puller) CacheKey(ctx context.Context, g session.Group, index int) (cach
 		}
 
 		desc := p.manifest.MainManifestDesc
-		k, err := mainManifestKey(desc, p.Platform, p.layerLimit)
+		k, err := mainManifestKey(desc, p.Platform, p.layerLimit, p.requiredPaths)
 		if err != nil {
 			return struct{}{}, err
 		}
 		p.manifestKey = k.String()
 
+		if p.layersSelected {
+			// only some layers are pulled, the chain of the selected layers
+			// identifies the result
+			p.configKey = selectedLayersKey(p.manifest.Descriptors).String()
+			p.cacheKeyDone = true
+			return struct{}{}, nil
+		}
+
 		dt, err := content.ReadBlob(ctx, p.ContentStore, p.manifest.ConfigDesc)
 		if err != nil {
 			return struct{}{}, err
@@ -283,6 +309,19 @@ func (p *puller) Snapshot(ctx context.Context, g session.Group) (ir cache.Immuta
 	return current, nil
 }
 
+// selectedLayersKey returns the chainID of the layers, or an empty digest if
+// no layers were selected.
+func selectedLayersKey(descs []ocispecs.Descriptor) digest.Digest {
+	if len(descs) == 0 {
+		return ""
+	}
+	diffIDs := make([]digest.Digest, len(descs))
+	for i, desc := range descs {
+		diffIDs[i] = digest.Digest(desc.Annotations[labels.LabelUncompressed])
+	}
+	return identity.ChainID(diffIDs)
+}
+
 // cacheKeyFromConfig returns a stable digest from image config. If image config
 // is a known oci image we will use chainID of layers.
 func cacheKeyFromConfig(dt []byte, layerLimit *int) (digest.Digest, error) {
@@ -0,0 +1,196 @@
+package containerimage
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
+	"github.com/moby/buildkit/util/bklog"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+	// maxSymlinkExpansions limits how many times symlinks in the layers are
+	// followed when expanding the required paths.
+	maxSymlinkExpansions = 32
+)
+
+// tocEntry is a file in the table of contents of a layer.
+type tocEntry struct {
+	// path is the cleaned path of the file relative to the root. For
+	// whiteouts, it is the path of the deleted file or the opaque directory.
+	path     string
+	typ      string
+	linkName string
+	whiteout bool
+}
+
+// selectLayers returns the layers that contain the required paths. Layers
+// are selected using the table of contents of eStargz and zstd:chunked
+// layers, so only a small part of each layer needs to be fetched. If any
+// layer has no table of contents, all layers are returned.
+func selectLayers(ctx context.Context, provider content.Provider, descs []ocispecs.Descriptor, paths []string) ([]ocispecs.Descriptor, bool) {
+	tocs := make([][]tocEntry, len(descs))
+	for i, desc := range descs {
+		toc, err := readTOC(ctx, provider, desc)
+		if err != nil {
+			bklog.G(ctx).Debugf("pulling all layers, failed to read table of contents of %s: %v", desc.Digest, err)
+			return descs, false
+		}
+		tocs[i] = toc
+	}
+
+	required := expandSymlinks(cleanPaths(paths), tocs)
+
+	var out []ocispecs.Descriptor
+	for i, toc := range tocs {
+		if layerContains(toc, required) {
+			out = append(out, descs[i])
+		}
+	}
+	return out, true
+}
+
+// readTOC reads the table of contents of an eStargz or zstd:chunked layer.
+func readTOC(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor) ([]tocEntry, error) {
+	tocDigest, ok := desc.Annotations[estargz.TOCJSONDigestAnnotation]
+	if !ok {
+		tocDigest, ok = desc.Annotations[zstdchunked.ManifestChecksumAnnotation]
+	}
+	if !ok {
+		return nil, errors.New("layer has no table of contents")
+	}
+	dgst, err := digest.Parse(tocDigest)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid table of contents digest")
+	}
+
+	ra, err := provider.ReaderAt(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer ra.Close()
+
+	r, err := estargz.Open(io.NewSectionReader(ra, 0, desc.Size), estargz.WithDecompressors(new(zstdchunked.Decompressor)))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.VerifyTOC(dgst); err != nil {
+		return nil, err
+	}
+
+	var entries []tocEntry
+	root, ok := r.Lookup("")
+	if !ok {
+		return nil, nil
+	}
+	var walk func(dir string, e *estargz.TOCEntry)
+	walk = func(dir string, e *estargz.TOCEntry) {
+		e.ForeachChild(func(base string, ent *estargz.TOCEntry) bool {
+			p := path.Join(dir, base)
+			switch {
+			case base == whiteoutOpaque:
+				entries = append(entries, tocEntry{path: dir, whiteout: true})
+			case strings.HasPrefix(base, whiteoutPrefix):
+				entries = append(entries, tocEntry{path: path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), whiteout: true})
+			default:
+				entries = append(entries, tocEntry{path: p, typ: ent.Type, linkName: ent.LinkName})
+			}
+			if ent.Type == "dir" {
+				walk(p, ent)
+			}
+			return true
+		})
+	}
+	walk("", root)
+	return entries, nil
+}
+
+func cleanPaths(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		p = strings.TrimPrefix(path.Clean("/"+p), "/")
+		out = append(out, p)
+	}
+	return out
+}
+
+// expandSymlinks adds the targets of symlinks in the layers to the required
+// paths, e.g. usr/bin/sh for bin/sh if bin is a symlink to usr/bin.
+func expandSymlinks(required []string, tocs [][]tocEntry) []string {
+	seen := make(map[string]struct{}, len(required))
+	for _, p := range required {
+		seen[p] = struct{}{}
+	}
+	for range maxSymlinkExpansions {
+		var added []string
+		for _, toc := range tocs {
+			for _, e := range toc {
+				if e.typ != "symlink" {
+					continue
+				}
+				for _, p := range required {
+					rest, ok := isWithin(p, e.path)
+					if !ok {
+						continue
+					}
+					target := e.linkName
+					if !path.IsAbs(target) {
+						target = path.Join("/", path.Dir(e.path), target)
+					}
+					resolved := strings.TrimPrefix(path.Join(target, rest), "/")
+					if _, ok := seen[resolved]; !ok {
+						seen[resolved] = struct{}{}
+						added = append(added, resolved)
+					}
+				}
+			}
+		}
+		if len(added) == 0 {
+			break
+		}
+		required = append(required, added...)
+	}
+	return required
+}
+
+// layerContains returns true if the layer adds, modifies or deletes any of
+// the required paths.
+func layerContains(toc []tocEntry, required []string) bool {
+	for _, e := range toc {
+		for _, p := range required {
+			if _, ok := isWithin(e.path, p); ok {
+				return true
+			}
+			// a parent of the required path is deleted or replaced by a
+			// non-directory
+			if _, ok := isWithin(p, e.path); ok && (e.whiteout || e.typ != "dir") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isWithin returns the path of p relative to dir if p is dir or a path
+// inside it.
+func isWithin(p, dir string) (string, bool) {
+	if dir == "" {
+		return p, true
+	}
+	if p == dir {
+		return "", true
+	}
+	if rest, ok := strings.CutPrefix(p, dir+"/"); ok {
+		return rest, true
+	}
+	return "", false
+}
@@ -0,0 +1,98 @@
+package containerimage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
+	"github.com/klauspost/compress/zstd"
+	"github.com/moby/buildkit/util/contentutil"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+type zstdChunkedCompression struct {
+	*zstdchunked.Compressor
+	*zstdchunked.Decompressor
+}
+
+type testFile struct {
+	name     string
+	typ      byte
+	linkName string
+}
+
+func TestSelectLayers(t *testing.T) {
+	ctx := context.TODO()
+	b := contentutil.NewBuffer()
+
+	descs := []ocispecs.Descriptor{
+		testLayer(t, b, true, testFile{name: "bin", typ: tar.TypeSymlink, linkName: "usr/bin"}, testFile{name: "usr/", typ: tar.TypeDir}, testFile{name: "usr/bin/", typ: tar.TypeDir}, testFile{name: "usr/bin/sh"}),
+		testLayer(t, b, true, testFile{name: "usr/", typ: tar.TypeDir}, testFile{name: "usr/lib/", typ: tar.TypeDir}, testFile{name: "usr/lib/big"}),
+		testLayer(t, b, true, testFile{name: "usr/", typ: tar.TypeDir}, testFile{name: "usr/bin/", typ: tar.TypeDir}, testFile{name: "usr/bin/gcc"}),
+		testLayer(t, b, true, testFile{name: "usr/", typ: tar.TypeDir}, testFile{name: "usr/lib/", typ: tar.TypeDir}, testFile{name: "usr/lib/.wh.big"}),
+	}
+
+	selected, ok := selectLayers(ctx, b, descs, []string{"/bin/gcc"})
+	require.True(t, ok)
+	require.Equal(t, []ocispecs.Descriptor{descs[0], descs[2]}, selected)
+
+	selected, ok = selectLayers(ctx, b, descs, []string{"/usr/lib"})
+	require.True(t, ok)
+	require.Equal(t, []ocispecs.Descriptor{descs[1], descs[3]}, selected)
+
+	selected, ok = selectLayers(ctx, b, descs, []string{"/etc/passwd"})
+	require.True(t, ok)
+	require.Empty(t, selected)
+
+	// layers without a table of contents are pulled fully
+	descs = append(descs, testLayer(t, b, false, testFile{name: "etc/", typ: tar.TypeDir}, testFile{name: "etc/passwd"}))
+	selected, ok = selectLayers(ctx, b, descs, []string{"/bin/gcc"})
+	require.False(t, ok)
+	require.Equal(t, descs, selected)
+}
+
+func testLayer(t *testing.T, cs content.Ingester, toc bool, files ...testFile) ocispecs.Descriptor {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Typeflag: f.typ, Linkname: f.linkName, Mode: 0644}
+		if f.typ == 0 {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(f.name))
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(f.name))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+
+	desc := ocispecs.Descriptor{
+		MediaType:   ocispecs.MediaTypeImageLayerZstd,
+		Annotations: map[string]string{},
+	}
+	dt := buf.Bytes()
+	if toc {
+		blob, err := estargz.Build(io.NewSectionReader(bytes.NewReader(dt), 0, int64(len(dt))), estargz.WithCompression(&zstdChunkedCompression{
+			Compressor:   &zstdchunked.Compressor{CompressionLevel: zstd.SpeedDefault},
+			Decompressor: &zstdchunked.Decompressor{},
+		}))
+		require.NoError(t, err)
+		defer blob.Close()
+		dt, err = io.ReadAll(blob)
+		require.NoError(t, err)
+		desc.Annotations[zstdchunked.ManifestChecksumAnnotation] = blob.TOCDigest().String()
+	}
+	desc.Digest = digest.FromBytes(dt)
+	desc.Size = int64(len(dt))
+	require.NoError(t, content.WriteBlob(context.TODO(), cs, desc.Digest.String(), bytes.NewReader(dt), desc))
+	return desc
+}
@@ -2,8 +2,10 @@ package containerimage
 
 import (
 	"context"
+	"encoding/json"
 	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/containerd/containerd/v2/core/content"
 	"github.com/containerd/containerd/v2/core/diff"
@@ -26,6 +28,7 @@ import (
 	"github.com/moby/buildkit/util/imageutil"
 	"github.com/moby/buildkit/util/pull"
 	"github.com/moby/buildkit/util/resolver"
+	"github.com/moby/buildkit/util/signutil"
 	"github.com/moby/buildkit/util/tracing"
 	digest "github.com/opencontainers/go-digest"
 	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
@@ -51,6 +54,9 @@ type SourceOpt struct {
 	RegistryHosts docker.RegistryHosts
 	ResolverType
 	LeaseManager leases.Manager
+	// VerifyPolicies are applied to all images pulled from a registry
+	// matching the policy.
+	VerifyPolicies []VerifyPolicy
 }
 
 type Source struct {
@@ -85,14 +91,17 @@ func (is *Source) Identifier(scheme, ref string, attrs map[string]string, platfo
 
 func (is *Source) Resolve(ctx context.Context, id source.Identifier, sm *session.Manager, vtx solver.Vertex) (source.SourceInstance, error) {
 	var (
-		p          *puller
-		platform   = platforms.DefaultSpec()
-		pullerUtil *pull.Puller
-		mode       resolver.ResolveMode
-		recordType client.UsageRecordType
-		ref        reference.Spec
-		store      sourceresolver.ResolveImageConfigOptStore
-		layerLimit *int
+		p             *puller
+		platform      = platforms.DefaultSpec()
+		pullerUtil    *pull.Puller
+		mode          resolver.ResolveMode
+		recordType    client.UsageRecordType
+		ref           reference.Spec
+		store         sourceresolver.ResolveImageConfigOptStore
+		layerLimit    *int
+		verify        []verifyPolicy
+		requiredPaths []string
+		err           error
 	)
 	switch is.ResolverType {
 	case ResolverTypeRegistry:
@@ -108,6 +117,11 @@ func (is *Source) Resolve(ctx context.Context, id source.Identifier, sm *session
 		recordType = imageIdentifier.RecordType
 		ref = imageIdentifier.Reference
 		layerLimit = imageIdentifier.LayerLimit
+		requiredPaths = imageIdentifier.RequiredPaths
+		verify, err = is.verifyPolicies(imageIdentifier)
+		if err != nil {
+			return nil, err
+		}
 	case ResolverTypeOCILayout:
 		ociIdentifier, ok := id.(*OCIIdentifier)
 		if !ok {
@@ -146,6 +160,8 @@ func (is *Source) Resolve(ctx context.Context, id source.Identifier, sm *session
 		vtx:            vtx,
 		store:          store,
 		layerLimit:     layerLimit,
+		verify:         verify,
+		requiredPaths:  requiredPaths,
 	}
 	return p, nil
 }
@@ -245,6 +261,23 @@ func (is *Source) registryIdentifier(ref string, attrs map[string]string, platfo
 				return nil, errors.Errorf("invalid layer limit %s", v)
 			}
 			id.LayerLimit = &l
+		case pb.AttrImageRequiredPaths:
+			var paths []string
+			if err := json.Unmarshal([]byte(v), &paths); err != nil {
+				return nil, errors.Wrapf(err, "invalid required paths %s", v)
+			}
+			id.RequiredPaths = paths
+		case pb.AttrImageSignatureKey:
+			if _, err := signutil.ParsePublicKeys([]byte(v)); err != nil {
+				return nil, err
+			}
+			id.SignatureKey = []byte(v)
+		case pb.AttrImageAttestations:
+			for _, t := range strings.Split(v, ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					id.Attestations = append(id.Attestations, t)
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,390 @@
+package containerimage
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"slices"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/remotes"
+	cerrdefs "github.com/containerd/errdefs"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/moby/buildkit/sourcepolicy"
+	"github.com/moby/buildkit/util/attestation"
+	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/util/resolver"
+	"github.com/moby/buildkit/util/signutil"
+	"github.com/moby/buildkit/util/wildcard"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+)
+
+const (
+	cosignSignatureAnnotation      = "dev.cosignproject.cosign/signature"
+	inTotoPredicateTypeAnnotation  = "in-toto.io/predicate-type"
+	cosignSignatureTagSuffix       = ".sig"
+	cosignAttestationTagSuffix     = ".att"
+	maxVerifyManifestSize          = 4 << 20
+	maxVerifyBlobSize              = 32 << 20
+	cosignSimpleSigningPayloadType = "cosign container image signature"
+	// attestationManifestArtifactType is the artifact type of attestation
+	// manifests pushed by BuildKit as referrers
+	attestationManifestArtifactType = "application/vnd.docker.attestation.manifest.v1+json"
+)
+
+// VerifyPolicy requires images to be signed or to have attestations before
+// they are used in a build.
+type VerifyPolicy struct {
+	// Match is the name of the images the policy applies to, e.g.
+	// docker.io/library/alpine. Wildcards are supported. An empty Match
+	// applies to all images.
+	Match string
+	// SignatureKey contains PEM encoded public keys. Images need a cosign
+	// signature made with one of the keys.
+	SignatureKey []byte
+	// Attestations are the in-toto predicate types images need to have
+	// attestations for. If SignatureKey is set, the attestations need to be
+	// signed with one of the keys.
+	Attestations []string
+}
+
+type verifyPolicy struct {
+	keys         []crypto.PublicKey
+	attestations []string
+}
+
+// verifyPolicies returns the policies that apply to the image, both from the
+// daemon configuration and from the attributes of the source.
+func (is *Source) verifyPolicies(id *ImageIdentifier) ([]verifyPolicy, error) {
+	var out []verifyPolicy
+	for _, vp := range is.VerifyPolicies {
+		if vp.Match != "" {
+			w, err := wildcard.New(vp.Match)
+			if err != nil {
+				return nil, err
+			}
+			if w.Match(id.Reference.Locator) == nil {
+				continue
+			}
+		}
+		p, err := newVerifyPolicy(vp.SignatureKey, vp.Attestations)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid verify policy for %s", vp.Match)
+		}
+		out = append(out, p)
+	}
+	if len(id.SignatureKey) > 0 || len(id.Attestations) > 0 {
+		p, err := newVerifyPolicy(id.SignatureKey, id.Attestations)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func newVerifyPolicy(key []byte, attestations []string) (verifyPolicy, error) {
+	p := verifyPolicy{attestations: attestations}
+	if len(key) > 0 {
+		keys, err := signutil.ParsePublicKeys(key)
+		if err != nil {
+			return p, err
+		}
+		p.keys = keys
+	}
+	return p, nil
+}
+
+// verifyImage checks that the pulled image satisfies all verify policies.
+// Failures are returned as policy errors.
+func (p *puller) verifyImage(ctx context.Context) (err error) {
+	verifyProgressDone := progress.OneOff(ctx, "verify "+p.Src.String())
+	defer func() {
+		verifyProgressDone(err)
+	}()
+
+	subjects := p.verifySubjects()
+	for _, vp := range p.verify {
+		if len(vp.keys) > 0 {
+			if err := p.verifySignature(ctx, subjects, vp.keys); err != nil {
+				return policyError(p.Src.String(), err)
+			}
+		}
+		for _, t := range vp.attestations {
+			if err := p.verifyAttestation(ctx, subjects, t, vp.keys); err != nil {
+				return policyError(p.Src.String(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func policyError(ref string, err error) error {
+	if cerrdefs.IsNotFound(err) || errors.Is(err, errVerify) {
+		return errors.Wrapf(sourcepolicy.ErrSourceDenied, "source %q denied by policy: %v", ref, err)
+	}
+	return err
+}
+
+var errVerify = errors.New("verification failed")
+
+// verifySubjects returns the digests a signature or attestation may refer to:
+// the resolved image and, for multi-platform images, the manifest of the
+// selected platform.
+func (p *puller) verifySubjects() []digest.Digest {
+	root := p.manifest.MainManifestDesc
+	subjects := []digest.Digest{root.Digest}
+	if images.IsIndexType(root.MediaType) {
+		for _, desc := range p.manifest.Nonlayers {
+			if images.IsManifestType(desc.MediaType) && desc.Digest != root.Digest {
+				subjects = append(subjects, desc.Digest)
+			}
+		}
+	}
+	return subjects
+}
+
+// verifySignature checks that one of the subjects has a cosign signature made
+// with one of the keys.
+func (p *puller) verifySignature(ctx context.Context, subjects []digest.Digest, keys []crypto.PublicKey) error {
+	for _, subject := range subjects {
+		mfst, fetcher, err := p.fetchTagManifest(ctx, subject, cosignSignatureTagSuffix)
+		if err != nil {
+			if cerrdefs.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		for _, l := range mfst.Layers {
+			sig, ok := l.Annotations[cosignSignatureAnnotation]
+			if !ok {
+				continue
+			}
+			sigDt, err := base64.StdEncoding.DecodeString(sig)
+			if err != nil {
+				continue
+			}
+			payload, err := fetchBlob(ctx, fetcher, l, maxVerifyBlobSize)
+			if err != nil {
+				return err
+			}
+			if !signutil.VerifyAny(keys, payload, sigDt) {
+				continue
+			}
+			if err := checkSignaturePayload(payload, subject); err != nil {
+				continue
+			}
+			return nil
+		}
+	}
+	return errors.Wrap(errVerify, "no signature made with the trusted keys found")
+}
+
+// cosignPayload is the simple signing payload signed by cosign.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+func checkSignaturePayload(dt []byte, subject digest.Digest) error {
+	var payload cosignPayload
+	if err := json.Unmarshal(dt, &payload); err != nil {
+		return errors.Wrap(errVerify, "invalid signature payload")
+	}
+	if payload.Critical.Type != cosignSimpleSigningPayloadType {
+		return errors.Wrapf(errVerify, "unsupported signature payload type %q", payload.Critical.Type)
+	}
+	if payload.Critical.Image.DockerManifestDigest != subject.String() {
+		return errors.Wrapf(errVerify, "signature is for %s, expected %s", payload.Critical.Image.DockerManifestDigest, subject)
+	}
+	return nil
+}
+
+// verifyAttestation checks that one of the subjects has an attestation with
+// the predicate type. With keys, the attestation needs to be a DSSE envelope
+// signed with one of the keys as pushed by "cosign attest". Otherwise the
+// attestation manifests BuildKit adds to image indexes or pushes as referrers
+// are checked.
+func (p *puller) verifyAttestation(ctx context.Context, subjects []digest.Digest, predicateType string, keys []crypto.PublicKey) error {
+	if len(keys) > 0 {
+		return p.verifySignedAttestation(ctx, subjects, predicateType, keys)
+	}
+
+	fetcher, err := p.Resolver.Fetcher(ctx, p.manifest.Ref)
+	if err != nil {
+		return err
+	}
+	root := p.manifest.MainManifestDesc
+	if images.IsIndexType(root.MediaType) {
+		dt, err := content.ReadBlob(ctx, p.ContentStore, root)
+		if err != nil {
+			return err
+		}
+		var idx ocispecs.Index
+		if err := json.Unmarshal(dt, &idx); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, desc := range idx.Manifests {
+			if desc.Annotations[attestation.DockerAnnotationReferenceType] != attestation.DockerAnnotationReferenceTypeDefault {
+				continue
+			}
+			if !slices.Contains(subjects, digest.Digest(desc.Annotations[attestation.DockerAnnotationReferenceDigest])) {
+				continue
+			}
+			if ok, err := hasPredicateType(ctx, fetcher, desc, predicateType); ok || err != nil {
+				return err
+			}
+		}
+	}
+
+	// attestations pushed as referrers of the image manifests
+	if r, ok := p.Resolver.(*resolver.Resolver); ok {
+		for _, subject := range subjects {
+			descs, err := r.Referrers(ctx, p.manifest.Ref, subject, attestationManifestArtifactType)
+			if err != nil {
+				return err
+			}
+			for _, desc := range descs {
+				if ok, err := hasPredicateType(ctx, fetcher, desc, predicateType); ok || err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return errors.Wrapf(errVerify, "no attestation with predicate type %s found", predicateType)
+}
+
+// hasPredicateType checks if the attestation manifest contains an
+// attestation with the predicate type.
+func hasPredicateType(ctx context.Context, fetcher remotes.Fetcher, desc ocispecs.Descriptor, predicateType string) (bool, error) {
+	dt, err := fetchBlob(ctx, fetcher, desc, maxVerifyManifestSize)
+	if err != nil {
+		return false, err
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return false, errors.WithStack(err)
+	}
+	for _, l := range mfst.Layers {
+		if l.Annotations[inTotoPredicateTypeAnnotation] == predicateType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (p *puller) verifySignedAttestation(ctx context.Context, subjects []digest.Digest, predicateType string, keys []crypto.PublicKey) error {
+	for _, subject := range subjects {
+		mfst, fetcher, err := p.fetchTagManifest(ctx, subject, cosignAttestationTagSuffix)
+		if err != nil {
+			if cerrdefs.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		for _, l := range mfst.Layers {
+			dt, err := fetchBlob(ctx, fetcher, l, maxVerifyBlobSize)
+			if err != nil {
+				return err
+			}
+			stmt, err := verifyEnvelope(dt, keys)
+			if err != nil {
+				continue
+			}
+			if stmt.PredicateType != predicateType {
+				continue
+			}
+			for _, s := range stmt.Subject {
+				if s.Digest[subject.Algorithm().String()] == subject.Encoded() {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.Wrapf(errVerify, "no attestation with predicate type %s signed with the trusted keys found", predicateType)
+}
+
+// verifyEnvelope verifies the signature of a DSSE envelope containing an
+// in-toto statement and returns the statement.
+func verifyEnvelope(dt []byte, keys []crypto.PublicKey) (*intoto.Statement, error) {
+	var env dsse.Envelope
+	if err := json.Unmarshal(dt, &env); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	payload, err := env.DecodeB64Payload()
+	if err != nil {
+		return nil, err
+	}
+	pae := dsse.PAE(env.PayloadType, payload)
+	verified := false
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		if signutil.VerifyAny(keys, pae, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, errors.Wrap(errVerify, "envelope is not signed with the trusted keys")
+	}
+	var stmt intoto.Statement
+	if err := json.Unmarshal(payload, &stmt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &stmt, nil
+}
+
+// fetchTagManifest fetches the manifest cosign stores for the subject under
+// the tag sha256-<hex><suffix> in the repository of the image.
+func (p *puller) fetchTagManifest(ctx context.Context, subject digest.Digest, suffix string) (*ocispecs.Manifest, remotes.Fetcher, error) {
+	ref := p.Src.Locator + ":" + subject.Algorithm().String() + "-" + subject.Encoded() + suffix
+	name, desc, err := p.Resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	fetcher, err := p.Resolver.Fetcher(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	dt, err := fetchBlob(ctx, fetcher, desc, maxVerifyManifestSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return &mfst, fetcher, nil
+}
+
+func fetchBlob(ctx context.Context, fetcher remotes.Fetcher, desc ocispecs.Descriptor, limit int64) ([]byte, error) {
+	if desc.Size > limit {
+		return nil, errors.Errorf("%s is too large: %d bytes", desc.Digest, desc.Size)
+	}
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	dt, err := io.ReadAll(io.LimitReader(rc, desc.Size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(dt)) != desc.Size || desc.Digest.Algorithm().FromBytes(dt) != desc.Digest {
+		return nil, errors.Errorf("digest mismatch for %s", desc.Digest)
+	}
+	return dt, nil
+}
@@ -0,0 +1,121 @@
+package containerimage
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/containerd/containerd/v2/pkg/reference"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
+	"github.com/moby/buildkit/util/signutil"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/secure-systems-lab/go-securesystemslib/dsse"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifySignaturePayload(t *testing.T) {
+	priv, pub := testKey(t)
+	keys, err := signutil.ParsePublicKeys(pub)
+	require.NoError(t, err)
+
+	dgst := digest.FromString("manifest")
+	payload := []byte(`{"critical":{"identity":{"docker-reference":"docker.io/library/alpine"},"image":{"docker-manifest-digest":"` + dgst.String() + `"},"type":"cosign container image signature"},"optional":null}`)
+	sig := sign(t, priv, payload)
+
+	require.True(t, signutil.VerifyAny(keys, payload, sig))
+	require.NoError(t, checkSignaturePayload(payload, dgst))
+	require.ErrorIs(t, checkSignaturePayload(payload, digest.FromString("other")), errVerify)
+
+	otherPriv, _ := testKey(t)
+	require.False(t, signutil.VerifyAny(keys, payload, sign(t, otherPriv, payload)))
+	require.False(t, signutil.VerifyAny(keys, append(payload, ' '), sig))
+}
+
+func TestVerifyEnvelope(t *testing.T) {
+	priv, pub := testKey(t)
+	keys, err := signutil.ParsePublicKeys(pub)
+	require.NoError(t, err)
+
+	stmt := intoto.Statement{
+		StatementHeader: intoto.StatementHeader{
+			Type:          intoto.StatementInTotoV01,
+			PredicateType: "https://slsa.dev/provenance/v0.2",
+			Subject: []intoto.Subject{{
+				Name:   "docker.io/library/alpine",
+				Digest: map[string]string{"sha256": digest.FromString("manifest").Encoded()},
+			}},
+		},
+	}
+	payload, err := json.Marshal(stmt)
+	require.NoError(t, err)
+	env := dsse.Envelope{
+		PayloadType: "application/vnd.in-toto+json",
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []dsse.Signature{{
+			Sig: base64.StdEncoding.EncodeToString(sign(t, priv, dsse.PAE("application/vnd.in-toto+json", payload))),
+		}},
+	}
+	dt, err := json.Marshal(env)
+	require.NoError(t, err)
+
+	out, err := verifyEnvelope(dt, keys)
+	require.NoError(t, err)
+	require.Equal(t, stmt.PredicateType, out.PredicateType)
+
+	env.PayloadType = "application/json"
+	dt, err = json.Marshal(env)
+	require.NoError(t, err)
+	_, err = verifyEnvelope(dt, keys)
+	require.ErrorIs(t, err, errVerify)
+}
+
+func TestVerifyPolicies(t *testing.T) {
+	_, pub := testKey(t)
+	is := &Source{SourceOpt: SourceOpt{
+		VerifyPolicies: []VerifyPolicy{
+			{Match: "docker.io/myorg/*", SignatureKey: pub},
+			{Attestations: []string{"https://spdx.dev/Document"}},
+		},
+	}}
+
+	id := &ImageIdentifier{Reference: reference.Spec{Locator: "docker.io/myorg/app", Object: "latest"}}
+	policies, err := is.verifyPolicies(id)
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	require.Len(t, policies[0].keys, 1)
+
+	id = &ImageIdentifier{
+		Reference:    reference.Spec{Locator: "docker.io/library/alpine", Object: "latest"},
+		Attestations: []string{"https://slsa.dev/provenance/v0.2"},
+	}
+	policies, err = is.verifyPolicies(id)
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	require.Equal(t, []string{"https://spdx.dev/Document"}, policies[0].attestations)
+	require.Equal(t, []string{"https://slsa.dev/provenance/v0.2"}, policies[1].attestations)
+
+	_, err = signutil.ParsePublicKeys([]byte("not a key"))
+	require.Error(t, err)
+}
+
+func testKey(t *testing.T) (crypto.Signer, []byte) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	dt, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	return priv, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: dt})
+}
+
+func sign(t *testing.T, priv crypto.Signer, dt []byte) []byte {
+	sum := sha256.Sum256(dt)
+	sig, err := priv.Sign(rand.Reader, sum[:], crypto.SHA256)
+	require.NoError(t, err)
+	return sig
+}
@@ -20,6 +20,7 @@ type GitIdentifier struct {
 	AuthHeaderSecret string
 	MountSSHSock     string
 	KnownSSHHosts    string
+	SubdirTreeKey    bool
 }
 
 func NewGitIdentifier(remoteURL string) (*GitIdentifier, error) {
@@ -94,6 +94,10 @@ func (gs *gitSource) Identifier(scheme, ref string, attrs map[string]string, pla
 			id.MountSSHSock = v
 		case pb.AttrGitChecksum:
 			id.Checksum = v
+		case pb.AttrGitSubdirTreeKey:
+			if v == "true" {
+				id.SubdirTreeKey = true
+			}
 		}
 	}
 
@@ -366,7 +370,12 @@ func (gs *gitSourceHandler) CacheKey(ctx context.Context, g session.Group, index
 	if refCommitFullHash == "" && gitutil.IsCommitSHA(gs.src.Ref) {
 		refCommitFullHash = gs.src.Ref
 	}
-	if refCommitFullHash != "" {
+	useTreeKey := gs.src.SubdirTreeKey && gs.src.Subdir != ""
+	if subdir := path.Clean(gs.src.Subdir); gs.src.KeepGitDir && (subdir == "/" || subdir == ".") {
+		// the kept .git directory of the whole repository depends on the commit
+		useTreeKey = false
+	}
+	if refCommitFullHash != "" && !useTreeKey {
 		cacheKey := gs.shaToCacheKey(refCommitFullHash, ref2)
 		gs.cacheKey = cacheKey
 		// gs.src.Checksum is verified when checking out the commit
@@ -381,6 +390,15 @@ func (gs *gitSourceHandler) CacheKey(ctx context.Context, g session.Group, index
 	}
 	defer cleanup()
 
+	if refCommitFullHash != "" {
+		cacheKey, err := gs.subdirTreeCacheKey(ctx, git, refCommitFullHash, refCommitFullHash, ref2)
+		if err != nil {
+			return "", "", nil, false, err
+		}
+		gs.cacheKey = cacheKey
+		return cacheKey, refCommitFullHash, nil, true, nil
+	}
+
 	ref := gs.src.Ref
 	if ref == "" {
 		ref, err = getDefaultBranch(ctx, git, gs.src.Remote)
@@ -436,11 +454,88 @@ func (gs *gitSourceHandler) CacheKey(ctx context.Context, g session.Group, index
 	if gs.src.Checksum != "" && !strings.HasPrefix(sha, gs.src.Checksum) {
 		return "", "", nil, false, errors.Errorf("expected checksum to match %s, got %s", gs.src.Checksum, sha)
 	}
+	if useTreeKey {
+		cacheKey, err := gs.subdirTreeCacheKey(ctx, git, sha, ref, usedRef)
+		if err != nil {
+			return "", "", nil, false, err
+		}
+		gs.cacheKey = cacheKey
+		return cacheKey, sha, nil, true, nil
+	}
 	cacheKey := gs.shaToCacheKey(sha, usedRef)
 	gs.cacheKey = cacheKey
 	return cacheKey, sha, nil, true, nil
 }
 
+// subdirTreeCacheKey returns a cache key based on the tree object of the
+// requested subdirectory at commit sha, so that commits that do not touch the
+// subdirectory resolve to the same key. The commit is fetched from fetchRef if
+// it is not available locally yet. Like shaToCacheKey, the key of a source
+// that keeps the .git directory includes ref. Needs to be called with repo
+// lock.
+func (gs *gitSourceHandler) subdirTreeCacheKey(ctx context.Context, git *gitutil.GitCLI, sha, fetchRef, ref string) (string, error) {
+	if _, err := git.Run(ctx, "cat-file", "-e", sha+"^{commit}"); err != nil {
+		gitDir, err := git.GitDir(ctx)
+		if err != nil {
+			return "", err
+		}
+		if err := gs.fetch(ctx, git, gitDir, fetchRef); err != nil {
+			return "", err
+		}
+	}
+
+	subdir := strings.TrimPrefix(path.Clean("/"+gs.src.Subdir), "/")
+	buf, err := git.Run(ctx, "rev-parse", sha+":"+subdir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve subdir %s at %s for %s", subdir, sha, urlutil.RedactCredentials(gs.src.Remote))
+	}
+	tree := strings.TrimSpace(string(buf))
+	if !gitutil.IsCommitSHA(tree) {
+		return "", errors.Errorf("invalid tree sha %q", tree)
+	}
+	key := "tree:" + tree
+	if gs.src.KeepGitDir {
+		key += ".git"
+		if ref != "" {
+			key += "#" + ref
+		}
+	}
+	return key, nil
+}
+
+// fetch fetches ref from the remote into the shared repository at gitDir.
+// Needs to be called with repo lock.
+func (gs *gitSourceHandler) fetch(ctx context.Context, git *gitutil.GitCLI, gitDir, ref string) error {
+	// make sure no old lock files have leaked
+	os.RemoveAll(filepath.Join(gitDir, "shallow.lock"))
+
+	args := []string{"fetch"}
+	if !gitutil.IsCommitSHA(ref) { // TODO: find a branch from ls-remote?
+		args = append(args, "--depth=1", "--no-tags")
+	} else {
+		args = append(args, "--tags")
+		if _, err := os.Lstat(filepath.Join(gitDir, "shallow")); err == nil {
+			args = append(args, "--unshallow")
+		}
+	}
+	args = append(args, "origin")
+	if gitutil.IsCommitSHA(ref) {
+		args = append(args, ref)
+	} else {
+		// local refs are needed so they would be advertised on next fetches. Force is used
+		// in case the ref is a branch and it now points to a different commit sha
+		// TODO: is there a better way to do this?
+		args = append(args, "--force", ref+":tags/"+ref)
+	}
+	if _, err := git.Run(ctx, args...); err != nil {
+		return errors.Wrapf(err, "failed to fetch remote %s", urlutil.RedactCredentials(gs.src.Remote))
+	}
+	if _, err := git.Run(ctx, "reflog", "expire", "--all", "--expire=now"); err != nil {
+		return errors.Wrapf(err, "failed to expire reflog for remote %s", urlutil.RedactCredentials(gs.src.Remote))
+	}
+	return nil
+}
+
 func (gs *gitSourceHandler) Snapshot(ctx context.Context, g session.Group) (out cache.ImmutableRef, retErr error) {
 	cacheKey := gs.cacheKey
 	if cacheKey == "" {
@@ -495,33 +590,8 @@ func (gs *gitSourceHandler) Snapshot(ctx context.Context, g session.Group) (out
 	}
 
 	if doFetch {
-		// make sure no old lock files have leaked
-		os.RemoveAll(filepath.Join(gitDir, "shallow.lock"))
-
-		args := []string{"fetch"}
-		if !gitutil.IsCommitSHA(ref) { // TODO: find a branch from ls-remote?
-			args = append(args, "--depth=1", "--no-tags")
-		} else {
-			args = append(args, "--tags")
-			if _, err := os.Lstat(filepath.Join(gitDir, "shallow")); err == nil {
-				args = append(args, "--unshallow")
-			}
-		}
-		args = append(args, "origin")
-		if gitutil.IsCommitSHA(ref) {
-			args = append(args, ref)
-		} else {
-			// local refs are needed so they would be advertised on next fetches. Force is used
-			// in case the ref is a branch and it now points to a different commit sha
-			// TODO: is there a better way to do this?
-			args = append(args, "--force", ref+":tags/"+ref)
-		}
-		if _, err := git.Run(ctx, args...); err != nil {
-			return nil, errors.Wrapf(err, "failed to fetch remote %s", urlutil.RedactCredentials(gs.src.Remote))
-		}
-		_, err = git.Run(ctx, "reflog", "expire", "--all", "--expire=now")
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to expire reflog for remote %s", urlutil.RedactCredentials(gs.src.Remote))
+		if err := gs.fetch(ctx, git, gitDir, ref); err != nil {
+			return nil, err
 		}
 	}
 
@@ -806,6 +806,139 @@ func testSubdir(t *testing.T, keepGitDir bool) {
 	require.Equal(t, "abc\n", string(dt))
 }
 
+func TestSubdirTreeKey(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Depends on unimplemented containerd bind-mount support on Windows")
+	}
+
+	t.Parallel()
+
+	ctx := logProgressStreams(context.Background(), t)
+
+	gs := setupGitSource(t, t.TempDir())
+
+	repodir := t.TempDir()
+
+	runShell(t, repodir,
+		"git -c init.defaultBranch=master init",
+		"git config --local user.email test",
+		"git config --local user.name test",
+		"echo foo > abc",
+		"mkdir sub",
+		"echo abc > sub/bar",
+		"git add abc sub",
+		"git commit -m initial",
+	)
+
+	repoURL := serveGitRepo(t, repodir)
+	id := &GitIdentifier{Remote: repoURL, Subdir: "sub", SubdirTreeKey: true}
+
+	cacheKey := func() (string, string) {
+		g, err := gs.Resolve(ctx, id, nil, nil)
+		require.NoError(t, err)
+
+		key, pin, _, done, err := g.CacheKey(ctx, nil, 0)
+		require.NoError(t, err)
+		require.True(t, done)
+		require.Equal(t, 40, len(pin))
+		return key, pin
+	}
+
+	key1, pin1 := cacheKey()
+	require.True(t, strings.HasPrefix(key1, "tree:"))
+
+	// commit outside of subdir does not change the key
+	runShell(t, repodir,
+		"echo bar > abc",
+		"git add abc",
+		"git commit -m outside",
+	)
+
+	key2, pin2 := cacheKey()
+	require.Equal(t, key1, key2)
+	require.NotEqual(t, pin1, pin2)
+
+	// commit inside of subdir changes the key
+	runShell(t, repodir,
+		"echo def > sub/bar",
+		"git add sub",
+		"git commit -m inside",
+	)
+
+	key3, pin3 := cacheKey()
+	require.NotEqual(t, key2, key3)
+	require.NotEqual(t, pin2, pin3)
+
+	g, err := gs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	ref, err := g.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	defer ref.Release(context.TODO())
+
+	mount, err := ref.Mount(ctx, true, nil)
+	require.NoError(t, err)
+
+	lm := snapshot.LocalMounter(mount)
+	dir, err := lm.Mount()
+	require.NoError(t, err)
+	defer lm.Unmount()
+
+	dt, err := os.ReadFile(filepath.Join(dir, "bar"))
+	require.NoError(t, err)
+	require.Equal(t, "def\n", string(dt))
+}
+
+func TestSubdirTreeKeyKeepGitDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Depends on unimplemented containerd bind-mount support on Windows")
+	}
+
+	t.Parallel()
+
+	ctx := logProgressStreams(context.Background(), t)
+
+	gs := setupGitSource(t, t.TempDir())
+
+	repodir := t.TempDir()
+
+	runShell(t, repodir,
+		"git -c init.defaultBranch=master init",
+		"git config --local user.email test",
+		"git config --local user.name test",
+		"echo foo > abc",
+		"mkdir sub",
+		"echo abc > sub/bar",
+		"git add abc sub",
+		"git commit -m initial",
+	)
+
+	repoURL := serveGitRepo(t, repodir)
+
+	cacheKey := func(id *GitIdentifier) string {
+		g, err := gs.Resolve(ctx, id, nil, nil)
+		require.NoError(t, err)
+
+		key, _, _, done, err := g.CacheKey(ctx, nil, 0)
+		require.NoError(t, err)
+		require.True(t, done)
+		return key
+	}
+
+	key := cacheKey(&GitIdentifier{Remote: repoURL, Subdir: "sub", SubdirTreeKey: true})
+	require.True(t, strings.HasPrefix(key, "tree:"))
+
+	// a checkout that keeps the .git directory does not share the key
+	keyGit := cacheKey(&GitIdentifier{Remote: repoURL, Subdir: "sub", SubdirTreeKey: true, KeepGitDir: true})
+	require.Equal(t, key+".git#refs/heads/master", keyGit)
+
+	// the .git directory of the whole repository is kept, so the key is
+	// based on the commit
+	keyRoot := cacheKey(&GitIdentifier{Remote: repoURL, Subdir: "/", SubdirTreeKey: true, KeepGitDir: true})
+	require.False(t, strings.HasPrefix(keyRoot, "tree:"))
+	require.True(t, strings.HasSuffix(keyRoot, ".git#refs/heads/master:/"), keyRoot)
+}
+
 func setupGitSource(t *testing.T, tmpdir string) source.Source {
 	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
 	require.NoError(t, err)
@@ -0,0 +1,231 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/progress"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+)
+
+// RewriteRule sends the requests for URLs starting with Prefix to mirrors
+// first. The prefix of the URL is replaced with each of the mirrors in order
+// and the original URL is only tried if none of the mirrors succeed.
+type RewriteRule struct {
+	Prefix  string
+	Mirrors []string
+}
+
+// errStatus is returned for responses with a status that can't be used.
+type errStatus struct {
+	code int
+}
+
+func (e *errStatus) Error() string {
+	return fmt.Sprintf("invalid response status %d", e.code)
+}
+
+// urls returns the URLs that are tried for u in order: the mirrors set on the
+// source if u is the source URL, the mirrors from the matching rewrite rule
+// and finally u itself.
+func (hs *httpSourceHandler) urls(u string) []string {
+	var urls []string
+	if u == hs.src.URL {
+		urls = slices.Clone(hs.src.Mirrors)
+	}
+	var rule *RewriteRule
+	for i, r := range hs.rewriteRules {
+		if r.Prefix == "" || !strings.HasPrefix(u, r.Prefix) {
+			continue
+		}
+		// the longest matching prefix wins
+		if rule == nil || len(r.Prefix) > len(rule.Prefix) {
+			rule = &hs.rewriteRules[i]
+		}
+	}
+	if rule != nil {
+		rest := strings.TrimPrefix(u, rule.Prefix)
+		for _, m := range rule.Mirrors {
+			urls = append(urls, m+rest)
+		}
+	}
+	return append(urls, u)
+}
+
+// do sends the request for u to the URLs returned by urls until one of them
+// responds. Requests that fail with a network error or a temporary error
+// status are retried with an exponential backoff if retry is set. A mirror
+// that responds with any other error status is skipped, while the response of
+// u itself is returned as is. prepare is called for every request before it is
+// sent.
+func (hs *httpSourceHandler) do(ctx context.Context, g session.Group, u, method string, retry bool, prepare func(*http.Request)) (*http.Response, error) {
+	retries := 0
+	if retry {
+		retries = hs.retries
+		if hs.src.Retries != nil {
+			retries = *hs.src.Retries
+		}
+	}
+
+	client := hs.client(g)
+	urls := hs.urls(u)
+
+	var lastErr error
+	for i, u := range urls {
+		isMirror := i < len(urls)-1
+		req, err := hs.newHTTPRequest(ctx, g, u)
+		if err != nil {
+			if isMirror {
+				lastErr = err
+				continue
+			}
+			return nil, err
+		}
+		req.Method = method
+		if prepare != nil {
+			prepare(req)
+		}
+
+		for attempt := 0; attempt <= retries; attempt++ {
+			if attempt > 0 {
+				if err := sleep(ctx, hs.retryDelay(attempt, lastErr)); err != nil {
+					return nil, err
+				}
+			}
+
+			name := fmt.Sprintf("%s %s", method, redactURL(u))
+			if attempt > 0 {
+				name += fmt.Sprintf(" (attempt %d/%d)", attempt+1, retries+1)
+			}
+			done := progress.OneOff(ctx, name)
+			resp, err := client.Do(req.Clone(ctx))
+			if err == nil {
+				if !isTemporaryStatus(resp.StatusCode) && (!isMirror || resp.StatusCode < 400) {
+					done(nil)
+					return resp, nil
+				}
+				resp.Body.Close()
+				err = &errStatus{code: resp.StatusCode}
+				if ra := retryAfter(resp); ra > 0 {
+					err = &errRetryAfter{err: err, d: ra}
+				}
+			}
+			lastErr = done(errors.Wrapf(err, "%s %s", method, redactURL(u)))
+			if ctx.Err() != nil {
+				return nil, context.Cause(ctx)
+			}
+			bklog.G(ctx).WithError(lastErr).Debugf("http request failed")
+			var es *errStatus
+			if errors.As(err, &es) && !isTemporaryStatus(es.code) {
+				// mirror doesn't have the file, no point retrying it
+				break
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// fetchFile returns the content of a small file like a checksum file or a
+// signature, up to maxSize bytes.
+func (hs *httpSourceHandler) fetchFile(ctx context.Context, g session.Group, u string, maxSize int64) ([]byte, error) {
+	resp, err := hs.do(ctx, g, u, http.MethodGet, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.Wrapf(&errStatus{code: resp.StatusCode}, "failed to fetch %s", redactURL(u))
+	}
+	dt, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", redactURL(u))
+	}
+	if int64(len(dt)) > maxSize {
+		return nil, errors.Errorf("%s exceeds the maximum size of %d bytes", redactURL(u), maxSize)
+	}
+	return dt, nil
+}
+
+func (hs *httpSource) retryDelay(attempt int, err error) time.Duration {
+	var ra *errRetryAfter
+	if errors.As(err, &ra) {
+		return min(ra.d, maxRetryBackoff)
+	}
+	d := hs.retryBackoff << (attempt - 1)
+	if d <= 0 || d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d
+}
+
+type errRetryAfter struct {
+	err error
+	d   time.Duration
+}
+
+func (e *errRetryAfter) Error() string {
+	return e.err.Error()
+}
+
+func (e *errRetryAfter) Unwrap() error {
+	return e.err
+}
+
+// retryAfter returns the delay requested by the Retry-After header of the
+// response, if any.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func isTemporaryStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-t.C:
+		return nil
+	}
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	return u.Redacted()
+}
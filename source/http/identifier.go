@@ -27,6 +27,19 @@ type HTTPIdentifier struct {
 	GID              int
 	AuthHeaderSecret string
 	Header           []HeaderField
+	// Mirrors are tried in order before URL. They are expected to serve the
+	// same content as URL and don't affect the cache key.
+	Mirrors []string
+	// Retries overrides the number of retries of a failed request if set.
+	Retries *int
+	// ChecksumURL is the URL of a checksum file, e.g. SHA256SUMS, that
+	// contains the checksum of the file.
+	ChecksumURL string
+	// SignatureURL is the URL of a detached signature made with
+	// SignatureKey. The signature is for the checksum file if ChecksumURL is
+	// set and for the file itself otherwise.
+	SignatureURL string
+	SignatureKey string
 }
 
 type HeaderField struct {
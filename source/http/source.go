@@ -49,11 +49,19 @@ var supportedUserDefinedHeaders = map[string]bool{
 type Opt struct {
 	CacheAccessor cache.Accessor
 	Transport     http.RoundTripper
+	// Retries is the default number of times a request that failed with a
+	// network error or a temporary error status is retried.
+	Retries int
+	// RewriteRules redirect requests for matching URLs to mirrors.
+	RewriteRules []RewriteRule
 }
 
 type httpSource struct {
-	cache     cache.Accessor
-	transport http.RoundTripper
+	cache        cache.Accessor
+	transport    http.RoundTripper
+	retries      int
+	retryBackoff time.Duration
+	rewriteRules []RewriteRule
 }
 
 func NewSource(opt Opt) (source.Source, error) {
@@ -62,8 +70,11 @@ func NewSource(opt Opt) (source.Source, error) {
 		transport = tracing.DefaultTransport
 	}
 	hs := &httpSource{
-		cache:     opt.CacheAccessor,
-		transport: transport,
+		cache:        opt.CacheAccessor,
+		transport:    transport,
+		retries:      opt.Retries,
+		retryBackoff: defaultRetryBackoff,
+		rewriteRules: opt.RewriteRules,
 	}
 	return hs, nil
 }
@@ -108,6 +119,25 @@ func (hs *httpSource) Identifier(scheme, ref string, attrs map[string]string, pl
 			id.GID = int(i)
 		case pb.AttrHTTPAuthHeaderSecret:
 			id.AuthHeaderSecret = v
+		case pb.AttrHTTPMirrors:
+			if err := json.Unmarshal([]byte(v), &id.Mirrors); err != nil {
+				return nil, errors.Wrap(err, "failed to parse HTTP mirrors")
+			}
+		case pb.AttrHTTPRetries:
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, err
+			}
+			if i < 0 {
+				return nil, errors.Errorf("invalid number of HTTP retries %d", i)
+			}
+			id.Retries = &i
+		case pb.AttrHTTPChecksumURL:
+			id.ChecksumURL = v
+		case pb.AttrHTTPSignatureURL:
+			id.SignatureURL = v
+		case pb.AttrHTTPSignatureKey:
+			id.SignatureKey = v
 		default:
 			if name, found := strings.CutPrefix(k, pb.AttrHTTPHeaderPrefix); found {
 				name = http.CanonicalHeaderKey(name)
@@ -118,6 +148,18 @@ func (hs *httpSource) Identifier(scheme, ref string, attrs map[string]string, pl
 		}
 	}
 
+	if id.ChecksumURL != "" && id.Checksum != "" {
+		return nil, errors.New("checksum and checksum URL can't be set at the same time")
+	}
+	if (id.SignatureURL == "") != (id.SignatureKey == "") {
+		return nil, errors.New("signature URL and signature key must be set together")
+	}
+	if id.SignatureKey != "" {
+		if _, err := newVerifier(id.SignatureKey); err != nil {
+			return nil, err
+		}
+	}
+
 	// Sort header fields to ensure consistent hashing (see urlHash() and
 	// formatCacheKey())
 	slices.SortFunc(id.Header, func(a, b HeaderField) int {
@@ -155,11 +197,16 @@ func (hs *httpSourceHandler) client(g session.Group) *http.Client {
 // urlHash is internal hash the etag is stored by that doesn't leak outside
 // this package.
 func (hs *httpSourceHandler) urlHash() (digest.Digest, error) {
+	urls := hs.urls(hs.src.URL)
 	dt, err := json.Marshal(struct {
 		Filename         []byte
 		Perm, UID, GID   int
 		AuthHeaderSecret string `json:",omitempty"`
 		Header           []HeaderField
+		// Mirrors set by the client and by the rewrite rules of the daemon
+		// are part of the hash so that the etag of a response from a mirror
+		// is never used for requests to the origin or to other mirrors.
+		Mirrors []string `json:",omitempty"`
 	}{
 		Filename: bytes.Join([][]byte{
 			[]byte(hs.src.URL),
@@ -170,6 +217,7 @@ func (hs *httpSourceHandler) urlHash() (digest.Digest, error) {
 		GID:              hs.src.GID,
 		AuthHeaderSecret: hs.src.AuthHeaderSecret,
 		Header:           hs.src.Header,
+		Mirrors:          urls[:len(urls)-1],
 	})
 	if err != nil {
 		return "", err
@@ -202,11 +250,29 @@ func (hs *httpSourceHandler) formatCacheKey(filename string, dgst digest.Digest,
 }
 
 func (hs *httpSourceHandler) CacheKey(ctx context.Context, g session.Group, index int) (string, string, solver.CacheOpts, bool, error) {
+	if hs.src.ChecksumURL != "" {
+		dgst, err := hs.checksumFromURL(ctx, g)
+		if err != nil {
+			return "", "", nil, false, err
+		}
+		hs.src.Checksum = dgst
+	} else if hs.src.SignatureURL != "" {
+		// the signature is for the file itself so it needs to be downloaded
+		// for verification even if the checksum is known
+		return hs.verifiedCacheKey(ctx, g)
+	}
+
 	if hs.src.Checksum != "" {
 		hs.cacheKey = hs.src.Checksum
 		return hs.formatCacheKey(getFileName(hs.src.URL, hs.src.Filename, nil), hs.src.Checksum, "").String(), hs.src.Checksum.String(), nil, true, nil
 	}
 
+	return hs.fetchCacheKey(ctx, g)
+}
+
+// fetchCacheKey returns the cache key from the digest of the file, reusing a
+// previously downloaded copy if the server reports that it hasn't changed.
+func (hs *httpSourceHandler) fetchCacheKey(ctx context.Context, g session.Group) (string, string, solver.CacheOpts, bool, error) {
 	uh, err := hs.urlHash()
 	if err != nil {
 		return "", "", nil, false, err
@@ -218,11 +284,8 @@ func (hs *httpSourceHandler) CacheKey(ctx context.Context, g session.Group, inde
 		return "", "", nil, false, errors.Wrapf(err, "failed to search metadata for %s", uh)
 	}
 
-	req, err := hs.newHTTPRequest(ctx, g)
-	if err != nil {
-		return "", "", nil, false, err
-	}
 	m := map[string]cacheRefMetadata{}
+	var ifNoneMatch string
 
 	// If we request a single ETag in 'If-None-Match', some servers omit the
 	// unambiguous ETag in their response.
@@ -249,7 +312,7 @@ func (hs *httpSourceHandler) CacheKey(ctx context.Context, g session.Group, inde
 			for t := range m {
 				etags = append(etags, t)
 			}
-			req.Header.Set("If-None-Match", strings.Join(etags, ", "))
+			ifNoneMatch = strings.Join(etags, ", ")
 
 			if len(etags) == 1 {
 				onlyETag = etags[0]
@@ -257,17 +320,23 @@ func (hs *httpSourceHandler) CacheKey(ctx context.Context, g session.Group, inde
 		}
 	}
 
-	client := hs.client(g)
+	setIfNoneMatch := func(req *http.Request) {
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+	}
 
 	// Some servers seem to have trouble supporting If-None-Match properly even
 	// though they return ETag-s. So first, optionally try a HEAD request with
-	// manual ETag value comparison.
+	// manual ETag value comparison. Failures are not retried as the GET
+	// request below is made anyway.
 	if len(m) > 0 {
-		req.Method = "HEAD"
-		// we need to add accept-encoding header manually because stdlib only adds it to GET requests
-		// some servers will return different etags if Accept-Encoding header is different
-		req.Header.Set("Accept-Encoding", "gzip")
-		resp, err := client.Do(req)
+		resp, err := hs.do(ctx, g, hs.src.URL, http.MethodHead, false, func(req *http.Request) {
+			setIfNoneMatch(req)
+			// we need to add accept-encoding header manually because stdlib only adds it to GET requests
+			// some servers will return different etags if Accept-Encoding header is different
+			req.Header.Set("Accept-Encoding", "gzip")
+		})
 		if err == nil {
 			if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotModified {
 				respETag := etagValue(resp.Header.Get("ETag"))
@@ -291,19 +360,19 @@ func (hs *httpSourceHandler) CacheKey(ctx context.Context, g session.Group, inde
 			}
 			resp.Body.Close()
 		}
-		req.Method = "GET"
-		// Unset explicit Accept-Encoding for GET, otherwise the go http library will not
-		// transparently decompress the response body when it is gzipped. It will still add
-		// this header implicitly when the request is made though.
-		req.Header.Del("Accept-Encoding")
 	}
 
-	resp, err := client.Do(req)
+	// Accept-Encoding is not set explicitly for GET, otherwise the go http
+	// library will not transparently decompress the response body when it is
+	// gzipped. It will still add this header implicitly when the request is
+	// made though.
+	resp, err := hs.do(ctx, g, hs.src.URL, http.MethodGet, true, setIfNoneMatch)
 	if err != nil {
 		return "", "", nil, false, err
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		return "", "", nil, false, errors.Errorf("invalid response status %d", resp.StatusCode)
+		resp.Body.Close()
+		return "", "", nil, false, &errStatus{code: resp.StatusCode}
 	}
 	if resp.StatusCode == http.StatusNotModified {
 		respETag := etagValue(resp.Header.Get("ETag"))
@@ -473,20 +542,16 @@ func (hs *httpSourceHandler) Snapshot(ctx context.Context, g session.Group) (cac
 		}
 	}
 
-	req, err := hs.newHTTPRequest(ctx, g)
-	if err != nil {
-		return nil, err
-	}
-
-	client := hs.client(g)
-
-	resp, err := client.Do(req)
+	resp, err := hs.do(ctx, g, hs.src.URL, http.MethodGet, true, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &errStatus{code: resp.StatusCode}
+	}
 
 	ref, dgst, err := hs.save(ctx, resp, g)
 	if err != nil {
@@ -500,8 +565,11 @@ func (hs *httpSourceHandler) Snapshot(ctx context.Context, g session.Group) (cac
 	return ref, nil
 }
 
-func (hs *httpSourceHandler) newHTTPRequest(ctx context.Context, g session.Group) (*http.Request, error) {
-	req, err := http.NewRequest(http.MethodGet, hs.src.URL, nil)
+// newHTTPRequest returns a new request for urlStr, which is either the URL of
+// the source or one of its mirrors. The auth secret set on the source is only
+// sent to the source URL.
+func (hs *httpSourceHandler) newHTTPRequest(ctx context.Context, g session.Group, urlStr string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, urlStr, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -516,11 +584,16 @@ func (hs *httpSourceHandler) newHTTPRequest(ctx context.Context, g session.Group
 		token bool
 	}
 
+	authHeaderSecret := hs.src.AuthHeaderSecret
+	if urlStr != hs.src.URL {
+		authHeaderSecret = ""
+	}
+
 	var secretNames []authSecret
-	if hs.src.AuthHeaderSecret != "" {
-		secretNames = append(secretNames, authSecret{name: hs.src.AuthHeaderSecret})
+	if authHeaderSecret != "" {
+		secretNames = append(secretNames, authSecret{name: authHeaderSecret})
 	} else {
-		u, err := url.Parse(hs.src.URL)
+		u, err := url.Parse(urlStr)
 		if err == nil {
 			secretNames = append(secretNames, authSecret{name: HTTPAuthHeaderSecretPrefix + u.Hostname()})
 			secretNames = append(secretNames, authSecret{name: HTTPAuthTokenSecretPrefix + u.Hostname(), token: true})
@@ -540,8 +613,8 @@ func (hs *httpSourceHandler) newHTTPRequest(ctx context.Context, g session.Group
 			req.Header.Set("Authorization", v)
 			return nil
 		})
-		if err != nil && hs.src.AuthHeaderSecret != "" {
-			return nil, errors.Wrapf(err, "failed to retrieve HTTP auth secret %s", hs.src.AuthHeaderSecret)
+		if err != nil && authHeaderSecret != "" {
+			return nil, errors.Wrapf(err, "failed to retrieve HTTP auth secret %s", authHeaderSecret)
 		}
 	}
 
@@ -2,9 +2,13 @@ package http
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/containerd/containerd/v2/core/diff/apply"
 	ctdmetadata "github.com/containerd/containerd/v2/core/metadata"
@@ -17,6 +21,7 @@ import (
 	"github.com/moby/buildkit/identity"
 	"github.com/moby/buildkit/snapshot"
 	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
+	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/source"
 	"github.com/moby/buildkit/util/leaseutil"
 	"github.com/moby/buildkit/util/testutil/httpserver"
@@ -284,6 +289,334 @@ func TestHTTPChecksum(t *testing.T) {
 	ref = nil
 }
 
+func TestHTTPRetry(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	hs, err := newHTTPSourceWithOpt(t, Opt{Retries: 2})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+		if n <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("content1"))
+	}))
+	defer server.Close()
+
+	numRequests := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+
+	id := &HTTPIdentifier{URL: server.URL + "/foo"}
+
+	h, err := hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, p, _, _, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes([]byte("content1")).String(), p)
+	require.Equal(t, 3, numRequests())
+
+	// retries can be disabled per source
+	mu.Lock()
+	requests = 0
+	mu.Unlock()
+
+	retries := 0
+	id = &HTTPIdentifier{URL: server.URL + "/bar", Retries: &retries}
+	h, err = hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, _, _, _, err = h.CacheKey(ctx, nil, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid response status 503")
+	require.Equal(t, 1, numRequests())
+}
+
+func TestHTTPMirrorEtag(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	hs, err := newHTTPSource(t)
+	require.NoError(t, err)
+
+	etag := identity.NewID()
+	origin := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/foo": {Content: []byte("content1"), Etag: etag},
+	})
+	defer origin.Close()
+
+	// the mirror serves different content with the same etag
+	mirror := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/foo": {Content: []byte("content2"), Etag: etag},
+	})
+	defer mirror.Close()
+
+	id := &HTTPIdentifier{URL: origin.URL + "/foo", Mirrors: []string{mirror.URL + "/foo"}}
+	h, err := hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, p, _, _, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes([]byte("content2")).String(), p)
+
+	ref, err := h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	ref.Release(context.WithoutCancel(ctx))
+	require.Equal(t, 0, origin.Stats("/foo").AllRequests)
+
+	// the etag of the mirror response is not used for the origin
+	id = &HTTPIdentifier{URL: origin.URL + "/foo"}
+	h, err = hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, p, _, _, err = h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes([]byte("content1")).String(), p)
+
+	ref, err = h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	defer ref.Release(context.WithoutCancel(ctx))
+
+	dt, err := readFile(ctx, ref, "foo")
+	require.NoError(t, err)
+	require.Equal(t, []byte("content1"), dt)
+	require.Equal(t, 0, origin.Stats("/foo").CachedRequests)
+}
+
+func TestHTTPRewriteMirrorsHash(t *testing.T) {
+	t.Parallel()
+
+	urlHash := func(rules []RewriteRule) digest.Digest {
+		hs := &httpSourceHandler{
+			httpSource: &httpSource{rewriteRules: rules},
+			src:        HTTPIdentifier{URL: "https://example.com/files/foo"},
+		}
+		dgst, err := hs.urlHash()
+		require.NoError(t, err)
+		return dgst
+	}
+
+	base := urlHash(nil)
+	// rules that don't match the URL don't change the hash
+	require.Equal(t, base, urlHash([]RewriteRule{
+		{Prefix: "https://example.org/", Mirrors: []string{"https://mirror1.example.com/"}},
+	}))
+
+	mirror1 := urlHash([]RewriteRule{
+		{Prefix: "https://example.com/", Mirrors: []string{"https://mirror1.example.com/"}},
+	})
+	mirror2 := urlHash([]RewriteRule{
+		{Prefix: "https://example.com/", Mirrors: []string{"https://mirror2.example.com/"}},
+	})
+	require.NotEqual(t, base, mirror1)
+	require.NotEqual(t, mirror1, mirror2)
+}
+
+func TestHTTPMirrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	origin := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/files/foo": {Content: []byte("content1")},
+	})
+	defer origin.Close()
+
+	mirror := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/mirror/files/foo": {Content: []byte("content1")},
+	})
+	defer mirror.Close()
+
+	emptyMirror := httpserver.NewTestServer(map[string]httpserver.Response{})
+	defer emptyMirror.Close()
+
+	hs, err := newHTTPSourceWithOpt(t, Opt{
+		Retries: 2,
+		RewriteRules: []RewriteRule{
+			{Prefix: origin.URL + "/", Mirrors: []string{emptyMirror.URL + "/", mirror.URL + "/mirror/"}},
+			{Prefix: origin.URL + "/other/", Mirrors: []string{emptyMirror.URL + "/"}},
+		},
+	})
+	require.NoError(t, err)
+
+	id := &HTTPIdentifier{URL: origin.URL + "/files/foo"}
+
+	h, err := hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, p, _, _, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes([]byte("content1")).String(), p)
+
+	ref, err := h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	defer ref.Release(context.WithoutCancel(ctx))
+
+	dt, err := readFile(ctx, ref, "foo")
+	require.NoError(t, err)
+	require.Equal(t, []byte("content1"), dt)
+
+	require.Equal(t, 1, mirror.Stats("/mirror/files/foo").AllRequests)
+	require.Equal(t, 0, origin.Stats("/files/foo").AllRequests)
+
+	// mirrors of the source are tried before rewrite rules
+	mirror2 := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/foo": {Content: []byte("content1")},
+	})
+	defer mirror2.Close()
+
+	id = &HTTPIdentifier{URL: origin.URL + "/files/foo", Mirrors: []string{mirror2.URL + "/foo"}}
+
+	h, err = hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, p, _, _, err = h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes([]byte("content1")).String(), p)
+
+	require.Equal(t, 1, mirror2.Stats("/foo").AllRequests)
+	require.Equal(t, 1, mirror.Stats("/mirror/files/foo").AllRequests)
+	require.Equal(t, 0, origin.Stats("/files/foo").AllRequests)
+
+	// falls back to the source URL if no mirror has the file
+	origin.SetRoute("/other/bar", httpserver.Response{Content: []byte("content2")})
+	id = &HTTPIdentifier{URL: origin.URL + "/other/bar"}
+
+	h, err = hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, p, _, _, err = h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes([]byte("content2")).String(), p)
+	require.Equal(t, 1, origin.Stats("/other/bar").AllRequests)
+}
+
+func TestHTTPChecksumURL(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	hs, err := newHTTPSource(t)
+	require.NoError(t, err)
+
+	content := []byte("release content")
+	sums := []byte(digest.FromBytes([]byte("other")).Encoded() + "  other.tar.gz\n" +
+		digest.FromBytes(content).Encoded() + "  release.tar.gz\n")
+
+	signer := newMinisignSigner(t)
+	server := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/release.tar.gz":          {Content: content},
+		"/SHA256SUMS":              {Content: sums},
+		"/SHA256SUMS.minisig":      {Content: signer.Sign(t, sums)},
+		"/SHA256SUMS.minisig.fake": {Content: newMinisignSigner(t).Sign(t, sums)},
+	})
+	defer server.Close()
+
+	id := &HTTPIdentifier{
+		URL:          server.URL + "/release.tar.gz",
+		ChecksumURL:  server.URL + "/SHA256SUMS",
+		SignatureURL: server.URL + "/SHA256SUMS.minisig",
+		SignatureKey: signer.PublicKey(),
+	}
+
+	h, err := hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, p, _, _, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes(content).String(), p)
+	// the file itself is only downloaded on snapshot
+	require.Equal(t, 0, server.Stats("/release.tar.gz").AllRequests)
+
+	ref, err := h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	defer ref.Release(context.WithoutCancel(ctx))
+
+	dt, err := readFile(ctx, ref, "release.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, content, dt)
+
+	// signature made with a different key
+	id.SignatureURL = server.URL + "/SHA256SUMS.minisig.fake"
+	h, err = hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, _, _, _, err = h.CacheKey(ctx, nil, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to verify")
+
+	// file missing from checksum file
+	id = &HTTPIdentifier{
+		URL:         server.URL + "/SHA256SUMS.minisig",
+		ChecksumURL: server.URL + "/SHA256SUMS",
+	}
+	h, err = hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, _, _, _, err = h.CacheKey(ctx, nil, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum for SHA256SUMS.minisig not found")
+}
+
+func TestHTTPSignature(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	hs, err := newHTTPSource(t)
+	require.NoError(t, err)
+
+	content := []byte("release content")
+	signer := newECDSASigner(t)
+	server := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/release.tar.gz":     {Content: content, Etag: identity.NewID()},
+		"/release.tar.gz.sig": {Content: signer.Sign(t, content)},
+		"/other.sig":          {Content: signer.Sign(t, []byte("other content"))},
+	})
+	defer server.Close()
+
+	id := &HTTPIdentifier{
+		URL:          server.URL + "/release.tar.gz",
+		SignatureURL: server.URL + "/release.tar.gz.sig",
+		SignatureKey: signer.PublicKey(),
+	}
+
+	h, err := hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, p, _, _, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromBytes(content).String(), p)
+
+	ref, err := h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	ref.Release(context.WithoutCancel(ctx))
+	require.Equal(t, 1, server.Stats("/release.tar.gz").AllRequests)
+
+	// cached copy of the file is verified as well
+	id.SignatureURL = server.URL + "/other.sig"
+	h, err = hs.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, _, _, _, err = h.CacheKey(ctx, nil, 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid ECDSA signature")
+	require.Equal(t, 1, server.Stats("/release.tar.gz").CachedRequests)
+
+	_, err = hs.Identifier("http", server.URL[len("http://"):]+"/release.tar.gz", map[string]string{
+		pb.AttrHTTPSignatureURL: server.URL + "/release.tar.gz.sig",
+	}, nil)
+	require.Error(t, err)
+}
+
 func readFile(ctx context.Context, ref cache.ImmutableRef, fp string) ([]byte, error) {
 	mount, err := ref.Mount(ctx, true, nil)
 	if err != nil {
@@ -307,6 +640,10 @@ func readFile(ctx context.Context, ref cache.ImmutableRef, fp string) ([]byte, e
 }
 
 func newHTTPSource(t *testing.T) (source.Source, error) {
+	return newHTTPSourceWithOpt(t, Opt{})
+}
+
+func newHTTPSourceWithOpt(t *testing.T, opt Opt) (source.Source, error) {
 	tmpdir := t.TempDir()
 
 	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
@@ -365,7 +702,11 @@ func newHTTPSource(t *testing.T) (source.Source, error) {
 		require.NoError(t, cm.Close())
 	})
 
-	return NewSource(Opt{
-		CacheAccessor: cm,
-	})
+	opt.CacheAccessor = cm
+	hs, err := NewSource(opt)
+	if err != nil {
+		return nil, err
+	}
+	hs.(*httpSource).retryBackoff = time.Millisecond
+	return hs, nil
 }
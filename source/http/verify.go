@@ -0,0 +1,344 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	maxChecksumFileSize = 1 << 20
+	maxSignatureSize    = 64 << 10
+)
+
+// checksumFromURL returns the checksum of the source from its checksum file,
+// verifying the signature of the checksum file if one is set.
+func (hs *httpSourceHandler) checksumFromURL(ctx context.Context, g session.Group) (digest.Digest, error) {
+	dt, err := hs.fetchFile(ctx, g, hs.src.ChecksumURL, maxChecksumFileSize)
+	if err != nil {
+		return "", err
+	}
+	if hs.src.SignatureURL != "" {
+		if err := hs.verify(ctx, g, bytes.NewReader(dt)); err != nil {
+			return "", errors.Wrapf(err, "failed to verify %s", redactURL(hs.src.ChecksumURL))
+		}
+	}
+	// checksum files list the files by their upstream name
+	dgst, err := checksumFromFile(dt, getFileName(hs.src.URL, "", nil))
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid checksum file %s", redactURL(hs.src.ChecksumURL))
+	}
+	return dgst, nil
+}
+
+// verifiedCacheKey downloads the file and verifies its signature before
+// returning the cache key.
+func (hs *httpSourceHandler) verifiedCacheKey(ctx context.Context, g session.Group) (string, string, solver.CacheOpts, bool, error) {
+	k, p, opts, done, err := hs.fetchCacheKey(ctx, g)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	if hs.src.Checksum != "" && p != hs.src.Checksum.String() {
+		return "", "", nil, false, errors.Errorf("digest mismatch %s: %s", p, hs.src.Checksum)
+	}
+
+	ref, err := hs.cache.Get(ctx, hs.refID, nil)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	defer ref.Release(context.WithoutCancel(ctx))
+
+	mount, err := ref.Mount(ctx, true, g)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	lm := snapshot.LocalMounter(mount)
+	dir, err := lm.Mount()
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	defer lm.Unmount()
+
+	// the snapshot contains only the downloaded file
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	if len(ents) != 1 {
+		return "", "", nil, false, errors.Errorf("unexpected content in HTTP snapshot of %s", redactURL(hs.src.URL))
+	}
+	f, err := os.Open(filepath.Join(dir, ents[0].Name()))
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	defer f.Close()
+
+	if err := hs.verify(ctx, g, f); err != nil {
+		return "", "", nil, false, errors.Wrapf(err, "failed to verify %s", redactURL(hs.src.URL))
+	}
+	return k, p, opts, done, nil
+}
+
+// verify checks the signature of the source for data.
+func (hs *httpSourceHandler) verify(ctx context.Context, g session.Group, data io.Reader) error {
+	v, err := newVerifier(hs.src.SignatureKey)
+	if err != nil {
+		return err
+	}
+	sig, err := hs.fetchFile(ctx, g, hs.src.SignatureURL, maxSignatureSize)
+	if err != nil {
+		return err
+	}
+	return v.Verify(data, sig)
+}
+
+// verifier checks a detached signature of a file.
+type verifier interface {
+	Verify(data io.Reader, sig []byte) error
+}
+
+// newVerifier returns a verifier for the public key. The type of the
+// signature is detected from the format of the key:
+//   - minisign public keys
+//   - PEM encoded PKIX public keys as used by "cosign sign-blob"
+//   - armored OpenPGP public keys as exported by "gpg --export --armor"
+func newVerifier(key string) (verifier, error) {
+	key = strings.TrimSpace(key)
+	switch {
+	case strings.HasPrefix(key, "-----BEGIN PGP PUBLIC KEY BLOCK-----"):
+		keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse PGP public key")
+		}
+		if len(keyring) == 0 {
+			return nil, errors.New("failed to parse PGP public key: no keys found")
+		}
+		return &pgpVerifier{keyring: keyring}, nil
+	case strings.HasPrefix(key, "-----BEGIN"):
+		block, _ := pem.Decode([]byte(key))
+		if block == nil {
+			return nil, errors.New("failed to decode PEM public key")
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse public key")
+		}
+		return &pkixVerifier{pub: pub}, nil
+	default:
+		return newMinisignVerifier(key)
+	}
+}
+
+// pkixVerifier verifies signatures made with "cosign sign-blob". The signature
+// is base64 encoded and made over the SHA-256 digest of the file for ECDSA and
+// RSA keys.
+type pkixVerifier struct {
+	pub crypto.PublicKey
+}
+
+func (v *pkixVerifier) Verify(data io.Reader, sig []byte) error {
+	if dt, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig))); err == nil {
+		sig = dt
+	}
+	if pub, ok := v.pub.(ed25519.PublicKey); ok {
+		dt, err := io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(pub, dt, sig) {
+			return errors.New("invalid ed25519 signature")
+		}
+		return nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, data); err != nil {
+		return err
+	}
+	sum := h.Sum(nil)
+	switch pub := v.pub.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, sum, sig) {
+			return errors.New("invalid ECDSA signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum, sig); err != nil {
+			if err := rsa.VerifyPSS(pub, crypto.SHA256, sum, sig, nil); err != nil {
+				return errors.Wrap(err, "invalid RSA signature")
+			}
+		}
+	default:
+		return errors.Errorf("unsupported public key type %T", v.pub)
+	}
+	return nil
+}
+
+// pgpVerifier verifies detached OpenPGP signatures made with "gpg
+// --detach-sign". The signature can be armored or binary.
+type pgpVerifier struct {
+	keyring openpgp.EntityList
+}
+
+func (v *pgpVerifier) Verify(data io.Reader, sig []byte) error {
+	check := openpgp.CheckDetachedSignature
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN PGP SIGNATURE-----")) {
+		check = openpgp.CheckArmoredDetachedSignature
+	}
+	if _, err := check(v.keyring, data, bytes.NewReader(sig), nil); err != nil {
+		return errors.Wrap(err, "invalid PGP signature")
+	}
+	return nil
+}
+
+// minisignVerifier verifies signatures in the minisign format, see
+// https://jedisct1.github.io/minisign/
+type minisignVerifier struct {
+	keyID [8]byte
+	pub   ed25519.PublicKey
+}
+
+func newMinisignVerifier(key string) (*minisignVerifier, error) {
+	var encoded string
+	for _, l := range strings.Split(key, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "untrusted comment:") {
+			continue
+		}
+		encoded = l
+		break
+	}
+	dt, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(dt) != 2+8+ed25519.PublicKeySize || string(dt[:2]) != "Ed" {
+		return nil, errors.New("unsupported public key, expected a minisign, PEM or PGP public key")
+	}
+	v := &minisignVerifier{pub: ed25519.PublicKey(dt[10:])}
+	copy(v.keyID[:], dt[2:10])
+	return v, nil
+}
+
+func (v *minisignVerifier) Verify(data io.Reader, sig []byte) error {
+	var lines []string
+	s := bufio.NewScanner(bytes.NewReader(sig))
+	for s.Scan() {
+		lines = append(lines, strings.TrimRight(s.Text(), "\r"))
+	}
+	if len(lines) < 4 {
+		return errors.New("invalid minisign signature")
+	}
+	sigDt, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sigDt) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	trustedComment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return errors.New("invalid minisign signature: missing trusted comment")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	if !bytes.Equal(sigDt[2:10], v.keyID[:]) {
+		return errors.Errorf("signature was made with key %X, expected %X", reverse(sigDt[2:10]), reverse(v.keyID[:]))
+	}
+
+	var msg []byte
+	switch string(sigDt[:2]) {
+	case "ED": // prehashed
+		h, _ := blake2b.New512(nil)
+		if _, err := io.Copy(h, data); err != nil {
+			return err
+		}
+		msg = h.Sum(nil)
+	case "Ed":
+		msg, err = io.ReadAll(data)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("unsupported minisign signature algorithm %q", sigDt[:2])
+	}
+	if !ed25519.Verify(v.pub, msg, sigDt[10:]) {
+		return errors.New("invalid minisign signature")
+	}
+	if !ed25519.Verify(v.pub, slices.Concat(sigDt[10:], []byte(trustedComment)), globalSig) {
+		return errors.New("invalid minisign signature: trusted comment does not match")
+	}
+	return nil
+}
+
+// reverse returns the key ID in the byte order minisign prints it in.
+func reverse(dt []byte) []byte {
+	out := make([]byte, len(dt))
+	for i, b := range dt {
+		out[len(dt)-1-i] = b
+	}
+	return out
+}
+
+// checksumFromFile returns the SHA-256 checksum of filename from a checksum
+// file in the format written by sha256sum, e.g. SHA256SUMS. BSD style lines
+// written by "sha256sum --tag" are also supported.
+func checksumFromFile(dt []byte, filename string) (digest.Digest, error) {
+	s := bufio.NewScanner(bytes.NewReader(dt))
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		var sum, name string
+		if rest, ok := strings.CutPrefix(l, "SHA256 ("); ok {
+			// SHA256 (filename) = checksum
+			var found bool
+			name, sum, found = strings.Cut(rest, ") = ")
+			if !found {
+				continue
+			}
+		} else {
+			var found bool
+			sum, name, found = strings.Cut(l, " ")
+			if !found {
+				continue
+			}
+			name = strings.TrimLeft(name, " ")
+			// binary mode marker
+			name = strings.TrimPrefix(name, "*")
+		}
+		if name != filename && path.Base(strings.TrimPrefix(name, "./")) != filename {
+			continue
+		}
+		if len(sum) != 2*sha256.Size {
+			return "", errors.Errorf("unsupported checksum %q for %s, only sha256 is supported", sum, filename)
+		}
+		if _, err := hex.DecodeString(sum); err != nil {
+			return "", errors.Errorf("invalid checksum %q for %s", sum, filename)
+		}
+		return digest.NewDigestFromEncoded(digest.SHA256, strings.ToLower(sum)), nil
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.Errorf("checksum for %s not found", filename)
+}
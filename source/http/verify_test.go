@@ -0,0 +1,185 @@
+package http
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+type testSigner interface {
+	PublicKey() string
+	Sign(t *testing.T, data []byte) []byte
+}
+
+type minisignSigner struct {
+	keyID [8]byte
+	priv  ed25519.PrivateKey
+}
+
+func newMinisignSigner(t *testing.T) *minisignSigner {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	s := &minisignSigner{priv: priv}
+	_, err = rand.Read(s.keyID[:])
+	require.NoError(t, err)
+	return s
+}
+
+func (s *minisignSigner) PublicKey() string {
+	dt := append([]byte("Ed"), s.keyID[:]...)
+	dt = append(dt, s.priv.Public().(ed25519.PublicKey)...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(dt) + "\n"
+}
+
+func (s *minisignSigner) Sign(t *testing.T, data []byte) []byte {
+	h := blake2b.Sum512(data)
+	sig := ed25519.Sign(s.priv, h[:])
+	trusted := "timestamp:1700000000\tfile:test"
+	global := ed25519.Sign(s.priv, append(bytes.Clone(sig), []byte(trusted)...))
+
+	dt := append([]byte("ED"), s.keyID[:]...)
+	dt = append(dt, sig...)
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(dt) + "\n" +
+		"trusted comment: " + trusted + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+type ecdsaSigner struct {
+	priv *ecdsa.PrivateKey
+}
+
+func newECDSASigner(t *testing.T) *ecdsaSigner {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &ecdsaSigner{priv: priv}
+}
+
+func (s *ecdsaSigner) PublicKey() string {
+	dt, _ := x509.MarshalPKIXPublicKey(s.priv.Public())
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: dt}))
+}
+
+func (s *ecdsaSigner) Sign(t *testing.T, data []byte) []byte {
+	sum := sha256.Sum256(data)
+	sig, err := s.priv.Sign(rand.Reader, sum[:], crypto.SHA256)
+	require.NoError(t, err)
+	return []byte(base64.StdEncoding.EncodeToString(sig))
+}
+
+type pgpSigner struct {
+	entity *openpgp.Entity
+	armor  bool
+}
+
+func newPGPSigner(t *testing.T, armor bool) *pgpSigner {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	require.NoError(t, err)
+	return &pgpSigner{entity: entity, armor: armor}
+}
+
+func (s *pgpSigner) PublicKey() string {
+	var buf bytes.Buffer
+	w, _ := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	s.entity.Serialize(w)
+	w.Close()
+	return buf.String()
+}
+
+func (s *pgpSigner) Sign(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	sign := openpgp.DetachSign
+	if s.armor {
+		sign = openpgp.ArmoredDetachSign
+	}
+	require.NoError(t, sign(&buf, s.entity, bytes.NewReader(data), nil))
+	return buf.Bytes()
+}
+
+func TestVerifier(t *testing.T) {
+	t.Parallel()
+
+	signers := map[string]func(*testing.T) testSigner{
+		"minisign":  func(t *testing.T) testSigner { return newMinisignSigner(t) },
+		"ecdsa":     func(t *testing.T) testSigner { return newECDSASigner(t) },
+		"pgp":       func(t *testing.T) testSigner { return newPGPSigner(t, false) },
+		"pgp-armor": func(t *testing.T) testSigner { return newPGPSigner(t, true) },
+	}
+
+	for name, newSigner := range signers {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := newSigner(t)
+			data := []byte("release content")
+			sig := s.Sign(t, data)
+
+			v, err := newVerifier(s.PublicKey())
+			require.NoError(t, err)
+
+			require.NoError(t, v.Verify(bytes.NewReader(data), sig))
+			require.Error(t, v.Verify(bytes.NewReader([]byte("tampered content")), sig))
+
+			other := newSigner(t)
+			v, err = newVerifier(other.PublicKey())
+			require.NoError(t, err)
+			require.Error(t, v.Verify(bytes.NewReader(data), sig))
+		})
+	}
+
+	_, err := newVerifier("not a key")
+	require.Error(t, err)
+
+	_, err = newVerifier("-----BEGIN PGP PUBLIC KEY BLOCK-----\n\n-----END PGP PUBLIC KEY BLOCK-----\n")
+	require.ErrorContains(t, err, "failed to parse PGP public key")
+}
+
+func TestChecksumFromFile(t *testing.T) {
+	t.Parallel()
+
+	foo := digest.FromBytes([]byte("foo"))
+	bar := digest.FromBytes([]byte("bar"))
+	baz := digest.FromBytes([]byte("baz"))
+
+	dt := strings.Join([]string{
+		"# comment",
+		foo.Encoded() + "  foo.tar.gz",
+		bar.Encoded() + " *./dist/bar.zip",
+		"SHA256 (baz.bin) = " + baz.Encoded(),
+		"",
+	}, "\n")
+
+	dgst, err := checksumFromFile([]byte(dt), "foo.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, foo, dgst)
+
+	dgst, err = checksumFromFile([]byte(dt), "bar.zip")
+	require.NoError(t, err)
+	require.Equal(t, bar, dgst)
+
+	dgst, err = checksumFromFile([]byte(dt), "baz.bin")
+	require.NoError(t, err)
+	require.Equal(t, baz, dgst)
+
+	_, err = checksumFromFile([]byte(dt), "missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found")
+
+	_, err = checksumFromFile([]byte(strings.Repeat("a", 128)+"  sha512.bin\n"), "sha512.bin")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only sha256")
+}
@@ -5,6 +5,7 @@ import (
 	provenancetypes "github.com/moby/buildkit/solver/llbsolver/provenance/types"
 	"github.com/moby/buildkit/source"
 	srctypes "github.com/moby/buildkit/source/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/tonistiigi/fsutil"
 )
 
@@ -18,6 +19,7 @@ type LocalIdentifier struct {
 	Differ             fsutil.DiffType
 	MetadataOnly       bool
 	MetadataExceptions []string
+	ChunkedTransfer    bool
 }
 
 func NewLocalIdentifier(str string) (*LocalIdentifier, error) {
@@ -32,7 +34,8 @@ var _ source.Identifier = (*LocalIdentifier)(nil)
 
 func (id *LocalIdentifier) Capture(c *provenance.Capture, pin string) error {
 	c.AddLocal(provenancetypes.LocalSource{
-		Name: id.Name,
+		Name:   id.Name,
+		Digest: digest.Digest(pin),
 	})
 	return nil
 }
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/moby/buildkit/cache"
@@ -29,19 +31,48 @@ import (
 	"golang.org/x/time/rate"
 )
 
+// maxChunkIndexes limits the number of shared keys that chunk indexes are
+// kept for. The least recently used index is dropped.
+const maxChunkIndexes = 64
+
 type Opt struct {
 	CacheAccessor cache.Accessor
 }
 
 func NewSource(opt Opt) (source.Source, error) {
 	ls := &localSource{
-		cm: opt.CacheAccessor,
+		cm:           opt.CacheAccessor,
+		chunkIndexes: make(map[string]*filesync.ChunkIndex),
 	}
 	return ls, nil
 }
 
 type localSource struct {
 	cm cache.Accessor
+
+	mu           sync.Mutex
+	chunkIndexes map[string]*filesync.ChunkIndex
+	chunkKeys    []string
+}
+
+// chunkIndex returns the index of the chunks of the files transferred with
+// the shared key.
+func (ls *localSource) chunkIndex(sharedKey string) *filesync.ChunkIndex {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	idx, ok := ls.chunkIndexes[sharedKey]
+	if ok {
+		ls.chunkKeys = slices.DeleteFunc(ls.chunkKeys, func(k string) bool { return k == sharedKey })
+	} else {
+		idx = filesync.NewChunkIndex()
+		ls.chunkIndexes[sharedKey] = idx
+		if len(ls.chunkKeys) >= maxChunkIndexes {
+			delete(ls.chunkIndexes, ls.chunkKeys[0])
+			ls.chunkKeys = ls.chunkKeys[1:]
+		}
+	}
+	ls.chunkKeys = append(ls.chunkKeys, sharedKey)
+	return idx
 }
 
 func (ls *localSource) Schemes() []string {
@@ -101,6 +132,12 @@ func (ls *localSource) Identifier(scheme, ref string, attrs map[string]string, p
 				return nil, err
 			}
 			id.MetadataExceptions = exceptions
+		case pb.AttrLocalChunkedTransfer:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value for local.chunkedtransfer %q", v)
+			}
+			id.ChunkedTransfer = b
 		}
 	}
 
@@ -158,7 +195,8 @@ func (ls *localSourceHandler) CacheKey(ctx context.Context, g session.Group, ind
 	if err != nil {
 		return "", "", nil, false, err
 	}
-	return "session:" + ls.src.Name + ":" + dgst.String(), dgst.String(), nil, true, nil
+	// the pin is set to the checksum of the files after the transfer
+	return "session:" + ls.src.Name + ":" + dgst.String(), "", nil, true, nil
 }
 
 func (ls *localSourceHandler) Snapshot(ctx context.Context, g session.Group) (cache.ImmutableRef, error) {
@@ -277,6 +315,10 @@ func (ls *localSourceHandler) snapshot(ctx context.Context, caller session.Calle
 		MetadataOnly:    ls.src.MetadataOnly,
 	}
 
+	if ls.src.ChunkedTransfer {
+		opt.ChunkIndex = ls.chunkIndex(sharedKey)
+	}
+
 	if opt.MetadataOnly && len(ls.src.MetadataExceptions) > 0 {
 		matcher, err := patternmatcher.New(ls.src.MetadataExceptions)
 		if err != nil {
@@ -0,0 +1,85 @@
+package lockfile
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/moby/buildkit/solver/llbsolver/provenance"
+	provenancetypes "github.com/moby/buildkit/solver/llbsolver/provenance/types"
+	"github.com/moby/buildkit/source"
+	srctypes "github.com/moby/buildkit/source/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+)
+
+// Entry is a single file in a lockfile.
+type Entry struct {
+	URL      string        `json:"url"`
+	Digest   digest.Digest `json:"digest"`
+	Filename string        `json:"filename,omitempty"`
+}
+
+type LockfileIdentifier struct {
+	Name    string
+	Entries []Entry
+}
+
+func NewLockfileIdentifier(name string) (*LockfileIdentifier, error) {
+	return &LockfileIdentifier{Name: name}, nil
+}
+
+var _ source.Identifier = (*LockfileIdentifier)(nil)
+
+func (*LockfileIdentifier) Scheme() string {
+	return srctypes.LockfileScheme
+}
+
+func (id *LockfileIdentifier) Capture(c *provenance.Capture, pin string) error {
+	for _, e := range id.Entries {
+		c.AddHTTP(provenancetypes.HTTPSource{
+			URL:    e.URL,
+			Digest: e.Digest,
+		})
+	}
+	return nil
+}
+
+// validateEntries checks the entries of a lockfile and fills in default
+// filenames for entries that don't define one.
+func validateEntries(entries []Entry) error {
+	if len(entries) == 0 {
+		return errors.New("lockfile does not contain any entries")
+	}
+	seen := map[string]struct{}{}
+	for i, e := range entries {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return errors.Wrapf(err, "invalid URL %q", e.URL)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.Errorf("unsupported URL scheme %q for %s", u.Scheme, e.URL)
+		}
+		if err := e.Digest.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid digest for %s", e.URL)
+		}
+		if e.Digest.Algorithm() != digest.SHA256 {
+			return errors.Errorf("unsupported digest algorithm %s for %s", e.Digest.Algorithm(), e.URL)
+		}
+		if e.Filename == "" {
+			e.Filename = "download"
+			if base := path.Base(u.Path); base != "." && base != "/" {
+				e.Filename = base
+			}
+		}
+		if e.Filename == "." || e.Filename == ".." || strings.ContainsAny(e.Filename, `/\`) {
+			return errors.Errorf("invalid filename %q for %s", e.Filename, e.URL)
+		}
+		if _, ok := seen[e.Filename]; ok {
+			return errors.Errorf("duplicate filename %q for %s", e.Filename, e.URL)
+		}
+		seen[e.Filename] = struct{}{}
+		entries[i] = e
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package lockfile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/source"
+	srctypes "github.com/moby/buildkit/source/types"
+	"github.com/moby/buildkit/util/progress"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxParallelFetches is the maximum number of lockfile entries that are
+// fetched at the same time.
+const maxParallelFetches = 8
+
+type Opt struct {
+	CacheAccessor cache.Accessor
+	// HTTPSource is used for fetching the individual entries so that the
+	// per-URL cache of the HTTP source is shared.
+	HTTPSource source.Source
+}
+
+type lockfileSource struct {
+	cache      cache.Accessor
+	httpSource source.Source
+}
+
+// NewSource returns a source that fetches all entries of a lockfile into a
+// single directory, verifying the digest of each entry.
+func NewSource(opt Opt) (source.Source, error) {
+	if opt.HTTPSource == nil {
+		return nil, errors.New("lockfile source requires an HTTP source")
+	}
+	return &lockfileSource{
+		cache:      opt.CacheAccessor,
+		httpSource: opt.HTTPSource,
+	}, nil
+}
+
+func (ls *lockfileSource) Schemes() []string {
+	return []string{srctypes.LockfileScheme}
+}
+
+func (ls *lockfileSource) Identifier(scheme, ref string, attrs map[string]string, platform *pb.Platform) (source.Identifier, error) {
+	id, err := NewLockfileIdentifier(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range attrs {
+		switch k {
+		case pb.AttrLockfileEntries:
+			if err := json.Unmarshal([]byte(v), &id.Entries); err != nil {
+				return nil, errors.Wrap(err, "failed to parse lockfile entries")
+			}
+		}
+	}
+	if err := validateEntries(id.Entries); err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+func (ls *lockfileSource) Resolve(ctx context.Context, id source.Identifier, sm *session.Manager, _ solver.Vertex) (source.SourceInstance, error) {
+	lockfileIdentifier, ok := id.(*LockfileIdentifier)
+	if !ok {
+		return nil, errors.Errorf("invalid lockfile identifier %v", id)
+	}
+	return &lockfileSourceHandler{
+		lockfileSource: ls,
+		src:            *lockfileIdentifier,
+		sm:             sm,
+	}, nil
+}
+
+type lockfileSourceHandler struct {
+	*lockfileSource
+	src LockfileIdentifier
+	sm  *session.Manager
+}
+
+func (lh *lockfileSourceHandler) CacheKey(ctx context.Context, g session.Group, index int) (string, string, solver.CacheOpts, bool, error) {
+	// All entries are pinned by digest so the key can be computed without
+	// accessing the network.
+	dt, err := json.Marshal(struct {
+		Entries []Entry
+	}{
+		Entries: lh.src.Entries,
+	})
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	dgst := digest.FromBytes(dt)
+	return dgst.String(), dgst.String(), nil, true, nil
+}
+
+func (lh *lockfileSourceHandler) Snapshot(ctx context.Context, g session.Group) (_ cache.ImmutableRef, retErr error) {
+	refs := make([]cache.ImmutableRef, len(lh.src.Entries))
+	defer func() {
+		for _, ref := range refs {
+			if ref != nil {
+				ref.Release(context.WithoutCancel(ctx))
+			}
+		}
+	}()
+
+	eg, egctx := errgroup.WithContext(ctx)
+	eg.SetLimit(maxParallelFetches)
+	for i, e := range lh.src.Entries {
+		eg.Go(func() error {
+			done := progress.OneOff(egctx, fmt.Sprintf("fetch %s", e.URL))
+			ref, err := lh.fetch(egctx, g, e)
+			if err != nil {
+				return done(err)
+			}
+			refs[i] = ref
+			return done(nil)
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	if len(refs) == 1 {
+		ref := refs[0]
+		refs[0] = nil
+		return ref, nil
+	}
+	return lh.cache.Merge(ctx, refs, nil, cache.WithDescription(fmt.Sprintf("lockfile %s", lh.src.Name)))
+}
+
+// fetch fetches a single entry through the HTTP source. The entry is resolved
+// without a checksum so that a previously downloaded copy of the URL is
+// revalidated with the server instead of being fetched again, and the digest
+// is verified afterwards.
+func (lh *lockfileSourceHandler) fetch(ctx context.Context, g session.Group, e Entry) (cache.ImmutableRef, error) {
+	scheme, ref, ok := strings.Cut(e.URL, "://")
+	if !ok {
+		return nil, errors.Errorf("invalid URL %s", e.URL)
+	}
+	id, err := lh.httpSource.Identifier(scheme, ref, map[string]string{
+		pb.AttrHTTPFilename: e.Filename,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := lh.httpSource.Resolve(ctx, id, lh.sm, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, pin, _, _, err := inst.CacheKey(ctx, g, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch %s", e.URL)
+	}
+	if pin != e.Digest.String() {
+		return nil, errors.Errorf("digest mismatch for %s: expected %s, got %s", e.URL, e.Digest, pin)
+	}
+	return inst.Snapshot(ctx, g)
+}
@@ -0,0 +1,261 @@
+package lockfile
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/diff/apply"
+	ctdmetadata "github.com/containerd/containerd/v2/core/metadata"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/containerd/containerd/v2/plugins/diff/walking"
+	"github.com/containerd/containerd/v2/plugins/snapshots/native"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/cache/metadata"
+	"github.com/moby/buildkit/snapshot"
+	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/source"
+	"github.com/moby/buildkit/source/http"
+	"github.com/moby/buildkit/util/leaseutil"
+	"github.com/moby/buildkit/util/testutil/httpserver"
+	"github.com/moby/buildkit/util/winlayers"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestLockfileSource(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	ls, err := newLockfileSource(t)
+	require.NoError(t, err)
+
+	server := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/foo": {Etag: "foo1", Content: []byte("foo1")},
+		"/bar": {Etag: "bar1", Content: []byte("bar1")},
+	})
+	defer server.Close()
+
+	entries := []Entry{
+		{URL: server.URL + "/foo", Digest: digest.FromBytes([]byte("foo1"))},
+		{URL: server.URL + "/bar", Digest: digest.FromBytes([]byte("bar1")), Filename: "bar.bin"},
+	}
+
+	k1, files := snapshotLockfile(ctx, t, ls, entries)
+	require.Equal(t, map[string]string{
+		"foo":     "foo1",
+		"bar.bin": "bar1",
+	}, files)
+	require.Equal(t, 1, server.Stats("/foo").AllRequests)
+	require.Equal(t, 1, server.Stats("/bar").AllRequests)
+
+	// only the changed entry is downloaded again
+	server.SetRoute("/bar", httpserver.Response{Etag: "bar2", Content: []byte("bar2")})
+	entries[1].Digest = digest.FromBytes([]byte("bar2"))
+
+	k2, files := snapshotLockfile(ctx, t, ls, entries)
+	require.NotEqual(t, k1, k2)
+	require.Equal(t, map[string]string{
+		"foo":     "foo1",
+		"bar.bin": "bar2",
+	}, files)
+	require.Equal(t, 2, server.Stats("/foo").AllRequests)
+	require.Equal(t, 1, server.Stats("/foo").CachedRequests)
+	require.Equal(t, 3, server.Stats("/bar").AllRequests)
+	require.Equal(t, 0, server.Stats("/bar").CachedRequests)
+}
+
+func TestLockfileSourceDigestMismatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	ls, err := newLockfileSource(t)
+	require.NoError(t, err)
+
+	server := httpserver.NewTestServer(map[string]httpserver.Response{
+		"/foo": {Etag: "foo1", Content: []byte("foo1")},
+	})
+	defer server.Close()
+
+	id, err := lockfileIdentifier(ls, []Entry{
+		{URL: server.URL + "/foo", Digest: digest.FromBytes([]byte("foo2"))},
+	})
+	require.NoError(t, err)
+
+	h, err := ls.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, err = h.Snapshot(ctx, nil)
+	require.ErrorContains(t, err, "digest mismatch")
+}
+
+func TestLockfileSourceInvalid(t *testing.T) {
+	t.Parallel()
+
+	ls, err := newLockfileSource(t)
+	require.NoError(t, err)
+
+	dgst := digest.FromBytes([]byte("foo"))
+
+	for _, tc := range []struct {
+		name    string
+		entries []Entry
+		err     string
+	}{
+		{
+			name: "empty",
+			err:  "does not contain any entries",
+		},
+		{
+			name:    "scheme",
+			entries: []Entry{{URL: "ftp://example.com/foo", Digest: dgst}},
+			err:     "unsupported URL scheme",
+		},
+		{
+			name:    "digest",
+			entries: []Entry{{URL: "https://example.com/foo", Digest: "sha256:foo"}},
+			err:     "invalid digest",
+		},
+		{
+			name: "duplicate",
+			entries: []Entry{
+				{URL: "https://example.com/a/foo", Digest: dgst},
+				{URL: "https://example.com/b/foo", Digest: dgst},
+			},
+			err: "duplicate filename",
+		},
+		{
+			name:    "filename",
+			entries: []Entry{{URL: "https://example.com/foo", Digest: dgst, Filename: "../foo"}},
+			err:     "invalid filename",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := lockfileIdentifier(ls, tc.entries)
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+func lockfileIdentifier(ls source.Source, entries []Entry) (source.Identifier, error) {
+	dt, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	return ls.Identifier("lockfile", "test", map[string]string{
+		pb.AttrLockfileEntries: string(dt),
+	}, nil)
+}
+
+func snapshotLockfile(ctx context.Context, t *testing.T, ls source.Source, entries []Entry) (string, map[string]string) {
+	id, err := lockfileIdentifier(ls, entries)
+	require.NoError(t, err)
+
+	h, err := ls.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	k, p, _, done, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.True(t, done)
+	require.Equal(t, k, p)
+
+	ref, err := h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	defer ref.Release(context.TODO())
+
+	mount, err := ref.Mount(ctx, true, nil)
+	require.NoError(t, err)
+
+	lm := snapshot.LocalMounter(mount)
+	dir, err := lm.Mount()
+	require.NoError(t, err)
+	defer lm.Unmount()
+
+	des, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	for _, de := range des {
+		dt, err := os.ReadFile(filepath.Join(dir, de.Name()))
+		require.NoError(t, err)
+		files[de.Name()] = string(dt)
+	}
+	return k, files
+}
+
+func newLockfileSource(t *testing.T) (source.Source, error) {
+	tmpdir := t.TempDir()
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, snapshotter.Close())
+	})
+
+	store, err := local.NewStore(tmpdir)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(tmpdir, "containerdmeta.db"), 0644, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+
+	mdb := ctdmetadata.NewDB(db, store, map[string]snapshots.Snapshotter{
+		"native": snapshotter,
+	})
+
+	md, err := metadata.NewStore(filepath.Join(tmpdir, "metadata.db"))
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, md.Close())
+	})
+
+	lm := leaseutil.WithNamespace(ctdmetadata.NewLeaseManager(mdb), "buildkit")
+	c := mdb.ContentStore()
+	applier := winlayers.NewFileSystemApplierWithWindows(c, apply.NewFileSystemApplier(c))
+	differ := winlayers.NewWalkingDiffWithWindows(c, walking.NewWalkingDiff(c))
+
+	cm, err := cache.NewManager(cache.ManagerOpt{
+		Snapshotter:    snapshot.FromContainerdSnapshotter("native", containerdsnapshot.NSSnapshotter("buildkit", mdb.Snapshotter("native")), nil),
+		MetadataStore:  md,
+		LeaseManager:   lm,
+		ContentStore:   c,
+		Applier:        applier,
+		Differ:         differ,
+		GarbageCollect: mdb.GarbageCollect,
+		Root:           tmpdir,
+		MountPoolRoot:  filepath.Join(tmpdir, "cachemounts"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, cm.Close())
+	})
+
+	hs, err := http.NewSource(http.Opt{
+		CacheAccessor: cm,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSource(Opt{
+		CacheAccessor: cm,
+		HTTPSource:    hs,
+	})
+}
@@ -0,0 +1,53 @@
+package ociartifact
+
+import (
+	"github.com/containerd/containerd/v2/pkg/reference"
+	"github.com/moby/buildkit/solver/llbsolver/provenance"
+	provenancetypes "github.com/moby/buildkit/solver/llbsolver/provenance/types"
+	"github.com/moby/buildkit/source"
+	srctypes "github.com/moby/buildkit/source/types"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+type ArtifactIdentifier struct {
+	Reference reference.Spec
+	Platform  *ocispecs.Platform
+	// MediaTypes limits the selected layers to the ones with one of the
+	// listed media types. All layers are selected if empty.
+	MediaTypes []string
+	// Annotations limits the selected layers to the ones that have all of
+	// the listed annotations with matching values.
+	Annotations map[string]string
+}
+
+func NewArtifactIdentifier(str string) (*ArtifactIdentifier, error) {
+	ref, err := reference.Parse(str)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if ref.Object == "" {
+		return nil, errors.WithStack(reference.ErrObjectRequired)
+	}
+	return &ArtifactIdentifier{Reference: ref}, nil
+}
+
+var _ source.Identifier = (*ArtifactIdentifier)(nil)
+
+func (*ArtifactIdentifier) Scheme() string {
+	return srctypes.OCIArtifactScheme
+}
+
+func (id *ArtifactIdentifier) Capture(c *provenance.Capture, pin string) error {
+	dgst, err := digest.Parse(pin)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse artifact digest %s", pin)
+	}
+	c.AddImage(provenancetypes.ImageSource{
+		Ref:      id.Reference.String(),
+		Platform: id.Platform,
+		Digest:   dgst,
+	})
+	return nil
+}
@@ -0,0 +1,409 @@
+package ociartifact
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/containerd/platforms"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/snapshot"
+	"github.com/moby/buildkit/solver"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/source"
+	srctypes "github.com/moby/buildkit/source/types"
+	"github.com/moby/buildkit/util/contentutil"
+	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/util/resolver"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxManifestSize is the maximum size of a manifest or index that is read
+// when resolving an artifact.
+const maxManifestSize = 4 << 20
+
+type Opt struct {
+	CacheAccessor cache.Accessor
+	RegistryHosts docker.RegistryHosts
+}
+
+type artifactSource struct {
+	cache         cache.Accessor
+	registryHosts docker.RegistryHosts
+}
+
+// NewSource returns a source that pulls the layers of non-image OCI artifacts
+// (e.g. Helm charts, WASM modules, signatures) from a registry and
+// materializes them as regular files.
+func NewSource(opt Opt) (source.Source, error) {
+	return &artifactSource{
+		cache:         opt.CacheAccessor,
+		registryHosts: opt.RegistryHosts,
+	}, nil
+}
+
+func (as *artifactSource) Schemes() []string {
+	return []string{srctypes.OCIArtifactScheme}
+}
+
+func (as *artifactSource) Identifier(scheme, ref string, attrs map[string]string, platform *pb.Platform) (source.Identifier, error) {
+	id, err := NewArtifactIdentifier(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if platform != nil {
+		id.Platform = &ocispecs.Platform{
+			OS:           platform.OS,
+			Architecture: platform.Architecture,
+			Variant:      platform.Variant,
+			OSVersion:    platform.OSVersion,
+		}
+		if platform.OSFeatures != nil {
+			id.Platform.OSFeatures = slices.Clone(platform.OSFeatures)
+		}
+	}
+
+	for k, v := range attrs {
+		switch k {
+		case pb.AttrOCIArtifactMediaTypes:
+			for _, mt := range strings.Split(v, ",") {
+				if mt = strings.TrimSpace(mt); mt != "" {
+					id.MediaTypes = append(id.MediaTypes, mt)
+				}
+			}
+		default:
+			if name, ok := strings.CutPrefix(k, pb.AttrOCIArtifactAnnotationPrefix); ok {
+				if id.Annotations == nil {
+					id.Annotations = map[string]string{}
+				}
+				id.Annotations[name] = v
+			}
+		}
+	}
+	slices.Sort(id.MediaTypes)
+
+	return id, nil
+}
+
+func (as *artifactSource) Resolve(ctx context.Context, id source.Identifier, sm *session.Manager, _ solver.Vertex) (source.SourceInstance, error) {
+	artifactIdentifier, ok := id.(*ArtifactIdentifier)
+	if !ok {
+		return nil, errors.Errorf("invalid oci artifact identifier %v", id)
+	}
+	return &artifactSourceHandler{
+		artifactSource: as,
+		src:            *artifactIdentifier,
+		sm:             sm,
+	}, nil
+}
+
+type artifactSourceHandler struct {
+	*artifactSource
+	src ArtifactIdentifier
+	sm  *session.Manager
+
+	manifestDigest digest.Digest
+	files          []artifactFile
+}
+
+// artifactFile is a selected layer of the artifact and the filename it is
+// written to.
+type artifactFile struct {
+	Filename   string
+	Descriptor ocispecs.Descriptor
+}
+
+func (ah *artifactSourceHandler) resolver(g session.Group) *resolver.Resolver {
+	return resolver.DefaultPool.GetResolver(ah.registryHosts, ah.src.Reference.String(), "pull", ah.sm, g)
+}
+
+func (ah *artifactSourceHandler) CacheKey(ctx context.Context, g session.Group, index int) (string, string, solver.CacheOpts, bool, error) {
+	ref := ah.src.Reference.String()
+	done := progress.OneOff(ctx, "resolve "+ref)
+
+	dgst, files, err := ah.resolve(ctx, g)
+	if err != nil {
+		return "", "", nil, false, done(err)
+	}
+	done(nil)
+
+	ah.manifestDigest = dgst
+	ah.files = files
+
+	// The cache key only depends on the selected content so that artifacts
+	// that are re-pushed with identical layers do not invalidate the cache.
+	dt, err := json.Marshal(struct {
+		Files []artifactFile
+	}{
+		Files: files,
+	})
+	if err != nil {
+		return "", "", nil, false, err
+	}
+	return digest.FromBytes(dt).String(), dgst.String(), nil, true, nil
+}
+
+func (ah *artifactSourceHandler) resolve(ctx context.Context, g session.Group) (digest.Digest, []artifactFile, error) {
+	ref := ah.src.Reference.String()
+	r := ah.resolver(g)
+
+	_, desc, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to resolve %s", ref)
+	}
+	fetcher, err := r.Fetcher(ctx, ref)
+	if err != nil {
+		return "", nil, err
+	}
+	provider := contentutil.FromFetcher(fetcher)
+
+	mfst, err := readManifest(ctx, provider, desc, ah.platformMatcher())
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to read manifest for %s", ref)
+	}
+
+	files, err := ah.selectLayers(mfst.Layers)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "invalid artifact %s", ref)
+	}
+	return desc.Digest, files, nil
+}
+
+func (ah *artifactSourceHandler) platformMatcher() platforms.MatchComparer {
+	if ah.src.Platform != nil {
+		return platforms.Only(*ah.src.Platform)
+	}
+	return platforms.Default()
+}
+
+func (ah *artifactSourceHandler) selectLayers(layers []ocispecs.Descriptor) ([]artifactFile, error) {
+	var files []artifactFile
+	seen := map[string]struct{}{}
+	for _, l := range layers {
+		if len(ah.src.MediaTypes) > 0 && !slices.Contains(ah.src.MediaTypes, l.MediaType) {
+			continue
+		}
+		if !matchAnnotations(l.Annotations, ah.src.Annotations) {
+			continue
+		}
+		name, err := layerFilename(l)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[name]; ok {
+			return nil, errors.Errorf("duplicate filename %q for layer %s", name, l.Digest)
+		}
+		seen[name] = struct{}{}
+		files = append(files, artifactFile{
+			Filename: name,
+			Descriptor: ocispecs.Descriptor{
+				MediaType: l.MediaType,
+				Digest:    l.Digest,
+				Size:      l.Size,
+			},
+		})
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("no layers matching media types %v and annotations %v", ah.src.MediaTypes, ah.src.Annotations)
+	}
+	return files, nil
+}
+
+func (ah *artifactSourceHandler) Snapshot(ctx context.Context, g session.Group) (_ cache.ImmutableRef, retErr error) {
+	if ah.files == nil {
+		if _, _, _, _, err := ah.CacheKey(ctx, g, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	ref := ah.src.Reference.String()
+	r := ah.resolver(g)
+	fetcher, err := r.Fetcher(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	newRef, err := ah.cache.New(ctx, nil, g, cache.WithDescription(fmt.Sprintf("oci artifact %s@%s", ref, ah.manifestDigest)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil && newRef != nil {
+			newRef.Release(context.WithoutCancel(ctx))
+		}
+	}()
+
+	mount, err := newRef.Mount(ctx, false, g)
+	if err != nil {
+		return nil, err
+	}
+	lm := snapshot.LocalMounter(mount)
+	dir, err := lm.Mount()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if lm != nil {
+			lm.Unmount()
+		}
+	}()
+
+	uid, gid := 0, 0
+	if idmap := mount.IdentityMapping(); idmap != nil {
+		uid, gid = idmap.RootPair()
+	}
+
+	eg, egctx := errgroup.WithContext(ctx)
+	for _, f := range ah.files {
+		eg.Go(func() error {
+			done := progress.OneOff(egctx, fmt.Sprintf("fetch %s %s", f.Filename, f.Descriptor.Digest))
+			return done(fetchFile(egctx, fetcher, f, filepath.Join(dir, f.Filename), uid, gid))
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	if err := lm.Unmount(); err != nil {
+		return nil, err
+	}
+	lm = nil
+
+	snap, err := newRef.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	newRef = nil
+	return snap, nil
+}
+
+func fetchFile(ctx context.Context, fetcher remotes.Fetcher, f artifactFile, fp string, uid, gid int) (retErr error) {
+	rc, err := fetcher.Fetch(ctx, f.Descriptor)
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch %s", f.Descriptor.Digest)
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(fp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if out != nil {
+			out.Close()
+		}
+	}()
+
+	verifier := f.Descriptor.Digest.Verifier()
+	n, err := io.Copy(io.MultiWriter(out, verifier), io.LimitReader(rc, f.Descriptor.Size+1))
+	if err != nil {
+		return errors.Wrapf(err, "failed to write %s", f.Filename)
+	}
+	if n != f.Descriptor.Size || !verifier.Verified() {
+		return errors.Errorf("digest mismatch for %s: expected %s with size %d", f.Filename, f.Descriptor.Digest, f.Descriptor.Size)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	out = nil
+
+	if uid != 0 || gid != 0 {
+		if err := os.Lchown(fp, uid, gid); err != nil {
+			return err
+		}
+	}
+	mTime := time.Unix(0, 0)
+	return os.Chtimes(fp, mTime, mTime)
+}
+
+// readManifest reads the manifest for desc. If desc points to an index, the
+// first manifest matching the platform, or without a platform, is used.
+func readManifest(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor, platform platforms.MatchComparer) (*ocispecs.Manifest, error) {
+	if images.IsIndexType(desc.MediaType) {
+		dt, err := readBlob(ctx, provider, desc)
+		if err != nil {
+			return nil, err
+		}
+		var idx ocispecs.Index
+		if err := json.Unmarshal(dt, &idx); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse index %s", desc.Digest)
+		}
+		var found bool
+		for _, d := range idx.Manifests {
+			if !images.IsManifestType(d.MediaType) {
+				continue
+			}
+			if d.Platform == nil || platform.Match(*d.Platform) {
+				desc = d
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("no matching manifest in index %s", desc.Digest)
+		}
+	}
+	if !images.IsManifestType(desc.MediaType) {
+		return nil, errors.Errorf("unsupported media type %s", desc.MediaType)
+	}
+	dt, err := readBlob(ctx, provider, desc)
+	if err != nil {
+		return nil, err
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse manifest %s", desc.Digest)
+	}
+	return &mfst, nil
+}
+
+func readBlob(ctx context.Context, provider content.Provider, desc ocispecs.Descriptor) ([]byte, error) {
+	if desc.Size > maxManifestSize {
+		return nil, errors.Errorf("manifest %s is too large: %d bytes", desc.Digest, desc.Size)
+	}
+	dt, err := content.ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return nil, err
+	}
+	if dgst := desc.Digest.Algorithm().FromBytes(dt); dgst != desc.Digest {
+		return nil, errors.Errorf("digest mismatch for %s: got %s", desc.Digest, dgst)
+	}
+	return dt, nil
+}
+
+func matchAnnotations(annotations, filter map[string]string) bool {
+	for k, v := range filter {
+		if av, ok := annotations[k]; !ok || av != v {
+			return false
+		}
+	}
+	return true
+}
+
+// layerFilename returns the name of the file a layer is written to. The
+// standard title annotation is used if set, otherwise the digest encoding.
+func layerFilename(desc ocispecs.Descriptor) (string, error) {
+	name := desc.Digest.Encoded()
+	if title, ok := desc.Annotations[ocispecs.AnnotationTitle]; ok {
+		name = title
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", errors.Errorf("invalid filename %q for layer %s", name, desc.Digest)
+	}
+	return name, nil
+}
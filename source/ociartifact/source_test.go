@@ -0,0 +1,373 @@
+package ociartifact
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/diff/apply"
+	ctdmetadata "github.com/containerd/containerd/v2/core/metadata"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	"github.com/containerd/containerd/v2/plugins/diff/walking"
+	"github.com/containerd/containerd/v2/plugins/snapshots/native"
+	"github.com/moby/buildkit/cache"
+	"github.com/moby/buildkit/cache/metadata"
+	"github.com/moby/buildkit/snapshot"
+	containerdsnapshot "github.com/moby/buildkit/snapshot/containerd"
+	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/source"
+	"github.com/moby/buildkit/util/leaseutil"
+	"github.com/moby/buildkit/util/winlayers"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	mediaTypeHelmChart      = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	mediaTypeHelmProvenance = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+)
+
+func TestArtifactSource(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	as, err := newArtifactSource(t)
+	require.NoError(t, err)
+
+	reg := newTestRegistry(t)
+	chart := reg.pushBlob([]byte("chart"))
+	chart.MediaType = mediaTypeHelmChart
+	chart.Annotations = map[string]string{ocispecs.AnnotationTitle: "mychart-0.1.0.tgz"}
+	prov := reg.pushBlob([]byte("provenance"))
+	prov.MediaType = mediaTypeHelmProvenance
+	prov.Annotations = map[string]string{ocispecs.AnnotationTitle: "mychart-0.1.0.tgz.prov"}
+	sig := reg.pushBlob([]byte("signature"))
+	sig.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	mfst1 := reg.pushManifest("charts/mychart", "0.1.0", nil, chart, prov, sig)
+
+	id, err := as.Identifier("oci-artifact", reg.host+"/charts/mychart:0.1.0", nil, nil)
+	require.NoError(t, err)
+
+	h, err := as.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	k1, p, _, done, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.True(t, done)
+	require.Equal(t, mfst1.String(), p)
+
+	ref, err := h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	files := readFiles(ctx, t, ref)
+	ref.Release(context.TODO())
+
+	require.Equal(t, map[string]string{
+		"mychart-0.1.0.tgz":      "chart",
+		"mychart-0.1.0.tgz.prov": "provenance",
+		sig.Digest.Encoded():     "signature",
+	}, files)
+
+	// select by media type
+	id, err = as.Identifier("oci-artifact", reg.host+"/charts/mychart:0.1.0", map[string]string{
+		pb.AttrOCIArtifactMediaTypes: mediaTypeHelmChart,
+	}, nil)
+	require.NoError(t, err)
+
+	h, err = as.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	k2, _, _, _, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.NotEqual(t, k1, k2)
+
+	ref, err = h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	files = readFiles(ctx, t, ref)
+	ref.Release(context.TODO())
+
+	require.Equal(t, map[string]string{
+		"mychart-0.1.0.tgz": "chart",
+	}, files)
+
+	// select by annotation
+	id, err = as.Identifier("oci-artifact", reg.host+"/charts/mychart:0.1.0", map[string]string{
+		pb.AttrOCIArtifactAnnotationPrefix + ocispecs.AnnotationTitle: "mychart-0.1.0.tgz.prov",
+	}, nil)
+	require.NoError(t, err)
+
+	h, err = as.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	ref, err = h.Snapshot(ctx, nil)
+	require.NoError(t, err)
+	files = readFiles(ctx, t, ref)
+	ref.Release(context.TODO())
+
+	require.Equal(t, map[string]string{
+		"mychart-0.1.0.tgz.prov": "provenance",
+	}, files)
+
+	// repushing the same layers with a different manifest keeps the cache key
+	mfst2 := reg.pushManifest("charts/mychart", "0.1.0", map[string]string{"foo": "bar"}, chart, prov, sig)
+	require.NotEqual(t, mfst1, mfst2)
+
+	id, err = as.Identifier("oci-artifact", reg.host+"/charts/mychart:0.1.0", nil, nil)
+	require.NoError(t, err)
+
+	h, err = as.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	k3, p, _, _, err := h.CacheKey(ctx, nil, 0)
+	require.NoError(t, err)
+	require.Equal(t, k1, k3)
+	require.Equal(t, mfst2.String(), p)
+}
+
+func TestArtifactSourceNoMatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	as, err := newArtifactSource(t)
+	require.NoError(t, err)
+
+	reg := newTestRegistry(t)
+	chart := reg.pushBlob([]byte("chart"))
+	chart.MediaType = mediaTypeHelmChart
+	reg.pushManifest("charts/mychart", "0.1.0", nil, chart)
+
+	id, err := as.Identifier("oci-artifact", reg.host+"/charts/mychart:0.1.0", map[string]string{
+		pb.AttrOCIArtifactMediaTypes: mediaTypeHelmProvenance,
+	}, nil)
+	require.NoError(t, err)
+
+	h, err := as.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, _, _, _, err = h.CacheKey(ctx, nil, 0)
+	require.ErrorContains(t, err, "no layers matching")
+}
+
+func TestArtifactSourceDigestMismatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+
+	as, err := newArtifactSource(t)
+	require.NoError(t, err)
+
+	reg := newTestRegistry(t)
+	chart := reg.pushBlob([]byte("chart"))
+	chart.MediaType = mediaTypeHelmChart
+	reg.pushManifest("charts/mychart", "0.1.0", nil, chart)
+
+	// tamper with the blob content after the manifest has been pushed
+	reg.mu.Lock()
+	reg.blobs[chart.Digest] = []byte("CHART")
+	reg.mu.Unlock()
+
+	id, err := as.Identifier("oci-artifact", reg.host+"/charts/mychart:0.1.0", nil, nil)
+	require.NoError(t, err)
+
+	h, err := as.Resolve(ctx, id, nil, nil)
+	require.NoError(t, err)
+
+	_, err = h.Snapshot(ctx, nil)
+	require.Error(t, err)
+}
+
+// testRegistry is a minimal in-process implementation of the read side of the
+// OCI distribution API.
+type testRegistry struct {
+	host string
+
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	manifests map[string]ocispecs.Descriptor
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	reg := &testRegistry{
+		blobs:     map[digest.Digest][]byte{},
+		manifests: map[string]ocispecs.Descriptor{},
+	}
+	srv := httptest.NewServer(reg)
+	t.Cleanup(srv.Close)
+	reg.host = strings.TrimPrefix(srv.URL, "http://")
+	return reg
+}
+
+func (r *testRegistry) pushBlob(dt []byte) ocispecs.Descriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	dgst := digest.FromBytes(dt)
+	r.blobs[dgst] = dt
+	return ocispecs.Descriptor{
+		MediaType: "application/octet-stream",
+		Digest:    dgst,
+		Size:      int64(len(dt)),
+	}
+}
+
+func (r *testRegistry) pushManifest(name, tag string, annotations map[string]string, layers ...ocispecs.Descriptor) digest.Digest {
+	cfg := r.pushBlob([]byte("{}"))
+	cfg.MediaType = ocispecs.MediaTypeEmptyJSON
+	dt, err := json.Marshal(ocispecs.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.example.test",
+		Config:       cfg,
+		Layers:       layers,
+		Annotations:  annotations,
+	})
+	if err != nil {
+		panic(err)
+	}
+	desc := r.pushBlob(dt)
+	desc.MediaType = ocispecs.MediaTypeImageManifest
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.manifests[name+":"+tag] = desc
+	r.manifests[name+":"+desc.Digest.String()] = desc
+	return desc.Digest
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if p == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var desc ocispecs.Descriptor
+	if name, ref, ok := strings.Cut(p, "/manifests/"); ok {
+		d, ok := r.manifests[name+":"+ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		desc = d
+	} else if _, ref, ok := strings.Cut(p, "/blobs/"); ok {
+		dgst, err := digest.Parse(ref)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		desc = ocispecs.Descriptor{MediaType: "application/octet-stream", Digest: dgst}
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	dt, ok := r.blobs[desc.Digest]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", desc.MediaType)
+	w.Header().Set("Docker-Content-Digest", desc.Digest.String())
+	w.Header().Set("Content-Length", strconv.Itoa(len(dt)))
+	w.WriteHeader(http.StatusOK)
+	if req.Method != http.MethodHead {
+		w.Write(dt)
+	}
+}
+
+func readFiles(ctx context.Context, t *testing.T, ref cache.ImmutableRef) map[string]string {
+	mount, err := ref.Mount(ctx, true, nil)
+	require.NoError(t, err)
+
+	lm := snapshot.LocalMounter(mount)
+	dir, err := lm.Mount()
+	require.NoError(t, err)
+	defer lm.Unmount()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	files := map[string]string{}
+	for _, e := range entries {
+		dt, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		require.NoError(t, err)
+		files[e.Name()] = string(dt)
+	}
+	return files
+}
+
+func newArtifactSource(t *testing.T) (source.Source, error) {
+	tmpdir := t.TempDir()
+
+	snapshotter, err := native.NewSnapshotter(filepath.Join(tmpdir, "snapshots"))
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, snapshotter.Close())
+	})
+
+	store, err := local.NewStore(tmpdir)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(tmpdir, "containerdmeta.db"), 0644, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, db.Close())
+	})
+
+	mdb := ctdmetadata.NewDB(db, store, map[string]snapshots.Snapshotter{
+		"native": snapshotter,
+	})
+
+	md, err := metadata.NewStore(filepath.Join(tmpdir, "metadata.db"))
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, md.Close())
+	})
+
+	lm := leaseutil.WithNamespace(ctdmetadata.NewLeaseManager(mdb), "buildkit")
+	c := mdb.ContentStore()
+	applier := winlayers.NewFileSystemApplierWithWindows(c, apply.NewFileSystemApplier(c))
+	differ := winlayers.NewWalkingDiffWithWindows(c, walking.NewWalkingDiff(c))
+
+	cm, err := cache.NewManager(cache.ManagerOpt{
+		Snapshotter:    snapshot.FromContainerdSnapshotter("native", containerdsnapshot.NSSnapshotter("buildkit", mdb.Snapshotter("native")), nil),
+		MetadataStore:  md,
+		LeaseManager:   lm,
+		ContentStore:   c,
+		Applier:        applier,
+		Differ:         differ,
+		GarbageCollect: mdb.GarbageCollect,
+		Root:           tmpdir,
+		MountPoolRoot:  filepath.Join(tmpdir, "cachemounts"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		require.NoError(t, cm.Close())
+	})
+
+	return NewSource(Opt{
+		CacheAccessor: cm,
+	})
+}
@@ -7,4 +7,6 @@ const (
 	HTTPScheme        = "http"
 	HTTPSScheme       = "https"
 	OCIScheme         = "oci-layout"
+	OCIArtifactScheme = "oci-artifact"
+	LockfileScheme    = "lockfile"
 )
@@ -0,0 +1,92 @@
+package sourcepolicy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+)
+
+// Decision is a match of a policy rule recorded by the engine.
+type Decision struct {
+	// Policy is the index of the policy in the engine.
+	Policy int `json:"policy"`
+	// Rule is the index of the matched rule in the policy.
+	Rule     int              `json:"rule"`
+	Action   spb.PolicyAction `json:"action"`
+	Selector *spb.Selector    `json:"selector"`
+	// Identifier is the identifier of the source before any conversions.
+	Identifier string `json:"identifier,omitempty"`
+	// Updated is the identifier of the source after all conversions, if the
+	// source was converted.
+	Updated string `json:"updated,omitempty"`
+	// Args are the arguments of the process for exec operations.
+	Args []string `json:"args,omitempty"`
+}
+
+func (d Decision) String() string {
+	var subject string
+	if sel := d.Selector.GetExec(); sel != nil {
+		subject = fmt.Sprintf("exec %q", strings.Join(d.Args, " "))
+	} else {
+		subject = fmt.Sprintf("source %q", d.Identifier)
+		if d.Updated != "" {
+			subject += fmt.Sprintf(" (converted to %q)", d.Updated)
+		}
+	}
+	return fmt.Sprintf("%s matched %s rule %d of policy %d", subject, d.Action, d.Rule, d.Policy)
+}
+
+// DecisionHandler is called for each rule matched by the engine.
+type DecisionHandler func(ctx context.Context, d Decision)
+
+// EngineOpt configures the policy engine.
+type EngineOpt func(*Engine)
+
+// WithDecisionHandler sets a handler that is called with the rules matched
+// during each evaluation.
+func WithDecisionHandler(fn DecisionHandler) EngineOpt {
+	return func(e *Engine) {
+		e.onDecision = fn
+	}
+}
+
+// decisionLog collects the matched rules during an evaluation.
+type decisionLog struct {
+	decisions []Decision
+}
+
+func (l *decisionLog) record(polIdx, ruleIdx int, rule *spb.Rule) {
+	if l == nil {
+		return
+	}
+	for _, d := range l.decisions {
+		if d.Policy == polIdx && d.Rule == ruleIdx {
+			return
+		}
+	}
+	l.decisions = append(l.decisions, Decision{
+		Policy:   polIdx,
+		Rule:     ruleIdx,
+		Action:   rule.Action,
+		Selector: rule.Selector,
+	})
+}
+
+func (e *Engine) newDecisionLog() *decisionLog {
+	if e.onDecision == nil {
+		return nil
+	}
+	return &decisionLog{}
+}
+
+func (e *Engine) report(ctx context.Context, l *decisionLog, fn func(*Decision)) {
+	if l == nil {
+		return
+	}
+	for _, d := range l.decisions {
+		fn(&d)
+		e.onDecision(ctx, d)
+	}
+}
@@ -14,6 +14,9 @@ var (
 	// ErrSourceDenied is returned by the policy engine when a source is denied by the policy.
 	ErrSourceDenied = errors.New("source denied by policy")
 
+	// ErrExecDenied is returned by the policy engine when an exec operation is denied by the policy.
+	ErrExecDenied = errors.New("exec denied by policy")
+
 	// ErrTooManyOps is returned by the policy engine when there are too many converts for a single source op.
 	ErrTooManyOps = errors.New("too many operations")
 )
@@ -25,15 +28,20 @@ var (
 // Rule matching is delegated to the `Matcher` interface.
 // Mutations are delegated to the `Mutater` interface.
 type Engine struct {
-	pol     []*spb.Policy
-	sources map[string]*selectorCache
+	pol        []*spb.Policy
+	sources    map[string]*selectorCache
+	onDecision DecisionHandler
 }
 
 // NewEngine creates a new source policy engine.
-func NewEngine(pol []*spb.Policy) *Engine {
-	return &Engine{
+func NewEngine(pol []*spb.Policy, opts ...EngineOpt) *Engine {
+	e := &Engine{
 		pol: pol,
 	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
 }
 
 // TODO: The key here can't be used to cache attr constraint regexes.
@@ -69,6 +77,15 @@ func (e *Engine) Evaluate(ctx context.Context, op *pb.SourceOp) (bool, error) {
 	var mutated bool
 	const maxIterr = 20
 
+	log := e.newDecisionLog()
+	orig := op.GetIdentifier()
+	defer e.report(ctx, log, func(d *Decision) {
+		d.Identifier = orig
+		if updated := op.GetIdentifier(); updated != orig {
+			d.Updated = updated
+		}
+	})
+
 	for i := 0; ; i++ {
 		if i > maxIterr {
 			return mutated, errors.Wrapf(ErrTooManyOps, "too many mutations on a single source")
@@ -81,7 +98,7 @@ func (e *Engine) Evaluate(ctx context.Context, op *pb.SourceOp) (bool, error) {
 			ctx = bklog.WithLogger(ctx, bklog.G(ctx).WithField("updated", op))
 		}
 
-		mut, err := e.evaluatePolicies(ctx, op)
+		mut, err := e.evaluatePolicies(ctx, op, log)
 		if mut {
 			mutated = true
 		}
@@ -96,9 +113,11 @@ func (e *Engine) Evaluate(ctx context.Context, op *pb.SourceOp) (bool, error) {
 	return mutated, nil
 }
 
-func (e *Engine) evaluatePolicies(ctx context.Context, srcOp *pb.SourceOp) (bool, error) {
-	for _, pol := range e.pol {
-		mut, err := e.evaluatePolicy(ctx, pol, srcOp)
+func (e *Engine) evaluatePolicies(ctx context.Context, srcOp *pb.SourceOp, log *decisionLog) (bool, error) {
+	for i, pol := range e.pol {
+		mut, err := e.evaluatePolicy(ctx, pol, srcOp, func(ruleIdx int, rule *spb.Rule) {
+			log.record(i, ruleIdx, rule)
+		})
 		if mut || err != nil {
 			return mut, err
 		}
@@ -112,7 +131,8 @@ func (e *Engine) evaluatePolicies(ctx context.Context, srcOp *pb.SourceOp) (bool
 //
 // For Allow/Deny rules, the last matching rule wins.
 // E.g. `ALLOW foo; DENY foo` will deny `foo`, `DENY foo; ALLOW foo` will allow `foo`.
-func (e *Engine) evaluatePolicy(ctx context.Context, pol *spb.Policy, srcOp *pb.SourceOp) (retMut bool, retErr error) {
+// Audit and pin rules don't change the result, every match is passed to `record`.
+func (e *Engine) evaluatePolicy(ctx context.Context, pol *spb.Policy, srcOp *pb.SourceOp, record func(int, *spb.Rule)) (retMut bool, retErr error) {
 	ident := srcOp.GetIdentifier()
 
 	ctx = bklog.WithLogger(ctx, bklog.G(ctx).WithField("ref", ident))
@@ -128,7 +148,10 @@ func (e *Engine) evaluatePolicy(ctx context.Context, pol *spb.Policy, srcOp *pb.
 	}()
 
 	var deny bool
-	for _, rule := range pol.Rules {
+	for i, rule := range pol.Rules {
+		if rule.Selector.GetExec() != nil {
+			continue
+		}
 		selector := e.selectorCache(rule.Selector)
 		matched, err := match(selector, ident, srcOp.Attrs)
 		if err != nil {
@@ -137,12 +160,14 @@ func (e *Engine) evaluatePolicy(ctx context.Context, pol *spb.Policy, srcOp *pb.
 		if !matched {
 			continue
 		}
+		record(i, rule)
 
 		switch rule.Action {
 		case spb.PolicyAction_ALLOW:
 			deny = false
 		case spb.PolicyAction_DENY:
 			deny = true
+		case spb.PolicyAction_AUDIT, spb.PolicyAction_PIN:
 		case spb.PolicyAction_CONVERT:
 			mut, err := mutate(ctx, srcOp, rule, selector, ident)
 			if err != nil || mut {
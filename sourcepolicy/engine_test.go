@@ -451,3 +451,101 @@ func testDenyAll(t *testing.T) {
 		})
 	}
 }
+
+func TestEngineAudit(t *testing.T) {
+	pol := []*spb.Policy{
+		{
+			Rules: []*spb.Rule{
+				{
+					Action: spb.PolicyAction_AUDIT,
+					Selector: &spb.Selector{
+						Identifier: "docker-image://docker.io/library/busybox:*",
+					},
+				},
+				{
+					Action: spb.PolicyAction_CONVERT,
+					Selector: &spb.Selector{
+						Identifier: "docker-image://docker.io/library/busybox:latest",
+					},
+					Updates: &spb.Update{
+						Identifier: "docker-image://docker.io/library/busybox:1.36",
+					},
+				},
+				{
+					Action: spb.PolicyAction_AUDIT,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{Network: "host"},
+					},
+				},
+			},
+		},
+	}
+
+	var decisions []Decision
+	e := NewEngine(pol, WithDecisionHandler(func(_ context.Context, d Decision) {
+		decisions = append(decisions, d)
+	}))
+	ctx := context.Background()
+
+	op := &pb.SourceOp{Identifier: "docker-image://docker.io/library/busybox:latest"}
+	mutated, err := e.Evaluate(ctx, op)
+	require.NoError(t, err)
+	require.True(t, mutated)
+	require.Len(t, decisions, 2)
+	require.Equal(t, 0, decisions[0].Rule)
+	require.Equal(t, spb.PolicyAction_AUDIT, decisions[0].Action)
+	require.Equal(t, "docker-image://docker.io/library/busybox:latest", decisions[0].Identifier)
+	require.Equal(t, "docker-image://docker.io/library/busybox:1.36", decisions[0].Updated)
+	require.Equal(t, 1, decisions[1].Rule)
+	require.Equal(t, spb.PolicyAction_CONVERT, decisions[1].Action)
+
+	// audit rules don't change the result
+	decisions = nil
+	mutated, err = e.Evaluate(ctx, &pb.SourceOp{Identifier: "docker-image://docker.io/library/busybox:1.35"})
+	require.NoError(t, err)
+	require.False(t, mutated)
+	require.Len(t, decisions, 1)
+	require.Empty(t, decisions[0].Updated)
+
+	decisions = nil
+	err = e.EvaluateExec(ctx, &pb.ExecOp{Meta: &pb.Meta{Args: []string{"curl", "localhost"}}, Network: pb.NetMode_HOST})
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	require.Equal(t, 2, decisions[0].Rule)
+	require.Equal(t, []string{"curl", "localhost"}, decisions[0].Args)
+	require.Equal(t, `exec "curl localhost" matched AUDIT rule 2 of policy 0`, decisions[0].String())
+}
+
+func TestEnginePin(t *testing.T) {
+	pol := []*spb.Policy{
+		{
+			Rules: []*spb.Rule{
+				{
+					Action: spb.PolicyAction_PIN,
+					Selector: &spb.Selector{
+						Identifier: "docker-image://docker.io/library/*",
+					},
+				},
+			},
+		},
+	}
+
+	var decisions []Decision
+	e := NewEngine(pol, WithDecisionHandler(func(_ context.Context, d Decision) {
+		decisions = append(decisions, d)
+	}))
+
+	op := &pb.SourceOp{Identifier: "docker-image://docker.io/library/busybox:latest"}
+	mutated, err := e.Evaluate(context.Background(), op)
+	require.NoError(t, err)
+	require.False(t, mutated)
+	require.Equal(t, "docker-image://docker.io/library/busybox:latest", op.Identifier)
+	require.Len(t, decisions, 1)
+	require.Equal(t, spb.PolicyAction_PIN, decisions[0].Action)
+
+	err = NewEngine([]*spb.Policy{{Rules: []*spb.Rule{{
+		Action:   spb.PolicyAction_PIN,
+		Selector: &spb.Selector{Exec: &spb.ExecSelector{}},
+	}}}}).EvaluateExec(context.Background(), &pb.ExecOp{Meta: &pb.Meta{}})
+	require.ErrorContains(t, err, "not supported for exec selectors")
+}
@@ -0,0 +1,191 @@
+package sourcepolicy
+
+import (
+	"context"
+	"strings"
+
+	"github.com/moby/buildkit/solver/pb"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+	"github.com/moby/buildkit/util/bklog"
+	"github.com/moby/buildkit/util/wildcard"
+	"github.com/pkg/errors"
+)
+
+// EvaluateExec evaluates an exec operation against the rules of the policy
+// that have an exec selector.
+//
+// For Allow/Deny rules, the last matching rule wins. Audit rules only record
+// the match.
+// An error is returned when the exec is denied by the policy.
+func (e *Engine) EvaluateExec(ctx context.Context, op *pb.ExecOp) error {
+	if len(e.pol) == 0 || op == nil {
+		return nil
+	}
+	log := e.newDecisionLog()
+	defer e.report(ctx, log, func(d *Decision) {
+		d.Args = op.GetMeta().GetArgs()
+	})
+	for i, pol := range e.pol {
+		if err := evaluateExecPolicy(ctx, pol, op, func(ruleIdx int, rule *spb.Rule) {
+			log.record(i, ruleIdx, rule)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func evaluateExecPolicy(ctx context.Context, pol *spb.Policy, op *pb.ExecOp, record func(int, *spb.Rule)) error {
+	var deny *spb.ExecSelector
+	for i, rule := range pol.Rules {
+		sel := rule.Selector.GetExec()
+		if sel == nil {
+			continue
+		}
+		matched, err := matchExec(sel, op)
+		if err != nil {
+			return errors.Wrap(err, "error matching source policy")
+		}
+		if !matched {
+			continue
+		}
+		record(i, rule)
+
+		switch rule.Action {
+		case spb.PolicyAction_ALLOW:
+			deny = nil
+		case spb.PolicyAction_DENY:
+			deny = sel
+		case spb.PolicyAction_AUDIT:
+		default:
+			return errors.Errorf("source policy: rule %s: action is not supported for exec selectors", rule.Action)
+		}
+	}
+
+	if deny != nil {
+		err := errors.Wrapf(ErrExecDenied, "exec %q denied by policy: %s", strings.Join(op.GetMeta().GetArgs(), " "), describeExecSelector(deny))
+		bklog.G(ctx).WithError(err).Debug("Evaluated source policy")
+		return err
+	}
+	return nil
+}
+
+func matchExec(sel *spb.ExecSelector, op *pb.ExecOp) (bool, error) {
+	if sel.Network != "" {
+		mode, err := netMode(sel.Network)
+		if err != nil {
+			return false, err
+		}
+		if op.Network != mode {
+			return false, nil
+		}
+	}
+	if sel.Security != "" {
+		mode, err := securityMode(sel.Security)
+		if err != nil {
+			return false, err
+		}
+		if op.Security != mode {
+			return false, nil
+		}
+	}
+	if sel.CacheId != "" {
+		w, err := wildcard.New(sel.CacheId)
+		if err != nil {
+			return false, err
+		}
+		var matched bool
+		for _, m := range op.Mounts {
+			if m.MountType != pb.MountType_CACHE || m.CacheOpt == nil {
+				continue
+			}
+			id := m.CacheOpt.ID
+			if id == "" {
+				id = m.Dest
+			}
+			if w.Match(id) != nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	if sel.CdiDevice != "" {
+		w, err := wildcard.New(sel.CdiDevice)
+		if err != nil {
+			return false, err
+		}
+		var matched bool
+		for _, d := range op.CdiDevices {
+			if w.Match(d.Name) != nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func netMode(v string) (pb.NetMode, error) {
+	switch v {
+	case "sandbox", "default":
+		return pb.NetMode_UNSET, nil
+	case "host":
+		return pb.NetMode_HOST, nil
+	case "none":
+		return pb.NetMode_NONE, nil
+	default:
+		return 0, errors.Errorf("invalid network mode %q", v)
+	}
+}
+
+func securityMode(v string) (pb.SecurityMode, error) {
+	switch v {
+	case "sandbox":
+		return pb.SecurityMode_SANDBOX, nil
+	case "insecure":
+		return pb.SecurityMode_INSECURE, nil
+	default:
+		return 0, errors.Errorf("invalid security mode %q", v)
+	}
+}
+
+// ValidateExecSelector checks that the values of the selector are valid.
+func ValidateExecSelector(sel *spb.ExecSelector) error {
+	if sel.Network != "" {
+		if _, err := netMode(sel.Network); err != nil {
+			return err
+		}
+	}
+	if sel.Security != "" {
+		if _, err := securityMode(sel.Security); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func describeExecSelector(sel *spb.ExecSelector) string {
+	var parts []string
+	if sel.Network != "" {
+		parts = append(parts, "network "+sel.Network)
+	}
+	if sel.Security != "" {
+		parts = append(parts, "security "+sel.Security)
+	}
+	if sel.CacheId != "" {
+		parts = append(parts, "cache mount "+sel.CacheId)
+	}
+	if sel.CdiDevice != "" {
+		parts = append(parts, "device "+sel.CdiDevice)
+	}
+	if len(parts) == 0 {
+		return "all execs are denied"
+	}
+	return strings.Join(parts, ", ")
+}
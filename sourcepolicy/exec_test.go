@@ -0,0 +1,125 @@
+package sourcepolicy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/buildkit/solver/pb"
+	spb "github.com/moby/buildkit/sourcepolicy/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineEvaluateExec(t *testing.T) {
+	pol := []*spb.Policy{
+		{
+			Rules: []*spb.Rule{
+				{
+					Action: spb.PolicyAction_DENY,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{Network: "host"},
+					},
+				},
+				{
+					Action: spb.PolicyAction_DENY,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{Security: "insecure"},
+					},
+				},
+				{
+					Action: spb.PolicyAction_DENY,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{CacheId: "secret-*"},
+					},
+				},
+				{
+					Action: spb.PolicyAction_ALLOW,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{CacheId: "secret-allowed"},
+					},
+				},
+				{
+					Action: spb.PolicyAction_DENY,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{CdiDevice: "nvidia.com/gpu=*"},
+					},
+				},
+			},
+		},
+	}
+	e := NewEngine(pol)
+	ctx := context.Background()
+
+	exec := func(fn func(*pb.ExecOp)) *pb.ExecOp {
+		op := &pb.ExecOp{Meta: &pb.Meta{Args: []string{"true"}}}
+		fn(op)
+		return op
+	}
+	cacheMount := func(id, dest string) *pb.Mount {
+		return &pb.Mount{Dest: dest, MountType: pb.MountType_CACHE, CacheOpt: &pb.CacheOpt{ID: id}}
+	}
+
+	require.NoError(t, e.EvaluateExec(ctx, exec(func(*pb.ExecOp) {})))
+
+	err := e.EvaluateExec(ctx, exec(func(op *pb.ExecOp) { op.Network = pb.NetMode_HOST }))
+	require.ErrorIs(t, err, ErrExecDenied)
+	require.ErrorContains(t, err, "network host")
+	require.NoError(t, e.EvaluateExec(ctx, exec(func(op *pb.ExecOp) { op.Network = pb.NetMode_NONE })))
+
+	err = e.EvaluateExec(ctx, exec(func(op *pb.ExecOp) { op.Security = pb.SecurityMode_INSECURE }))
+	require.ErrorIs(t, err, ErrExecDenied)
+
+	err = e.EvaluateExec(ctx, exec(func(op *pb.ExecOp) {
+		op.Mounts = []*pb.Mount{cacheMount("go-build", "/root/.cache"), cacheMount("secret-keys", "/keys")}
+	}))
+	require.ErrorIs(t, err, ErrExecDenied)
+	require.NoError(t, e.EvaluateExec(ctx, exec(func(op *pb.ExecOp) {
+		op.Mounts = []*pb.Mount{cacheMount("secret-allowed", "/keys")}
+	})))
+	// the mount destination is the ID of cache mounts without one
+	err = e.EvaluateExec(ctx, exec(func(op *pb.ExecOp) {
+		op.Mounts = []*pb.Mount{cacheMount("", "secret-dir")}
+	}))
+	require.ErrorIs(t, err, ErrExecDenied)
+
+	err = e.EvaluateExec(ctx, exec(func(op *pb.ExecOp) {
+		op.CdiDevices = []*pb.CDIDevice{{Name: "nvidia.com/gpu=all"}}
+	}))
+	require.ErrorIs(t, err, ErrExecDenied)
+
+	// exec rules don't apply to sources
+	mut, err := e.Evaluate(ctx, &pb.SourceOp{Identifier: "docker-image://docker.io/library/busybox:latest"})
+	require.NoError(t, err)
+	require.False(t, mut)
+}
+
+func TestEngineEvaluateExecInvalid(t *testing.T) {
+	e := NewEngine([]*spb.Policy{
+		{
+			Rules: []*spb.Rule{
+				{
+					Action: spb.PolicyAction_DENY,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{Network: "bridge"},
+					},
+				},
+			},
+		},
+	})
+	err := e.EvaluateExec(context.Background(), &pb.ExecOp{Meta: &pb.Meta{}})
+	require.ErrorContains(t, err, "invalid network mode")
+
+	e = NewEngine([]*spb.Policy{
+		{
+			Rules: []*spb.Rule{
+				{
+					Action: spb.PolicyAction_CONVERT,
+					Selector: &spb.Selector{
+						Exec: &spb.ExecSelector{},
+					},
+				},
+			},
+		},
+	})
+	err = e.EvaluateExec(context.Background(), &pb.ExecOp{Meta: &pb.Meta{}})
+	require.ErrorContains(t, err, "not supported for exec selectors")
+}
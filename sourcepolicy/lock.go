@@ -0,0 +1,8 @@
+package sourcepolicy
+
+// LockResponseKey is the key of the exporter response that contains the
+// lockfile of the sources matched by PIN rules. The value is a base64 encoded
+// JSON policy with a CONVERT rule for each source that replaces it with the
+// immutable form resolved by the build. Using the lockfile as the source
+// policy of a later build reproduces the same inputs.
+const LockResponseKey = "sourcepolicy.lock"
@@ -28,6 +28,13 @@ const (
 	PolicyAction_ALLOW   PolicyAction = 0
 	PolicyAction_DENY    PolicyAction = 1
 	PolicyAction_CONVERT PolicyAction = 2
+	// AUDIT records the match as a build warning without changing the result
+	// of the evaluation. It can be used to test a rule before enforcing it.
+	PolicyAction_AUDIT PolicyAction = 3
+	// PIN records the immutable form of the matched source that was resolved
+	// by the build, e.g. the digest of an image, the commit of a git ref or the
+	// checksum of an HTTP source, in the source policy lockfile of the build.
+	PolicyAction_PIN PolicyAction = 4
 )
 
 // Enum value maps for PolicyAction.
@@ -36,11 +43,15 @@ var (
 		0: "ALLOW",
 		1: "DENY",
 		2: "CONVERT",
+		3: "AUDIT",
+		4: "PIN",
 	}
 	PolicyAction_value = map[string]int32{
 		"ALLOW":   0,
 		"DENY":    1,
 		"CONVERT": 2,
+		"AUDIT":   3,
+		"PIN":     4,
 	}
 )
 
@@ -296,8 +307,11 @@ type Selector struct {
 	state      protoimpl.MessageState `protogen:"open.v1"`
 	Identifier string                 `protobuf:"bytes,1,opt,name=identifier,proto3" json:"identifier,omitempty"`
 	// MatchType is the type of match to perform on the source identifier
-	MatchType     MatchType         `protobuf:"varint,2,opt,name=match_type,json=matchType,proto3,enum=moby.buildkit.v1.sourcepolicy.MatchType" json:"match_type,omitempty"`
-	Constraints   []*AttrConstraint `protobuf:"bytes,3,rep,name=constraints,proto3" json:"constraints,omitempty"`
+	MatchType   MatchType         `protobuf:"varint,2,opt,name=match_type,json=matchType,proto3,enum=moby.buildkit.v1.sourcepolicy.MatchType" json:"match_type,omitempty"`
+	Constraints []*AttrConstraint `protobuf:"bytes,3,rep,name=constraints,proto3" json:"constraints,omitempty"`
+	// Exec matches exec operations instead of sources. The identifier and the
+	// constraints are ignored if it is set.
+	Exec          *ExecSelector `protobuf:"bytes,4,opt,name=exec,proto3" json:"exec,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -353,6 +367,13 @@ func (x *Selector) GetConstraints() []*AttrConstraint {
 	return nil
 }
 
+func (x *Selector) GetExec() *ExecSelector {
+	if x != nil {
+		return x.Exec
+	}
+	return nil
+}
+
 // AttrConstraint defines a constraint on a source attribute
 type AttrConstraint struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -467,6 +488,82 @@ func (x *Policy) GetRules() []*Rule {
 	return nil
 }
 
+// ExecSelector matches exec operations by their properties. Fields that are
+// empty match any value. Rules with an exec selector only support the ALLOW,
+// DENY and AUDIT actions.
+type ExecSelector struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// network is the network mode: "sandbox", "host" or "none"
+	Network string `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
+	// security is the security mode: "sandbox" or "insecure"
+	Security string `protobuf:"bytes,2,opt,name=security,proto3" json:"security,omitempty"`
+	// cache_id matches the ID of any cache mount. Wildcards are supported.
+	CacheId string `protobuf:"bytes,3,opt,name=cache_id,json=cacheId,proto3" json:"cache_id,omitempty"`
+	// cdi_device matches the name of any requested CDI device. Wildcards are
+	// supported.
+	CdiDevice     string `protobuf:"bytes,4,opt,name=cdi_device,json=cdiDevice,proto3" json:"cdi_device,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecSelector) Reset() {
+	*x = ExecSelector{}
+	mi := &file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecSelector) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecSelector) ProtoMessage() {}
+
+func (x *ExecSelector) ProtoReflect() protoreflect.Message {
+	mi := &file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecSelector.ProtoReflect.Descriptor instead.
+func (*ExecSelector) Descriptor() ([]byte, []int) {
+	return file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ExecSelector) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *ExecSelector) GetSecurity() string {
+	if x != nil {
+		return x.Security
+	}
+	return ""
+}
+
+func (x *ExecSelector) GetCacheId() string {
+	if x != nil {
+		return x.CacheId
+	}
+	return ""
+}
+
+func (x *ExecSelector) GetCdiDevice() string {
+	if x != nil {
+		return x.CdiDevice
+	}
+	return ""
+}
+
 var File_github_com_moby_buildkit_sourcepolicy_pb_policy_proto protoreflect.FileDescriptor
 
 const file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_rawDesc = "" +
@@ -484,25 +581,34 @@ const file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_rawDesc = "" +
 	"\n" +
 	"AttrsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xc4\x01\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x85\x02\n" +
 	"\bSelector\x12\x1e\n" +
 	"\n" +
 	"identifier\x18\x01 \x01(\tR\n" +
 	"identifier\x12G\n" +
 	"\n" +
 	"match_type\x18\x02 \x01(\x0e2(.moby.buildkit.v1.sourcepolicy.MatchTypeR\tmatchType\x12O\n" +
-	"\vconstraints\x18\x03 \x03(\v2-.moby.buildkit.v1.sourcepolicy.AttrConstraintR\vconstraints\"\x80\x01\n" +
+	"\vconstraints\x18\x03 \x03(\v2-.moby.buildkit.v1.sourcepolicy.AttrConstraintR\vconstraints\x12?\n" +
+	"\x04exec\x18\x04 \x01(\v2+.moby.buildkit.v1.sourcepolicy.ExecSelectorR\x04exec\"\x80\x01\n" +
 	"\x0eAttrConstraint\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
 	"\x05value\x18\x02 \x01(\tR\x05value\x12F\n" +
 	"\tcondition\x18\x03 \x01(\x0e2(.moby.buildkit.v1.sourcepolicy.AttrMatchR\tcondition\"]\n" +
 	"\x06Policy\x12\x18\n" +
 	"\aversion\x18\x01 \x01(\x03R\aversion\x129\n" +
-	"\x05rules\x18\x02 \x03(\v2#.moby.buildkit.v1.sourcepolicy.RuleR\x05rules*0\n" +
+	"\x05rules\x18\x02 \x03(\v2#.moby.buildkit.v1.sourcepolicy.RuleR\x05rules\"~\n" +
+	"\fExecSelector\x12\x18\n" +
+	"\anetwork\x18\x01 \x01(\tR\anetwork\x12\x1a\n" +
+	"\bsecurity\x18\x02 \x01(\tR\bsecurity\x12\x19\n" +
+	"\bcache_id\x18\x03 \x01(\tR\acacheId\x12\x1d\n" +
+	"\n" +
+	"cdi_device\x18\x04 \x01(\tR\tcdiDevice*D\n" +
 	"\fPolicyAction\x12\t\n" +
 	"\x05ALLOW\x10\x00\x12\b\n" +
 	"\x04DENY\x10\x01\x12\v\n" +
-	"\aCONVERT\x10\x02*1\n" +
+	"\aCONVERT\x10\x02\x12\t\n" +
+	"\x05AUDIT\x10\x03\x12\a\n" +
+	"\x03PIN\x10\x04*1\n" +
 	"\tAttrMatch\x12\t\n" +
 	"\x05EQUAL\x10\x00\x12\f\n" +
 	"\bNOTEQUAL\x10\x01\x12\v\n" +
@@ -525,7 +631,7 @@ func file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_rawDescGZIP() []
 }
 
 var file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-var file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_goTypes = []any{
 	(PolicyAction)(0),      // 0: moby.buildkit.v1.sourcepolicy.PolicyAction
 	(AttrMatch)(0),         // 1: moby.buildkit.v1.sourcepolicy.AttrMatch
@@ -535,22 +641,24 @@ var file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_goTypes = []any{
 	(*Selector)(nil),       // 5: moby.buildkit.v1.sourcepolicy.Selector
 	(*AttrConstraint)(nil), // 6: moby.buildkit.v1.sourcepolicy.AttrConstraint
 	(*Policy)(nil),         // 7: moby.buildkit.v1.sourcepolicy.Policy
-	nil,                    // 8: moby.buildkit.v1.sourcepolicy.Update.AttrsEntry
+	(*ExecSelector)(nil),   // 8: moby.buildkit.v1.sourcepolicy.ExecSelector
+	nil,                    // 9: moby.buildkit.v1.sourcepolicy.Update.AttrsEntry
 }
 var file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_depIdxs = []int32{
 	0, // 0: moby.buildkit.v1.sourcepolicy.Rule.action:type_name -> moby.buildkit.v1.sourcepolicy.PolicyAction
 	5, // 1: moby.buildkit.v1.sourcepolicy.Rule.selector:type_name -> moby.buildkit.v1.sourcepolicy.Selector
 	4, // 2: moby.buildkit.v1.sourcepolicy.Rule.updates:type_name -> moby.buildkit.v1.sourcepolicy.Update
-	8, // 3: moby.buildkit.v1.sourcepolicy.Update.attrs:type_name -> moby.buildkit.v1.sourcepolicy.Update.AttrsEntry
+	9, // 3: moby.buildkit.v1.sourcepolicy.Update.attrs:type_name -> moby.buildkit.v1.sourcepolicy.Update.AttrsEntry
 	2, // 4: moby.buildkit.v1.sourcepolicy.Selector.match_type:type_name -> moby.buildkit.v1.sourcepolicy.MatchType
 	6, // 5: moby.buildkit.v1.sourcepolicy.Selector.constraints:type_name -> moby.buildkit.v1.sourcepolicy.AttrConstraint
-	1, // 6: moby.buildkit.v1.sourcepolicy.AttrConstraint.condition:type_name -> moby.buildkit.v1.sourcepolicy.AttrMatch
-	3, // 7: moby.buildkit.v1.sourcepolicy.Policy.rules:type_name -> moby.buildkit.v1.sourcepolicy.Rule
-	8, // [8:8] is the sub-list for method output_type
-	8, // [8:8] is the sub-list for method input_type
-	8, // [8:8] is the sub-list for extension type_name
-	8, // [8:8] is the sub-list for extension extendee
-	0, // [0:8] is the sub-list for field type_name
+	8, // 6: moby.buildkit.v1.sourcepolicy.Selector.exec:type_name -> moby.buildkit.v1.sourcepolicy.ExecSelector
+	1, // 7: moby.buildkit.v1.sourcepolicy.AttrConstraint.condition:type_name -> moby.buildkit.v1.sourcepolicy.AttrMatch
+	3, // 8: moby.buildkit.v1.sourcepolicy.Policy.rules:type_name -> moby.buildkit.v1.sourcepolicy.Rule
+	9, // [9:9] is the sub-list for method output_type
+	9, // [9:9] is the sub-list for method input_type
+	9, // [9:9] is the sub-list for extension type_name
+	9, // [9:9] is the sub-list for extension extendee
+	0, // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_init() }
@@ -564,7 +672,7 @@ func file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_rawDesc), len(file_github_com_moby_buildkit_sourcepolicy_pb_policy_proto_rawDesc)),
 			NumEnums:      3,
-			NumMessages:   6,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -28,10 +28,14 @@ func (c zstdType) NeedsConversion(ctx context.Context, cs content.Store, desc oc
 	if err != nil {
 		return false, err
 	}
-	if ct == Zstd {
-		return false, nil
+	if ct != Zstd {
+		return true, nil
+	}
+	chunked, err := ZstdChunked.Is(ctx, cs, desc.Digest)
+	if err != nil {
+		return false, err
 	}
-	return true, nil
+	return chunked, nil
 }
 
 func (c zstdType) NeedsComputeDiffBySelf(comp Config) bool {
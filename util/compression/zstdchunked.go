@@ -0,0 +1,208 @@
+package compression
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"sync"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/pkg/labels"
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/containerd/stargz-snapshotter/estargz/zstdchunked"
+	"github.com/klauspost/compress/zstd"
+	"github.com/moby/buildkit/util/iohelper"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+var ZstdChunkedAnnotations = []string{zstdchunked.ManifestChecksumAnnotation, zstdchunked.ManifestPositionAnnotation}
+
+const zstdChunkedLabel = "buildkit.io/compression/zstd-chunked"
+
+func (c zstdChunkedType) Compress(ctx context.Context, comp Config) (compressorFunc Compressor, finalize Finalizer) {
+	var cInfo *compressionInfo
+	var metadata map[string]string
+	var writeErr error
+	var mu sync.Mutex
+	return func(dest io.Writer, requiredMediaType string) (io.WriteCloser, error) {
+			ct, err := FromMediaType(requiredMediaType)
+			if err != nil {
+				return nil, err
+			}
+			if ct != Zstd {
+				return nil, errors.Errorf("unsupported media type for zstd:chunked compressor %q", requiredMediaType)
+			}
+			done := make(chan struct{})
+			pr, pw := io.Pipe()
+			go func() (retErr error) {
+				defer close(done)
+				defer func() {
+					if retErr != nil {
+						mu.Lock()
+						writeErr = retErr
+						mu.Unlock()
+					}
+				}()
+
+				blobInfoW, bInfoCh := calculateBlobInfo()
+				defer blobInfoW.Close()
+				level := zstd.SpeedDefault
+				if comp.Level != nil {
+					level = toZstdEncoderLevel(*comp.Level)
+				}
+				zc := &zstdchunked.Compressor{
+					CompressionLevel: level,
+					Metadata:         map[string]string{},
+				}
+				w := estargz.NewWriterWithCompressor(io.MultiWriter(dest, blobInfoW), zc)
+
+				// The TOC is stored in a skippable frame, so the blob
+				// decompresses to the original tar with any zstd reader.
+				if err := w.AppendTarLossLess(pr); err != nil {
+					pr.CloseWithError(err)
+					return err
+				}
+				tocDgst, err := w.Close()
+				if err != nil {
+					pr.CloseWithError(err)
+					return err
+				}
+				if err := blobInfoW.Close(); err != nil {
+					pr.CloseWithError(err)
+					return err
+				}
+				bInfo := <-bInfoCh
+				mu.Lock()
+				cInfo = &compressionInfo{bInfo, tocDgst}
+				metadata = zc.Metadata
+				mu.Unlock()
+				pr.Close()
+				return nil
+			}()
+			return &iohelper.WriteCloser{WriteCloser: pw, CloseFunc: func() error {
+				<-done // wait until the write completes
+				return nil
+			}}, nil
+		}, func(ctx context.Context, cs content.Store) (map[string]string, error) {
+			mu.Lock()
+			cInfo, metadata, writeErr := cInfo, metadata, writeErr
+			mu.Unlock()
+			if cInfo == nil {
+				if writeErr != nil {
+					return nil, errors.Wrapf(writeErr, "cannot finalize due to write error")
+				}
+				return nil, errors.Errorf("cannot finalize (reason unknown)")
+			}
+
+			// Fill necessary labels
+			info, err := cs.Info(ctx, cInfo.compressedDigest)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to get info from content store")
+			}
+			if info.Labels == nil {
+				info.Labels = make(map[string]string)
+			}
+			info.Labels[labels.LabelUncompressed] = cInfo.uncompressedDigest.String()
+			info.Labels[zstdChunkedLabel] = "true"
+			if _, err := cs.Update(ctx, info, "labels."+labels.LabelUncompressed, "labels."+zstdChunkedLabel); err != nil {
+				return nil, err
+			}
+
+			// Fill annotations
+			a := maps.Clone(metadata)
+			a[estargz.TOCJSONDigestAnnotation] = cInfo.tocDigest.String()
+			a[estargz.StoreUncompressedSizeAnnotation] = fmt.Sprintf("%d", cInfo.uncompressedSize)
+			a[labels.LabelUncompressed] = cInfo.uncompressedDigest.String()
+			return a, nil
+		}
+}
+
+func (c zstdChunkedType) Decompress(ctx context.Context, cs content.Store, desc ocispecs.Descriptor) (io.ReadCloser, error) {
+	return decompress(ctx, cs, desc)
+}
+
+func (c zstdChunkedType) NeedsConversion(ctx context.Context, cs content.Store, desc ocispecs.Descriptor) (bool, error) {
+	if !images.IsLayerType(desc.MediaType) {
+		return false, nil
+	}
+	ct, err := FromMediaType(desc.MediaType)
+	if err != nil {
+		return false, err
+	}
+	if ct != Zstd {
+		return true, nil
+	}
+	chunked, err := c.Is(ctx, cs, desc.Digest)
+	if err != nil {
+		return false, err
+	}
+	return !chunked, nil
+}
+
+func (c zstdChunkedType) NeedsComputeDiffBySelf(comp Config) bool {
+	return true
+}
+
+func (c zstdChunkedType) OnlySupportOCITypes() bool {
+	return true
+}
+
+func (c zstdChunkedType) MediaType() string {
+	return ocispecs.MediaTypeImageLayerZstd
+}
+
+func (c zstdChunkedType) String() string {
+	return "zstd:chunked"
+}
+
+// Is returns true when the specified digest of content exists in the
+// content store and it's zstd:chunked.
+func (c zstdChunkedType) Is(ctx context.Context, cs content.Store, dgst digest.Digest) (bool, error) {
+	info, err := cs.Info(ctx, dgst)
+	if err != nil {
+		return false, nil
+	}
+	if isChunkedStr, ok := info.Labels[zstdChunkedLabel]; ok {
+		if isChunked, err := strconv.ParseBool(isChunkedStr); err == nil {
+			return isChunked, nil
+		}
+	}
+
+	res := func() bool {
+		r, err := cs.ReaderAt(ctx, ocispecs.Descriptor{Digest: dgst})
+		if err != nil {
+			return false
+		}
+		defer r.Close()
+
+		// Does this have the footer?
+		decompressor := new(zstdchunked.Decompressor)
+		footerSize := decompressor.FooterSize()
+		if r.Size() < footerSize {
+			return false
+		}
+		footer := make([]byte, footerSize)
+		if _, err := io.ReadFull(io.NewSectionReader(r, r.Size()-footerSize, footerSize), footer); err != nil {
+			return false
+		}
+		if _, _, _, err := decompressor.ParseFooter(footer); err != nil {
+			return false
+		}
+		return true
+	}()
+
+	if info.Labels == nil {
+		info.Labels = make(map[string]string)
+	}
+	info.Labels[zstdChunkedLabel] = strconv.FormatBool(res) // cache the result
+	if _, err := cs.Update(ctx, info, "labels."+zstdChunkedLabel); err != nil {
+		return false, err
+	}
+
+	return res, nil
+}
@@ -17,12 +17,14 @@ const (
 	EntitlementSecurityInsecure Entitlement = "security.insecure"
 	EntitlementNetworkHost      Entitlement = "network.host"
 	EntitlementDevice           Entitlement = "device"
+	EntitlementExporterCustom   Entitlement = "exporter.custom"
 )
 
 var all = map[Entitlement]struct{}{
 	EntitlementSecurityInsecure: {},
 	EntitlementNetworkHost:      {},
 	EntitlementDevice:           {},
+	EntitlementExporterCustom:   {},
 }
 
 type EntitlementsConfig interface {
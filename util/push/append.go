@@ -0,0 +1,130 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/distribution/reference"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/contentutil"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+const maxAppendManifestSize = 4 << 20
+
+// AppendLayers pushes the manifest dgst to the tag ref. If the tag already
+// points to a manifest, the layers of dgst are appended to the layers of the
+// existing manifest instead of replacing it. This is how cosign keeps all
+// signatures of an image in its signature tag.
+func AppendLayers(ctx context.Context, sm *session.Manager, sid string, store content.Store, dgst digest.Digest, ref string, insecure bool, hosts docker.RegistryHosts) error {
+	parsed, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return err
+	}
+	r := pushResolver(sm, sid, parsed, ref, insecure, hosts)
+	name, existingDesc, err := r.Resolve(ctx, ref)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return Push(ctx, sm, sid, store, store, dgst, ref, insecure, hosts, false, nil)
+		}
+		return err
+	}
+	if existingDesc.Digest == dgst {
+		return nil
+	}
+	if existingDesc.Size > maxAppendManifestSize {
+		return errors.Errorf("manifest %s is too large: %d bytes", ref, existingDesc.Size)
+	}
+	fetcher, err := r.Fetcher(ctx, name)
+	if err != nil {
+		return err
+	}
+	rc, err := fetcher.Fetch(ctx, existingDesc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	dt, err := io.ReadAll(io.LimitReader(rc, existingDesc.Size))
+	if err != nil {
+		return err
+	}
+	if existingDesc.Digest.Algorithm().FromBytes(dt) != existingDesc.Digest {
+		return errors.Errorf("digest mismatch for %s", ref)
+	}
+	var existing ocispecs.Manifest
+	if err := json.Unmarshal(dt, &existing); err != nil {
+		return errors.Wrapf(err, "invalid manifest %s", ref)
+	}
+
+	dt, err = content.ReadBlob(ctx, store, ocispecs.Descriptor{Digest: dgst})
+	if err != nil {
+		return err
+	}
+	var mfst ocispecs.Manifest
+	if err := json.Unmarshal(dt, &mfst); err != nil {
+		return errors.Wrapf(err, "failed to parse manifest %s", dgst)
+	}
+
+	merged, changed := appendLayers(existing, mfst)
+	if !changed {
+		return nil
+	}
+
+	// the blobs of the existing manifest are pushed again from the local store
+	provider := contentutil.FromFetcher(fetcher)
+	for _, desc := range append([]ocispecs.Descriptor{existing.Config}, existing.Layers...) {
+		if err := contentutil.Copy(ctx, store, provider, desc, name, nil); err != nil {
+			return errors.Wrapf(err, "failed to fetch %s from %s", desc.Digest, ref)
+		}
+	}
+
+	dt, err = json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal manifest")
+	}
+	desc := ocispecs.Descriptor{
+		MediaType: merged.MediaType,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	labels := map[string]string{}
+	for i, l := range append([]ocispecs.Descriptor{merged.Config}, merged.Layers...) {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i)] = l.Digest.String()
+	}
+	if err := content.WriteBlob(ctx, store, desc.Digest.String(), bytes.NewReader(dt), desc, content.WithLabels(labels)); err != nil {
+		return errors.Wrapf(err, "error writing manifest %s", desc.Digest)
+	}
+	return Push(ctx, sm, sid, store, store, desc.Digest, ref, insecure, hosts, false, nil)
+}
+
+// appendLayers returns the existing manifest with the layers of mfst that it
+// doesn't contain yet.
+func appendLayers(existing, mfst ocispecs.Manifest) (ocispecs.Manifest, bool) {
+	if existing.MediaType == "" {
+		existing.MediaType = ocispecs.MediaTypeImageManifest
+	}
+	layers := slices.Clone(existing.Layers)
+	for _, l := range mfst.Layers {
+		if slices.ContainsFunc(layers, func(e ocispecs.Descriptor) bool {
+			return e.Digest == l.Digest && maps.Equal(e.Annotations, l.Annotations)
+		}) {
+			continue
+		}
+		layers = append(layers, l)
+	}
+	if len(layers) == len(existing.Layers) {
+		return existing, false
+	}
+	existing.Layers = layers
+	return existing, true
+}
@@ -0,0 +1,141 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/plugins/content/local"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// testRegistry is an in-memory registry supporting the requests used for
+// pushing and resolving manifests.
+type testRegistry struct {
+	mu        sync.Mutex
+	blobs     map[digest.Digest][]byte
+	manifests map[string]digest.Digest
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	p := r.URL.Path
+	switch {
+	case p == "/v2/" || p == "/v2":
+		return
+	case strings.HasPrefix(p, "/v2/test/blobs/uploads/"):
+		if r.Method == http.MethodPost {
+			w.Header().Set("Location", "/v2/test/blobs/uploads/1")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		dt, _ := io.ReadAll(r.Body)
+		dgst := digest.Digest(r.URL.Query().Get("digest"))
+		reg.blobs[dgst] = dt
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+		return
+	case strings.HasPrefix(p, "/v2/test/manifests/") && r.Method == http.MethodPut:
+		dt, _ := io.ReadAll(r.Body)
+		dgst := digest.FromBytes(dt)
+		reg.blobs[dgst] = dt
+		reg.manifests[strings.TrimPrefix(p, "/v2/test/manifests/")] = dgst
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	var dgst digest.Digest
+	switch {
+	case strings.HasPrefix(p, "/v2/test/manifests/"):
+		ref := strings.TrimPrefix(p, "/v2/test/manifests/")
+		if d, ok := reg.manifests[ref]; ok {
+			dgst = d
+		} else {
+			dgst = digest.Digest(ref)
+		}
+		w.Header().Set("Content-Type", ocispecs.MediaTypeImageManifest)
+	case strings.HasPrefix(p, "/v2/test/blobs/"):
+		dgst = digest.Digest(strings.TrimPrefix(p, "/v2/test/blobs/"))
+	}
+	dt, ok := reg.blobs[dgst]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Docker-Content-Digest", dgst.String())
+	w.Header().Set("Content-Length", strconv.Itoa(len(dt)))
+	if r.Method != http.MethodHead {
+		w.Write(dt)
+	}
+}
+
+func TestAppendLayers(t *testing.T) {
+	ctx := context.TODO()
+	store, err := local.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	reg := &testRegistry{blobs: map[digest.Digest][]byte{}, manifests: map[string]digest.Digest{}}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	ref := strings.TrimPrefix(srv.URL, "http://") + "/test:sig"
+
+	writeManifest := func(sig string) digest.Digest {
+		layerDt := []byte("payload")
+		layer := ocispecs.Descriptor{
+			MediaType:   "application/vnd.dev.cosign.simplesigning.v1+json",
+			Digest:      digest.FromBytes(layerDt),
+			Size:        int64(len(layerDt)),
+			Annotations: map[string]string{"dev.cosignproject.cosign/signature": sig},
+		}
+		for _, b := range [][]byte{layerDt, ocispecs.DescriptorEmptyJSON.Data} {
+			require.NoError(t, content.WriteBlob(ctx, store, digest.FromBytes(b).String(), bytes.NewReader(b), ocispecs.Descriptor{Digest: digest.FromBytes(b), Size: int64(len(b))}))
+		}
+		dt, err := json.Marshal(ocispecs.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispecs.MediaTypeImageManifest,
+			Config:    ocispecs.DescriptorEmptyJSON,
+			Layers:    []ocispecs.Descriptor{layer},
+		})
+		require.NoError(t, err)
+		dgst := digest.FromBytes(dt)
+		require.NoError(t, content.WriteBlob(ctx, store, dgst.String(), bytes.NewReader(dt), ocispecs.Descriptor{Digest: dgst, Size: int64(len(dt))}))
+		return dgst
+	}
+
+	tagged := func() ocispecs.Manifest {
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+		var mfst ocispecs.Manifest
+		require.NoError(t, json.Unmarshal(reg.blobs[reg.manifests["sig"]], &mfst))
+		return mfst
+	}
+
+	first := writeManifest("sig1")
+	require.NoError(t, AppendLayers(ctx, nil, "", store, first, ref, true, nil))
+	require.Equal(t, first, reg.manifests["sig"])
+
+	// a second signature is appended to the first one
+	require.NoError(t, AppendLayers(ctx, nil, "", store, writeManifest("sig2"), ref, true, nil))
+	mfst := tagged()
+	require.Len(t, mfst.Layers, 2)
+	require.Equal(t, "sig1", mfst.Layers[0].Annotations["dev.cosignproject.cosign/signature"])
+	require.Equal(t, "sig2", mfst.Layers[1].Annotations["dev.cosignproject.cosign/signature"])
+
+	// existing signatures are not added again
+	require.NoError(t, AppendLayers(ctx, nil, "", store, first, ref, true, nil))
+	require.Len(t, tagged().Layers, 2)
+}
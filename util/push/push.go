@@ -30,6 +30,13 @@ import (
 	"github.com/pkg/errors"
 )
 
+// signature payloads pushed with the image signatures and signed attestations
+const (
+	mediaTypeCosignSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	mediaTypeJWS                 = "application/jose+json"
+	mediaTypeDSSEEnvelope        = "application/vnd.dsse.envelope.v1+json"
+)
+
 type pusher struct {
 	remotes.Pusher
 }
@@ -69,20 +76,7 @@ func Push(ctx context.Context, sm *session.Manager, sid string, provider content
 		ref = r.String()
 	}
 
-	scope := "push"
-	if insecure {
-		insecureTrue := true
-		httpTrue := true
-		hosts = resolver.NewRegistryConfig(map[string]resolverconfig.RegistryConfig{
-			reference.Domain(parsed): {
-				Insecure:  &insecureTrue,
-				PlainHTTP: &httpTrue,
-			},
-		})
-		scope += ":insecure"
-	}
-
-	resolver := resolver.DefaultPool.GetResolver(hosts, ref, scope, sm, session.NewGroup(sid))
+	resolver := pushResolver(sm, sid, parsed, ref, insecure, hosts)
 
 	pusher, err := Pusher(ctx, resolver, ref)
 	if err != nil {
@@ -146,6 +140,22 @@ func Push(ctx context.Context, sm *session.Manager, sid string, provider content
 	return mfstDone(nil)
 }
 
+func pushResolver(sm *session.Manager, sid string, parsed reference.Named, ref string, insecure bool, hosts docker.RegistryHosts) *resolver.Resolver {
+	scope := "push"
+	if insecure {
+		insecureTrue := true
+		httpTrue := true
+		hosts = resolver.NewRegistryConfig(map[string]resolverconfig.RegistryConfig{
+			reference.Domain(parsed): {
+				Insecure:  &insecureTrue,
+				PlainHTTP: &httpTrue,
+			},
+		})
+		scope += ":insecure"
+	}
+	return resolver.DefaultPool.GetResolver(hosts, ref, scope, sm, session.NewGroup(sid))
+}
+
 // TODO: the containerd function for this is filtering too much, that needs to be fixed.
 // For now we just carry this.
 func skipNonDistributableBlobs(f images.HandlerFunc) images.HandlerFunc {
@@ -251,7 +261,8 @@ func childrenHandler(provider content.Provider) images.HandlerFunc {
 		case images.MediaTypeDockerSchema2Layer, images.MediaTypeDockerSchema2LayerGzip,
 			images.MediaTypeDockerSchema2Config, ocispecs.MediaTypeImageConfig,
 			ocispecs.MediaTypeImageLayer, ocispecs.MediaTypeImageLayerGzip,
-			intoto.PayloadType:
+			intoto.PayloadType, ocispecs.MediaTypeEmptyJSON,
+			mediaTypeCosignSimpleSigning, mediaTypeJWS, mediaTypeDSSEEnvelope:
 			// childless data types.
 			return nil, nil
 		default:
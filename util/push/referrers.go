@@ -0,0 +1,129 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/distribution/reference"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/util/progress"
+	"github.com/moby/buildkit/util/resolver"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// PushReferrers pushes manifests that refer to other manifests with their
+// subject field to the repository of ref. For registries without the OCI
+// referrers API, the referrers are also added to the index in the referrers
+// tag of their subject.
+func PushReferrers(ctx context.Context, sm *session.Manager, sid string, store content.Store, referrers []ocispecs.Descriptor, ref string, insecure bool, hosts docker.RegistryHosts) error {
+	parsed, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return err
+	}
+	repo := parsed.Name()
+
+	var subjects []digest.Digest
+	bySubject := map[digest.Digest][]ocispecs.Descriptor{}
+	for _, desc := range referrers {
+		dt, err := content.ReadBlob(ctx, store, desc)
+		if err != nil {
+			return err
+		}
+		var mfst ocispecs.Manifest
+		if err := json.Unmarshal(dt, &mfst); err != nil {
+			return errors.Wrapf(err, "failed to parse referrer %s", desc.Digest)
+		}
+		if mfst.Subject == nil {
+			return errors.Errorf("referrer %s has no subject", desc.Digest)
+		}
+		if err := Push(ctx, sm, sid, store, store, desc.Digest, repo, insecure, hosts, true, nil); err != nil {
+			return err
+		}
+
+		artifactType := mfst.ArtifactType
+		if artifactType == "" {
+			artifactType = mfst.Config.MediaType
+		}
+		subject := mfst.Subject.Digest
+		if _, ok := bySubject[subject]; !ok {
+			subjects = append(subjects, subject)
+		}
+		bySubject[subject] = append(bySubject[subject], ocispecs.Descriptor{
+			MediaType:    mfst.MediaType,
+			ArtifactType: artifactType,
+			Digest:       desc.Digest,
+			Size:         desc.Size,
+			Annotations:  mfst.Annotations,
+		})
+	}
+
+	r := pushResolver(sm, sid, parsed, repo, insecure, hosts)
+	for _, subject := range subjects {
+		if _, err := r.ReferrersAPI(ctx, repo, subject); err == nil {
+			continue
+		} else if !errors.Is(err, resolver.ErrNoReferrersAPI) {
+			return err
+		}
+		if err := pushReferrersTag(ctx, r, store, repo, subject, bySubject[subject]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushReferrersTag adds the referrers to the index in the referrers tag of
+// the subject.
+func pushReferrersTag(ctx context.Context, r *resolver.Resolver, store content.Store, repo string, subject digest.Digest, referrers []ocispecs.Descriptor) error {
+	idx, err := r.ReferrersTagIndex(ctx, repo, subject)
+	if err != nil {
+		return err
+	}
+	if idx == nil {
+		idx = &ocispecs.Index{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			MediaType: ocispecs.MediaTypeImageIndex,
+		}
+	}
+	changed := false
+	for _, desc := range referrers {
+		if slices.ContainsFunc(idx.Manifests, func(d ocispecs.Descriptor) bool { return d.Digest == desc.Digest }) {
+			continue
+		}
+		idx.Manifests = append(idx.Manifests, desc)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	dt, err := json.Marshal(idx)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal referrers index")
+	}
+	desc := ocispecs.Descriptor{
+		MediaType: ocispecs.MediaTypeImageIndex,
+		Digest:    digest.FromBytes(dt),
+		Size:      int64(len(dt)),
+	}
+	if err := content.WriteBlob(ctx, store, desc.Digest.String(), bytes.NewReader(dt), desc); err != nil {
+		return errors.Wrapf(err, "error writing referrers index %s", desc.Digest)
+	}
+
+	tagRef := repo + ":" + resolver.ReferrersTag(subject)
+	done := progress.OneOff(ctx, fmt.Sprintf("pushing referrers index for %s", tagRef))
+	pusher, err := Pusher(ctx, r, tagRef)
+	if err != nil {
+		return done(err)
+	}
+	_, err = remotes.PushHandler(pusher, store)(ctx, desc)
+	return done(err)
+}
@@ -0,0 +1,186 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	cerrdefs "github.com/containerd/errdefs"
+	distreference "github.com/distribution/reference"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+)
+
+// maxReferrersIndexSize limits the size of the referrers index returned by the
+// registry or stored in the fallback tag.
+const maxReferrersIndexSize = 4 << 20
+
+// ErrNoReferrersAPI is returned when the registry does not support the OCI
+// referrers API.
+var ErrNoReferrersAPI = errors.New("registry does not support the referrers API")
+
+// ReferrersTag returns the tag of the index listing the referrers of the
+// subject in registries without the referrers API.
+func ReferrersTag(subject digest.Digest) string {
+	return subject.Algorithm().String() + "-" + subject.Encoded()
+}
+
+// ReferrersAPI lists the referrers of the subject in the repository of ref
+// with the OCI referrers API. ErrNoReferrersAPI is returned if the registry
+// doesn't support the API.
+func (r *Resolver) ReferrersAPI(ctx context.Context, ref string, subject digest.Digest) (*ocispecs.Index, error) {
+	named, err := distreference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, err
+	}
+	hosts, err := r.HostsFunc(distreference.Domain(named))
+	if err != nil {
+		return nil, err
+	}
+	ctx = docker.ContextWithAppendPullRepositoryScope(ctx, distreference.Path(named))
+
+	var lastErr error
+	for _, host := range hosts {
+		if host.Capabilities&docker.HostCapabilityResolve == 0 {
+			continue
+		}
+		u := url.URL{
+			Scheme: host.Scheme,
+			Host:   host.Host,
+			Path:   strings.TrimSuffix(host.Path, "/") + "/" + distreference.Path(named) + "/referrers/" + subject.String(),
+		}
+		idx, err := r.fetchReferrers(ctx, host, u.String())
+		if err == nil || errors.Is(err, ErrNoReferrersAPI) {
+			return idx, err
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.Errorf("no registry host found for %s", ref)
+	}
+	return nil, lastErr
+}
+
+func (r *Resolver) fetchReferrers(ctx context.Context, host docker.RegistryHost, u string) (*ocispecs.Index, error) {
+	var resp *http.Response
+	for range 2 {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range r.headers {
+			req.Header[k] = v
+		}
+		for k, v := range host.Header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Accept", ocispecs.MediaTypeImageIndex)
+		if host.Authorizer != nil {
+			if err := host.Authorizer.Authorize(ctx, req); err != nil {
+				return nil, err
+			}
+		}
+		client := host.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || host.Authorizer == nil {
+			break
+		}
+		resp.Body.Close()
+		if err := host.Authorizer.AddResponses(ctx, []*http.Response{resp}); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusBadRequest, http.StatusMethodNotAllowed:
+		return nil, ErrNoReferrersAPI
+	default:
+		return nil, errors.Errorf("unexpected status listing referrers from %s: %s", u, resp.Status)
+	}
+	if ct, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";"); ct != ocispecs.MediaTypeImageIndex {
+		return nil, ErrNoReferrersAPI
+	}
+	dt, err := io.ReadAll(io.LimitReader(resp.Body, maxReferrersIndexSize))
+	if err != nil {
+		return nil, err
+	}
+	var idx ocispecs.Index
+	if err := json.Unmarshal(dt, &idx); err != nil {
+		return nil, errors.Wrap(err, "invalid referrers index")
+	}
+	return &idx, nil
+}
+
+// ReferrersTagIndex returns the index stored in the referrers fallback tag of
+// the subject, or nil if the tag doesn't exist.
+func (r *Resolver) ReferrersTagIndex(ctx context.Context, ref string, subject digest.Digest) (*ocispecs.Index, error) {
+	named, err := distreference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return nil, err
+	}
+	tagRef := named.Name() + ":" + ReferrersTag(subject)
+	name, desc, err := r.Resolve(ctx, tagRef)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if desc.Size > maxReferrersIndexSize {
+		return nil, errors.Errorf("referrers index %s is too large: %d bytes", tagRef, desc.Size)
+	}
+	fetcher, err := r.Fetcher(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	dt, err := io.ReadAll(io.LimitReader(rc, desc.Size))
+	if err != nil {
+		return nil, err
+	}
+	if desc.Digest.Algorithm().FromBytes(dt) != desc.Digest {
+		return nil, errors.Errorf("digest mismatch for %s", tagRef)
+	}
+	var idx ocispecs.Index
+	if err := json.Unmarshal(dt, &idx); err != nil {
+		return nil, errors.Wrapf(err, "invalid referrers index %s", tagRef)
+	}
+	return &idx, nil
+}
+
+// Referrers returns the referrers of the subject in the repository of ref
+// with the artifact type. Empty artifactType returns all referrers. The
+// referrers tag schema is used for registries without the referrers API.
+func (r *Resolver) Referrers(ctx context.Context, ref string, subject digest.Digest, artifactType string) ([]ocispecs.Descriptor, error) {
+	idx, err := r.ReferrersAPI(ctx, ref, subject)
+	if errors.Is(err, ErrNoReferrersAPI) {
+		idx, err = r.ReferrersTagIndex(ctx, ref, subject)
+	}
+	if err != nil || idx == nil {
+		return nil, err
+	}
+	var out []ocispecs.Descriptor
+	for _, desc := range idx.Manifests {
+		if artifactType == "" || desc.ArtifactType == artifactType {
+			out = append(out, desc)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,90 @@
+package resolver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	digest "github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferrers(t *testing.T) {
+	subject := digest.FromString("manifest")
+	att := ocispecs.Descriptor{
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.docker.attestation.manifest.v1+json",
+		Digest:       digest.FromString("attestation"),
+		Size:         11,
+	}
+	sig := ocispecs.Descriptor{
+		MediaType:    ocispecs.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.dev.cosign.artifact.sig.v1+json",
+		Digest:       digest.FromString("signature"),
+		Size:         9,
+	}
+	idx, err := json.Marshal(ocispecs.Index{MediaType: ocispecs.MediaTypeImageIndex, Manifests: []ocispecs.Descriptor{att, sig}})
+	require.NoError(t, err)
+	idxDgst := digest.FromBytes(idx)
+
+	supported := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case supported && r.URL.Path == "/v2/library/test/referrers/"+subject.String():
+			w.Header().Set("Content-Type", ocispecs.MediaTypeImageIndex)
+			w.Write(idx)
+		case !supported && strings.HasPrefix(r.URL.Path, "/v2/library/test/manifests/"):
+			ref := strings.TrimPrefix(r.URL.Path, "/v2/library/test/manifests/")
+			if ref != ReferrersTag(subject) && ref != idxDgst.String() {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", ocispecs.MediaTypeImageIndex)
+			w.Header().Set("Docker-Content-Digest", idxDgst.String())
+			w.Header().Set("Content-Length", strconv.Itoa(len(idx)))
+			if r.Method == http.MethodHead {
+				return
+			}
+			w.Write(idx)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	hosts := func(string) ([]docker.RegistryHost, error) {
+		return []docker.RegistryHost{{
+			Client:       srv.Client(),
+			Host:         strings.TrimPrefix(srv.URL, "http://"),
+			Scheme:       "http",
+			Path:         "/v2",
+			Capabilities: docker.HostCapabilityPull | docker.HostCapabilityResolve,
+		}}, nil
+	}
+	r := newResolver(hosts, newAuthHandlerNS(nil), nil, nil)
+	ctx := context.TODO()
+	const ref = "docker.io/library/test:latest"
+
+	descs, err := r.Referrers(ctx, ref, subject, att.ArtifactType)
+	require.NoError(t, err)
+	require.Equal(t, []ocispecs.Descriptor{att}, descs)
+
+	_, err = r.ReferrersAPI(ctx, ref, digest.FromString("other"))
+	require.ErrorIs(t, err, ErrNoReferrersAPI)
+
+	// registries without the referrers API use the fallback tag
+	supported = false
+	descs, err = r.Referrers(ctx, ref, subject, "")
+	require.NoError(t, err)
+	require.Equal(t, []ocispecs.Descriptor{att, sig}, descs)
+
+	descs, err = r.Referrers(ctx, ref, digest.FromString("other"), "")
+	require.NoError(t, err)
+	require.Empty(t, descs)
+}
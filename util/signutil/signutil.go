@@ -0,0 +1,148 @@
+// Package signutil parses the keys used for image and attestation signatures
+// and creates and verifies the signatures the same way as cosign.
+package signutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParsePrivateKey parses the PEM encoded ECDSA, RSA or ed25519 private key in
+// dt and the certificates that come with it. Encrypted keys are not
+// supported.
+func ParsePrivateKey(dt []byte) (crypto.Signer, []*x509.Certificate, error) {
+	var (
+		key   crypto.Signer
+		certs []*x509.Certificate
+	)
+	for {
+		var block *pem.Block
+		block, dt = pem.Decode(dt)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "invalid certificate")
+			}
+			certs = append(certs, cert)
+		case strings.Contains(block.Type, "ENCRYPTED"):
+			return nil, nil, errors.New("encrypted private keys are not supported")
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if key != nil {
+				return nil, nil, errors.New("multiple private keys found")
+			}
+			k, err := parsePrivateKeyBlock(block)
+			if err != nil {
+				return nil, nil, err
+			}
+			key = k
+		}
+	}
+	if key == nil {
+		return nil, nil, errors.New("no private key found")
+	}
+	return key, certs, nil
+}
+
+func parsePrivateKeyBlock(block *pem.Block) (crypto.Signer, error) {
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid private key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// ParsePublicKeys parses all PEM encoded PKIX public keys in dt.
+func ParsePublicKeys(dt []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, dt = pem.Decode(dt)
+		if block == nil {
+			break
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse public key")
+		}
+		keys = append(keys, pub)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	return keys, nil
+}
+
+// Sign signs the data. ed25519 signatures are made over the data, ECDSA and
+// RSA signatures over the SHA-256 digest of the data.
+func Sign(key crypto.Signer, data []byte) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	sum := sha256.Sum256(data)
+	return key.Sign(rand.Reader, sum[:], crypto.SHA256)
+}
+
+// Verify verifies a signature as created by Sign. RSA signatures can use
+// either PKCS #1 v1.5 or PSS.
+func Verify(key crypto.PublicKey, data, sig []byte) error {
+	if pub, ok := key.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(pub, data, sig) {
+			return errors.New("invalid ed25519 signature")
+		}
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, sum[:], sig) {
+			return errors.New("invalid ECDSA signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+			if err := rsa.VerifyPSS(pub, crypto.SHA256, sum[:], sig, nil); err != nil {
+				return errors.Wrap(err, "invalid RSA signature")
+			}
+		}
+	default:
+		return errors.Errorf("unsupported public key type %T", key)
+	}
+	return nil
+}
+
+// VerifyAny returns true if the signature was made with one of the keys.
+func VerifyAny(keys []crypto.PublicKey, data, sig []byte) bool {
+	for _, k := range keys {
+		if Verify(k, data, sig) == nil {
+			return true
+		}
+	}
+	return false
+}
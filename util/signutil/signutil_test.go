@@ -0,0 +1,98 @@
+package signutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name  string
+		block *pem.Block
+	}{
+		{"ecdsa", &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}},
+		{"rsa", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}},
+		{"ed25519", &pem.Block{Type: "PRIVATE KEY", Bytes: edDER}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			key, certs, err := ParsePrivateKey(pem.EncodeToMemory(tc.block))
+			require.NoError(t, err)
+			require.Empty(t, certs)
+
+			pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+			require.NoError(t, err)
+			keys, err := ParsePublicKeys(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+			require.NoError(t, err)
+			require.Len(t, keys, 1)
+
+			data := []byte("payload")
+			sig, err := Sign(key, data)
+			require.NoError(t, err)
+			require.NoError(t, Verify(keys[0], data, sig))
+			require.True(t, VerifyAny(keys, data, sig))
+			require.False(t, VerifyAny(keys, []byte("other"), sig))
+			other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err)
+			require.False(t, VerifyAny([]crypto.PublicKey{other.Public()}, data, sig))
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})
+
+	k, certs, err := ParsePrivateKey(append(keyPEM, certPEM...))
+	require.NoError(t, err)
+	require.True(t, key.Equal(k))
+	require.Len(t, certs, 1)
+
+	_, _, err = ParsePrivateKey(append(keyPEM, keyPEM...))
+	require.ErrorContains(t, err, "multiple private keys")
+
+	_, _, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}))
+	require.ErrorContains(t, err, "encrypted private keys are not supported")
+
+	_, _, err = ParsePrivateKey(certPEM)
+	require.ErrorContains(t, err, "no private key found")
+
+	_, err = ParsePublicKeys([]byte("not a key"))
+	require.Error(t, err)
+}
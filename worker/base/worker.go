@@ -21,7 +21,9 @@ import (
 	"github.com/moby/buildkit/executor"
 	"github.com/moby/buildkit/executor/resources"
 	"github.com/moby/buildkit/exporter"
+	"github.com/moby/buildkit/exporter/attestation"
 	imageexporter "github.com/moby/buildkit/exporter/containerimage"
+	customexporter "github.com/moby/buildkit/exporter/custom"
 	localexporter "github.com/moby/buildkit/exporter/local"
 	ociexporter "github.com/moby/buildkit/exporter/oci"
 	tarexporter "github.com/moby/buildkit/exporter/tar"
@@ -41,6 +43,8 @@ import (
 	"github.com/moby/buildkit/source/git"
 	"github.com/moby/buildkit/source/http"
 	"github.com/moby/buildkit/source/local"
+	"github.com/moby/buildkit/source/lockfile"
+	"github.com/moby/buildkit/source/ociartifact"
 	"github.com/moby/buildkit/util/archutil"
 	"github.com/moby/buildkit/util/bklog"
 	"github.com/moby/buildkit/util/leaseutil"
@@ -84,6 +88,16 @@ type WorkerOpt struct {
 	MountPoolRoot    string
 	ResourceMonitor  *resources.Monitor
 	CDIManager       *cdidevices.Manager
+	HTTPRetries      int
+	HTTPRewriteRules []http.RewriteRule
+	// ImageVerifyPolicies are applied to images pulled from registries.
+	ImageVerifyPolicies []containerimage.VerifyPolicy
+	// ImageSigningKeys are the PEM encoded private keys the image exporter
+	// can sign with.
+	ImageSigningKeys map[string][]byte
+	// AttestationSigner signs the attestations that request a signature when
+	// they are exported.
+	AttestationSigner *attestation.Signer
 }
 
 // Worker is a local worker instance with dedicated snapshotter, cache, and so on.
@@ -126,14 +140,15 @@ func NewWorker(ctx context.Context, opt WorkerOpt) (*Worker, error) {
 	}
 
 	is, err := containerimage.NewSource(containerimage.SourceOpt{
-		Snapshotter:   opt.Snapshotter,
-		ContentStore:  opt.ContentStore,
-		Applier:       opt.Applier,
-		ImageStore:    opt.ImageStore,
-		CacheAccessor: cm,
-		RegistryHosts: opt.RegistryHosts,
-		ResolverType:  containerimage.ResolverTypeRegistry,
-		LeaseManager:  opt.LeaseManager,
+		Snapshotter:    opt.Snapshotter,
+		ContentStore:   opt.ContentStore,
+		Applier:        opt.Applier,
+		ImageStore:     opt.ImageStore,
+		CacheAccessor:  cm,
+		RegistryHosts:  opt.RegistryHosts,
+		ResolverType:   containerimage.ResolverTypeRegistry,
+		LeaseManager:   opt.LeaseManager,
+		VerifyPolicies: opt.ImageVerifyPolicies,
 	})
 	if err != nil {
 		return nil, err
@@ -155,6 +170,8 @@ func NewWorker(ctx context.Context, opt WorkerOpt) (*Worker, error) {
 
 	hs, err := http.NewSource(http.Opt{
 		CacheAccessor: cm,
+		Retries:       opt.HTTPRetries,
+		RewriteRules:  opt.HTTPRewriteRules,
 	})
 	if err != nil {
 		return nil, err
@@ -162,6 +179,16 @@ func NewWorker(ctx context.Context, opt WorkerOpt) (*Worker, error) {
 
 	sm.Register(hs)
 
+	lfs, err := lockfile.NewSource(lockfile.Opt{
+		CacheAccessor: cm,
+		HTTPSource:    hs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sm.Register(lfs)
+
 	ss, err := local.NewSource(local.Opt{
 		CacheAccessor: cm,
 	})
@@ -185,11 +212,23 @@ func NewWorker(ctx context.Context, opt WorkerOpt) (*Worker, error) {
 
 	sm.Register(os)
 
+	as, err := ociartifact.NewSource(ociartifact.Opt{
+		CacheAccessor: cm,
+		RegistryHosts: opt.RegistryHosts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sm.Register(as)
+
 	iw, err := imageexporter.NewImageWriter(imageexporter.WriterOpt{
-		Snapshotter:  opt.Snapshotter,
-		ContentStore: opt.ContentStore,
-		Applier:      opt.Applier,
-		Differ:       opt.Differ,
+		Snapshotter:       opt.Snapshotter,
+		ContentStore:      opt.ContentStore,
+		Applier:           opt.Applier,
+		Differ:            opt.Differ,
+		CacheManager:      cm,
+		AttestationSigner: opt.AttestationSigner,
 	})
 	if err != nil {
 		return nil, err
@@ -463,14 +502,18 @@ func (w *Worker) Exporter(name string, sm *session.Manager) (exporter.Exporter,
 			ImageWriter:    w.imageWriter,
 			RegistryHosts:  w.RegistryHosts,
 			LeaseManager:   w.LeaseManager(),
+			SigningKeys:    w.ImageSigningKeys,
 		})
 	case client.ExporterLocal:
 		return localexporter.New(localexporter.Opt{
-			SessionManager: sm,
+			SessionManager:    sm,
+			AttestationSigner: w.AttestationSigner,
 		})
 	case client.ExporterTar:
 		return tarexporter.New(tarexporter.Opt{
-			SessionManager: sm,
+			SessionManager:    sm,
+			AttestationSigner: w.AttestationSigner,
+			TempDir:           filepath.Join(w.Root, "fsimage"),
 		})
 	case client.ExporterOCI:
 		return ociexporter.New(ociexporter.Opt{
@@ -486,6 +529,12 @@ func (w *Worker) Exporter(name string, sm *session.Manager) (exporter.Exporter,
 			Variant:        ociexporter.VariantDocker,
 			LeaseManager:   w.LeaseManager(),
 		})
+	case client.ExporterCustom:
+		return customexporter.New(customexporter.Opt{
+			SessionManager: sm,
+			CacheManager:   w.CacheMgr,
+			Executor:       w.Executor(),
+		})
 	default:
 		return nil, errors.Errorf("exporter %q could not be found", name)
 	}